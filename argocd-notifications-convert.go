@@ -0,0 +1,271 @@
+// converts an Argo CD notifications ConfigMap into SlackMessages and MessageTemplates
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// triggerEvents maps the stock Argo CD triggers onto Kargo promotion events.
+var triggerEvents = map[string]string{
+	"on-sync-succeeded":      "PromotionSucceeded",
+	"on-sync-failed":         "PromotionFailed",
+	"on-sync-running":        "PromotionRunning",
+	"on-sync-status-unknown": "PromotionErrored",
+	"on-health-degraded":     "PromotionFailed",
+	"on-deployed":            "PromotionSucceeded",
+}
+
+var channelNameRe = regexp.MustCompile(`[^a-z0-9-]+`)
+
+type ConfigMap struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Data map[string]string `json:"data"`
+}
+
+type argoTemplate struct {
+	Message string         `json:"message"`
+	Slack   map[string]any `json:"slack,omitempty"`
+}
+
+type argoTrigger struct {
+	When string   `json:"when"`
+	Send []string `json:"send"`
+}
+
+type argoSubscription struct {
+	Recipients []string `json:"recipients"`
+	Triggers   []string `json:"triggers"`
+}
+
+type objectMeta struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+type messageTemplate struct {
+	APIVersion string     `json:"apiVersion"`
+	Kind       string     `json:"kind"`
+	Metadata   objectMeta `json:"metadata"`
+	Spec       struct {
+		Template string `json:"template"`
+	} `json:"spec"`
+}
+
+type subscription struct {
+	Stage  string   `json:"stage"`
+	Events []string `json:"events"`
+}
+
+type slackMessage struct {
+	APIVersion string     `json:"apiVersion"`
+	Kind       string     `json:"kind"`
+	Metadata   objectMeta `json:"metadata"`
+	Spec       struct {
+		SlackChannel  string         `json:"slackChannel"`
+		Layout        string         `json:"layout,omitempty"`
+		Message       string         `json:"message"`
+		Subscriptions []subscription `json:"subscriptions"`
+	} `json:"spec"`
+}
+
+type converter struct {
+	namespace string
+	stage     string
+
+	triggers  map[string][]argoTrigger
+	templates map[string]bool
+	warnings  []string
+}
+
+func (c *converter) warnf(format string, args ...any) {
+	c.warnings = append(c.warnings, fmt.Sprintf(format, args...))
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (c *converter) convert(cm *ConfigMap) ([]any, error) {
+	var out []any
+	c.triggers = make(map[string][]argoTrigger)
+	c.templates = make(map[string]bool)
+
+	for _, key := range sortedKeys(cm.Data) {
+		value := cm.Data[key]
+		switch {
+		case strings.HasPrefix(key, "template."):
+			name := strings.TrimPrefix(key, "template.")
+			var t argoTemplate
+			if err := yaml.Unmarshal([]byte(value), &t); err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			if len(t.Slack) > 0 {
+				c.warnf("%s: slack attachments/blocks are not supported, only the message text is converted", key)
+			}
+			if strings.Contains(t.Message, ".app.") || strings.Contains(t.Message, ".context.") {
+				c.warnf("%s: references Argo CD fields (.app, .context) that must be rewritten for Kargo events", key)
+			}
+			mt := messageTemplate{APIVersion: "kargo.akuity.io/v1alpha1", Kind: "MessageTemplate"}
+			mt.Metadata = objectMeta{Name: name, Namespace: c.namespace}
+			mt.Spec.Template = t.Message
+			out = append(out, mt)
+			c.templates[name] = true
+
+		case strings.HasPrefix(key, "trigger."):
+			var ts []argoTrigger
+			if err := yaml.Unmarshal([]byte(value), &ts); err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			c.triggers[strings.TrimPrefix(key, "trigger.")] = ts
+
+		case strings.HasPrefix(key, "service."):
+			if key != "service.slack" {
+				c.warnf("%s: only the Slack service is supported", key)
+			} else {
+				c.warnf("%s: the Slack token is not migrated, configure it on the notifier", key)
+			}
+
+		case key == "subscriptions", key == "context", key == "defaultTriggers":
+		default:
+			c.warnf("%s: unsupported key", key)
+		}
+	}
+
+	if v, ok := cm.Data["context"]; ok && v != "" {
+		c.warnf("context: template context values are not supported")
+	}
+
+	var subs []argoSubscription
+	if v := cm.Data["subscriptions"]; v != "" {
+		if err := yaml.Unmarshal([]byte(v), &subs); err != nil {
+			return nil, fmt.Errorf("subscriptions: %w", err)
+		}
+	}
+	for _, sub := range subs {
+		msgs, err := c.convertSubscription(sub)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, msgs...)
+	}
+	if len(subs) == 0 {
+		c.warnf("no subscriptions found; per-Application subscribe annotations are not converted")
+	}
+	return out, nil
+}
+
+// convertSubscription produces one SlackMessage per Slack recipient. The
+// layout is the template sent by the subscription's first trigger, and the
+// triggers become the subscribed events.
+func (c *converter) convertSubscription(sub argoSubscription) ([]any, error) {
+	var events []string
+	layout := ""
+	for _, name := range sub.Triggers {
+		ev, ok := triggerEvents[name]
+		if !ok {
+			c.warnf("trigger %s: no equivalent Kargo event, skipped", name)
+			continue
+		}
+		events = append(events, ev)
+		for _, t := range c.triggers[name] {
+			if t.When != "" {
+				c.warnf("trigger %s: condition %q is not converted", name, t.When)
+			}
+			for _, send := range t.Send {
+				switch {
+				case !c.templates[send]:
+					c.warnf("trigger %s: template %s not found", name, send)
+				case layout == "":
+					layout = send
+				case send != layout:
+					c.warnf("trigger %s: only one template per message is supported, %s dropped", name, send)
+				}
+			}
+		}
+	}
+	if len(events) == 0 {
+		c.warnf("subscription to %v has no convertible triggers, skipped", sub.Recipients)
+		return nil, nil
+	}
+
+	var out []any
+	for _, r := range sub.Recipients {
+		service, channel, ok := strings.Cut(r, ":")
+		if !ok || service != "slack" {
+			c.warnf("recipient %s: only slack recipients are supported", r)
+			continue
+		}
+		m := slackMessage{APIVersion: "kargo.akuity.io/v1alpha1", Kind: "SlackMessage"}
+		m.Metadata = objectMeta{
+			Name:      strings.Trim(channelNameRe.ReplaceAllString(strings.ToLower(channel), "-"), "-"),
+			Namespace: c.namespace,
+		}
+		m.Spec.SlackChannel = channel
+		m.Spec.Layout = layout
+		m.Spec.Subscriptions = []subscription{{Stage: c.stage, Events: events}}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+func main() {
+	input := flag.String("f", "-", "argocd-notifications-cm manifest to convert")
+	namespace := flag.String("namespace", "", "Kargo project namespace for the generated resources")
+	stage := flag.String("stage", "*", "stage the generated subscriptions apply to")
+	flag.Parse()
+	if *namespace == "" {
+		log.Fatal("-namespace is required")
+	}
+
+	var in io.Reader = os.Stdin
+	if *input != "-" {
+		f, err := os.Open(*input)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		in = f
+	}
+	raw, err := io.ReadAll(in)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var cm ConfigMap
+	if err := yaml.Unmarshal(raw, &cm); err != nil {
+		log.Fatalf("Parsing ConfigMap failed: %v", err)
+	}
+
+	c := &converter{namespace: *namespace, stage: *stage}
+	objs, err := c.convert(&cm)
+	if err != nil {
+		log.Fatalf("Converting failed: %v", err)
+	}
+	for _, obj := range objs {
+		b, err := yaml.Marshal(obj)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("---\n%s", b)
+	}
+
+	for _, w := range c.warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+	}
+	fmt.Fprintf(os.Stderr, "Converted %d resources with %d warnings\n", len(objs), len(c.warnings))
+}
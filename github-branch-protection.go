@@ -0,0 +1,594 @@
+// audits branch protection and merge queue rules against a desired state, and optionally applies it
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/google/go-github/v57/github"
+	"golang.org/x/oauth2"
+	"sigs.k8s.io/yaml"
+)
+
+// rulesetPrefix names the repository rulesets this tool creates, one per
+// branch, for branches that have no merge queue rule yet.
+const rulesetPrefix = "branch-protection: "
+
+// Policy is the desired state for one branch across a set of repositories,
+// e.g.
+//
+//	policies:
+//	- repos: [fykaa/kargo-talk-demo]
+//	  branch: main
+//	  protection:
+//	    requiredApprovingReviews: 1
+//	    requiredStatusChecks: [lint, test]
+//	    allowForcePushes: false
+//	  mergeQueue:
+//	    mergeMethod: SQUASH
+//	    maxEntriesToMerge: 5
+//
+// Settings left out are not checked, and apply keeps their live values.
+type Policy struct {
+	Repos      []string    `json:"repos"`
+	Branch     string      `json:"branch"`
+	Protection *Protection `json:"protection,omitempty"`
+	MergeQueue *MergeQueue `json:"mergeQueue,omitempty"`
+}
+
+// Protection is the classic branch protection of a branch, flattened.
+type Protection struct {
+	RequiredApprovingReviews      *int      `json:"requiredApprovingReviews,omitempty"`
+	DismissStaleReviews           *bool     `json:"dismissStaleReviews,omitempty"`
+	RequireCodeOwnerReviews       *bool     `json:"requireCodeOwnerReviews,omitempty"`
+	RequireLastPushApproval       *bool     `json:"requireLastPushApproval,omitempty"`
+	RequiredStatusChecks          *[]string `json:"requiredStatusChecks,omitempty"`
+	StrictStatusChecks            *bool     `json:"strictStatusChecks,omitempty"`
+	EnforceAdmins                 *bool     `json:"enforceAdmins,omitempty"`
+	RequireLinearHistory          *bool     `json:"requireLinearHistory,omitempty"`
+	RequireConversationResolution *bool     `json:"requireConversationResolution,omitempty"`
+	AllowForcePushes              *bool     `json:"allowForcePushes,omitempty"`
+	AllowDeletions                *bool     `json:"allowDeletions,omitempty"`
+}
+
+// MergeQueue holds the parameters of a merge_queue ruleset rule.
+type MergeQueue struct {
+	MergeMethod                  *string `json:"mergeMethod,omitempty"`
+	GroupingStrategy             *string `json:"groupingStrategy,omitempty"`
+	MaxEntriesToBuild            *int    `json:"maxEntriesToBuild,omitempty"`
+	MaxEntriesToMerge            *int    `json:"maxEntriesToMerge,omitempty"`
+	MinEntriesToMerge            *int    `json:"minEntriesToMerge,omitempty"`
+	MinEntriesToMergeWaitMinutes *int    `json:"minEntriesToMergeWaitMinutes,omitempty"`
+	CheckResponseTimeoutMinutes  *int    `json:"checkResponseTimeoutMinutes,omitempty"`
+}
+
+// defaultMergeQueue fills in what a new merge queue rule needs; GitHub
+// requires every parameter.
+var defaultMergeQueue = MergeQueue{
+	MergeMethod:                  ptr("MERGE"),
+	GroupingStrategy:             ptr("ALLGREEN"),
+	MaxEntriesToBuild:            ptr(5),
+	MaxEntriesToMerge:            ptr(5),
+	MinEntriesToMerge:            ptr(1),
+	MinEntriesToMergeWaitMinutes: ptr(5),
+	CheckResponseTimeoutMinutes:  ptr(60),
+}
+
+func ptr[T any](v T) *T { return &v }
+
+// diff lists the settings of want, a Protection or MergeQueue, that differ
+// from got. Fields want leaves nil are not compared.
+func diff(want, got any) []string {
+	wv, gv := reflect.ValueOf(want).Elem(), reflect.ValueOf(got).Elem()
+	var out []string
+	for i := 0; i < wv.NumField(); i++ {
+		w, g := wv.Field(i), gv.Field(i)
+		if w.IsNil() {
+			continue
+		}
+		if g.IsNil() || !reflect.DeepEqual(w.Elem().Interface(), g.Elem().Interface()) {
+			name, _, _ := strings.Cut(wv.Type().Field(i).Tag.Get("json"), ",")
+			out = append(out, fmt.Sprintf("%s is %s, want %s", name, show(g), show(w)))
+		}
+	}
+	return out
+}
+
+func show(v reflect.Value) string {
+	if v.IsNil() {
+		return "unset"
+	}
+	return fmt.Sprint(v.Elem().Interface())
+}
+
+// overlay returns live with the fields want sets replaced.
+func overlay[T any](live, want *T) *T {
+	out := *live
+	ov, wv := reflect.ValueOf(&out).Elem(), reflect.ValueOf(want).Elem()
+	for i := 0; i < wv.NumField(); i++ {
+		if !wv.Field(i).IsNil() {
+			ov.Field(i).Set(wv.Field(i))
+		}
+	}
+	return &out
+}
+
+// The protection and rulesets bodies are built here rather than with
+// go-github's types: v57 has no merge_queue rule, and its protection
+// request drops the app pinning of status checks. Requests still go
+// through its client for auth, rate limits and errors.
+func call(ctx context.Context, client *github.Client, method, path string, in, out any) error {
+	req, err := client.NewRequest(method, path, in)
+	if err != nil {
+		return err
+	}
+	_, err = client.Do(ctx, req, out)
+	return err
+}
+
+func isNotFound(err error) bool {
+	var e *github.ErrorResponse
+	return errors.As(err, &e) && e.Response != nil && e.Response.StatusCode == http.StatusNotFound
+}
+
+type enabled struct {
+	Enabled bool `json:"enabled"`
+}
+
+// actors are the users, teams and apps of a restriction or allowance.
+type actors struct {
+	Users []struct {
+		Login string `json:"login"`
+	} `json:"users"`
+	Teams []struct {
+		Slug string `json:"slug"`
+	} `json:"teams"`
+	Apps []struct {
+		Slug string `json:"slug"`
+	} `json:"apps"`
+}
+
+// request converts a to the form the protection API takes back.
+func (a *actors) request() map[string][]string {
+	out := map[string][]string{"users": {}, "teams": {}, "apps": {}}
+	for _, u := range a.Users {
+		out["users"] = append(out["users"], u.Login)
+	}
+	for _, t := range a.Teams {
+		out["teams"] = append(out["teams"], t.Slug)
+	}
+	for _, app := range a.Apps {
+		out["apps"] = append(out["apps"], app.Slug)
+	}
+	return out
+}
+
+type statusCheck struct {
+	Context string `json:"context"`
+	AppID   *int64 `json:"app_id,omitempty"`
+}
+
+// liveProtection is the branch protection API's representation. Besides
+// what Protection covers it holds the settings a PUT would otherwise reset:
+// push restrictions, review dismissal and bypass lists, app-pinned checks
+// and the branch lock.
+type liveProtection struct {
+	RequiredStatusChecks *struct {
+		Strict bool          `json:"strict"`
+		Checks []statusCheck `json:"checks"`
+	} `json:"required_status_checks"`
+	EnforceAdmins              enabled `json:"enforce_admins"`
+	RequiredPullRequestReviews *struct {
+		DismissalRestrictions        *actors `json:"dismissal_restrictions"`
+		BypassPullRequestAllowances  *actors `json:"bypass_pull_request_allowances"`
+		DismissStaleReviews          bool    `json:"dismiss_stale_reviews"`
+		RequireCodeOwnerReviews      bool    `json:"require_code_owner_reviews"`
+		RequiredApprovingReviewCount int     `json:"required_approving_review_count"`
+		RequireLastPushApproval      bool    `json:"require_last_push_approval"`
+	} `json:"required_pull_request_reviews"`
+	Restrictions                   *actors `json:"restrictions"`
+	RequiredLinearHistory          enabled `json:"required_linear_history"`
+	AllowForcePushes               enabled `json:"allow_force_pushes"`
+	AllowDeletions                 enabled `json:"allow_deletions"`
+	BlockCreations                 enabled `json:"block_creations"`
+	RequiredConversationResolution enabled `json:"required_conversation_resolution"`
+	LockBranch                     enabled `json:"lock_branch"`
+	AllowForkSyncing               enabled `json:"allow_fork_syncing"`
+}
+
+func protectionPath(repo, branch string) string {
+	return "repos/" + repo + "/branches/" + url.PathEscape(branch) + "/protection"
+}
+
+// getProtection returns the protection of a branch; an unprotected branch
+// has everything off.
+func getProtection(ctx context.Context, client *github.Client, repo, branch string) (*liveProtection, error) {
+	var l liveProtection
+	if err := call(ctx, client, http.MethodGet, protectionPath(repo, branch), nil, &l); err != nil && !isNotFound(err) {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// protection flattens l.
+func (l *liveProtection) protection() *Protection {
+	p := &Protection{
+		RequiredApprovingReviews:      ptr(0),
+		DismissStaleReviews:           ptr(false),
+		RequireCodeOwnerReviews:       ptr(false),
+		RequireLastPushApproval:       ptr(false),
+		RequiredStatusChecks:          ptr([]string{}),
+		StrictStatusChecks:            ptr(false),
+		EnforceAdmins:                 ptr(l.EnforceAdmins.Enabled),
+		RequireLinearHistory:          ptr(l.RequiredLinearHistory.Enabled),
+		RequireConversationResolution: ptr(l.RequiredConversationResolution.Enabled),
+		AllowForcePushes:              ptr(l.AllowForcePushes.Enabled),
+		AllowDeletions:                ptr(l.AllowDeletions.Enabled),
+	}
+	if r := l.RequiredPullRequestReviews; r != nil {
+		p.RequiredApprovingReviews = ptr(r.RequiredApprovingReviewCount)
+		p.DismissStaleReviews = ptr(r.DismissStaleReviews)
+		p.RequireCodeOwnerReviews = ptr(r.RequireCodeOwnerReviews)
+		p.RequireLastPushApproval = ptr(r.RequireLastPushApproval)
+	}
+	if s := l.RequiredStatusChecks; s != nil {
+		contexts := []string{}
+		for _, c := range s.Checks {
+			contexts = append(contexts, c.Context)
+		}
+		slices.Sort(contexts)
+		p.RequiredStatusChecks = &contexts
+		p.StrictStatusChecks = ptr(s.Strict)
+	}
+	return p
+}
+
+// putProtection replaces the protection of a branch with p, which has
+// every field set. Everything p does not cover is sent back as read in
+// live, so it survives the PUT.
+func putProtection(ctx context.Context, client *github.Client, repo, branch string, live *liveProtection, p *Protection) error {
+	body := map[string]any{
+		"required_status_checks":           nil,
+		"enforce_admins":                   *p.EnforceAdmins,
+		"required_pull_request_reviews":    nil,
+		"restrictions":                     nil,
+		"required_linear_history":          *p.RequireLinearHistory,
+		"allow_force_pushes":               *p.AllowForcePushes,
+		"allow_deletions":                  *p.AllowDeletions,
+		"block_creations":                  live.BlockCreations.Enabled,
+		"required_conversation_resolution": *p.RequireConversationResolution,
+		"lock_branch":                      live.LockBranch.Enabled,
+		"allow_fork_syncing":               live.AllowForkSyncing.Enabled,
+	}
+	if live.Restrictions != nil {
+		body["restrictions"] = live.Restrictions.request()
+	}
+	if len(*p.RequiredStatusChecks) > 0 || *p.StrictStatusChecks {
+		// Checks that stay keep the app they are pinned to.
+		apps := make(map[string]*int64)
+		if s := live.RequiredStatusChecks; s != nil {
+			for _, c := range s.Checks {
+				apps[c.Context] = c.AppID
+			}
+		}
+		checks := []statusCheck{}
+		for _, name := range *p.RequiredStatusChecks {
+			checks = append(checks, statusCheck{Context: name, AppID: apps[name]})
+		}
+		body["required_status_checks"] = map[string]any{"strict": *p.StrictStatusChecks, "checks": checks}
+	}
+	if *p.RequiredApprovingReviews > 0 || *p.DismissStaleReviews || *p.RequireCodeOwnerReviews || *p.RequireLastPushApproval {
+		reviews := map[string]any{
+			"required_approving_review_count": *p.RequiredApprovingReviews,
+			"dismiss_stale_reviews":           *p.DismissStaleReviews,
+			"require_code_owner_reviews":      *p.RequireCodeOwnerReviews,
+			"require_last_push_approval":      *p.RequireLastPushApproval,
+		}
+		if r := live.RequiredPullRequestReviews; r != nil {
+			if r.DismissalRestrictions != nil {
+				reviews["dismissal_restrictions"] = r.DismissalRestrictions.request()
+			}
+			if r.BypassPullRequestAllowances != nil {
+				reviews["bypass_pull_request_allowances"] = r.BypassPullRequestAllowances.request()
+			}
+		}
+		body["required_pull_request_reviews"] = reviews
+	}
+	return call(ctx, client, http.MethodPut, protectionPath(repo, branch), body, nil)
+}
+
+type mergeQueueParams struct {
+	MergeMethod                  string `json:"merge_method"`
+	GroupingStrategy             string `json:"grouping_strategy"`
+	MaxEntriesToBuild            int    `json:"max_entries_to_build"`
+	MaxEntriesToMerge            int    `json:"max_entries_to_merge"`
+	MinEntriesToMerge            int    `json:"min_entries_to_merge"`
+	MinEntriesToMergeWaitMinutes int    `json:"min_entries_to_merge_wait_minutes"`
+	CheckResponseTimeoutMinutes  int    `json:"check_response_timeout_minutes"`
+}
+
+func (p mergeQueueParams) mergeQueue() *MergeQueue {
+	return &MergeQueue{
+		MergeMethod:                  ptr(p.MergeMethod),
+		GroupingStrategy:             ptr(p.GroupingStrategy),
+		MaxEntriesToBuild:            ptr(p.MaxEntriesToBuild),
+		MaxEntriesToMerge:            ptr(p.MaxEntriesToMerge),
+		MinEntriesToMerge:            ptr(p.MinEntriesToMerge),
+		MinEntriesToMergeWaitMinutes: ptr(p.MinEntriesToMergeWaitMinutes),
+		CheckResponseTimeoutMinutes:  ptr(p.CheckResponseTimeoutMinutes),
+	}
+}
+
+func (q *MergeQueue) params() mergeQueueParams {
+	return mergeQueueParams{
+		MergeMethod:                  *q.MergeMethod,
+		GroupingStrategy:             *q.GroupingStrategy,
+		MaxEntriesToBuild:            *q.MaxEntriesToBuild,
+		MaxEntriesToMerge:            *q.MaxEntriesToMerge,
+		MinEntriesToMerge:            *q.MinEntriesToMerge,
+		MinEntriesToMergeWaitMinutes: *q.MinEntriesToMergeWaitMinutes,
+		CheckResponseTimeoutMinutes:  *q.CheckResponseTimeoutMinutes,
+	}
+}
+
+type rule struct {
+	Type       string          `json:"type"`
+	Parameters json.RawMessage `json:"parameters,omitempty"`
+}
+
+// ruleset is a repository ruleset as the rulesets API reads and writes it.
+// ID and SourceType are only read.
+type ruleset struct {
+	ID           int64           `json:"id,omitempty"`
+	Name         string          `json:"name"`
+	Target       string          `json:"target"`
+	SourceType   string          `json:"source_type,omitempty"`
+	Enforcement  string          `json:"enforcement"`
+	BypassActors json.RawMessage `json:"bypass_actors,omitempty"`
+	Conditions   struct {
+		RefName struct {
+			Include []string `json:"include"`
+			Exclude []string `json:"exclude"`
+		} `json:"ref_name"`
+	} `json:"conditions"`
+	Rules []rule `json:"rules"`
+}
+
+// covers reports whether the ruleset's ref conditions take in branch.
+func (rs *ruleset) covers(branch string) bool {
+	match := func(patterns []string) bool {
+		return slices.ContainsFunc(patterns, func(p string) bool {
+			ok, _ := path.Match(p, "refs/heads/"+branch)
+			return ok || p == "~ALL"
+		})
+	}
+	return match(rs.Conditions.RefName.Include) && !match(rs.Conditions.RefName.Exclude)
+}
+
+func (rs *ruleset) hasMergeQueue() bool {
+	return slices.ContainsFunc(rs.Rules, func(r rule) bool { return r.Type == "merge_queue" })
+}
+
+// mergeQueueSource is the ruleset a branch's merge queue rule comes from.
+type mergeQueueSource struct {
+	RulesetID  int64  `json:"ruleset_id"`
+	SourceType string `json:"ruleset_source_type"`
+	Source     string `json:"ruleset_source"`
+}
+
+// getMergeQueue returns the merge queue rule in force on a branch and the
+// ruleset that sets it, or nil if there is none.
+func getMergeQueue(ctx context.Context, client *github.Client, repo, branch string) (*MergeQueue, *mergeQueueSource, error) {
+	var rules []struct {
+		rule
+		mergeQueueSource
+	}
+	if err := call(ctx, client, http.MethodGet, "repos/"+repo+"/rules/branches/"+url.PathEscape(branch), nil, &rules); err != nil {
+		return nil, nil, err
+	}
+	for _, r := range rules {
+		if r.Type != "merge_queue" {
+			continue
+		}
+		var p mergeQueueParams
+		if err := json.Unmarshal(r.Parameters, &p); err != nil {
+			return nil, nil, fmt.Errorf("decoding merge queue rule: %w", err)
+		}
+		return p.mergeQueue(), &r.mergeQueueSource, nil
+	}
+	return nil, nil, nil
+}
+
+// mergeQueueRuleset finds the repository ruleset to keep branch's merge
+// queue rule in: the one the rule in force comes from, else one that has
+// a merge queue rule for the branch but is not enforced, else the one this
+// tool created. It returns nil if there is none.
+func mergeQueueRuleset(ctx context.Context, client *github.Client, repo, branch string, source *mergeQueueSource) (*ruleset, error) {
+	if source != nil {
+		if source.SourceType != "Repository" {
+			return nil, fmt.Errorf("the merge queue comes from the rulesets of %s %s; change it there", strings.ToLower(source.SourceType), source.Source)
+		}
+		var rs ruleset
+		err := call(ctx, client, http.MethodGet, fmt.Sprintf("repos/%s/rulesets/%d", repo, source.RulesetID), nil, &rs)
+		return &rs, err
+	}
+
+	var list []ruleset
+	if err := call(ctx, client, http.MethodGet, "repos/"+repo+"/rulesets?includes_parents=false&per_page=100", nil, &list); err != nil {
+		return nil, err
+	}
+	var own *ruleset
+	for _, summary := range list {
+		if summary.Target != "branch" {
+			continue
+		}
+		var rs ruleset
+		if err := call(ctx, client, http.MethodGet, fmt.Sprintf("repos/%s/rulesets/%d", repo, summary.ID), nil, &rs); err != nil {
+			return nil, err
+		}
+		if rs.hasMergeQueue() && rs.covers(branch) {
+			return &rs, nil
+		}
+		if rs.Name == rulesetPrefix+branch {
+			own = &rs
+		}
+	}
+	return own, nil
+}
+
+// putMergeQueue sets the merge queue rule of branch to q, which has every
+// field set, in the ruleset mergeQueueRuleset finds, or in a new one. It
+// returns the name of the ruleset.
+func putMergeQueue(ctx context.Context, client *github.Client, repo, branch string, q *MergeQueue, source *mergeQueueSource) (string, error) {
+	params, err := json.Marshal(q.params())
+	if err != nil {
+		return "", err
+	}
+	rs, err := mergeQueueRuleset(ctx, client, repo, branch, source)
+	if err != nil {
+		return "", err
+	}
+	if rs == nil {
+		rs = &ruleset{Name: rulesetPrefix + branch, Target: "branch"}
+		rs.Conditions.RefName.Include = []string{"refs/heads/" + branch}
+		rs.Conditions.RefName.Exclude = []string{}
+	}
+	if i := slices.IndexFunc(rs.Rules, func(r rule) bool { return r.Type == "merge_queue" }); i >= 0 {
+		rs.Rules[i].Parameters = params
+	} else {
+		rs.Rules = append(rs.Rules, rule{Type: "merge_queue", Parameters: params})
+	}
+	rs.Enforcement = "active"
+
+	id := rs.ID
+	rs.ID, rs.SourceType = 0, ""
+	if id == 0 {
+		return rs.Name, call(ctx, client, http.MethodPost, "repos/"+repo+"/rulesets", rs, nil)
+	}
+	return rs.Name, call(ctx, client, http.MethodPut, fmt.Sprintf("repos/%s/rulesets/%d", repo, id), rs, nil)
+}
+
+// reconcile reports the drift of one repository from policy and, with
+// apply, converges it. It returns the number of settings that drifted.
+func reconcile(ctx context.Context, client *github.Client, repo string, policy Policy, apply bool) (int, error) {
+	target := repo + "@" + policy.Branch
+	drift := 0
+	if want := policy.Protection; want != nil {
+		if want.RequiredStatusChecks != nil {
+			slices.Sort(*want.RequiredStatusChecks)
+		}
+		live, err := getProtection(ctx, client, repo, policy.Branch)
+		if err != nil {
+			return drift, fmt.Errorf("reading branch protection of %s: %w", target, err)
+		}
+		got := live.protection()
+		d := diff(want, got)
+		for _, line := range d {
+			fmt.Printf("%s: protection.%s\n", target, line)
+		}
+		drift += len(d)
+		if apply && len(d) > 0 {
+			if err := putProtection(ctx, client, repo, policy.Branch, live, overlay(got, want)); err != nil {
+				return drift, fmt.Errorf("updating branch protection of %s: %w", target, err)
+			}
+			fmt.Printf("%s: branch protection updated\n", target)
+		}
+	}
+	if want := policy.MergeQueue; want != nil {
+		live, source, err := getMergeQueue(ctx, client, repo, policy.Branch)
+		if err != nil {
+			return drift, fmt.Errorf("reading rules of %s: %w", target, err)
+		}
+		var d []string
+		if live == nil {
+			d = []string{"no merge queue"}
+			live = &defaultMergeQueue
+		} else {
+			d = diff(want, live)
+		}
+		for _, line := range d {
+			fmt.Printf("%s: mergeQueue: %s\n", target, line)
+		}
+		drift += len(d)
+		if apply && len(d) > 0 {
+			name, err := putMergeQueue(ctx, client, repo, policy.Branch, overlay(live, want), source)
+			if err != nil {
+				return drift, fmt.Errorf("updating merge queue of %s: %w", target, err)
+			}
+			fmt.Printf("%s: merge queue ruleset %q updated\n", target, name)
+		}
+	}
+	return drift, nil
+}
+
+func loadPolicies(path string) ([]Policy, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg struct {
+		Policies []Policy `json:"policies"`
+	}
+	if err := yaml.UnmarshalStrict(raw, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	for i, p := range cfg.Policies {
+		if p.Branch == "" || len(p.Repos) == 0 {
+			return nil, fmt.Errorf("policies[%d]: repos and branch are required", i)
+		}
+		for _, r := range p.Repos {
+			if owner, name, ok := strings.Cut(r, "/"); !ok || owner == "" || name == "" {
+				return nil, fmt.Errorf("policies[%d]: repo %q is not owner/name", i, r)
+			}
+		}
+	}
+	return cfg.Policies, nil
+}
+
+func main() {
+	token := flag.String("token", "", "GitHub token")
+	config := flag.String("config", "branch-protection.yaml", "desired state file")
+	apply := flag.Bool("apply", false, "converge drifted repositories instead of only reporting them")
+	flag.Parse()
+
+	policies, err := loadPolicies(*config)
+	if err != nil {
+		log.Fatalf("Loading desired state failed: %v", err)
+	}
+
+	ctx := context.Background()
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: *token})
+	client := github.NewClient(oauth2.NewClient(ctx, ts))
+	drift, failed := 0, false
+	for _, p := range policies {
+		for _, repo := range p.Repos {
+			n, err := reconcile(ctx, client, repo, p, *apply)
+			drift += n
+			if err != nil {
+				log.Printf("%v", err)
+				failed = true
+			}
+		}
+	}
+
+	switch {
+	case failed:
+		os.Exit(2)
+	case drift == 0:
+		fmt.Println("No drift")
+	case !*apply:
+		fmt.Printf("%d settings drifted; run with -apply to converge\n", drift)
+		os.Exit(1)
+	}
+}
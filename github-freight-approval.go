@@ -0,0 +1,844 @@
+// requires a CODEOWNERS approval from Slack before a Freight is approved for a stage
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+	"golang.org/x/oauth2"
+)
+
+const (
+	getFreightPath     = "/akuity.io.kargo.service.v1alpha1.KargoService/GetFreight"
+	approveFreightPath = "/akuity.io.kargo.service.v1alpha1.KargoService/ApproveFreight"
+
+	approveActionID = "approve_freight"
+
+	// expiryTick is how often open requests are checked for expiry and
+	// reminders.
+	expiryTick = time.Minute
+
+	// slackMaxSkew is how old a signed Slack request may be before it is
+	// treated as a replay.
+	slackMaxSkew = 5 * time.Minute
+)
+
+// codeownersPaths are the locations GitHub reads CODEOWNERS from, in order.
+var codeownersPaths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+var githubRepoRe = regexp.MustCompile(`github\.com[/:]([^/]+)/([^/]+?)(?:\.git)?/?$`)
+
+type Commit struct {
+	RepoURL string `json:"repoURL"`
+	ID      string `json:"id"`
+}
+
+type Freight struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Commits []Commit `json:"commits"`
+}
+
+// ownerRule is one CODEOWNERS line.
+type ownerRule struct {
+	Pattern string
+	Owners  []string
+	re      *regexp.Regexp
+}
+
+// OwnerGroup is a set of changed paths whose last matching CODEOWNERS rule
+// is the same. One approval from any of Logins satisfies it.
+type OwnerGroup struct {
+	Repo    string   `json:"repo"`
+	Pattern string   `json:"pattern"`
+	Owners  []string `json:"owners"`
+	Logins  []string `json:"logins"`
+	Paths   []string `json:"paths"`
+}
+
+type ApprovalRequest struct {
+	Project   string          `json:"project"`
+	Freight   string          `json:"freight"`
+	Stage     string          `json:"stage"`
+	Groups    []OwnerGroup    `json:"groups"`
+	Approvals map[string]bool `json:"approvals"`
+	Approved  bool            `json:"approved"`
+
+	Opened time.Time `json:"opened"`
+	// ExpiresAt is when the request is rejected or escalated if it is
+	// still open, when expiry is configured.
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty"`
+	Expired      bool       `json:"expired,omitempty"`
+	Escalated    bool       `json:"escalated,omitempty"`
+	Reminders    int        `json:"reminders,omitempty"`
+	LastReminded *time.Time `json:"lastReminded,omitempty"`
+
+	// thread is the ts of the Slack message, which reminders and expiry
+	// notices reply to.
+	thread string
+}
+
+// pending reports whether the request still takes approvals.
+func (a *ApprovalRequest) pending() bool { return !a.Approved && !a.Expired }
+
+// satisfied reports whether every group has an approval from one of its
+// owners.
+func (a *ApprovalRequest) satisfied() bool {
+	for _, g := range a.Groups {
+		ok := false
+		for _, login := range g.Logins {
+			if a.Approvals[login] {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (a *ApprovalRequest) ownsAny(login string) bool {
+	for _, g := range a.Groups {
+		for _, l := range g.Logins {
+			if l == login {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func kargoCall(ctx context.Context, apiURL, token, path string, in, out any) error {
+	reqBody, _ := json.Marshal(in)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		strings.TrimSuffix(apiURL, "/")+path, bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("calling Kargo API: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Kargo API returned %s", resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func getFreight(ctx context.Context, apiURL, token, project, name string) (*Freight, error) {
+	var out struct {
+		Freight *Freight `json:"freight"`
+	}
+	if err := kargoCall(ctx, apiURL, token, getFreightPath,
+		map[string]string{"project": project, "name": name}, &out); err != nil {
+		return nil, err
+	}
+	if out.Freight == nil {
+		return nil, fmt.Errorf("freight %s/%s not found", project, name)
+	}
+	return out.Freight, nil
+}
+
+// parseCodeowners reads a CODEOWNERS file. Lines without owners are kept,
+// since they deliberately unassign paths matched by earlier rules.
+func parseCodeowners(data string) ([]ownerRule, error) {
+	var rules []ownerRule
+	for i, line := range strings.Split(data, "\n") {
+		if j := strings.Index(line, " #"); j >= 0 {
+			line = line[:j]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		re, err := codeownersPattern(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		rules = append(rules, ownerRule{Pattern: fields[0], Owners: fields[1:], re: re})
+	}
+	return rules, nil
+}
+
+// codeownersPattern translates a gitignore-style CODEOWNERS pattern. A
+// pattern matches a file or a directory and everything below it; one
+// without a leading or inner slash matches at any depth.
+func codeownersPattern(pattern string) (*regexp.Regexp, error) {
+	p := strings.TrimSuffix(pattern, "/")
+	anchored := strings.Contains(p, "/")
+	p = strings.TrimPrefix(p, "/")
+
+	var b strings.Builder
+	if anchored {
+		b.WriteString("^")
+	} else {
+		b.WriteString("^(?:.*/)?")
+	}
+	for i := 0; i < len(p); i++ {
+		switch {
+		case strings.HasPrefix(p[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(p[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case p[i] == '*':
+			b.WriteString("[^/]*")
+		case p[i] == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(p[i : i+1]))
+		}
+	}
+	b.WriteString("(?:/.*)?$")
+	return regexp.Compile(b.String())
+}
+
+// ownerOf returns the last rule matching path, which is the one GitHub
+// applies.
+func ownerOf(rules []ownerRule, path string) *ownerRule {
+	for i := len(rules) - 1; i >= 0; i-- {
+		if rules[i].re.MatchString(path) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+type approver struct {
+	client     *github.Client
+	kargoURL   string
+	kargoToken string
+
+	slackToken    string
+	slackChannel  string
+	signingSecret string
+	// users maps Slack user IDs to GitHub logins.
+	users map[string]string
+
+	// expireAfter closes requests left open this long, rejecting them or,
+	// with escalate, pinging escalateTo instead. remindEvery pings the
+	// approvers still missing at this interval. Zero disables either.
+	expireAfter time.Duration
+	escalate    bool
+	escalateTo  []string
+	remindEvery time.Duration
+
+	mu       sync.Mutex
+	requests map[string]*ApprovalRequest
+}
+
+func (a *approver) codeowners(ctx context.Context, owner, repo, ref string) ([]ownerRule, error) {
+	for _, path := range codeownersPaths {
+		file, _, resp, err := a.client.Repositories.GetContents(ctx, owner, repo, path,
+			&github.RepositoryContentGetOptions{Ref: ref})
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+		content, err := file.GetContent()
+		if err != nil {
+			return nil, fmt.Errorf("decoding %s: %w", path, err)
+		}
+		return parseCodeowners(content)
+	}
+	return nil, nil
+}
+
+// logins expands owners into GitHub logins. Teams are resolved through the
+// API; email owners cannot be matched to a Slack user and are skipped.
+func (a *approver) logins(ctx context.Context, owners []string) ([]string, error) {
+	seen := map[string]bool{}
+	for _, o := range owners {
+		name, ok := strings.CutPrefix(o, "@")
+		if !ok {
+			log.Printf("Skipping email owner %s", o)
+			continue
+		}
+		org, slug, isTeam := strings.Cut(name, "/")
+		if !isTeam {
+			seen[strings.ToLower(name)] = true
+			continue
+		}
+		opts := &github.TeamListTeamMembersOptions{ListOptions: github.ListOptions{PerPage: 100}}
+		for {
+			members, resp, err := a.client.Teams.ListTeamMembersBySlug(ctx, org, slug, opts)
+			if err != nil {
+				return nil, fmt.Errorf("listing members of %s: %w", o, err)
+			}
+			for _, m := range members {
+				seen[strings.ToLower(m.GetLogin())] = true
+			}
+			if resp.NextPage == 0 {
+				break
+			}
+			opts.Page = resp.NextPage
+		}
+	}
+	out := make([]string, 0, len(seen))
+	for l := range seen {
+		out = append(out, l)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// ownerGroups works out who has to approve the change from previous to
+// freight. Repos are compared commit to commit and the CODEOWNERS file is
+// read at the new commit.
+func (a *approver) ownerGroups(ctx context.Context, freight, previous *Freight) ([]OwnerGroup, error) {
+	base := map[string]string{}
+	for _, c := range previous.Commits {
+		base[c.RepoURL] = c.ID
+	}
+
+	var groups []OwnerGroup
+	for _, c := range freight.Commits {
+		m := githubRepoRe.FindStringSubmatch(c.RepoURL)
+		if m == nil {
+			log.Printf("Skipping non-GitHub repo %s", c.RepoURL)
+			continue
+		}
+		owner, repo := m[1], m[2]
+		from, ok := base[c.RepoURL]
+		if !ok || from == c.ID {
+			continue
+		}
+		cmp, _, err := a.client.Repositories.CompareCommits(ctx, owner, repo, from, c.ID, nil)
+		if err != nil {
+			return nil, fmt.Errorf("comparing %s...%s: %w", from, c.ID, err)
+		}
+		rules, err := a.codeowners(ctx, owner, repo, c.ID)
+		if err != nil {
+			return nil, fmt.Errorf("%s/%s: %w", owner, repo, err)
+		}
+
+		byRule := map[*ownerRule]*OwnerGroup{}
+		var order []*ownerRule
+		for _, f := range cmp.Files {
+			rule := ownerOf(rules, f.GetFilename())
+			if rule == nil || len(rule.Owners) == 0 {
+				continue
+			}
+			g, ok := byRule[rule]
+			if !ok {
+				g = &OwnerGroup{Repo: owner + "/" + repo, Pattern: rule.Pattern, Owners: rule.Owners}
+				byRule[rule] = g
+				order = append(order, rule)
+			}
+			g.Paths = append(g.Paths, f.GetFilename())
+		}
+		for _, rule := range order {
+			g := byRule[rule]
+			if g.Logins, err = a.logins(ctx, g.Owners); err != nil {
+				return nil, err
+			}
+			if len(g.Logins) == 0 {
+				return nil, fmt.Errorf("%s: no GitHub users own %s", g.Repo, g.Pattern)
+			}
+			groups = append(groups, *g)
+		}
+	}
+	return groups, nil
+}
+
+func (a *approver) open(ctx context.Context, project, name, previousName, stage string) (*ApprovalRequest, error) {
+	freight, err := getFreight(ctx, a.kargoURL, a.kargoToken, project, name)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := getFreight(ctx, a.kargoURL, a.kargoToken, project, previousName)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := a.ownerGroups(ctx, freight, previous)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &ApprovalRequest{Project: project, Freight: name, Stage: stage, Groups: groups, Approvals: map[string]bool{}, Opened: time.Now().UTC()}
+	if a.expireAfter > 0 {
+		expires := req.Opened.Add(a.expireAfter)
+		req.ExpiresAt = &expires
+	}
+	a.mu.Lock()
+	a.requests[project+"/"+name] = req
+	a.mu.Unlock()
+
+	if len(groups) == 0 {
+		log.Printf("No CODEOWNERS apply to freight %s/%s, approving", project, name)
+		return req, a.approve(ctx, req)
+	}
+	return req, a.postRequest(ctx, req)
+}
+
+func (a *approver) approve(ctx context.Context, req *ApprovalRequest) error {
+	err := kargoCall(ctx, a.kargoURL, a.kargoToken, approveFreightPath,
+		map[string]string{"project": req.Project, "name": req.Freight, "stage": req.Stage}, nil)
+	if err != nil {
+		return fmt.Errorf("approving freight: %w", err)
+	}
+	a.mu.Lock()
+	req.Approved = true
+	a.mu.Unlock()
+	log.Printf("Approved freight %s/%s for %s", req.Project, req.Freight, req.Stage)
+	return nil
+}
+
+func requestText(req *ApprovalRequest) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*Freight %s* is waiting for code owner approval before promotion to *%s*.\n",
+		req.Freight, req.Stage)
+	for _, g := range req.Groups {
+		fmt.Fprintf(&b, "• `%s` in %s (%d files): %s\n", g.Pattern, g.Repo, len(g.Paths), strings.Join(g.Owners, ", "))
+	}
+	return b.String()
+}
+
+func (a *approver) postRequest(ctx context.Context, req *ApprovalRequest) error {
+	text := requestText(req)
+	if req.ExpiresAt != nil {
+		action := "rejected"
+		if a.escalate {
+			action = "escalated"
+		}
+		text += fmt.Sprintf("Unless approved by <!date^%d^{date_short_pretty} {time}|%s>, it will be %s.\n",
+			req.ExpiresAt.Unix(), req.ExpiresAt.Format(time.RFC3339), action)
+	}
+	ts, err := a.postSlack(ctx, map[string]any{
+		"channel": a.slackChannel,
+		"text":    text,
+		"blocks": []any{
+			map[string]any{"type": "section", "text": map[string]string{"type": "mrkdwn", "text": text}},
+			map[string]any{"type": "actions", "elements": []any{map[string]any{
+				"type":      "button",
+				"action_id": approveActionID,
+				"style":     "primary",
+				"text":      map[string]string{"type": "plain_text", "text": "Approve"},
+				"value":     req.Project + "/" + req.Freight,
+			}}},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	req.thread = ts
+	a.mu.Unlock()
+	return nil
+}
+
+// replyInThread posts text as a reply to req's Slack message.
+func (a *approver) replyInThread(ctx context.Context, req *ApprovalRequest, text string) error {
+	_, err := a.postSlack(ctx, map[string]any{"channel": a.slackChannel, "thread_ts": req.thread, "text": text})
+	return err
+}
+
+// postSlack sends msg with chat.postMessage and returns the message's ts.
+func (a *approver) postSlack(ctx context.Context, msg map[string]any) (string, error) {
+	body, _ := json.Marshal(msg)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://slack.com/api/chat.postMessage", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	httpReq.Header.Set("Content-Type", "application/json; charset=utf-8")
+	httpReq.Header.Set("Authorization", "Bearer "+a.slackToken)
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var out struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+		TS    string `json:"ts"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("decoding Slack response: %w", err)
+	}
+	if !out.OK {
+		return "", fmt.Errorf("Slack returned %s", out.Error)
+	}
+	return out.TS, nil
+}
+
+// missingApprovers returns Slack mentions for the owners of the groups
+// that have no approval yet. Owners without a Slack mapping are left out.
+func (a *approver) missingApprovers(req *ApprovalRequest) []string {
+	var mentions []string
+	for _, g := range req.Groups {
+		approved := false
+		for _, login := range g.Logins {
+			approved = approved || req.Approvals[login]
+		}
+		if approved {
+			continue
+		}
+		for id, login := range a.users {
+			for _, l := range g.Logins {
+				if strings.EqualFold(login, l) {
+					mentions = append(mentions, "<@"+id+">")
+				}
+			}
+		}
+	}
+	sort.Strings(mentions)
+	return slices.Compact(mentions)
+}
+
+// watch expires and reminds about open requests until ctx is done.
+func (a *approver) watch(ctx context.Context) {
+	t := time.NewTicker(expiryTick)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			a.sweep(ctx, now.UTC())
+		}
+	}
+}
+
+// sweep handles the requests due for expiry or a reminder at now. Requests
+// whose Slack message was never posted have no thread to reply to and are
+// skipped.
+func (a *approver) sweep(ctx context.Context, now time.Time) {
+	type due struct {
+		req    *ApprovalRequest
+		expire bool
+		text   string
+	}
+	var work []due
+	a.mu.Lock()
+	for _, req := range a.requests {
+		if !req.pending() || req.thread == "" {
+			continue
+		}
+		mentions := strings.Join(a.missingApprovers(req), " ")
+		switch {
+		case req.ExpiresAt != nil && !req.Escalated && !now.Before(*req.ExpiresAt):
+			if a.escalate {
+				req.Escalated = true
+				work = append(work, due{req, false, fmt.Sprintf("This request has been waiting since %s and is escalated to %s. Still missing: %s",
+					req.Opened.Format(time.RFC3339), mentionAll(a.escalateTo), mentions)})
+			} else {
+				req.Expired = true
+				work = append(work, due{req, true, fmt.Sprintf("This request expired unapproved after %v; Freight %s will not be promoted to %s.",
+					a.expireAfter, req.Freight, req.Stage)})
+			}
+		case a.remindEvery > 0 && now.Sub(lastPing(req)) >= a.remindEvery:
+			req.Reminders++
+			reminded := now
+			req.LastReminded = &reminded
+			work = append(work, due{req, false, "Reminder: Freight " + req.Freight + " is still waiting for approval to " + req.Stage + ". " + mentions})
+		}
+	}
+	a.mu.Unlock()
+
+	for _, d := range work {
+		if d.expire {
+			log.Printf("Approval for freight %s/%s expired", d.req.Project, d.req.Freight)
+		}
+		if err := a.replyInThread(ctx, d.req, d.text); err != nil {
+			log.Printf("Posting to the approval thread for freight %s/%s failed: %v", d.req.Project, d.req.Freight, err)
+		}
+	}
+}
+
+// lastPing is when the approvers were last notified of req.
+func lastPing(req *ApprovalRequest) time.Time {
+	if req.LastReminded != nil {
+		return *req.LastReminded
+	}
+	return req.Opened
+}
+
+// mentionAll formats Slack user IDs and @handles as mentions.
+func mentionAll(targets []string) string {
+	out := make([]string, len(targets))
+	for i, t := range targets {
+		if strings.HasPrefix(t, "@") {
+			out[i] = t
+		} else {
+			out[i] = "<@" + t + ">"
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+// verifySlack checks the v0 request signature Slack puts on interactive
+// payloads.
+func (a *approver) verifySlack(r *http.Request, body []byte) bool {
+	ts := r.Header.Get("X-Slack-Request-Timestamp")
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || time.Since(time.Unix(sec, 0)).Abs() > slackMaxSkew {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(a.signingSecret))
+	fmt.Fprintf(mac, "v0:%s:%s", ts, body)
+	got, err := hex.DecodeString(strings.TrimPrefix(r.Header.Get("X-Slack-Signature"), "v0="))
+	return err == nil && hmac.Equal(got, mac.Sum(nil))
+}
+
+func respondSlack(ctx context.Context, responseURL, text string, replace bool) {
+	body, _ := json.Marshal(map[string]any{
+		"text":             text,
+		"response_type":    "ephemeral",
+		"replace_original": replace,
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, responseURL, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if resp, err := http.DefaultClient.Do(req); err != nil {
+		log.Printf("Responding to Slack failed: %v", err)
+	} else {
+		resp.Body.Close()
+	}
+}
+
+// actionsHandler receives Slack button clicks. An approval only counts when
+// the clicking Slack user maps to a GitHub login that owns changed paths.
+func (a *approver) actionsHandler(w http.ResponseWriter, r *http.Request) {
+	var body bytes.Buffer
+	if _, err := body.ReadFrom(r.Body); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	if !a.verifySlack(r, body.Bytes()) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	form, err := url.ParseQuery(body.String())
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	var payload struct {
+		User struct {
+			ID string `json:"id"`
+		} `json:"user"`
+		ResponseURL string `json:"response_url"`
+		Actions     []struct {
+			ActionID string `json:"action_id"`
+			Value    string `json:"value"`
+		} `json:"actions"`
+	}
+	if err := json.Unmarshal([]byte(form.Get("payload")), &payload); err != nil || len(payload.Actions) == 0 {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+
+	action := payload.Actions[0]
+	if action.ActionID != approveActionID {
+		return
+	}
+	ctx := context.WithoutCancel(r.Context())
+	login, ok := a.users[payload.User.ID]
+	login = strings.ToLower(login)
+	if !ok {
+		respondSlack(ctx, payload.ResponseURL, "Your Slack account is not mapped to a GitHub user.", false)
+		return
+	}
+
+	a.mu.Lock()
+	req, ok := a.requests[action.Value]
+	var owner, done, expired bool
+	if ok {
+		done, expired = req.Approved, req.Expired
+		owner = req.ownsAny(login)
+		if owner && req.pending() {
+			req.Approvals[login] = true
+		}
+	}
+	a.mu.Unlock()
+
+	switch {
+	case !ok:
+		respondSlack(ctx, payload.ResponseURL, "This approval request is no longer active.", false)
+	case expired:
+		respondSlack(ctx, payload.ResponseURL, "This approval request has expired.", false)
+	case done:
+		respondSlack(ctx, payload.ResponseURL, "This Freight has already been approved.", false)
+	case !owner:
+		respondSlack(ctx, payload.ResponseURL, "@"+login+" does not own any of the changed paths.", false)
+	default:
+		a.mu.Lock()
+		satisfied := req.satisfied()
+		a.mu.Unlock()
+		if !satisfied {
+			respondSlack(ctx, payload.ResponseURL, "Approval by @"+login+" recorded; other code owners still need to approve.", false)
+			return
+		}
+		if err := a.approve(ctx, req); err != nil {
+			log.Printf("Approving freight %s failed: %v", action.Value, err)
+			respondSlack(ctx, payload.ResponseURL, "Approval recorded, but approving the Freight failed: "+err.Error(), false)
+			return
+		}
+		respondSlack(ctx, payload.ResponseURL, fmt.Sprintf("Freight %s approved for %s by code owners.", req.Freight, req.Stage), true)
+	}
+}
+
+// requestHandler serves POST /request?project=&freight=&previous=&stage=,
+// for a Kargo promotion step or CI job to open an approval request, and
+// GET /request?project=&freight= for its status.
+func (a *approver) requestHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if r.Method == http.MethodGet {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		req, ok := a.requests[q.Get("project")+"/"+q.Get("freight")]
+		if !ok {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(req)
+		return
+	}
+	project, name, previous, stage := q.Get("project"), q.Get("freight"), q.Get("previous"), q.Get("stage")
+	if project == "" || name == "" || previous == "" || stage == "" {
+		http.Error(w, "project, freight, previous and stage are required", http.StatusBadRequest)
+		return
+	}
+	req, err := a.open(r.Context(), project, name, previous, stage)
+	if err != nil {
+		log.Printf("Opening approval for freight %s/%s failed: %v", project, name, err)
+		http.Error(w, "Opening approval failed", http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	json.NewEncoder(w).Encode(req)
+}
+
+func main() {
+	token := flag.String("token", "", "GitHub token (needs read:org to expand team owners)")
+	kargoURL := flag.String("kargo-url", "https://localhost:31444", "Kargo API server URL")
+	kargoToken := flag.String("kargo-token", os.Getenv("KARGO_TOKEN"), "Kargo API bearer token")
+	project := flag.String("project", "", "Kargo project")
+	freightName := flag.String("freight", "", "Freight to approve")
+	previousName := flag.String("previous", "", "Freight currently in the stage (start of the change range)")
+	stage := flag.String("stage", "", "stage to approve the Freight for")
+	slackToken := flag.String("slack-token", os.Getenv("SLACK_BOT_TOKEN"), "Slack bot token")
+	slackChannel := flag.String("slack-channel", "", "Slack channel to request approvals in")
+	signingSecret := flag.String("slack-signing-secret", os.Getenv("SLACK_SIGNING_SECRET"), "Slack app signing secret")
+	usersFile := flag.String("users", "", "JSON file mapping Slack user IDs to GitHub logins")
+	listen := flag.String("listen", "", "serve /request and /slack/actions on this address instead of printing the required owners")
+	expireAfter := flag.Duration("expire-after", 0, "close approval requests left open this long (0 keeps them open)")
+	onExpiry := flag.String("on-expiry", "reject", "what happens to expired requests: reject, or escalate to -escalate-to")
+	escalateTo := flag.String("escalate-to", "", "comma-separated Slack user IDs or @handles pinged when a request is escalated")
+	remindEvery := flag.Duration("remind-every", 0, "ping approvers still missing at this interval (0 disables reminders)")
+	flag.Parse()
+
+	users := map[string]string{}
+	if *usersFile != "" {
+		data, err := os.ReadFile(*usersFile)
+		if err != nil {
+			log.Fatalf("Reading users file failed: %v", err)
+		}
+		if err := json.Unmarshal(data, &users); err != nil {
+			log.Fatalf("Parsing users file failed: %v", err)
+		}
+	}
+
+	if *onExpiry != "reject" && *onExpiry != "escalate" {
+		log.Fatalf("-on-expiry must be reject or escalate, not %q", *onExpiry)
+	}
+	if *onExpiry == "escalate" && *escalateTo == "" {
+		log.Fatal("-escalate-to is required with -on-expiry=escalate")
+	}
+	var escalateTargets []string
+	if *escalateTo != "" {
+		escalateTargets = strings.Split(*escalateTo, ",")
+	}
+
+	ctx := context.Background()
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: *token})
+	a := &approver{
+		client:        github.NewClient(oauth2.NewClient(ctx, ts)),
+		kargoURL:      *kargoURL,
+		kargoToken:    *kargoToken,
+		slackToken:    *slackToken,
+		slackChannel:  *slackChannel,
+		signingSecret: *signingSecret,
+		users:         users,
+		requests:      make(map[string]*ApprovalRequest),
+		expireAfter:   *expireAfter,
+		escalate:      *onExpiry == "escalate",
+		escalateTo:    escalateTargets,
+		remindEvery:   *remindEvery,
+	}
+
+	if *listen != "" {
+		if *signingSecret == "" {
+			log.Fatal("-slack-signing-secret is required to accept approvals")
+		}
+		go a.watch(ctx)
+		http.HandleFunc("/request", a.requestHandler)
+		http.HandleFunc("/slack/actions", a.actionsHandler)
+		log.Printf("Serving Freight approvals on %s", *listen)
+		log.Fatal(http.ListenAndServe(*listen, nil))
+	}
+
+	freight, err := getFreight(ctx, *kargoURL, *kargoToken, *project, *freightName)
+	if err != nil {
+		log.Fatalf("Getting freight failed: %v", err)
+	}
+	previous, err := getFreight(ctx, *kargoURL, *kargoToken, *project, *previousName)
+	if err != nil {
+		log.Fatalf("Getting previous freight failed: %v", err)
+	}
+	groups, err := a.ownerGroups(ctx, freight, previous)
+	if err != nil {
+		log.Fatalf("Resolving code owners failed: %v", err)
+	}
+	if len(groups) == 0 {
+		fmt.Printf("Freight %s: no code owner approval required for %s\n", *freightName, *stage)
+		return
+	}
+	fmt.Printf("Freight %s needs code owner approval for %s:\n", *freightName, *stage)
+	for _, g := range groups {
+		fmt.Printf("%s %s: one of %s\n", g.Repo, g.Pattern, strings.Join(g.Logins, ", "))
+		for _, p := range g.Paths {
+			fmt.Printf("  %s\n", p)
+		}
+	}
+}
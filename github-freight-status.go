@@ -0,0 +1,364 @@
+// aggregates GitHub CI results across every commit in a Freight into one signal
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+	"golang.org/x/oauth2"
+)
+
+const (
+	getFreightPath = "/akuity.io.kargo.service.v1alpha1.KargoService/GetFreight"
+
+	// statusAnnotation is set on the Freight so a Kargo verification or a
+	// promotion step can gate on it.
+	statusAnnotation = "ci.github.com/status"
+
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+)
+
+const (
+	stateSuccess = "success"
+	statePending = "pending"
+	stateFailure = "failure"
+)
+
+var githubRepoRe = regexp.MustCompile(`github\.com[/:]([^/]+)/([^/]+?)(?:\.git)?/?$`)
+
+type Commit struct {
+	RepoURL string `json:"repoURL"`
+	ID      string `json:"id"`
+}
+
+type Freight struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Commits []Commit `json:"commits"`
+}
+
+// Check is one commit status context or check run.
+type Check struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+	URL   string `json:"url,omitempty"`
+}
+
+type CommitResult struct {
+	Repo   string  `json:"repo"`
+	SHA    string  `json:"sha"`
+	State  string  `json:"state"`
+	Checks []Check `json:"checks"`
+}
+
+type FreightResult struct {
+	Project   string         `json:"project"`
+	Freight   string         `json:"freight"`
+	State     string         `json:"state"`
+	Commits   []CommitResult `json:"commits"`
+	CheckedAt time.Time      `json:"checkedAt"`
+}
+
+func getFreight(ctx context.Context, apiURL, token, project, name string) (*Freight, error) {
+	reqBody, _ := json.Marshal(map[string]string{"project": project, "name": name})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		strings.TrimSuffix(apiURL, "/")+getFreightPath, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("calling Kargo API: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Kargo API returned %s", resp.Status)
+	}
+
+	var out struct {
+		Freight *Freight `json:"freight"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decoding Freight: %w", err)
+	}
+	if out.Freight == nil {
+		return nil, fmt.Errorf("freight %s/%s not found", project, name)
+	}
+	return out.Freight, nil
+}
+
+// worst combines states: any failure fails, otherwise any pending is pending.
+func worst(a, b string) string {
+	if a == stateFailure || b == stateFailure {
+		return stateFailure
+	}
+	if a == statePending || b == statePending {
+		return statePending
+	}
+	return stateSuccess
+}
+
+func checkRunState(status, conclusion string) string {
+	if status != "completed" {
+		return statePending
+	}
+	switch conclusion {
+	case "success", "neutral", "skipped":
+		return stateSuccess
+	default:
+		return stateFailure
+	}
+}
+
+// commitResult gathers both the legacy commit statuses and the check runs
+// for sha. A commit with neither is pending, so a Freight is never green
+// before CI has reported on it.
+func commitResult(ctx context.Context, client *github.Client, owner, repo, sha string) (CommitResult, error) {
+	res := CommitResult{Repo: owner + "/" + repo, SHA: sha, State: stateSuccess}
+
+	combined, _, err := client.Repositories.GetCombinedStatus(ctx, owner, repo, sha, nil)
+	if err != nil {
+		return res, fmt.Errorf("getting statuses for %s: %w", sha, err)
+	}
+	if combined.GetTotalCount() > 0 {
+		state := combined.GetState()
+		if state == "error" {
+			state = stateFailure
+		}
+		res.Checks = append(res.Checks, Check{Name: "commit statuses", State: state})
+		res.State = worst(res.State, state)
+	}
+
+	opts := &github.ListCheckRunsOptions{Filter: github.String("latest"), ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		runs, resp, err := client.Checks.ListCheckRunsForRef(ctx, owner, repo, sha, opts)
+		if err != nil {
+			return res, fmt.Errorf("listing check runs for %s: %w", sha, err)
+		}
+		for _, run := range runs.CheckRuns {
+			state := checkRunState(run.GetStatus(), run.GetConclusion())
+			res.Checks = append(res.Checks, Check{Name: run.GetName(), State: state, URL: run.GetHTMLURL()})
+			res.State = worst(res.State, state)
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	if len(res.Checks) == 0 {
+		res.State = statePending
+	}
+	return res, nil
+}
+
+type aggregator struct {
+	client     *github.Client
+	kargoURL   string
+	kargoToken string
+	annotate   bool
+
+	mu      sync.Mutex
+	results map[string]FreightResult
+}
+
+func (a *aggregator) evaluate(ctx context.Context, project, name string) (FreightResult, error) {
+	freight, err := getFreight(ctx, a.kargoURL, a.kargoToken, project, name)
+	if err != nil {
+		return FreightResult{}, err
+	}
+
+	out := FreightResult{Project: project, Freight: name, State: stateSuccess, CheckedAt: time.Now().UTC()}
+	for _, c := range freight.Commits {
+		m := githubRepoRe.FindStringSubmatch(c.RepoURL)
+		if m == nil {
+			log.Printf("Skipping non-GitHub repo %s", c.RepoURL)
+			continue
+		}
+		res, err := commitResult(ctx, a.client, m[1], m[2], c.ID)
+		if err != nil {
+			return FreightResult{}, err
+		}
+		out.Commits = append(out.Commits, res)
+		out.State = worst(out.State, res.State)
+	}
+	if len(out.Commits) == 0 {
+		out.State = statePending
+	}
+
+	if a.annotate {
+		if err := annotateFreight(ctx, project, name, out.State); err != nil {
+			log.Printf("Annotating freight %s/%s failed: %v", project, name, err)
+		}
+	}
+
+	a.mu.Lock()
+	a.results[project+"/"+name] = out
+	a.mu.Unlock()
+	return out, nil
+}
+
+// annotateFreight records state on the Freight through the Kubernetes API
+// using the pod's service account.
+func annotateFreight(ctx context.Context, project, name, state string) error {
+	token, err := os.ReadFile(serviceAccountDir + "/token")
+	if err != nil {
+		return err
+	}
+	ca, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return err
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca)
+	client := &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+	}
+
+	patch, _ := json.Marshal(map[string]any{
+		"metadata": map[string]any{"annotations": map[string]string{statusAnnotation: state}},
+	})
+	url := fmt.Sprintf("https://%s:%s/apis/kargo.akuity.io/v1alpha1/namespaces/%s/freights/%s",
+		os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT"), project, name)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPatch, url, bytes.NewReader(patch))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Kubernetes API returned %s", resp.Status)
+	}
+	return nil
+}
+
+// statusHandler serves GET /status?project=&freight=. It answers 200 only
+// when every commit is green, so it can back an HTTP verification check.
+func (a *aggregator) statusHandler(w http.ResponseWriter, r *http.Request) {
+	project, name := r.URL.Query().Get("project"), r.URL.Query().Get("freight")
+	if project == "" || name == "" {
+		http.Error(w, "project and freight are required", http.StatusBadRequest)
+		return
+	}
+	res, err := a.evaluate(r.Context(), project, name)
+	if err != nil {
+		log.Printf("Evaluating freight %s/%s failed: %v", project, name, err)
+		http.Error(w, "Evaluation failed", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	switch res.State {
+	case stateFailure:
+		w.WriteHeader(http.StatusConflict)
+	case statePending:
+		w.WriteHeader(http.StatusAccepted)
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+// metricsHandler exposes the last result per Freight in the Prometheus text
+// format.
+func (a *aggregator) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	keys := make([]string, 0, len(a.results))
+	for k := range a.results {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintln(w, "# HELP kargo_freight_ci_state Aggregated CI state of a Freight's commits (1 for the current state).")
+	fmt.Fprintln(w, "# TYPE kargo_freight_ci_state gauge")
+	for _, k := range keys {
+		res := a.results[k]
+		for _, state := range []string{stateSuccess, statePending, stateFailure} {
+			v := 0
+			if res.State == state {
+				v = 1
+			}
+			fmt.Fprintf(w, "kargo_freight_ci_state{project=%q,freight=%q,state=%q} %d\n",
+				res.Project, res.Freight, state, v)
+		}
+	}
+	fmt.Fprintln(w, "# HELP kargo_freight_ci_checked_timestamp_seconds When the Freight was last evaluated.")
+	fmt.Fprintln(w, "# TYPE kargo_freight_ci_checked_timestamp_seconds gauge")
+	for _, k := range keys {
+		res := a.results[k]
+		fmt.Fprintf(w, "kargo_freight_ci_checked_timestamp_seconds{project=%q,freight=%q} %d\n",
+			res.Project, res.Freight, res.CheckedAt.Unix())
+	}
+	a.mu.Unlock()
+}
+
+func main() {
+	token := flag.String("token", "", "GitHub token")
+	kargoURL := flag.String("kargo-url", "https://localhost:31444", "Kargo API server URL")
+	kargoToken := flag.String("kargo-token", os.Getenv("KARGO_TOKEN"), "Kargo API bearer token")
+	project := flag.String("project", "", "Kargo project")
+	freightName := flag.String("freight", "", "Freight to check")
+	annotate := flag.Bool("annotate", false, "record the result on the Freight as the "+statusAnnotation+" annotation")
+	listen := flag.String("listen", "", "serve /status and /metrics on this address instead of checking once")
+	flag.Parse()
+
+	ctx := context.Background()
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: *token})
+	a := &aggregator{
+		client:     github.NewClient(oauth2.NewClient(ctx, ts)),
+		kargoURL:   *kargoURL,
+		kargoToken: *kargoToken,
+		annotate:   *annotate,
+		results:    make(map[string]FreightResult),
+	}
+
+	if *listen != "" {
+		http.HandleFunc("/status", a.statusHandler)
+		http.HandleFunc("/metrics", a.metricsHandler)
+		log.Printf("Serving Freight CI status on %s", *listen)
+		log.Fatal(http.ListenAndServe(*listen, nil))
+	}
+
+	res, err := a.evaluate(ctx, *project, *freightName)
+	if err != nil {
+		log.Fatalf("Evaluating freight failed: %v", err)
+	}
+	for _, c := range res.Commits {
+		fmt.Printf("%s@%.7s: %s\n", c.Repo, c.SHA, c.State)
+		for _, check := range c.Checks {
+			if check.State != stateSuccess {
+				fmt.Printf("  %s: %s\n", check.Name, check.State)
+			}
+		}
+	}
+	fmt.Printf("Freight %s: %s\n", *freightName, res.State)
+	if res.State != stateSuccess {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,630 @@
+// adds a PR, or a stack of PRs bottom-up, to the merge queue, refusing stale heads and closed merge windows
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+	"golang.org/x/oauth2"
+	"sigs.k8s.io/yaml"
+)
+
+// graphql runs a query against the GitHub GraphQL API; merge queue
+// operations have no REST equivalent.
+func graphql(ctx context.Context, client *github.Client, query string, vars map[string]any, data any) error {
+	req, err := client.NewRequest(http.MethodPost, "graphql", map[string]any{"query": query, "variables": vars})
+	if err != nil {
+		return err
+	}
+	out := struct {
+		Data   any `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}{Data: data}
+	if _, err := client.Do(ctx, req, &out); err != nil {
+		return err
+	}
+	if len(out.Errors) > 0 {
+		return errors.New(out.Errors[0].Message)
+	}
+	return nil
+}
+
+// freshness reports whether the PR head is at most maxBehind commits behind
+// its base, or was committed (which a rebase does) within window.
+func freshness(ctx context.Context, client *github.Client, owner, repo string, pr *github.PullRequest, maxBehind int, window time.Duration) (bool, string, error) {
+	cmp, _, err := client.Repositories.CompareCommits(ctx, owner, repo, pr.GetBase().GetRef(), pr.GetHead().GetSHA(), &github.ListOptions{PerPage: 1})
+	if err != nil {
+		return false, "", fmt.Errorf("comparing with %s: %w", pr.GetBase().GetRef(), err)
+	}
+	behind := cmp.GetBehindBy()
+	detail := fmt.Sprintf("%d commits behind %s (limit %d)", behind, pr.GetBase().GetRef(), maxBehind)
+	if behind <= maxBehind {
+		return true, detail, nil
+	}
+	if window > 0 {
+		head, _, err := client.Repositories.GetCommit(ctx, owner, repo, pr.GetHead().GetSHA(), nil)
+		if err != nil {
+			return false, "", fmt.Errorf("reading head commit: %w", err)
+		}
+		age := time.Since(head.GetCommit().GetCommitter().GetDate().Time).Round(time.Minute)
+		detail += fmt.Sprintf("; head committed %s ago (limit %s)", age, window)
+		if age <= window {
+			return true, detail, nil
+		}
+	}
+	return false, detail, nil
+}
+
+// updateBranch merges base into the PR branch and waits for the new head,
+// which GitHub creates asynchronously.
+func updateBranch(ctx context.Context, client *github.Client, owner, repo string, pr *github.PullRequest, wait time.Duration) (*github.PullRequest, error) {
+	old := pr.GetHead().GetSHA()
+	_, _, err := client.PullRequests.UpdateBranch(ctx, owner, repo, pr.GetNumber(),
+		&github.PullRequestBranchUpdateOptions{ExpectedHeadSHA: github.String(old)})
+	var accepted *github.AcceptedError
+	if err != nil && !errors.As(err, &accepted) {
+		return nil, err
+	}
+	for deadline := time.Now().Add(wait); time.Now().Before(deadline); time.Sleep(3 * time.Second) {
+		pr, _, err = client.PullRequests.Get(ctx, owner, repo, pr.GetNumber())
+		if err != nil {
+			return nil, err
+		}
+		if pr.GetHead().GetSHA() != old {
+			return pr, nil
+		}
+	}
+	return nil, fmt.Errorf("head still at %.7s after %s", old, wait)
+}
+
+// enqueue adds the PR to its base branch's merge queue, pinned to the head
+// that passed the freshness check.
+func enqueue(ctx context.Context, client *github.Client, pr *github.PullRequest) (int, error) {
+	var data struct {
+		EnqueuePullRequest struct {
+			MergeQueueEntry struct {
+				Position int `json:"position"`
+			} `json:"mergeQueueEntry"`
+		} `json:"enqueuePullRequest"`
+	}
+	err := graphql(ctx, client,
+		`mutation($id: ID!, $head: GitObjectID!) { enqueuePullRequest(input: {pullRequestId: $id, expectedHeadOid: $head}) { mergeQueueEntry { position } } }`,
+		map[string]any{"id": pr.GetNodeID(), "head": pr.GetHead().GetSHA()}, &data)
+	return data.EnqueuePullRequest.MergeQueueEntry.Position, err
+}
+
+// enableAutoMerge has GitHub queue the PR once its required checks pass,
+// which a freshly updated head has not done yet.
+func enableAutoMerge(ctx context.Context, client *github.Client, pr *github.PullRequest) error {
+	return graphql(ctx, client,
+		`mutation($id: ID!, $head: GitObjectID!) { enablePullRequestAutoMerge(input: {pullRequestId: $id, expectedHeadOid: $head}) { clientMutationId } }`,
+		map[string]any{"id": pr.GetNodeID(), "head": pr.GetHead().GetSHA()}, nil)
+}
+
+type queueOptions struct {
+	maxBehind     int
+	rebasedWithin time.Duration
+	update        bool
+	wait          time.Duration
+	dryRun        bool
+	windows       []MergeWindow
+	override      string
+	// overridden holds the PRs whose override comment was already posted.
+	overridden map[int]bool
+}
+
+// MergeWindow is a weekly period in which matching repositories take no
+// merges, e.g.
+//
+//	windows:
+//	- name: weekend freeze
+//	  repos: [fykaa/prod-*]
+//	  timezone: Europe/Berlin
+//	  from: Fri 16:00
+//	  to: Mon 08:00
+//
+// Repos are path.Match patterns on owner/repo; an empty list matches every
+// repository.
+type MergeWindow struct {
+	Name     string   `json:"name"`
+	Repos    []string `json:"repos"`
+	Timezone string   `json:"timezone"`
+	From     string   `json:"from"`
+	To       string   `json:"to"`
+
+	loc      *time.Location
+	from, to int // minutes since Sunday 00:00
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// weekMinute parses "Fri 16:00" into minutes since Sunday 00:00.
+func weekMinute(s string) (int, error) {
+	day, clock, _ := strings.Cut(strings.TrimSpace(s), " ")
+	wd, ok := weekdays[strings.ToLower(day)]
+	if !ok {
+		return 0, fmt.Errorf("%q: want a weekday and time such as \"Fri 16:00\"", s)
+	}
+	t, err := time.Parse("15:04", strings.TrimSpace(clock))
+	if err != nil {
+		return 0, fmt.Errorf("%q: want a weekday and time such as \"Fri 16:00\"", s)
+	}
+	return int(wd)*24*60 + t.Hour()*60 + t.Minute(), nil
+}
+
+func loadWindows(file string) ([]MergeWindow, error) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var cfg struct {
+		Windows []MergeWindow `json:"windows"`
+	}
+	if err := yaml.UnmarshalStrict(raw, &cfg); err != nil {
+		return nil, err
+	}
+	for i := range cfg.Windows {
+		w := &cfg.Windows[i]
+		if w.loc, err = time.LoadLocation(w.Timezone); err != nil {
+			return nil, fmt.Errorf("window %q: %w", w.Name, err)
+		}
+		if w.from, err = weekMinute(w.From); err != nil {
+			return nil, fmt.Errorf("window %q: from %w", w.Name, err)
+		}
+		if w.to, err = weekMinute(w.To); err != nil {
+			return nil, fmt.Errorf("window %q: to %w", w.Name, err)
+		}
+	}
+	return cfg.Windows, nil
+}
+
+// closed reports whether the window covers repo at t. A window whose end
+// comes before its start in the week wraps over the weekend.
+func (w *MergeWindow) closed(repo string, t time.Time) bool {
+	if len(w.Repos) > 0 && !slices.ContainsFunc(w.Repos, func(p string) bool {
+		ok, _ := path.Match(p, repo)
+		return ok
+	}) {
+		return false
+	}
+	t = t.In(w.loc)
+	m := int(t.Weekday())*24*60 + t.Hour()*60 + t.Minute()
+	if w.from <= w.to {
+		return w.from <= m && m < w.to
+	}
+	return m >= w.from || m < w.to
+}
+
+// windowGate lets the PR through unless a merge window is closed for its
+// repository. An override needs a justification, which is recorded as a
+// PR comment once per PR.
+func windowGate(ctx context.Context, client *github.Client, owner, repo string, pr *github.PullRequest, o queueOptions) (bool, error) {
+	for _, w := range o.windows {
+		if !w.closed(owner+"/"+repo, time.Now()) {
+			continue
+		}
+		fmt.Printf("PR #%d: merge window %q is closed (%s to %s %s)\n", pr.GetNumber(), w.Name, w.From, w.To, w.Timezone)
+		if o.override == "" {
+			return false, nil
+		}
+		if o.dryRun || o.overridden[pr.GetNumber()] {
+			return true, nil
+		}
+		body := fmt.Sprintf("Queued during the %q merge window (%s to %s %s).\n\nJustification: %s", w.Name, w.From, w.To, w.Timezone, o.override)
+		if _, _, err := client.Issues.CreateComment(ctx, owner, repo, pr.GetNumber(), &github.IssueComment{Body: github.String(body)}); err != nil {
+			return false, fmt.Errorf("recording override: %w", err)
+		}
+		o.overridden[pr.GetNumber()] = true
+		return true, nil
+	}
+	return true, nil
+}
+
+// queue checks merge windows and the PR's freshness and queues it, updating a stale branch
+// first when allowed. It reports whether the PR is now queued or on its way.
+func queue(ctx context.Context, client *github.Client, owner, repo string, pr *github.PullRequest, o queueOptions) (bool, error) {
+	open, err := windowGate(ctx, client, owner, repo, pr, o)
+	if err != nil || !open {
+		return false, err
+	}
+	fresh, detail, err := freshness(ctx, client, owner, repo, pr, o.maxBehind, o.rebasedWithin)
+	if err != nil {
+		return false, fmt.Errorf("checking freshness: %w", err)
+	}
+	fmt.Printf("PR #%d head %.7s: %s\n", pr.GetNumber(), pr.GetHead().GetSHA(), detail)
+	if o.dryRun {
+		return fresh, nil
+	}
+
+	if fresh {
+		position, err := enqueue(ctx, client, pr)
+		if err != nil {
+			return false, fmt.Errorf("enqueueing: %w", err)
+		}
+		fmt.Printf("Queued PR #%d at position %d\n", pr.GetNumber(), position)
+		return true, nil
+	}
+	if !o.update {
+		fmt.Printf("PR #%d is stale; rebase it or rerun with -update-branch\n", pr.GetNumber())
+		return false, nil
+	}
+
+	if pr, err = updateBranch(ctx, client, owner, repo, pr, o.wait); err != nil {
+		return false, fmt.Errorf("updating branch: %w", err)
+	}
+	if err := enableAutoMerge(ctx, client, pr); err != nil {
+		return false, fmt.Errorf("enabling auto-merge: %w", err)
+	}
+	fmt.Printf("Updated PR #%d to %.7s; it joins the queue once its checks pass\n", pr.GetNumber(), pr.GetHead().GetSHA())
+	return true, nil
+}
+
+// stackNode is an open PR and the open PRs based on its head branch.
+type stackNode struct {
+	pr       *github.PullRequest
+	children []*stackNode
+}
+
+func (n *stackNode) contains(numbers map[int]bool) bool {
+	if numbers[n.pr.GetNumber()] {
+		return true
+	}
+	return slices.ContainsFunc(n.children, func(c *stackNode) bool { return c.contains(numbers) })
+}
+
+func (n *stackNode) walk(fn func(*stackNode)) {
+	fn(n)
+	for _, c := range n.children {
+		c.walk(fn)
+	}
+}
+
+// print draws the stack below its base branch, children indented under the
+// PR they are based on.
+func (n *stackNode) print(w io.Writer, indent string, queued map[int]bool) {
+	var state []string
+	switch {
+	case n.pr.GetDraft():
+		state = append(state, "draft")
+	case queued[n.pr.GetNumber()] || n.pr.GetAutoMerge() != nil:
+		state = append(state, "queued")
+	default:
+		state = append(state, "ready")
+	}
+	if indent == "" {
+		fmt.Fprintln(w, n.pr.GetBase().GetRef())
+	}
+	fmt.Fprintf(w, "%s└── #%d %s (%s)\n", indent, n.pr.GetNumber(), n.pr.GetHead().GetRef(), strings.Join(state, ", "))
+	for _, c := range n.children {
+		c.print(w, indent+"    ", queued)
+	}
+}
+
+func listOpen(ctx context.Context, client *github.Client, owner, repo string) ([]*github.PullRequest, error) {
+	var prs []*github.PullRequest
+	opts := &github.PullRequestListOptions{State: "open", ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		batch, resp, err := client.PullRequests.List(ctx, owner, repo, opts)
+		if err != nil {
+			return nil, err
+		}
+		prs = append(prs, batch...)
+		if resp.NextPage == 0 {
+			return prs, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// buildStacks links every open PR whose base is another open PR's head
+// branch under that PR. The roots target a branch no open PR provides,
+// usually the default branch. Heads from forks cannot be bases here, so
+// they only ever appear as leaves.
+func buildStacks(prs []*github.PullRequest, fullName string) []*stackNode {
+	byHead := make(map[string]*stackNode)
+	nodes := make([]*stackNode, len(prs))
+	for i, pr := range prs {
+		nodes[i] = &stackNode{pr: pr}
+		if pr.GetHead().GetRepo().GetFullName() == fullName {
+			byHead[pr.GetHead().GetRef()] = nodes[i]
+		}
+	}
+	var roots []*stackNode
+	for _, n := range nodes {
+		if parent := byHead[n.pr.GetBase().GetRef()]; parent != nil && parent != n {
+			parent.children = append(parent.children, n)
+		} else {
+			roots = append(roots, n)
+		}
+	}
+	for _, n := range nodes {
+		sort.Slice(n.children, func(i, j int) bool { return n.children[i].pr.GetNumber() < n.children[j].pr.GetNumber() })
+	}
+	return roots
+}
+
+// retargetMerged moves PRs based on the branch of a merged PR onto that
+// PR's own base, which is what GitHub does only when the merged branch is
+// deleted. parents caches the merged PR, or nil, found for each base.
+func retargetMerged(ctx context.Context, client *github.Client, owner, repo string, roots []*stackNode, parents map[string]*github.PullRequest) error {
+	for _, n := range roots {
+		base := n.pr.GetBase().GetRef()
+		parent, seen := parents[base]
+		if !seen {
+			merged, _, err := client.PullRequests.List(ctx, owner, repo, &github.PullRequestListOptions{
+				State: "closed", Head: owner + ":" + base, ListOptions: github.ListOptions{PerPage: 10},
+			})
+			if err != nil {
+				return fmt.Errorf("looking up PRs from %s: %w", base, err)
+			}
+			i := slices.IndexFunc(merged, func(pr *github.PullRequest) bool { return pr.MergedAt != nil })
+			if i >= 0 {
+				parent = merged[i]
+			}
+			parents[base] = parent
+		}
+		if parent == nil {
+			continue
+		}
+		target := parent.GetBase().GetRef()
+		updated, _, err := client.PullRequests.Edit(ctx, owner, repo, n.pr.GetNumber(),
+			&github.PullRequest{Base: &github.PullRequestBranch{Ref: github.String(target)}})
+		if err != nil {
+			return fmt.Errorf("retargeting #%d: %w", n.pr.GetNumber(), err)
+		}
+		fmt.Printf("Retargeted PR #%d from %s to %s; #%d merged\n", n.pr.GetNumber(), base, target, parent.GetNumber())
+		n.pr = updated
+	}
+	return nil
+}
+
+// runStack queues the bottom of each stack holding a tracked PR, retargeting
+// the PRs above a merged parent first. Once a bottom PR merges, the next
+// run queues the PRs that were stacked on it. It reports whether any
+// tracked PR is still open.
+func runStack(ctx context.Context, client *github.Client, owner, repo string, tracked, queued map[int]bool, parents map[string]*github.PullRequest, o queueOptions) (bool, error) {
+	prs, err := listOpen(ctx, client, owner, repo)
+	if err != nil {
+		return false, fmt.Errorf("listing PRs: %w", err)
+	}
+	roots := buildStacks(prs, owner+"/"+repo)
+	var mine []*stackNode
+	for _, n := range roots {
+		if n.contains(tracked) {
+			mine = append(mine, n)
+		}
+	}
+	if err := retargetMerged(ctx, client, owner, repo, mine, parents); err != nil {
+		return false, err
+	}
+
+	for _, n := range mine {
+		// PRs stacked onto the tracked ones later are managed too.
+		n.walk(func(c *stackNode) { tracked[c.pr.GetNumber()] = true })
+		n.print(os.Stdout, "", queued)
+
+		if n.pr.GetDraft() || queued[n.pr.GetNumber()] || n.pr.GetAutoMerge() != nil {
+			continue
+		}
+		ok, err := queue(ctx, client, owner, repo, n.pr, o)
+		if err != nil {
+			log.Printf("PR #%d: %v", n.pr.GetNumber(), err)
+			continue
+		}
+		if ok && !o.dryRun {
+			queued[n.pr.GetNumber()] = true
+		}
+	}
+	return len(mine) > 0, nil
+}
+
+// interaction is one recorded GitHub API call. Request headers, which carry
+// the token, are not recorded.
+type interaction struct {
+	Method   string      `json:"method"`
+	URL      string      `json:"url"`
+	Body     string      `json:"body,omitempty"`
+	Status   int         `json:"status"`
+	Header   http.Header `json:"header,omitempty"`
+	Response string      `json:"response"`
+}
+
+// cassette is an http.RoundTripper that appends every call to a file, one
+// JSON interaction per line, or answers calls from such a file without
+// touching the network. Replay hands out each interaction once, in
+// recorded order among calls with the same method, URL and body.
+type cassette struct {
+	mu     sync.Mutex
+	out    *os.File
+	tape   []interaction
+	played []bool
+}
+
+func newCassette(record, replay string) (*cassette, error) {
+	if record != "" {
+		f, err := os.Create(record)
+		if err != nil {
+			return nil, err
+		}
+		return &cassette{out: f}, nil
+	}
+	data, err := os.ReadFile(replay)
+	if err != nil {
+		return nil, err
+	}
+	c := &cassette{}
+	for i, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var in interaction
+		if err := json.Unmarshal([]byte(line), &in); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", replay, i+1, err)
+		}
+		c.tape = append(c.tape, in)
+	}
+	c.played = make([]bool, len(c.tape))
+	return c, nil
+}
+
+func (c *cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.out == nil {
+		for i, in := range c.tape {
+			if c.played[i] || in.Method != req.Method || in.URL != req.URL.String() || in.Body != string(body) {
+				continue
+			}
+			c.played[i] = true
+			return &http.Response{
+				Status:        fmt.Sprintf("%d %s", in.Status, http.StatusText(in.Status)),
+				StatusCode:    in.Status,
+				Proto:         "HTTP/1.1",
+				ProtoMajor:    1,
+				ProtoMinor:    1,
+				Header:        in.Header.Clone(),
+				Body:          io.NopCloser(strings.NewReader(in.Response)),
+				ContentLength: int64(len(in.Response)),
+				Request:       req,
+			}, nil
+		}
+		return nil, fmt.Errorf("no recorded response for %s %s", req.Method, req.URL)
+	}
+
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	header := resp.Header.Clone()
+	header.Del("Set-Cookie")
+	line, _ := json.Marshal(interaction{
+		Method: req.Method, URL: req.URL.String(), Body: string(body),
+		Status: resp.StatusCode, Header: header, Response: string(respBody),
+	})
+	if _, err := c.out.Write(append(line, '\n')); err != nil {
+		return nil, fmt.Errorf("recording: %w", err)
+	}
+	return resp, nil
+}
+
+func main() {
+	token := flag.String("token", "", "GitHub token")
+	owner := flag.String("owner", "", "repo owner")
+	repo := flag.String("repo", "", "repo name")
+	prNumber := flag.Int("pr", 0, "PR number")
+	maxBehind := flag.Int("max-behind", 10, "most commits the head may be behind base")
+	rebasedWithin := flag.Duration("rebased-within", 0, "also accept a head committed this recently, e.g. 2h (0 disables)")
+	update := flag.Bool("update-branch", false, "update a stale branch from base instead of refusing it")
+	wait := flag.Duration("wait", 2*time.Minute, "how long to wait for the updated head")
+	dryRun := flag.Bool("dry-run", false, "check freshness without changing the PR")
+	stack := flag.Bool("stack", false, "queue the PR's whole stack bottom-up, retargeting PRs whose parent merged")
+	status := flag.Bool("status", false, "print the PR's stack and exit")
+	watch := flag.Duration("watch", 0, "with -stack, repeat at this interval until every PR in the stack has merged")
+	windowsFile := flag.String("windows", "", "merge window configuration file")
+	override := flag.String("override-window", "", "queue inside a closed merge window; the justification is posted on the PR")
+	record := flag.String("record", "", "record GitHub API calls to this cassette file")
+	replay := flag.String("replay", "", "answer GitHub API calls from this cassette file instead of the network")
+	flag.Parse()
+
+	ctx := context.Background()
+	if *record != "" || *replay != "" {
+		c, err := newCassette(*record, *replay)
+		if err != nil {
+			log.Fatalf("Opening cassette failed: %v", err)
+		}
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: c})
+	}
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: *token})
+	client := github.NewClient(oauth2.NewClient(ctx, ts))
+
+	o := queueOptions{maxBehind: *maxBehind, rebasedWithin: *rebasedWithin, update: *update, wait: *wait, dryRun: *dryRun,
+		override: *override, overridden: make(map[int]bool)}
+	if *windowsFile != "" {
+		var err error
+		if o.windows, err = loadWindows(*windowsFile); err != nil {
+			log.Fatalf("Loading merge windows failed: %v", err)
+		}
+	}
+
+	if *status {
+		prs, err := listOpen(ctx, client, *owner, *repo)
+		if err != nil {
+			log.Fatalf("Listing PRs failed: %v", err)
+		}
+		for _, n := range buildStacks(prs, *owner+"/"+*repo) {
+			if n.contains(map[int]bool{*prNumber: true}) {
+				n.print(os.Stdout, "", nil)
+				return
+			}
+		}
+		log.Fatalf("PR #%d is not open", *prNumber)
+	}
+
+	if *stack {
+		tracked := map[int]bool{*prNumber: true}
+		queued := make(map[int]bool)
+		parents := make(map[string]*github.PullRequest)
+		for {
+			open, err := runStack(ctx, client, *owner, *repo, tracked, queued, parents, o)
+			if err != nil {
+				log.Fatalf("Processing stack failed: %v", err)
+			}
+			if !open {
+				fmt.Println("Every PR in the stack has merged or closed")
+				return
+			}
+			if *watch == 0 {
+				return
+			}
+			time.Sleep(*watch)
+		}
+	}
+
+	pr, _, err := client.PullRequests.Get(ctx, *owner, *repo, *prNumber)
+	if err != nil {
+		log.Fatalf("Fetching PR failed: %v", err)
+	}
+	if pr.GetState() != "open" || pr.GetDraft() {
+		log.Fatalf("PR #%d is not open and ready for review", pr.GetNumber())
+	}
+	ok, err := queue(ctx, client, *owner, *repo, pr, o)
+	if err != nil {
+		log.Fatalf("PR #%d: %v", pr.GetNumber(), err)
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
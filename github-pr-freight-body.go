@@ -0,0 +1,242 @@
+// renders a Kargo Freight summary into a release PR body, between markers
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/google/go-github/v57/github"
+	"golang.org/x/oauth2"
+)
+
+const (
+	startMarker = "<!-- kargo-freight:start -->"
+	endMarker   = "<!-- kargo-freight:end -->"
+
+	// getFreightPath is the Connect RPC route of the Kargo API server. Connect
+	// accepts plain JSON for unary calls, so no generated client is needed.
+	getFreightPath = "/akuity.io.kargo.service.v1alpha1.KargoService/GetFreight"
+)
+
+const defaultTemplate = `## Freight {{ .Freight.Alias }} ({{ .Freight.Metadata.Name }})
+
+Origin: {{ .Freight.Origin.Kind }}/{{ .Freight.Origin.Name }}
+{{ if .Freight.Images }}
+### Images
+| Repository | Tag | Digest |
+|---|---|---|
+{{- range .Freight.Images }}
+| {{ .RepoURL | cell }} | {{ .Tag | cell }} | {{ .Digest | cell }} |
+{{- end }}
+{{ end }}{{ if .Freight.Charts }}
+### Charts
+| Repository | Name | Version |
+|---|---|---|
+{{- range .Freight.Charts }}
+| {{ .RepoURL | cell }} | {{ .Name | cell }} | {{ .Version | cell }} |
+{{- end }}
+{{ end }}{{ if .Freight.Commits }}
+### Commits
+| Repository | Commit | Message |
+|---|---|---|
+{{- range .Freight.Commits }}
+| {{ .RepoURL | cell }} | {{ .ID | cell }} | {{ .Message | cell }} |
+{{- end }}
+{{ end }}
+### Promotion checklist
+{{- range .Stages }}
+- [{{ if .Verified }}x{{ else }} {{ end }}] {{ .Name }}{{ if .Current }} (currently deployed){{ end }}
+{{- end }}
+`
+
+// cellEscaper keeps a value inside one Markdown table cell: a pipe would
+// end the cell and a newline the row.
+var cellEscaper = strings.NewReplacer("|", `\|`, "\r\n", " ", "\n", " ", "\r", " ")
+
+// templateFuncs are available to the template; cell escapes a value for a
+// table cell.
+var templateFuncs = template.FuncMap{
+	"cell": cellEscaper.Replace,
+}
+
+type Freight struct {
+	Metadata struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"metadata"`
+	Alias  string `json:"alias"`
+	Origin struct {
+		Kind string `json:"kind"`
+		Name string `json:"name"`
+	} `json:"origin"`
+	Commits []struct {
+		RepoURL string `json:"repoURL"`
+		ID      string `json:"id"`
+		Tag     string `json:"tag"`
+		Message string `json:"message"`
+	} `json:"commits"`
+	Images []struct {
+		RepoURL string `json:"repoURL"`
+		Tag     string `json:"tag"`
+		Digest  string `json:"digest"`
+	} `json:"images"`
+	Charts []struct {
+		RepoURL string `json:"repoURL"`
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"charts"`
+	Status struct {
+		VerifiedIn  map[string]any `json:"verifiedIn"`
+		CurrentlyIn map[string]any `json:"currentlyIn"`
+	} `json:"status"`
+}
+
+type StageItem struct {
+	Name     string
+	Verified bool
+	Current  bool
+}
+
+func getFreight(ctx context.Context, apiURL, token, project, name string) (*Freight, error) {
+	reqBody, _ := json.Marshal(map[string]string{"project": project, "name": name})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		strings.TrimSuffix(apiURL, "/")+getFreightPath, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("calling Kargo API: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Kargo API returned %s", resp.Status)
+	}
+
+	var out struct {
+		Freight *Freight `json:"freight"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decoding Freight: %w", err)
+	}
+	if out.Freight == nil {
+		return nil, fmt.Errorf("freight %s/%s not found", project, name)
+	}
+	return out.Freight, nil
+}
+
+// replaceSection swaps the text between the markers for section, appending a
+// new marked section if the body does not have one yet.
+func replaceSection(body, section string) string {
+	block := startMarker + "\n" + section + "\n" + endMarker
+	start := strings.Index(body, startMarker)
+	end := strings.Index(body, endMarker)
+	if start == -1 || end == -1 || end < start {
+		if body == "" {
+			return block
+		}
+		return strings.TrimRight(body, "\n") + "\n\n" + block
+	}
+	return body[:start] + block + body[end+len(endMarker):]
+}
+
+func main() {
+	prNumber := flag.Int("pr", 0, "PR number")
+	token := flag.String("token", "", "GitHub token")
+	owner := flag.String("owner", "", "repo owner")
+	repo := flag.String("repo", "", "repo name")
+	kargoURL := flag.String("kargo-url", "https://localhost:31444", "Kargo API server URL")
+	kargoToken := flag.String("kargo-token", os.Getenv("KARGO_TOKEN"), "Kargo API bearer token")
+	project := flag.String("project", "", "Kargo project")
+	freightName := flag.String("freight", "", "Freight name")
+	stages := flag.String("stages", "", "comma-separated target stages, in promotion order")
+	tmplFile := flag.String("template", "", "template file (defaults to the built-in one); the cell function escapes values for table cells")
+	dryRun := flag.Bool("dry-run", false, "print the rendered section instead of updating the PR")
+	flag.Parse()
+
+	ctx := context.Background()
+
+	freight, err := getFreight(ctx, *kargoURL, *kargoToken, *project, *freightName)
+	if err != nil {
+		log.Fatalf("Fetching freight failed: %v", err)
+	}
+
+	tmplText := defaultTemplate
+	if *tmplFile != "" {
+		b, err := os.ReadFile(*tmplFile)
+		if err != nil {
+			log.Fatalf("Reading template failed: %v", err)
+		}
+		tmplText = string(b)
+	}
+	tmpl, err := template.New("freight").Funcs(templateFuncs).Parse(tmplText)
+	if err != nil {
+		log.Fatalf("Parsing template failed: %v", err)
+	}
+
+	var stageNames []string
+	if *stages != "" {
+		stageNames = strings.Split(*stages, ",")
+	} else {
+		for name := range freight.Status.CurrentlyIn {
+			stageNames = append(stageNames, name)
+		}
+		sort.Strings(stageNames)
+	}
+	var items []StageItem
+	for _, name := range stageNames {
+		name = strings.TrimSpace(name)
+		_, verified := freight.Status.VerifiedIn[name]
+		_, current := freight.Status.CurrentlyIn[name]
+		items = append(items, StageItem{Name: name, Verified: verified, Current: current})
+	}
+
+	var section bytes.Buffer
+	if err := tmpl.Execute(&section, map[string]any{
+		"Freight": freight,
+		"Stages":  items,
+	}); err != nil {
+		log.Fatalf("Rendering template failed: %v", err)
+	}
+
+	if *dryRun {
+		fmt.Println(section.String())
+		return
+	}
+
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: *token})
+	client := github.NewClient(oauth2.NewClient(ctx, ts))
+
+	pr, _, err := client.PullRequests.Get(ctx, *owner, *repo, *prNumber)
+	if err != nil {
+		log.Fatalf("Fetching PR failed: %v", err)
+	}
+
+	newBody := replaceSection(pr.GetBody(), strings.TrimSpace(section.String()))
+	if newBody == pr.GetBody() {
+		fmt.Println("PR body already up to date")
+		return
+	}
+
+	_, _, err = client.PullRequests.Edit(ctx, *owner, *repo, *prNumber, &github.PullRequest{
+		Body: github.String(newBody),
+	})
+	if err != nil {
+		log.Fatalf("Update failed: %v", err)
+	}
+	fmt.Printf("Updated PR #%d with freight %s\n", *prNumber, freight.Metadata.Name)
+}
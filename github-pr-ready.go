@@ -0,0 +1,519 @@
+// marks a draft PR ready for review once its checks, labels, linked issue, reviews and mergeability pass
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+	"golang.org/x/oauth2"
+)
+
+var linkedIssueRe = regexp.MustCompile(`(?i)\b(?:close[sd]?|fix(?:e[sd])?|resolve[sd]?)\s+#(\d+)`)
+
+// codeownersPaths are where GitHub looks for CODEOWNERS, in order.
+var codeownersPaths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// Gate is one readiness condition and whether the PR meets it.
+type Gate struct {
+	Name   string
+	OK     bool
+	Detail string
+}
+
+func isNotFound(resp *github.Response) bool {
+	return resp != nil && resp.StatusCode == http.StatusNotFound
+}
+
+// getPR fetches the PR, waiting briefly while GitHub still computes its
+// mergeability.
+func getPR(ctx context.Context, client *github.Client, owner, repo string, number int) (*github.PullRequest, error) {
+	for attempt := 0; ; attempt++ {
+		pr, _, err := client.PullRequests.Get(ctx, owner, repo, number)
+		if err != nil {
+			return nil, err
+		}
+		if pr.Mergeable != nil || attempt == 4 {
+			return pr, nil
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
+
+// checkGate passes when every named check run or status context on the
+// head commit succeeded.
+func checkGate(ctx context.Context, client *github.Client, owner, repo, sha string, names []string) Gate {
+	gate := Gate{Name: "checks"}
+	results := make(map[string]string)
+	status, _, err := client.Repositories.GetCombinedStatus(ctx, owner, repo, sha, &github.ListOptions{PerPage: 100})
+	if err != nil {
+		gate.Detail = err.Error()
+		return gate
+	}
+	for _, s := range status.Statuses {
+		results[s.GetContext()] = s.GetState()
+	}
+	runs, _, err := client.Checks.ListCheckRunsForRef(ctx, owner, repo, sha,
+		&github.ListCheckRunsOptions{Filter: github.String("latest"), ListOptions: github.ListOptions{PerPage: 100}})
+	if err != nil {
+		gate.Detail = err.Error()
+		return gate
+	}
+	for _, r := range runs.CheckRuns {
+		if r.GetStatus() != "completed" {
+			results[r.GetName()] = r.GetStatus()
+		} else {
+			results[r.GetName()] = r.GetConclusion()
+		}
+	}
+
+	var failing []string
+	for _, name := range names {
+		switch state, ok := results[name]; {
+		case !ok:
+			failing = append(failing, name+" missing")
+		case state != "success" && state != "skipped" && state != "neutral":
+			failing = append(failing, name+" "+state)
+		}
+	}
+	gate.OK = len(failing) == 0
+	gate.Detail = strings.Join(failing, ", ")
+	return gate
+}
+
+func labelGate(pr *github.PullRequest, required []string) Gate {
+	var missing []string
+	for _, want := range required {
+		if !slices.ContainsFunc(pr.Labels, func(l *github.Label) bool { return strings.EqualFold(l.GetName(), want) }) {
+			missing = append(missing, want)
+		}
+	}
+	gate := Gate{Name: "labels", OK: len(missing) == 0}
+	if !gate.OK {
+		gate.Detail = "missing " + strings.Join(missing, ", ")
+	}
+	return gate
+}
+
+// issueGate passes when the body closes an issue that exists in the repo.
+func issueGate(ctx context.Context, client *github.Client, owner, repo, body string) Gate {
+	gate := Gate{Name: "linked issue", Detail: "no closing keyword such as \"Fixes #123\" in the description"}
+	for _, m := range linkedIssueRe.FindAllStringSubmatch(body, -1) {
+		number, _ := strconv.Atoi(m[1])
+		issue, resp, err := client.Issues.Get(ctx, owner, repo, number)
+		switch {
+		case isNotFound(resp):
+			gate.Detail = "#" + m[1] + " does not exist"
+		case err != nil:
+			gate.Detail = err.Error()
+		case issue.IsPullRequest():
+			gate.Detail = "#" + m[1] + " is a pull request, not an issue"
+		default:
+			return Gate{Name: gate.Name, OK: true, Detail: "#" + m[1] + " (" + issue.GetState() + ")"}
+		}
+	}
+	return gate
+}
+
+// reviewGate passes with at least want approvals, counting each reviewer's
+// latest review, and no outstanding change requests.
+func reviewGate(ctx context.Context, client *github.Client, owner, repo string, number, want int) Gate {
+	gate := Gate{Name: "reviews"}
+	latest := make(map[string]string)
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		reviews, resp, err := client.PullRequests.ListReviews(ctx, owner, repo, number, opts)
+		if err != nil {
+			gate.Detail = err.Error()
+			return gate
+		}
+		for _, r := range reviews {
+			// Comments do not change a reviewer's verdict.
+			if r.GetState() != "COMMENTED" {
+				latest[r.GetUser().GetLogin()] = r.GetState()
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	approvals := 0
+	var blocking []string
+	for login, state := range latest {
+		switch state {
+		case "APPROVED":
+			approvals++
+		case "CHANGES_REQUESTED":
+			blocking = append(blocking, login)
+		}
+	}
+	slices.Sort(blocking)
+	gate.OK = approvals >= want && len(blocking) == 0
+	gate.Detail = fmt.Sprintf("%d of %d approvals", approvals, want)
+	if len(blocking) > 0 {
+		gate.Detail += "; changes requested by " + strings.Join(blocking, ", ")
+	}
+	return gate
+}
+
+func mergeableGate(pr *github.PullRequest) Gate {
+	switch {
+	case pr.Mergeable == nil:
+		return Gate{Name: "mergeable", Detail: "GitHub has not computed mergeability yet"}
+	case !pr.GetMergeable() || pr.GetMergeableState() == "dirty":
+		return Gate{Name: "mergeable", Detail: "conflicts with " + pr.GetBase().GetRef()}
+	}
+	return Gate{Name: "mergeable", OK: true}
+}
+
+// markReady flips a draft PR to ready for review, which only the GraphQL
+// API can do.
+func markReady(ctx context.Context, client *github.Client, pr *github.PullRequest) error {
+	req, err := client.NewRequest(http.MethodPost, "graphql", map[string]any{
+		"query":     `mutation($id: ID!) { markPullRequestReadyForReview(input: {pullRequestId: $id}) { pullRequest { isDraft } } }`,
+		"variables": map[string]string{"id": pr.GetNodeID()},
+	})
+	if err != nil {
+		return err
+	}
+	var out struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if _, err := client.Do(ctx, req, &out); err != nil {
+		return err
+	}
+	if len(out.Errors) > 0 {
+		return errors.New(out.Errors[0].Message)
+	}
+	return nil
+}
+
+// codeownersMatch reports whether a CODEOWNERS pattern matches file. It
+// covers the common forms: "*", "*.go", "docs/", "/build/" and
+// "apps/*/values.yaml"; a pattern with a slash other than a trailing one
+// is anchored at the repository root.
+func codeownersMatch(pattern, file string) bool {
+	p := strings.TrimSuffix(strings.TrimSuffix(pattern, "/**"), "/")
+	anchored := strings.Contains(p, "/")
+	p = strings.TrimPrefix(p, "/")
+	segs := strings.Split(file, "/")
+	for i := range segs {
+		if anchored {
+			// The file itself or a directory holding it.
+			if ok, _ := path.Match(p, strings.Join(segs[:i+1], "/")); ok {
+				return true
+			}
+		} else if ok, _ := path.Match(p, segs[i]); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// codeowners returns the owners of files; as in GitHub, the last matching
+// line of CODEOWNERS decides each file.
+func codeowners(file []byte, files []string) []string {
+	type rule struct {
+		pattern string
+		owners  []string
+	}
+	var rules []rule
+	for _, line := range strings.Split(string(file), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		rules = append(rules, rule{pattern: fields[0], owners: fields[1:]})
+	}
+	var out []string
+	for _, f := range files {
+		for i := len(rules) - 1; i >= 0; i-- {
+			if codeownersMatch(rules[i].pattern, f) {
+				for _, o := range rules[i].owners {
+					if !slices.Contains(out, o) {
+						out = append(out, o)
+					}
+				}
+				break
+			}
+		}
+	}
+	return out
+}
+
+// requestCodeowners asks the code owners of the changed files, other than
+// the author, for review. Owners given by email are skipped; GitHub cannot
+// request reviews from them.
+func requestCodeowners(ctx context.Context, client *github.Client, owner, repo string, pr *github.PullRequest) ([]string, error) {
+	base := pr.GetBase().GetRef()
+	var file string
+	for _, p := range codeownersPaths {
+		content, _, resp, err := client.Repositories.GetContents(ctx, owner, repo, p, &github.RepositoryContentGetOptions{Ref: base})
+		if isNotFound(resp) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", p, err)
+		}
+		if file, err = content.GetContent(); err != nil {
+			return nil, fmt.Errorf("decoding %s: %w", p, err)
+		}
+		break
+	}
+	if file == "" {
+		return nil, errors.New("no CODEOWNERS file on " + base)
+	}
+
+	var files []string
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		batch, resp, err := client.PullRequests.ListFiles(ctx, owner, repo, pr.GetNumber(), opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range batch {
+			files = append(files, f.GetFilename())
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	var users, teams []string
+	for _, o := range codeowners([]byte(file), files) {
+		name, ok := strings.CutPrefix(o, "@")
+		switch {
+		case !ok:
+		case strings.Contains(name, "/"):
+			_, slug, _ := strings.Cut(name, "/")
+			teams = append(teams, slug)
+		case !strings.EqualFold(name, pr.GetUser().GetLogin()):
+			users = append(users, name)
+		}
+	}
+	if len(users) == 0 && len(teams) == 0 {
+		return nil, nil
+	}
+	_, _, err := client.PullRequests.RequestReviewers(ctx, owner, repo, pr.GetNumber(),
+		github.ReviewersRequest{Reviewers: users, TeamReviewers: teams})
+	return append(users, teams...), err
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// interaction is one recorded GitHub API call. Request headers, which carry
+// the token, are not recorded.
+type interaction struct {
+	Method   string      `json:"method"`
+	URL      string      `json:"url"`
+	Body     string      `json:"body,omitempty"`
+	Status   int         `json:"status"`
+	Header   http.Header `json:"header,omitempty"`
+	Response string      `json:"response"`
+}
+
+// cassette is an http.RoundTripper that appends every call to a file, one
+// JSON interaction per line, or answers calls from such a file without
+// touching the network. Replay hands out each interaction once, in
+// recorded order among calls with the same method, URL and body.
+type cassette struct {
+	mu     sync.Mutex
+	out    *os.File
+	tape   []interaction
+	played []bool
+}
+
+func newCassette(record, replay string) (*cassette, error) {
+	if record != "" {
+		f, err := os.Create(record)
+		if err != nil {
+			return nil, err
+		}
+		return &cassette{out: f}, nil
+	}
+	data, err := os.ReadFile(replay)
+	if err != nil {
+		return nil, err
+	}
+	c := &cassette{}
+	for i, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var in interaction
+		if err := json.Unmarshal([]byte(line), &in); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", replay, i+1, err)
+		}
+		c.tape = append(c.tape, in)
+	}
+	c.played = make([]bool, len(c.tape))
+	return c, nil
+}
+
+func (c *cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.out == nil {
+		for i, in := range c.tape {
+			if c.played[i] || in.Method != req.Method || in.URL != req.URL.String() || in.Body != string(body) {
+				continue
+			}
+			c.played[i] = true
+			return &http.Response{
+				Status:        fmt.Sprintf("%d %s", in.Status, http.StatusText(in.Status)),
+				StatusCode:    in.Status,
+				Proto:         "HTTP/1.1",
+				ProtoMajor:    1,
+				ProtoMinor:    1,
+				Header:        in.Header.Clone(),
+				Body:          io.NopCloser(strings.NewReader(in.Response)),
+				ContentLength: int64(len(in.Response)),
+				Request:       req,
+			}, nil
+		}
+		return nil, fmt.Errorf("no recorded response for %s %s", req.Method, req.URL)
+	}
+
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	header := resp.Header.Clone()
+	header.Del("Set-Cookie")
+	line, _ := json.Marshal(interaction{
+		Method: req.Method, URL: req.URL.String(), Body: string(body),
+		Status: resp.StatusCode, Header: header, Response: string(respBody),
+	})
+	if _, err := c.out.Write(append(line, '\n')); err != nil {
+		return nil, fmt.Errorf("recording: %w", err)
+	}
+	return resp, nil
+}
+
+func main() {
+	token := flag.String("token", "", "GitHub token")
+	owner := flag.String("owner", "", "repo owner")
+	repo := flag.String("repo", "", "repo name")
+	prNumber := flag.Int("pr", 0, "PR number")
+	checks := flag.String("checks", "lint", "comma-separated check runs or status contexts that must pass")
+	labels := flag.String("labels", "", "comma-separated labels the PR must carry")
+	requireIssue := flag.Bool("require-issue", false, "require the description to close an existing issue")
+	minApprovals := flag.Int("min-approvals", 0, "approving reviews required; change requests always block")
+	requestOwners := flag.Bool("request-codeowners", false, "request reviews from the code owners of the changed files once ready")
+	dryRun := flag.Bool("dry-run", false, "report the gates without changing the PR")
+	record := flag.String("record", "", "record GitHub API calls to this cassette file")
+	replay := flag.String("replay", "", "answer GitHub API calls from this cassette file instead of the network")
+	flag.Parse()
+
+	ctx := context.Background()
+	if *record != "" || *replay != "" {
+		c, err := newCassette(*record, *replay)
+		if err != nil {
+			log.Fatalf("Opening cassette failed: %v", err)
+		}
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: c})
+	}
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: *token})
+	client := github.NewClient(oauth2.NewClient(ctx, ts))
+
+	pr, err := getPR(ctx, client, *owner, *repo, *prNumber)
+	if err != nil {
+		log.Fatalf("Fetching PR failed: %v", err)
+	}
+	if pr.GetState() != "open" {
+		log.Fatalf("PR #%d is %s", pr.GetNumber(), pr.GetState())
+	}
+
+	var gates []Gate
+	if names := splitList(*checks); len(names) > 0 {
+		gates = append(gates, checkGate(ctx, client, *owner, *repo, pr.GetHead().GetSHA(), names))
+	}
+	if required := splitList(*labels); len(required) > 0 {
+		gates = append(gates, labelGate(pr, required))
+	}
+	if *requireIssue {
+		gates = append(gates, issueGate(ctx, client, *owner, *repo, pr.GetBody()))
+	}
+	gates = append(gates, reviewGate(ctx, client, *owner, *repo, pr.GetNumber(), *minApprovals))
+	gates = append(gates, mergeableGate(pr))
+
+	ready := true
+	for _, gate := range gates {
+		mark := "ok"
+		if !gate.OK {
+			mark, ready = "FAIL", false
+		}
+		fmt.Printf("%-4s %s", mark, gate.Name)
+		if gate.Detail != "" {
+			fmt.Printf(": %s", gate.Detail)
+		}
+		fmt.Println()
+	}
+	if !ready {
+		fmt.Printf("PR #%d is not ready for review\n", pr.GetNumber())
+		os.Exit(1)
+	}
+	if *dryRun {
+		fmt.Printf("PR #%d passes every gate\n", pr.GetNumber())
+		return
+	}
+
+	if pr.GetDraft() {
+		if err := markReady(ctx, client, pr); err != nil {
+			log.Fatalf("Marking PR ready failed: %v", err)
+		}
+		fmt.Printf("Marked PR #%d ready for review\n", pr.GetNumber())
+	} else {
+		fmt.Printf("PR #%d is already ready for review\n", pr.GetNumber())
+	}
+	if *requestOwners {
+		requested, err := requestCodeowners(ctx, client, *owner, *repo, pr)
+		if err != nil {
+			log.Fatalf("Requesting code owner reviews failed: %v", err)
+		}
+		if len(requested) > 0 {
+			fmt.Printf("Requested reviews from %s\n", strings.Join(requested, ", "))
+		}
+	}
+}
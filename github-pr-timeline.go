@@ -0,0 +1,466 @@
+// prints a PR's path from opened to production: reviews, checks, merge queue, merge, image builds and promotions
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+	"golang.org/x/oauth2"
+)
+
+// Connect accepts plain JSON for unary calls, so no generated client is
+// needed.
+const (
+	queryFreightPath   = "/akuity.io.kargo.service.v1alpha1.KargoService/QueryFreight"
+	listPromotionsPath = "/akuity.io.kargo.service.v1alpha1.KargoService/ListPromotions"
+)
+
+// Entry is one step in the timeline.
+type Entry struct {
+	At     time.Time
+	Source string
+	What   string
+}
+
+type Freight struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Alias   string `json:"alias"`
+	Commits []struct {
+		ID string `json:"id"`
+	} `json:"commits"`
+	Images []struct {
+		RepoURL string `json:"repoURL"`
+		Tag     string `json:"tag"`
+	} `json:"images"`
+}
+
+type Promotion struct {
+	Metadata struct {
+		CreationTimestamp time.Time `json:"creationTimestamp"`
+	} `json:"metadata"`
+	Spec struct {
+		Stage   string `json:"stage"`
+		Freight string `json:"freight"`
+	} `json:"spec"`
+	Status struct {
+		Phase      string     `json:"phase"`
+		FinishedAt *time.Time `json:"finishedAt"`
+	} `json:"status"`
+}
+
+// StoredEvent is an event as the webhook receiver's /events API returns it.
+type StoredEvent struct {
+	ReceivedAt time.Time `json:"receivedAt"`
+	Event      struct {
+		Provider   string `json:"provider"`
+		Type       string `json:"type"`
+		Registry   string `json:"registry"`
+		Repository string `json:"repository"`
+		Tag        string `json:"tag"`
+		Ref        string `json:"ref"`
+		Action     string `json:"action"`
+	} `json:"event"`
+	Delivered bool   `json:"delivered"`
+	Error     string `json:"error"`
+}
+
+// githubEntries covers the PR's own history: opening, drafts, reviews, the
+// merge queue and the merge.
+func githubEntries(ctx context.Context, client *github.Client, owner, repo string, pr *github.PullRequest) ([]Entry, error) {
+	out := []Entry{{At: pr.GetCreatedAt().Time, Source: "github", What: "opened by @" + pr.GetUser().GetLogin()}}
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		events, resp, err := client.Issues.ListIssueTimeline(ctx, owner, repo, pr.GetNumber(), opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range events {
+			var what string
+			switch e.GetEvent() {
+			case "ready_for_review":
+				what = "marked ready for review"
+			case "convert_to_draft":
+				what = "converted to draft"
+			case "reviewed":
+				what = strings.ToLower(strings.ReplaceAll(e.GetState(), "_", " ")) + " by @" + e.GetActor().GetLogin()
+			case "head_ref_force_pushed":
+				what = "head force-pushed"
+			case "added_to_merge_queue":
+				what = "added to the merge queue"
+			case "removed_from_merge_queue":
+				what = "removed from the merge queue"
+			case "merged":
+				what = "merged as " + shortSHA(e.GetCommitID())
+			case "closed", "reopened":
+				what = e.GetEvent()
+			default:
+				continue
+			}
+			out = append(out, Entry{At: e.GetCreatedAt().Time, Source: "github", What: what})
+		}
+		if resp.NextPage == 0 {
+			return out, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// checkEntries lists the finished check runs on sha.
+func checkEntries(ctx context.Context, client *github.Client, owner, repo, sha, label string) ([]Entry, error) {
+	var out []Entry
+	opts := &github.ListCheckRunsOptions{Filter: github.String("all"), ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		runs, resp, err := client.Checks.ListCheckRunsForRef(ctx, owner, repo, sha, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range runs.CheckRuns {
+			if r.GetStatus() == "completed" {
+				out = append(out, Entry{At: r.GetCompletedAt().Time, Source: "checks", What: fmt.Sprintf("%s %s on %s", r.GetName(), r.GetConclusion(), label)})
+			}
+		}
+		if resp.NextPage == 0 {
+			return out, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// receiverEntries asks the webhook receiver for the events it ingested for
+// the given commits: source control events carrying one of them as
+// revision, and image pushes whose tag contains one's short SHA, which is
+// how CI tags builds.
+func receiverEntries(ctx context.Context, baseURL, token string, shas []string) ([]Entry, error) {
+	var terms []string
+	for _, sha := range shas {
+		terms = append(terms, fmt.Sprintf("revision == %q", sha), fmt.Sprintf("(type == \"push\" && tag.contains(%q))", shortSHA(sha)))
+	}
+	q := url.Values{"q": {strings.Join(terms, " || ")}, "limit": {"500"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(baseURL, "/")+"/events?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("calling receiver: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("receiver returned %s", resp.Status)
+	}
+	var page struct {
+		Events []StoredEvent `json:"events"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return nil, fmt.Errorf("decoding events: %w", err)
+	}
+
+	var out []Entry
+	for _, e := range page.Events {
+		var what string
+		switch ev := e.Event; ev.Type {
+		case "push":
+			what = "image " + strings.TrimPrefix(ev.Registry+"/", "/") + ev.Repository + ":" + ev.Tag + " pushed"
+		default:
+			what = strings.TrimSpace(ev.Type+" "+ev.Action) + " on " + ev.Repository
+			if ev.Ref != "" {
+				what += " " + ev.Ref
+			}
+		}
+		what += " (" + e.Event.Provider + ")"
+		if !e.Delivered && e.Error != "" {
+			what += ", delivery failed: " + e.Error
+		}
+		out = append(out, Entry{At: e.ReceivedAt, Source: "receiver", What: what})
+	}
+	return out, nil
+}
+
+func kargoCall(ctx context.Context, apiURL, token, path string, in, out any) error {
+	reqBody, _ := json.Marshal(in)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		strings.TrimSuffix(apiURL, "/")+path, bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("calling Kargo API: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Kargo API returned %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// kargoEntries finds the Freight that carries one of the commits, directly or
+// as an image tagged with its short SHA, and lists its promotions.
+func kargoEntries(ctx context.Context, apiURL, token, project string, shas []string) ([]Entry, error) {
+	var freight struct {
+		Groups map[string]struct {
+			Freight []Freight `json:"freight"`
+		} `json:"groups"`
+	}
+	if err := kargoCall(ctx, apiURL, token, queryFreightPath, map[string]string{"project": project}, &freight); err != nil {
+		return nil, err
+	}
+	carries := func(f Freight) bool {
+		for _, sha := range shas {
+			for _, c := range f.Commits {
+				if c.ID == sha {
+					return true
+				}
+			}
+			for _, i := range f.Images {
+				if strings.Contains(i.Tag, shortSHA(sha)) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	names := make(map[string]string)
+	for _, g := range freight.Groups {
+		for _, f := range g.Freight {
+			if carries(f) {
+				names[f.Metadata.Name] = f.Alias
+			}
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	var promotions struct {
+		Promotions []Promotion `json:"promotions"`
+	}
+	if err := kargoCall(ctx, apiURL, token, listPromotionsPath, map[string]string{"project": project}, &promotions); err != nil {
+		return nil, err
+	}
+	var out []Entry
+	for _, p := range promotions.Promotions {
+		alias, ok := names[p.Spec.Freight]
+		if !ok {
+			continue
+		}
+		if alias == "" {
+			alias = p.Spec.Freight
+		}
+		at := p.Metadata.CreationTimestamp
+		if p.Status.FinishedAt != nil {
+			at = *p.Status.FinishedAt
+		}
+		phase := p.Status.Phase
+		if phase == "" {
+			phase = "Pending"
+		}
+		out = append(out, Entry{At: at, Source: "kargo", What: fmt.Sprintf("freight %s promoted to %s: %s", alias, p.Spec.Stage, phase)})
+	}
+	return out, nil
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
+// interaction is one recorded GitHub API call. Request headers, which carry
+// the token, are not recorded.
+type interaction struct {
+	Method   string      `json:"method"`
+	URL      string      `json:"url"`
+	Body     string      `json:"body,omitempty"`
+	Status   int         `json:"status"`
+	Header   http.Header `json:"header,omitempty"`
+	Response string      `json:"response"`
+}
+
+// cassette is an http.RoundTripper that appends every call to a file, one
+// JSON interaction per line, or answers calls from such a file without
+// touching the network. Replay hands out each interaction once, in
+// recorded order among calls with the same method, URL and body.
+type cassette struct {
+	mu     sync.Mutex
+	out    *os.File
+	tape   []interaction
+	played []bool
+}
+
+func newCassette(record, replay string) (*cassette, error) {
+	if record != "" {
+		f, err := os.Create(record)
+		if err != nil {
+			return nil, err
+		}
+		return &cassette{out: f}, nil
+	}
+	data, err := os.ReadFile(replay)
+	if err != nil {
+		return nil, err
+	}
+	c := &cassette{}
+	for i, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var in interaction
+		if err := json.Unmarshal([]byte(line), &in); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", replay, i+1, err)
+		}
+		c.tape = append(c.tape, in)
+	}
+	c.played = make([]bool, len(c.tape))
+	return c, nil
+}
+
+func (c *cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.out == nil {
+		for i, in := range c.tape {
+			if c.played[i] || in.Method != req.Method || in.URL != req.URL.String() || in.Body != string(body) {
+				continue
+			}
+			c.played[i] = true
+			return &http.Response{
+				Status:        fmt.Sprintf("%d %s", in.Status, http.StatusText(in.Status)),
+				StatusCode:    in.Status,
+				Proto:         "HTTP/1.1",
+				ProtoMajor:    1,
+				ProtoMinor:    1,
+				Header:        in.Header.Clone(),
+				Body:          io.NopCloser(strings.NewReader(in.Response)),
+				ContentLength: int64(len(in.Response)),
+				Request:       req,
+			}, nil
+		}
+		return nil, fmt.Errorf("no recorded response for %s %s", req.Method, req.URL)
+	}
+
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	header := resp.Header.Clone()
+	header.Del("Set-Cookie")
+	line, _ := json.Marshal(interaction{
+		Method: req.Method, URL: req.URL.String(), Body: string(body),
+		Status: resp.StatusCode, Header: header, Response: string(respBody),
+	})
+	if _, err := c.out.Write(append(line, '\n')); err != nil {
+		return nil, fmt.Errorf("recording: %w", err)
+	}
+	return resp, nil
+}
+
+func main() {
+	token := flag.String("token", "", "GitHub token")
+	owner := flag.String("owner", "", "repo owner")
+	repo := flag.String("repo", "", "repo name")
+	prNumber := flag.Int("pr", 0, "PR number")
+	receiverURL := flag.String("receiver-url", "", "webhook receiver URL; its /events API supplies image builds and deliveries")
+	receiverToken := flag.String("receiver-token", os.Getenv("RECEIVER_TOKEN"), "OIDC bearer token for the receiver's /events API")
+	kargoURL := flag.String("kargo-url", "https://localhost:31444", "Kargo API server URL")
+	kargoToken := flag.String("kargo-token", os.Getenv("KARGO_TOKEN"), "Kargo API bearer token")
+	project := flag.String("project", "", "Kargo project to look for promotions in (empty skips Kargo)")
+	record := flag.String("record", "", "record GitHub API calls to this cassette file")
+	replay := flag.String("replay", "", "answer GitHub API calls from this cassette file instead of the network")
+	flag.Parse()
+
+	ctx := context.Background()
+	if *record != "" || *replay != "" {
+		c, err := newCassette(*record, *replay)
+		if err != nil {
+			log.Fatalf("Opening cassette failed: %v", err)
+		}
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: c})
+	}
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: *token})
+	client := github.NewClient(oauth2.NewClient(ctx, ts))
+
+	pr, _, err := client.PullRequests.Get(ctx, *owner, *repo, *prNumber)
+	if err != nil {
+		log.Fatalf("Fetching PR failed: %v", err)
+	}
+	entries, err := githubEntries(ctx, client, *owner, *repo, pr)
+	if err != nil {
+		log.Fatalf("Reading PR timeline failed: %v", err)
+	}
+
+	// The head carries the PR's checks and builds; once merged, the merge
+	// commit carries the ones that lead to production.
+	shas := []string{pr.GetHead().GetSHA()}
+	labels := map[string]string{pr.GetHead().GetSHA(): "head " + shortSHA(pr.GetHead().GetSHA())}
+	if pr.GetMerged() && pr.GetMergeCommitSHA() != "" {
+		shas = append(shas, pr.GetMergeCommitSHA())
+		labels[pr.GetMergeCommitSHA()] = "merge " + shortSHA(pr.GetMergeCommitSHA())
+	}
+	for _, sha := range shas {
+		checks, err := checkEntries(ctx, client, *owner, *repo, sha, labels[sha])
+		if err != nil {
+			log.Fatalf("Listing check runs failed: %v", err)
+		}
+		entries = append(entries, checks...)
+	}
+
+	// The receiver and Kargo only add to the picture; the timeline is still
+	// useful without them.
+	if *receiverURL != "" {
+		events, err := receiverEntries(ctx, *receiverURL, *receiverToken, shas)
+		if err != nil {
+			log.Printf("Querying receiver failed: %v", err)
+		}
+		entries = append(entries, events...)
+	}
+	if *project != "" {
+		promotions, err := kargoEntries(ctx, *kargoURL, *kargoToken, *project, shas)
+		if err != nil {
+			log.Printf("Querying Kargo failed: %v", err)
+		}
+		entries = append(entries, promotions...)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].At.Before(entries[j].At) })
+	fmt.Printf("#%d %s\n", pr.GetNumber(), pr.GetTitle())
+	for _, e := range entries {
+		fmt.Printf("%s  %-8s  %s\n", e.At.Local().Format("2006-01-02 15:04:05"), e.Source, e.What)
+	}
+}
@@ -0,0 +1,270 @@
+// compiles release notes for a Freight from the PRs in its commit range
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/google/go-github/v57/github"
+	"golang.org/x/oauth2"
+)
+
+const getFreightPath = "/akuity.io.kargo.service.v1alpha1.KargoService/GetFreight"
+
+var (
+	linkedIssueRe  = regexp.MustCompile(`(?i)\b(?:close[sd]?|fix(?:e[sd])?|resolve[sd]?)\s+#(\d+)`)
+	githubRepoRe   = regexp.MustCompile(`github\.com[/:]([^/]+)/([^/]+?)(?:\.git)?/?$`)
+	breakingLabels = map[string]bool{"breaking-change": true, "breaking": true}
+)
+
+const notesTemplate = `# Release notes for Freight {{ .Freight }}
+{{ if .Breaking }}
+## ⚠️ Breaking changes
+{{- range .Breaking }}
+- {{ .Title }} (#{{ .Number }}) by @{{ .Author }}
+{{- end }}
+{{ end }}
+## Changes
+{{- range .PRs }}
+- {{ .Title }} ([{{ .Repo }}#{{ .Number }}]({{ .URL }})) by @{{ .Author }}{{ if .Issues }} — fixes {{ range $i, $n := .Issues }}{{ if $i }}, {{ end }}#{{ $n }}{{ end }}{{ end }}
+{{- end }}
+{{- if not .PRs }}
+- No pull requests found in the commit range.
+{{- end }}
+`
+
+type Commit struct {
+	RepoURL string `json:"repoURL"`
+	ID      string `json:"id"`
+}
+
+type Freight struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Alias   string   `json:"alias"`
+	Commits []Commit `json:"commits"`
+}
+
+type PRNote struct {
+	Repo     string
+	Number   int
+	Title    string
+	Author   string
+	URL      string
+	Issues   []string
+	Breaking bool
+}
+
+func getFreight(ctx context.Context, apiURL, token, project, name string) (*Freight, error) {
+	reqBody, _ := json.Marshal(map[string]string{"project": project, "name": name})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		strings.TrimSuffix(apiURL, "/")+getFreightPath, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("calling Kargo API: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Kargo API returned %s", resp.Status)
+	}
+
+	var out struct {
+		Freight *Freight `json:"freight"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decoding Freight: %w", err)
+	}
+	if out.Freight == nil {
+		return nil, fmt.Errorf("freight %s/%s not found", project, name)
+	}
+	return out.Freight, nil
+}
+
+// collectPRs returns the pull requests that introduced the commits between
+// base and head, deduplicated by number.
+func collectPRs(ctx context.Context, client *github.Client, owner, repo, base, head string) ([]PRNote, error) {
+	cmp, _, err := client.Repositories.CompareCommits(ctx, owner, repo, base, head, nil)
+	if err != nil {
+		return nil, fmt.Errorf("comparing %s...%s: %w", base, head, err)
+	}
+
+	seen := make(map[int]bool)
+	var notes []PRNote
+	for _, c := range cmp.Commits {
+		prs, _, err := client.PullRequests.ListPullRequestsWithCommit(ctx, owner, repo, c.GetSHA(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("listing PRs for %s: %w", c.GetSHA(), err)
+		}
+		for _, pr := range prs {
+			if seen[pr.GetNumber()] || pr.GetMergedAt().IsZero() {
+				continue
+			}
+			seen[pr.GetNumber()] = true
+
+			note := PRNote{
+				Repo:   owner + "/" + repo,
+				Number: pr.GetNumber(),
+				Title:  pr.GetTitle(),
+				Author: pr.GetUser().GetLogin(),
+				URL:    pr.GetHTMLURL(),
+			}
+			for _, m := range linkedIssueRe.FindAllStringSubmatch(pr.GetBody(), -1) {
+				note.Issues = append(note.Issues, m[1])
+			}
+			for _, l := range pr.Labels {
+				if breakingLabels[strings.ToLower(l.GetName())] {
+					note.Breaking = true
+				}
+			}
+			notes = append(notes, note)
+		}
+	}
+	return notes, nil
+}
+
+func postToSlack(ctx context.Context, webhookURL, text string) error {
+	body, _ := json.Marshal(map[string]string{"text": text})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Slack returned %s", resp.Status)
+	}
+	return nil
+}
+
+func writeRelease(ctx context.Context, client *github.Client, owner, repo, tag, body string) error {
+	rel, resp, err := client.Repositories.GetReleaseByTag(ctx, owner, repo, tag)
+	if err != nil && (resp == nil || resp.StatusCode != http.StatusNotFound) {
+		return err
+	}
+	if rel != nil {
+		_, _, err = client.Repositories.EditRelease(ctx, owner, repo, rel.GetID(), &github.RepositoryRelease{
+			Body: github.String(body),
+		})
+		return err
+	}
+	_, _, err = client.Repositories.CreateRelease(ctx, owner, repo, &github.RepositoryRelease{
+		TagName: github.String(tag),
+		Name:    github.String(tag),
+		Body:    github.String(body),
+	})
+	return err
+}
+
+func main() {
+	token := flag.String("token", "", "GitHub token")
+	kargoURL := flag.String("kargo-url", "https://localhost:31444", "Kargo API server URL")
+	kargoToken := flag.String("kargo-token", os.Getenv("KARGO_TOKEN"), "Kargo API bearer token")
+	project := flag.String("project", "", "Kargo project")
+	freightName := flag.String("freight", "", "Freight being promoted")
+	previousName := flag.String("previous", "", "Freight currently in the target stage (start of the commit range)")
+	slackWebhook := flag.String("slack-webhook", "", "Slack incoming webhook URL to post the notes to")
+	releaseRepo := flag.String("release-repo", "", "owner/repo to write a GitHub Release to")
+	releaseTag := flag.String("release-tag", "", "tag of the GitHub Release to create or update")
+	flag.Parse()
+
+	ctx := context.Background()
+
+	current, err := getFreight(ctx, *kargoURL, *kargoToken, *project, *freightName)
+	if err != nil {
+		log.Fatalf("Fetching freight failed: %v", err)
+	}
+	previous, err := getFreight(ctx, *kargoURL, *kargoToken, *project, *previousName)
+	if err != nil {
+		log.Fatalf("Fetching previous freight failed: %v", err)
+	}
+	base := make(map[string]string)
+	for _, c := range previous.Commits {
+		base[c.RepoURL] = c.ID
+	}
+
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: *token})
+	client := github.NewClient(oauth2.NewClient(ctx, ts))
+
+	var prs []PRNote
+	for _, c := range current.Commits {
+		m := githubRepoRe.FindStringSubmatch(c.RepoURL)
+		if m == nil {
+			log.Printf("Skipping non-GitHub repo %s", c.RepoURL)
+			continue
+		}
+		from, ok := base[c.RepoURL]
+		if !ok || from == c.ID {
+			continue
+		}
+		notes, err := collectPRs(ctx, client, m[1], m[2], from, c.ID)
+		if err != nil {
+			log.Fatalf("Collecting PRs failed: %v", err)
+		}
+		prs = append(prs, notes...)
+	}
+	sort.Slice(prs, func(i, j int) bool {
+		if prs[i].Repo != prs[j].Repo {
+			return prs[i].Repo < prs[j].Repo
+		}
+		return prs[i].Number < prs[j].Number
+	})
+
+	var breaking []PRNote
+	for _, pr := range prs {
+		if pr.Breaking {
+			breaking = append(breaking, pr)
+		}
+	}
+	name := current.Alias
+	if name == "" {
+		name = current.Metadata.Name
+	}
+
+	var out bytes.Buffer
+	tmpl := template.Must(template.New("notes").Parse(notesTemplate))
+	if err := tmpl.Execute(&out, map[string]any{
+		"Freight":  name,
+		"PRs":      prs,
+		"Breaking": breaking,
+	}); err != nil {
+		log.Fatalf("Rendering notes failed: %v", err)
+	}
+	notes := out.String()
+	fmt.Print(notes)
+
+	if *slackWebhook != "" {
+		if err := postToSlack(ctx, *slackWebhook, notes); err != nil {
+			log.Fatalf("Posting to Slack failed: %v", err)
+		}
+	}
+	if *releaseRepo != "" && *releaseTag != "" {
+		owner, repo, _ := strings.Cut(*releaseRepo, "/")
+		if err := writeRelease(ctx, client, owner, repo, *releaseTag, notes); err != nil {
+			log.Fatalf("Writing release failed: %v", err)
+		}
+		fmt.Printf("Wrote release %s to %s\n", *releaseTag, *releaseRepo)
+	}
+}
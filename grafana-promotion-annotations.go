@@ -0,0 +1,317 @@
+// writes Grafana annotations for Kargo promotions and incident windows, per stage dashboard
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// getFreightPath is the Connect RPC route of the Kargo API server. Connect
+// accepts plain JSON for unary calls, so no generated client is needed.
+const getFreightPath = "/akuity.io.kargo.service.v1alpha1.KargoService/GetFreight"
+
+type Freight struct {
+	Metadata struct {
+		Name              string    `json:"name"`
+		CreationTimestamp time.Time `json:"creationTimestamp"`
+	} `json:"metadata"`
+	Alias string `json:"alias"`
+}
+
+func getFreight(ctx context.Context, apiURL, token, project, name string) (*Freight, error) {
+	reqBody, _ := json.Marshal(map[string]string{"project": project, "name": name})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		strings.TrimSuffix(apiURL, "/")+getFreightPath, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("calling Kargo API: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Kargo API returned %s", resp.Status)
+	}
+
+	var out struct {
+		Freight *Freight `json:"freight"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decoding Freight: %w", err)
+	}
+	if out.Freight == nil {
+		return nil, fmt.Errorf("freight %s/%s not found", project, name)
+	}
+	return out.Freight, nil
+}
+
+// Panel is where an annotation is drawn; without a PanelID it shows on
+// every panel of the dashboard.
+type Panel struct {
+	DashboardUID string `json:"dashboardUID"`
+	PanelID      int    `json:"panelId,omitempty"`
+}
+
+// Mapping is the config file: the panels to annotate for each stage, and
+// tags added to every annotation of the stage.
+type Mapping struct {
+	Stages map[string]struct {
+		Panels []Panel  `json:"panels"`
+		Tags   []string `json:"tags,omitempty"`
+	} `json:"stages"`
+}
+
+// Promotion is a finished promotion, as posted to /promotions or given on
+// the command line.
+type Promotion struct {
+	Project    string    `json:"project"`
+	Stage      string    `json:"stage"`
+	Freight    string    `json:"freight"`
+	Phase      string    `json:"phase"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+}
+
+// Incident opens or resolves an incident window on a stage's dashboards.
+type Incident struct {
+	ID      string    `json:"id"`
+	Project string    `json:"project"`
+	Stage   string    `json:"stage"`
+	State   string    `json:"state"` // open or resolved
+	Title   string    `json:"title,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+type annotation struct {
+	DashboardUID string   `json:"dashboardUID,omitempty"`
+	PanelID      int      `json:"panelId,omitempty"`
+	Time         int64    `json:"time"`
+	TimeEnd      int64    `json:"timeEnd,omitempty"`
+	Tags         []string `json:"tags"`
+	Text         string   `json:"text"`
+}
+
+type publisher struct {
+	grafanaURL   string
+	grafanaToken string
+	kargoURL     string
+	kargoToken   string
+	mapping      Mapping
+
+	mu sync.Mutex
+	// open maps incident IDs to the annotations drawn for them, to be
+	// closed into regions when the incident is resolved.
+	open map[string][]int64
+}
+
+func (p *publisher) grafana(ctx context.Context, method, path string, body any) (*http.Response, error) {
+	b, _ := json.Marshal(body)
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(p.grafanaURL, "/")+path, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+p.grafanaToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("calling Grafana: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("Grafana returned %s for %s %s", resp.Status, method, path)
+	}
+	return resp, nil
+}
+
+// annotate draws a on every panel mapped for stage and returns the IDs
+// Grafana assigned.
+func (p *publisher) annotate(ctx context.Context, stage string, a annotation) ([]int64, error) {
+	cfg, ok := p.mapping.Stages[stage]
+	if !ok {
+		log.Printf("No dashboards mapped for stage %s, skipping annotation", stage)
+		return nil, nil
+	}
+	a.Tags = append(a.Tags, cfg.Tags...)
+	var ids []int64
+	for _, panel := range cfg.Panels {
+		a.DashboardUID, a.PanelID = panel.DashboardUID, panel.PanelID
+		resp, err := p.grafana(ctx, http.MethodPost, "/api/annotations", a)
+		if err != nil {
+			return ids, err
+		}
+		var out struct {
+			ID int64 `json:"id"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&out)
+		resp.Body.Close()
+		if err != nil {
+			return ids, fmt.Errorf("decoding Grafana response: %w", err)
+		}
+		ids = append(ids, out.ID)
+	}
+	return ids, nil
+}
+
+// promotion annotates the promotion window. The lead time runs from the
+// Freight's creation, i.e. when the change was discovered, to the end of
+// the promotion.
+func (p *publisher) promotion(ctx context.Context, pr Promotion) error {
+	freight, err := getFreight(ctx, p.kargoURL, p.kargoToken, pr.Project, pr.Freight)
+	if err != nil {
+		return err
+	}
+	name := freight.Metadata.Name
+	if freight.Alias != "" {
+		name = freight.Alias + " (" + freight.Metadata.Name + ")"
+	}
+	text := fmt.Sprintf("Promoted %s to %s: %s", name, pr.Stage, pr.Phase)
+	if created := freight.Metadata.CreationTimestamp; !created.IsZero() {
+		text += fmt.Sprintf(", lead time %s", pr.FinishedAt.Sub(created).Round(time.Second))
+	}
+	_, err = p.annotate(ctx, pr.Stage, annotation{
+		Time:    pr.StartedAt.UnixMilli(),
+		TimeEnd: pr.FinishedAt.UnixMilli(),
+		Tags:    []string{"kargo", "promotion", pr.Project, pr.Stage, strings.ToLower(pr.Phase)},
+		Text:    text,
+	})
+	return err
+}
+
+// incident starts an incident annotation, or turns the open one into a
+// region ending at inc.Time.
+func (p *publisher) incident(ctx context.Context, inc Incident) error {
+	switch inc.State {
+	case "open":
+		ids, err := p.annotate(ctx, inc.Stage, annotation{
+			Time: inc.Time.UnixMilli(),
+			Tags: []string{"kargo", "incident", inc.Project, inc.Stage},
+			Text: fmt.Sprintf("Incident %s: %s", inc.ID, inc.Title),
+		})
+		p.mu.Lock()
+		p.open[inc.ID] = append(p.open[inc.ID], ids...)
+		p.mu.Unlock()
+		return err
+	case "resolved":
+		p.mu.Lock()
+		ids := p.open[inc.ID]
+		delete(p.open, inc.ID)
+		p.mu.Unlock()
+		if ids == nil {
+			return fmt.Errorf("incident %s is not open", inc.ID)
+		}
+		for _, id := range ids {
+			resp, err := p.grafana(ctx, http.MethodPatch, fmt.Sprintf("/api/annotations/%d", id),
+				map[string]int64{"timeEnd": inc.Time.UnixMilli()})
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown incident state %q", inc.State)
+}
+
+func (p *publisher) promotionsHandler(w http.ResponseWriter, r *http.Request) {
+	var pr Promotion
+	if err := json.NewDecoder(r.Body).Decode(&pr); err != nil || pr.Stage == "" || pr.Freight == "" {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	if err := p.promotion(r.Context(), pr); err != nil {
+		log.Printf("Annotating promotion of %s to %s failed: %v", pr.Freight, pr.Stage, err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *publisher) incidentsHandler(w http.ResponseWriter, r *http.Request) {
+	var inc Incident
+	if err := json.NewDecoder(r.Body).Decode(&inc); err != nil || inc.ID == "" || inc.Stage == "" {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	if inc.Time.IsZero() {
+		inc.Time = time.Now()
+	}
+	if err := p.incident(r.Context(), inc); err != nil {
+		log.Printf("Annotating incident %s failed: %v", inc.ID, err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func main() {
+	mappingFile := flag.String("config", "", "JSON file mapping stages to Grafana dashboards and panels")
+	grafanaURL := flag.String("grafana-url", "", "Grafana base URL")
+	grafanaToken := flag.String("grafana-token", os.Getenv("GRAFANA_TOKEN"), "Grafana service account token")
+	kargoURL := flag.String("kargo-url", "https://localhost:31444", "Kargo API server URL")
+	kargoToken := flag.String("kargo-token", os.Getenv("KARGO_TOKEN"), "Kargo API bearer token")
+	project := flag.String("project", "", "Kargo project")
+	stage := flag.String("stage", "", "stage the Freight was promoted to")
+	freightName := flag.String("freight", "", "Freight that was promoted")
+	phase := flag.String("phase", "Succeeded", "promotion outcome")
+	started := flag.String("started", "", "promotion start time (RFC 3339)")
+	finished := flag.String("finished", "", "promotion end time (RFC 3339), defaults to now")
+	listen := flag.String("listen", "", "serve /promotions and /incidents on this address instead of annotating once")
+	flag.Parse()
+
+	if *mappingFile == "" || *grafanaURL == "" {
+		log.Fatal("-config and -grafana-url are required")
+	}
+	data, err := os.ReadFile(*mappingFile)
+	if err != nil {
+		log.Fatalf("Reading config failed: %v", err)
+	}
+	p := &publisher{
+		grafanaURL:   *grafanaURL,
+		grafanaToken: *grafanaToken,
+		kargoURL:     *kargoURL,
+		kargoToken:   *kargoToken,
+		open:         make(map[string][]int64),
+	}
+	if err := json.Unmarshal(data, &p.mapping); err != nil {
+		log.Fatalf("Parsing config failed: %v", err)
+	}
+
+	if *listen != "" {
+		http.HandleFunc("POST /promotions", p.promotionsHandler)
+		http.HandleFunc("POST /incidents", p.incidentsHandler)
+		log.Printf("Serving Grafana annotations on %s", *listen)
+		log.Fatal(http.ListenAndServe(*listen, nil))
+	}
+
+	pr := Promotion{Project: *project, Stage: *stage, Freight: *freightName, Phase: *phase, FinishedAt: time.Now()}
+	if *started == "" {
+		log.Fatal("-started is required")
+	}
+	if pr.StartedAt, err = time.Parse(time.RFC3339, *started); err != nil {
+		log.Fatalf("Invalid -started: %v", err)
+	}
+	if *finished != "" {
+		if pr.FinishedAt, err = time.Parse(time.RFC3339, *finished); err != nil {
+			log.Fatalf("Invalid -finished: %v", err)
+		}
+	}
+	if err := p.promotion(context.Background(), pr); err != nil {
+		log.Fatalf("Annotating promotion failed: %v", err)
+	}
+	fmt.Printf("Annotated promotion of %s to %s\n", pr.Freight, pr.Stage)
+}
@@ -0,0 +1,268 @@
+// serves the image/chart/commit delta between two Kargo Freight over HTTP
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// Connect accepts plain JSON for unary calls, so no generated client is
+	// needed.
+	getFreightPath   = "/akuity.io.kargo.service.v1alpha1.KargoService/GetFreight"
+	queryFreightPath = "/akuity.io.kargo.service.v1alpha1.KargoService/QueryFreight"
+)
+
+type Freight struct {
+	Metadata struct {
+		Name              string    `json:"name"`
+		Namespace         string    `json:"namespace"`
+		CreationTimestamp time.Time `json:"creationTimestamp"`
+	} `json:"metadata"`
+	Alias  string `json:"alias"`
+	Origin struct {
+		Kind string `json:"kind"`
+		Name string `json:"name"`
+	} `json:"origin"`
+	Commits []struct {
+		RepoURL string `json:"repoURL"`
+		ID      string `json:"id"`
+		Tag     string `json:"tag"`
+		Message string `json:"message"`
+	} `json:"commits"`
+	Images []struct {
+		RepoURL string `json:"repoURL"`
+		Tag     string `json:"tag"`
+		Digest  string `json:"digest"`
+	} `json:"images"`
+	Charts []struct {
+		RepoURL string `json:"repoURL"`
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"charts"`
+}
+
+// Change is one artifact that differs between two Freight. From is empty for
+// added artifacts and To is empty for removed ones.
+type Change struct {
+	Kind    string `json:"kind"`
+	RepoURL string `json:"repoURL"`
+	Name    string `json:"name,omitempty"`
+	From    string `json:"from,omitempty"`
+	To      string `json:"to,omitempty"`
+}
+
+type Diff struct {
+	Freight string   `json:"freight"`
+	Alias   string   `json:"alias,omitempty"`
+	Against string   `json:"against,omitempty"`
+	Images  []Change `json:"images"`
+	Charts  []Change `json:"charts"`
+	Commits []Change `json:"commits"`
+}
+
+var errNotFound = errors.New("not found")
+
+type kargoClient struct {
+	url   string
+	token string
+}
+
+func (k *kargoClient) call(ctx context.Context, path string, in, out any) error {
+	reqBody, _ := json.Marshal(in)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		strings.TrimSuffix(k.url, "/")+path, bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if k.token != "" {
+		req.Header.Set("Authorization", "Bearer "+k.token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("calling Kargo API: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return errNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Kargo API returned %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (k *kargoClient) getFreight(ctx context.Context, project, name string) (*Freight, error) {
+	var out struct {
+		Freight *Freight `json:"freight"`
+	}
+	if err := k.call(ctx, getFreightPath, map[string]string{"project": project, "name": name}, &out); err != nil {
+		return nil, err
+	}
+	if out.Freight == nil {
+		return nil, errNotFound
+	}
+	return out.Freight, nil
+}
+
+// previous returns the newest Freight from the same origin that was created
+// before f, or nil if f is the first one.
+func (k *kargoClient) previous(ctx context.Context, project string, f *Freight) (*Freight, error) {
+	var out struct {
+		Groups map[string]struct {
+			Freight []*Freight `json:"freight"`
+		} `json:"groups"`
+	}
+	if err := k.call(ctx, queryFreightPath, map[string]string{"project": project}, &out); err != nil {
+		return nil, err
+	}
+	var prev *Freight
+	for _, g := range out.Groups {
+		for _, c := range g.Freight {
+			if c.Origin != f.Origin || !c.Metadata.CreationTimestamp.Before(f.Metadata.CreationTimestamp) {
+				continue
+			}
+			if prev == nil || c.Metadata.CreationTimestamp.After(prev.Metadata.CreationTimestamp) {
+				prev = c
+			}
+		}
+	}
+	return prev, nil
+}
+
+// diffFreight compares to against from. A nil from reports every artifact in
+// to as added.
+func diffFreight(from, to *Freight) *Diff {
+	d := &Diff{Freight: to.Metadata.Name, Alias: to.Alias}
+	if from == nil {
+		from = &Freight{}
+	} else {
+		d.Against = from.Metadata.Name
+	}
+
+	images := func(f *Freight) map[string][2]string {
+		m := make(map[string][2]string)
+		for _, i := range f.Images {
+			v := i.Tag
+			if v == "" {
+				v = i.Digest
+			}
+			m[i.RepoURL] = [2]string{"", v}
+		}
+		return m
+	}
+	charts := func(f *Freight) map[string][2]string {
+		m := make(map[string][2]string)
+		for _, c := range f.Charts {
+			m[c.RepoURL+"\x00"+c.Name] = [2]string{c.Name, c.Version}
+		}
+		return m
+	}
+	commits := func(f *Freight) map[string][2]string {
+		m := make(map[string][2]string)
+		for _, c := range f.Commits {
+			m[c.RepoURL] = [2]string{"", c.ID}
+		}
+		return m
+	}
+
+	d.Images = changes("image", images(from), images(to))
+	d.Charts = changes("chart", charts(from), charts(to))
+	d.Commits = changes("commit", commits(from), commits(to))
+	return d
+}
+
+// changes compares two artifact sets keyed by repository (plus chart name),
+// each value holding the artifact name and its version.
+func changes(kind string, from, to map[string][2]string) []Change {
+	out := []Change{}
+	for key, t := range to {
+		if f, ok := from[key]; !ok || f[1] != t[1] {
+			out = append(out, Change{Kind: kind, RepoURL: strings.Split(key, "\x00")[0], Name: t[0], From: f[1], To: t[1]})
+		}
+	}
+	for key, f := range from {
+		if _, ok := to[key]; !ok {
+			out = append(out, Change{Kind: kind, RepoURL: strings.Split(key, "\x00")[0], Name: f[0], From: f[1]})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].RepoURL != out[j].RepoURL {
+			return out[i].RepoURL < out[j].RepoURL
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+func main() {
+	listen := flag.String("listen", ":8090", "listen address")
+	kargoURL := flag.String("kargo-url", "https://localhost:31444", "Kargo API server URL")
+	kargoToken := flag.String("kargo-token", os.Getenv("KARGO_TOKEN"), "Kargo API bearer token")
+	defaultProject := flag.String("project", "", "Kargo project used when the request has no ?project=")
+	flag.Parse()
+
+	k := &kargoClient{url: *kargoURL, token: *kargoToken}
+
+	mux := http.NewServeMux()
+	// GET /api/freight/{name}/diff?against=previous|<freight>&project=<project>
+	mux.HandleFunc("GET /api/freight/{name}/diff", func(w http.ResponseWriter, r *http.Request) {
+		project := r.URL.Query().Get("project")
+		if project == "" {
+			project = *defaultProject
+		}
+		if project == "" {
+			http.Error(w, "project is required", http.StatusBadRequest)
+			return
+		}
+		against := r.URL.Query().Get("against")
+		if against == "" {
+			against = "previous"
+		}
+
+		to, err := k.getFreight(r.Context(), project, r.PathValue("name"))
+		if errors.Is(err, errNotFound) {
+			http.Error(w, "freight not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("getting freight %s/%s: %v", project, r.PathValue("name"), err)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		var from *Freight
+		if against == "previous" {
+			from, err = k.previous(r.Context(), project, to)
+		} else {
+			from, err = k.getFreight(r.Context(), project, against)
+		}
+		if errors.Is(err, errNotFound) {
+			http.Error(w, "freight "+against+" not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("getting freight to compare %s/%s against: %v", project, to.Metadata.Name, err)
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(diffFreight(from, to))
+	})
+
+	log.Printf("serving freight diffs on %s", *listen)
+	log.Fatal(http.ListenAndServe(*listen, mux))
+}
@@ -0,0 +1,167 @@
+//go:build !no_acr
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	acrPath = "/webhook/acr"
+
+	eventGridValidationType  = "Microsoft.EventGrid.SubscriptionValidationEvent"
+	eventGridEventTypeHeader = "aeg-event-type"
+)
+
+func init() {
+	registerProvider(acrPath, acrProvider{})
+}
+
+// eventGridEvent covers both the Event Grid schema and the CloudEvents 1.0
+// schema an Event Grid subscription can be configured to deliver.
+type eventGridEvent struct {
+	ID        string          `json:"id"`
+	Topic     string          `json:"topic"`
+	Source    string          `json:"source"`
+	EventType string          `json:"eventType"`
+	Type      string          `json:"type"`
+	EventTime time.Time       `json:"eventTime"`
+	Time      time.Time       `json:"time"`
+	Data      json.RawMessage `json:"data"`
+}
+
+type acrEventData struct {
+	ValidationCode string `json:"validationCode"`
+	Action         string `json:"action"`
+	Target         struct {
+		MediaType  string `json:"mediaType"`
+		Digest     string `json:"digest"`
+		Repository string `json:"repository"`
+		Tag        string `json:"tag"`
+		Name       string `json:"name"`
+		Version    string `json:"version"`
+	} `json:"target"`
+	Request struct {
+		Host string `json:"host"`
+	} `json:"request"`
+}
+
+// acrProvider accepts Azure Container Registry events delivered by an Event
+// Grid webhook subscription. The shared secret is passed in the `code` query
+// parameter of the subscription's endpoint URL.
+type acrProvider struct{}
+
+func (acrProvider) Name() string { return "acr" }
+
+func (p acrProvider) Authenticate(r *http.Request, _ []byte) error {
+	return checkSecret(r, p.Name(), r.URL.Query().Get("code"))
+}
+
+// Handshake answers both subscription validation styles: the Event Grid
+// schema's SubscriptionValidationEvent and the CloudEvents OPTIONS abuse
+// protection request.
+func (p acrProvider) Handshake(w http.ResponseWriter, r *http.Request, body []byte) bool {
+	if abuseProtection(w, r, func() error { return p.Authenticate(r, body) }) {
+		return true
+	}
+
+	if r.Header.Get(eventGridEventTypeHeader) != "SubscriptionValidation" {
+		return false
+	}
+	if err := p.Authenticate(r, body); err != nil {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return true
+	}
+	events, err := decodeEventGrid(body)
+	if err != nil || len(events) == 0 || events[0].EventType != eventGridValidationType {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return true
+	}
+	var data acrEventData
+	if err := json.Unmarshal(events[0].Data, &data); err != nil || data.ValidationCode == "" {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return true
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"validationResponse": data.ValidationCode})
+	return true
+}
+
+func (acrProvider) Parse(_ *http.Request, body []byte) ([]Event, error) {
+	raw, err := decodeEventGrid(body)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	for _, e := range raw {
+		typ := e.EventType
+		if typ == "" {
+			typ = e.Type
+		}
+		ts := e.EventTime
+		if ts.IsZero() {
+			ts = e.Time
+		}
+
+		var kind string
+		switch typ {
+		case "Microsoft.ContainerRegistry.ImagePushed", "Microsoft.ContainerRegistry.ChartPushed":
+			kind = EventPush
+		case "Microsoft.ContainerRegistry.ImageDeleted", "Microsoft.ContainerRegistry.ChartDeleted":
+			kind = EventDelete
+		default:
+			log.Printf("Ignoring Event Grid event type %s", typ)
+			continue
+		}
+
+		var data acrEventData
+		if err := json.Unmarshal(e.Data, &data); err != nil {
+			return nil, fmt.Errorf("event %s: %w", e.ID, err)
+		}
+		ev := Event{
+			ID:         e.ID,
+			Provider:   "acr",
+			Type:       kind,
+			Registry:   data.Request.Host,
+			Repository: data.Target.Repository,
+			Tag:        data.Target.Tag,
+			Digest:     data.Target.Digest,
+			MediaType:  data.Target.MediaType,
+			Timestamp:  ts,
+		}
+		if strings.HasSuffix(typ, "ChartPushed") || strings.HasSuffix(typ, "ChartDeleted") {
+			ev.Repository = data.Target.Name
+			ev.Tag = data.Target.Version
+		}
+		events = append(events, ev)
+	}
+	return events, nil
+}
+
+// decodeEventGrid accepts an Event Grid schema batch (a JSON array) or a
+// single CloudEvents object.
+func decodeEventGrid(body []byte) ([]eventGridEvent, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return nil, errors.New("empty body")
+	}
+	if body[0] == '[' {
+		var events []eventGridEvent
+		err := json.Unmarshal(body, &events)
+		return events, err
+	}
+	var e eventGridEvent
+	if err := json.Unmarshal(body, &e); err != nil {
+		return nil, err
+	}
+	return []eventGridEvent{e}, nil
+}
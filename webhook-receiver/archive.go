@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const archivePruneInterval = time.Hour
+
+// Verdicts recorded for archived deliveries.
+const (
+	verdictAccepted  = "accepted"
+	verdictRejected  = "rejected"
+	verdictInvalid   = "invalid"
+	verdictThrottled = "throttled"
+	verdictOverQuota = "over_quota"
+	verdictDuplicate = "duplicate"
+)
+
+// Credentials are not written to the archive or the logs.
+var redactedHeaders = []string{"Authorization", "Cookie", secretHeader, "X-Gitlab-Token"}
+
+type ArchiveConfig struct {
+	// Path is the SQLite database file, created if missing.
+	Path string `json:"path"`
+	// Retention is how long deliveries are kept; unset keeps them until
+	// MaxDeliveries pushes them out.
+	Retention string `json:"retention,omitempty"`
+	// MaxDeliveries caps the number kept, dropping the oldest first.
+	MaxDeliveries int `json:"maxDeliveries,omitempty"`
+
+	retention time.Duration
+}
+
+func (c *ArchiveConfig) Validate() error {
+	var errs []error
+	if c.Path == "" {
+		errs = append(errs, errors.New("archive.path: required"))
+	}
+	if c.Retention != "" {
+		d, err := time.ParseDuration(c.Retention)
+		if err != nil || d <= 0 {
+			errs = append(errs, errors.New("archive.retention: must be a positive duration"))
+		}
+		c.retention = d
+	}
+	if c.MaxDeliveries < 0 {
+		errs = append(errs, errors.New("archive.maxDeliveries: must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+// Delivery is one webhook request as received, with the receiver's verdict.
+type Delivery struct {
+	ID         int64       `json:"id"`
+	ReceivedAt time.Time   `json:"receivedAt"`
+	Provider   string      `json:"provider"`
+	Path       string      `json:"path"`
+	RemoteAddr string      `json:"remoteAddr"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body,omitempty"`
+	Verdict    string      `json:"verdict"`
+	Status     int         `json:"status"`
+	Detail     string      `json:"detail,omitempty"`
+	Events     int         `json:"events"`
+}
+
+// archiveMigrations are applied in order; PRAGMA user_version records how
+// many have run. Append only.
+var archiveMigrations = []string{
+	`CREATE TABLE deliveries (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		received_at INTEGER NOT NULL,
+		provider    TEXT NOT NULL,
+		path        TEXT NOT NULL,
+		remote_addr TEXT NOT NULL,
+		header      TEXT NOT NULL,
+		body        BLOB NOT NULL,
+		verdict     TEXT NOT NULL,
+		status      INTEGER NOT NULL,
+		detail      TEXT NOT NULL DEFAULT '',
+		events      INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX deliveries_received_at ON deliveries (received_at);
+	CREATE INDEX deliveries_provider ON deliveries (provider, id);`,
+}
+
+// Archive keeps every webhook delivery in SQLite so operators can audit
+// them and replay them later.
+type Archive struct {
+	db        *sql.DB
+	retention time.Duration
+	max       int
+}
+
+// archive is set by main when an archive is configured.
+var archive *Archive
+
+func OpenArchive(cfg ArchiveConfig) (*Archive, error) {
+	db, err := sql.Open("sqlite", "file:"+cfg.Path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows one writer; a single connection avoids busy errors.
+	db.SetMaxOpenConns(1)
+	a := &Archive{db: db, retention: cfg.retention, max: cfg.MaxDeliveries}
+	if err := migrateDB(db, "archive", archiveMigrations); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrating %s: %w", cfg.Path, err)
+	}
+	return a, nil
+}
+
+// migrateDB applies the migrations db has not run yet; PRAGMA user_version
+// records how many have. name is used in log lines.
+func migrateDB(db *sql.DB, name string, migrations []string) error {
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	for i := version; i < len(migrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		// PRAGMA does not take bind parameters.
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, i+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		log.Printf("Applied %s migration %d", name, i+1)
+	}
+	return nil
+}
+
+func (a *Archive) Close() error { return a.db.Close() }
+
+// Record stores d and returns its ID.
+func (a *Archive) Record(d Delivery) (int64, error) {
+	hj, _ := json.Marshal(redactHeaders(d.Header))
+	res, err := a.db.Exec(`INSERT INTO deliveries
+		(received_at, provider, path, remote_addr, header, body, verdict, status, detail, events)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		d.ReceivedAt.UnixNano(), d.Provider, d.Path, d.RemoteAddr, string(hj), d.Body,
+		d.Verdict, d.Status, d.Detail, d.Events)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// redactHeaders returns a copy of h with credentials masked.
+func redactHeaders(h http.Header) http.Header {
+	out := h.Clone()
+	for _, k := range redactedHeaders {
+		if out.Get(k) != "" {
+			out.Set(k, "REDACTED")
+		}
+	}
+	return out
+}
+
+// Get returns delivery id with its body, or nil if it is not archived.
+func (a *Archive) Get(ctx context.Context, id int64) (*Delivery, error) {
+	rows, err := a.db.QueryContext(ctx, `SELECT id, received_at, provider, path, remote_addr, header, body,
+		verdict, status, detail, events FROM deliveries WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	out, err := scanDeliveries(rows, true)
+	if err != nil || len(out) == 0 {
+		return nil, err
+	}
+	return &out[0], nil
+}
+
+// DeliveryFilter narrows List; zero fields match everything.
+type DeliveryFilter struct {
+	Provider string
+	Verdict  string
+	Since    time.Time
+}
+
+// List returns up to limit deliveries matching f, newest first, with IDs
+// below before (0 for the newest). Bodies are left out.
+func (a *Archive) List(ctx context.Context, f DeliveryFilter, before int64, limit int) ([]Delivery, error) {
+	where, args := []string{"1 = 1"}, []any{}
+	if f.Provider != "" {
+		where, args = append(where, "provider = ?"), append(args, f.Provider)
+	}
+	if f.Verdict != "" {
+		where, args = append(where, "verdict = ?"), append(args, f.Verdict)
+	}
+	if !f.Since.IsZero() {
+		where, args = append(where, "received_at >= ?"), append(args, f.Since.UnixNano())
+	}
+	if before > 0 {
+		where, args = append(where, "id < ?"), append(args, before)
+	}
+	rows, err := a.db.QueryContext(ctx, `SELECT id, received_at, provider, path, remote_addr, header, x'',
+		verdict, status, detail, events FROM deliveries WHERE `+strings.Join(where, " AND ")+
+		` ORDER BY id DESC LIMIT ?`, append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	return scanDeliveries(rows, false)
+}
+
+func scanDeliveries(rows *sql.Rows, withBody bool) ([]Delivery, error) {
+	defer rows.Close()
+	var out []Delivery
+	for rows.Next() {
+		var d Delivery
+		var ts int64
+		var header string
+		if err := rows.Scan(&d.ID, &ts, &d.Provider, &d.Path, &d.RemoteAddr, &header, &d.Body,
+			&d.Verdict, &d.Status, &d.Detail, &d.Events); err != nil {
+			return nil, err
+		}
+		d.ReceivedAt = time.Unix(0, ts).UTC()
+		json.Unmarshal([]byte(header), &d.Header)
+		if !withBody {
+			d.Body = nil
+		}
+		out = append(out, d)
+	}
+	return out, rows.Err()
+}
+
+// prune applies the retention policy.
+func (a *Archive) prune() (int64, error) {
+	var total int64
+	if a.retention > 0 {
+		res, err := a.db.Exec(`DELETE FROM deliveries WHERE received_at < ?`,
+			time.Now().Add(-a.retention).UnixNano())
+		if err != nil {
+			return total, err
+		}
+		n, _ := res.RowsAffected()
+		total += n
+	}
+	if a.max > 0 {
+		res, err := a.db.Exec(`DELETE FROM deliveries WHERE id <= (
+			SELECT id FROM deliveries ORDER BY id DESC LIMIT 1 OFFSET ?)`, a.max)
+		if err != nil {
+			return total, err
+		}
+		n, _ := res.RowsAffected()
+		total += n
+	}
+	return total, nil
+}
+
+// Run prunes the archive periodically until ctx is done.
+func (a *Archive) Run(ctx context.Context) {
+	tick := time.NewTicker(archivePruneInterval)
+	defer tick.Stop()
+	for {
+		if n, err := a.prune(); err != nil {
+			log.Printf("Pruning archive: %v", err)
+		} else if n > 0 {
+			log.Printf("Pruned %d archived deliveries", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+// listHandler serves GET /admin/deliveries?provider=&verdict=&since=&limit=&cursor=.
+func (a *Archive) listHandler(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	f := DeliveryFilter{Provider: params.Get("provider"), Verdict: params.Get("verdict")}
+	var err error
+	if v := params.Get("since"); v != "" {
+		if f.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "since must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+	}
+	limit := defaultEventsLimit
+	if v := params.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 || limit > maxEventsLimit {
+			http.Error(w, "limit must be between 1 and "+strconv.Itoa(maxEventsLimit), http.StatusBadRequest)
+			return
+		}
+	}
+	var before int64
+	if v := params.Get("cursor"); v != "" {
+		if before, err = strconv.ParseInt(v, 10, 64); err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+	}
+
+	page, err := a.List(r.Context(), f, before, limit)
+	if err != nil {
+		log.Printf("Listing deliveries: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	out := struct {
+		Deliveries []Delivery `json:"deliveries"`
+		Next       string     `json:"next,omitempty"`
+	}{Deliveries: page}
+	if out.Deliveries == nil {
+		out.Deliveries = []Delivery{}
+	}
+	if len(page) == limit {
+		out.Next = strconv.FormatInt(page[len(page)-1].ID, 10)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// getHandler serves GET /admin/deliveries/{id}, including the body.
+func (a *Archive) getHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+	d, err := a.Get(r.Context(), id)
+	if err != nil {
+		log.Printf("Reading delivery %d: %v", id, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if d == nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(d)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type ArgoEventsConfig struct {
+	// URL is the endpoint of an Argo Events webhook EventSource.
+	URL string `json:"url"`
+	// AuthTokenFile holds the bearer token configured as the EventSource's
+	// authSecret, if any.
+	AuthTokenFile string `json:"authTokenFile,omitempty"`
+	Timeout       string `json:"timeout,omitempty"`
+}
+
+func (c *ArgoEventsConfig) Validate() error {
+	if err := validateURL(c.URL); err != nil {
+		return fmt.Errorf("url: %w", err)
+	}
+	if c.AuthTokenFile != "" {
+		if _, err := readSecretFile(c.AuthTokenFile); err != nil {
+			return fmt.Errorf("authTokenFile: %w", err)
+		}
+	}
+	if c.Timeout != "" {
+		if _, err := time.ParseDuration(c.Timeout); err != nil {
+			return fmt.Errorf("timeout: %w", err)
+		}
+	}
+	return nil
+}
+
+// ArgoEventsSink re-emits events to an Argo Events webhook EventSource. The
+// EventSource wraps each request as {header, body}, so sensors written
+// against it can filter on body.provider, body.repository, body.tag, etc.
+type ArgoEventsSink struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func NewArgoEventsSink(cfg ArgoEventsConfig) (*ArgoEventsSink, error) {
+	s := &ArgoEventsSink{
+		url:    cfg.URL,
+		client: &http.Client{Timeout: defaultSinkTimeout, Transport: outboundTransport},
+	}
+	if cfg.Timeout != "" {
+		s.client.Timeout, _ = time.ParseDuration(cfg.Timeout)
+	}
+	if cfg.AuthTokenFile != "" {
+		token, err := readSecretFile(cfg.AuthTokenFile)
+		if err != nil {
+			return nil, err
+		}
+		s.token = token
+	}
+	return s, nil
+}
+
+func (s *ArgoEventsSink) Name() string { return "argo-events" }
+
+func (s *ArgoEventsSink) Send(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-Provider", e.Provider)
+	req.Header.Set("X-Event-Type", e.Type)
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("EventSource returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+//go:build !no_artifactory
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	artifactoryPath       = "/webhook/artifactory"
+	artifactoryAuthHeader = "X-JFrog-Event-Auth"
+)
+
+func init() {
+	registerProvider(artifactoryPath, artifactoryProvider{})
+}
+
+type artifactoryPayload struct {
+	Domain    string `json:"domain"`
+	EventType string `json:"event_type"`
+	Origin    string `json:"jpd_origin"`
+	Data      *struct {
+		RepoKey   string `json:"repo_key"`
+		Path      string `json:"path"`
+		Name      string `json:"name"`
+		SHA256    string `json:"sha256"`
+		ImageName string `json:"image_name"`
+		Tag       string `json:"tag"`
+	} `json:"data"`
+}
+
+// artifactoryProvider accepts JFrog Artifactory "docker" and "artifact"
+// domain webhooks. Artifactory sends the webhook secret in
+// X-JFrog-Event-Auth, either verbatim or, with payload signing enabled, as
+// the hex HMAC-SHA256 of the body; both are accepted.
+type artifactoryProvider struct{}
+
+func (artifactoryProvider) Name() string { return "artifactory" }
+
+func (p artifactoryProvider) Authenticate(r *http.Request, body []byte) error {
+	got := r.Header.Get(artifactoryAuthHeader)
+	if got == "" {
+		return errMissingSecret
+	}
+	secrets := secretsFor(r, p.Name())
+	if sig, err := hex.DecodeString(got); err == nil && secrets.signed(sha256.New, body, sig) {
+		return nil
+	}
+	return secrets.check(got)
+}
+
+func (artifactoryProvider) Parse(_ *http.Request, body []byte) ([]Event, error) {
+	var p artifactoryPayload
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, err
+	}
+	// The "Test" button in the webhook settings posts a payload without
+	// event data; acknowledge it so the UI reports success.
+	if p.Domain == "" || p.Data == nil {
+		log.Printf("Artifactory test ping received")
+		return nil, nil
+	}
+
+	var kind string
+	switch p.EventType {
+	case "pushed", "deployed":
+		kind = EventPush
+	case "deleted":
+		kind = EventDelete
+	default:
+		log.Printf("Ignoring Artifactory %s/%s event", p.Domain, p.EventType)
+		return nil, nil
+	}
+
+	ev := Event{
+		Provider:  "artifactory",
+		Type:      kind,
+		Registry:  strings.TrimPrefix(strings.TrimPrefix(p.Origin, "https://"), "http://"),
+		Timestamp: time.Now(),
+	}
+	if p.Data.SHA256 != "" {
+		ev.Digest = "sha256:" + p.Data.SHA256
+	}
+	switch p.Domain {
+	case "docker":
+		ev.Repository = p.Data.RepoKey + "/" + p.Data.ImageName
+		ev.Tag = p.Data.Tag
+	case "artifact":
+		// Generic artifacts have no tag; the path within the repository
+		// identifies the version.
+		ev.Repository = p.Data.RepoKey
+		ev.Tag = p.Data.Path
+	default:
+		log.Printf("Ignoring Artifactory %s domain event", p.Domain)
+		return nil, nil
+	}
+	return []Event{ev}, nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Signing schemes that can be selected per provider in place of the
+// provider's built-in check.
+const (
+	// schemeSecretHeader compares a header with the shared secret.
+	schemeSecretHeader = "secret-header"
+	// schemeHMACSHA256 and schemeHMACSHA1 verify a hex HMAC of the body,
+	// optionally prefixed "sha256=" / "sha1=" as GitHub sends it.
+	schemeHMACSHA256 = "hmac-sha256"
+	schemeHMACSHA1   = "hmac-sha1"
+	// schemeGitLabToken compares X-Gitlab-Token with the secret.
+	schemeGitLabToken = "gitlab-token"
+	// schemeDockerHubCallback accepts Docker Hub deliveries whose
+	// callback_url points back at Docker Hub for the pushed repository.
+	// Docker Hub does not sign webhooks and anyone can write such a URL,
+	// so on its own the check proves nothing: the scheme also needs a
+	// secret header, or server.allowedSources.allowedCIDRs covering the
+	// provider so that only Docker Hub's addresses reach it.
+	schemeDockerHubCallback = "dockerhub-callback"
+)
+
+var schemeDefaultHeader = map[string]string{
+	schemeSecretHeader: secretHeader,
+	schemeHMACSHA256:   "X-Hub-Signature-256",
+	schemeHMACSHA1:     "X-Hub-Signature",
+	schemeGitLabToken:  "X-Gitlab-Token",
+	// The Docker Hub callback scheme's optional secret header.
+	schemeDockerHubCallback: secretHeader,
+}
+
+type AuthConfig struct {
+	Scheme string `json:"scheme"`
+	// Header overrides the scheme's default header.
+	Header string `json:"header,omitempty"`
+	// SecretFile is shorthand for Secrets with just this file.
+	SecretFile string         `json:"secretFile,omitempty"`
+	Secrets    *SecretsConfig `json:"secrets,omitempty"`
+
+	secrets *SecretsConfig
+}
+
+func (c *AuthConfig) Validate() error {
+	if _, ok := schemeDefaultHeader[c.Scheme]; !ok {
+		return fmt.Errorf("scheme: unknown %q", c.Scheme)
+	}
+	switch {
+	case c.SecretFile != "" && c.Secrets != nil:
+		return errors.New("secretFile: cannot be combined with secrets")
+	case c.Secrets != nil:
+		if err := c.Secrets.Validate(); err != nil {
+			return fmt.Errorf("secrets.%w", err)
+		}
+		c.secrets = c.Secrets
+		return nil
+	case c.SecretFile == "" && c.Scheme == schemeDockerHubCallback:
+		// Config.Validate checks the source filter instead.
+		return nil
+	case c.SecretFile == "":
+		return errors.New("secretFile or secrets: required")
+	}
+	secrets, err := readSecretLines(c.SecretFile)
+	if err != nil {
+		return fmt.Errorf("secretFile: %w", err)
+	}
+	if len(secrets) == 0 {
+		return errors.New("secretFile: empty")
+	}
+	c.secrets = &SecretsConfig{Files: []string{c.SecretFile}, refresh: defaultSecretsRefresh}
+	return nil
+}
+
+// authenticator checks a delivery like Provider.Authenticate.
+type authenticator func(r *http.Request, body []byte) error
+
+// providerAuth holds the configured schemes by provider name.
+var providerAuth = map[string]authenticator{}
+
+// authenticator checks deliveries against secrets, which may be nil for
+// the Docker Hub callback scheme.
+func (c *AuthConfig) authenticator(secrets *SecretSet) authenticator {
+	header := c.Header
+	if header == "" {
+		header = schemeDefaultHeader[c.Scheme]
+	}
+
+	switch c.Scheme {
+	case schemeHMACSHA256:
+		return hmacAuthenticator(header, "sha256=", sha256.New, secrets)
+	case schemeHMACSHA1:
+		return hmacAuthenticator(header, "sha1=", sha1.New, secrets)
+	case schemeDockerHubCallback:
+		if secrets == nil {
+			return dockerHubCallbackAuth
+		}
+		return func(r *http.Request, body []byte) error {
+			if err := requestSecrets(r, secrets).check(r.Header.Get(header)); err != nil {
+				return err
+			}
+			return dockerHubCallbackAuth(r, body)
+		}
+	default:
+		return func(r *http.Request, _ []byte) error {
+			return requestSecrets(r, secrets).check(r.Header.Get(header))
+		}
+	}
+}
+
+func hmacAuthenticator(header, prefix string, h func() hash.Hash, secrets *SecretSet) authenticator {
+	return func(r *http.Request, body []byte) error {
+		sig := r.Header.Get(header)
+		if sig == "" {
+			return errMissingSecret
+		}
+		got, err := hex.DecodeString(strings.TrimPrefix(sig, prefix))
+		if err != nil {
+			return errInvalidSecret
+		}
+		if !requestSecrets(r, secrets).signed(h, body, got) {
+			return errInvalidSecret
+		}
+		return nil
+	}
+}
+
+func dockerHubCallbackAuth(_ *http.Request, body []byte) error {
+	var push DockerHubPush
+	if err := json.Unmarshal(body, &push); err != nil || push.CallbackURL == "" {
+		return errMissingSecret
+	}
+	u, err := url.Parse(push.CallbackURL)
+	if err != nil || u.Scheme != "https" || u.Host != "registry.hub.docker.com" ||
+		!strings.HasPrefix(u.Path, "/u/"+push.Repository.RepoName+"/hook/") {
+		return errInvalidSecret
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func hexMAC(h func() hash.Hash, secret, body string) string {
+	m := hmac.New(h, []byte(secret))
+	m.Write([]byte(body))
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+func TestAuthenticators(t *testing.T) {
+	secrets := staticSecrets("old-secret", "new-secret")
+	const body = `{"ref":"refs/tags/v1"}`
+	const push = `{"callback_url":"https://registry.hub.docker.com/u/team/app/hook/abc/","repository":{"repo_name":"team/app"}}`
+
+	tests := []struct {
+		name      string
+		auth      AuthConfig
+		noSecrets bool
+		header    string
+		value     string
+		body      string
+		wantErr   error
+	}{
+		{name: "hmac-sha256 valid", auth: AuthConfig{Scheme: schemeHMACSHA256}, header: "X-Hub-Signature-256", value: "sha256=" + hexMAC(sha256.New, "new-secret", body)},
+		{name: "hmac-sha256 rotated secret", auth: AuthConfig{Scheme: schemeHMACSHA256}, header: "X-Hub-Signature-256", value: "sha256=" + hexMAC(sha256.New, "old-secret", body)},
+		{name: "hmac-sha256 without prefix", auth: AuthConfig{Scheme: schemeHMACSHA256}, header: "X-Hub-Signature-256", value: hexMAC(sha256.New, "new-secret", body)},
+		{name: "hmac-sha256 tampered body", auth: AuthConfig{Scheme: schemeHMACSHA256}, header: "X-Hub-Signature-256", value: "sha256=" + hexMAC(sha256.New, "new-secret", body), body: `{"ref":"refs/tags/v2"}`, wantErr: errInvalidSecret},
+		{name: "hmac-sha256 wrong secret", auth: AuthConfig{Scheme: schemeHMACSHA256}, header: "X-Hub-Signature-256", value: "sha256=" + hexMAC(sha256.New, "guess", body), wantErr: errInvalidSecret},
+		{name: "hmac-sha256 given a sha1 signature", auth: AuthConfig{Scheme: schemeHMACSHA256}, header: "X-Hub-Signature-256", value: "sha1=" + hexMAC(sha1.New, "new-secret", body), wantErr: errInvalidSecret},
+		{name: "hmac-sha256 not hex", auth: AuthConfig{Scheme: schemeHMACSHA256}, header: "X-Hub-Signature-256", value: "sha256=zz", wantErr: errInvalidSecret},
+		{name: "hmac-sha256 missing", auth: AuthConfig{Scheme: schemeHMACSHA256}, wantErr: errMissingSecret},
+		{name: "hmac-sha1 valid", auth: AuthConfig{Scheme: schemeHMACSHA1}, header: "X-Hub-Signature", value: "sha1=" + hexMAC(sha1.New, "new-secret", body)},
+		{name: "hmac-sha1 given a sha256 signature", auth: AuthConfig{Scheme: schemeHMACSHA1}, header: "X-Hub-Signature", value: "sha256=" + hexMAC(sha256.New, "new-secret", body), wantErr: errInvalidSecret},
+		{name: "hmac custom header", auth: AuthConfig{Scheme: schemeHMACSHA256, Header: "X-Signature"}, header: "X-Signature", value: hexMAC(sha256.New, "new-secret", body)},
+		{name: "secret header valid", auth: AuthConfig{Scheme: schemeSecretHeader}, header: secretHeader, value: "old-secret"},
+		{name: "secret header wrong", auth: AuthConfig{Scheme: schemeSecretHeader}, header: secretHeader, value: "new-secret-but-longer", wantErr: errInvalidSecret},
+		{name: "secret header missing", auth: AuthConfig{Scheme: schemeSecretHeader}, wantErr: errMissingSecret},
+		{name: "gitlab token valid", auth: AuthConfig{Scheme: schemeGitLabToken}, header: "X-Gitlab-Token", value: "new-secret"},
+		{name: "gitlab token in the wrong header", auth: AuthConfig{Scheme: schemeGitLabToken}, header: secretHeader, value: "new-secret", wantErr: errMissingSecret},
+		{name: "callback with secret", auth: AuthConfig{Scheme: schemeDockerHubCallback}, header: secretHeader, value: "new-secret", body: push},
+		{name: "callback without the secret", auth: AuthConfig{Scheme: schemeDockerHubCallback}, body: push, wantErr: errMissingSecret},
+		{name: "callback only, behind a source filter", auth: AuthConfig{Scheme: schemeDockerHubCallback}, noSecrets: true, body: push},
+		{name: "callback for another repository", auth: AuthConfig{Scheme: schemeDockerHubCallback}, header: secretHeader, value: "new-secret",
+			body: strings.Replace(push, `"repo_name":"team/app"`, `"repo_name":"team/other"`, 1), wantErr: errInvalidSecret},
+		{name: "callback to another host", auth: AuthConfig{Scheme: schemeDockerHubCallback}, header: secretHeader, value: "new-secret",
+			body: strings.Replace(push, "registry.hub.docker.com", "attacker.example.com", 1), wantErr: errInvalidSecret},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := secrets
+			if tt.noSecrets {
+				s = nil
+			}
+			b := tt.body
+			if b == "" {
+				b = body
+			}
+			r := httptest.NewRequest("POST", "/webhook", strings.NewReader(b))
+			if tt.header != "" {
+				r.Header.Set(tt.header, tt.value)
+			}
+			if err := tt.auth.authenticator(s)(r, []byte(b)); err != tt.wantErr {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDockerHubCallbackNeedsSecretOrSourceFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		sources *SourceFilterConfig
+		wantErr bool
+	}{
+		{name: "neither", wantErr: true},
+		{name: "source filter", sources: &SourceFilterConfig{AllowedCIDRs: []string{"203.0.113.0/24"}}},
+		{name: "source filter for other providers", sources: &SourceFilterConfig{AllowedCIDRs: []string{"203.0.113.0/24"}, Providers: []string{"github"}}, wantErr: true},
+		{name: "GitHub ranges only", sources: &SourceFilterConfig{GitHubMeta: &GitHubMetaConfig{}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				Version: configVersion,
+				Server:  &ServerConfig{Secrets: &SecretsConfig{}, AllowedSources: tt.sources},
+				Auth:    map[string]*AuthConfig{"dockerhub": {Scheme: schemeDockerHubCallback}},
+			}
+			err := cfg.Validate()
+			if got := err != nil && strings.Contains(err.Error(), "auth.dockerhub:"); got != tt.wantErr {
+				t.Errorf("Validate() = %v, want auth.dockerhub error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+//go:build !no_aws
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+func init() { compiledSinks = append(compiledSinks, "aws") }
+
+// AWSSinkConfig sends events to an SQS queue or an SNS topic, for
+// automation that lives in AWS Lambda. Credentials come from the default
+// chain: IRSA or EKS Pod Identity in a cluster, the instance role or the
+// usual environment variables elsewhere.
+type AWSSinkConfig struct {
+	// Name identifies the sink in routing rules.
+	Name string `json:"name"`
+	// Exactly one of QueueURL and TopicARN is set. For FIFO queues and
+	// topics the repository is the message group, so each repository's
+	// events arrive in order, and the delivery ID the deduplication ID;
+	// events without one need content-based deduplication enabled.
+	QueueURL string `json:"queueURL,omitempty"`
+	TopicARN string `json:"topicARN,omitempty"`
+	// Region defaults to the one in the queue URL or topic ARN.
+	Region  string `json:"region,omitempty"`
+	Timeout string `json:"timeout,omitempty"`
+}
+
+func (c *AWSSinkConfig) Validate() error {
+	var errs []error
+	if c.Name == "" {
+		errs = append(errs, errors.New("name: required"))
+	}
+	switch {
+	case (c.QueueURL == "") == (c.TopicARN == ""):
+		errs = append(errs, errors.New("queueURL, topicARN: exactly one is required"))
+	case c.QueueURL != "":
+		if err := validateURL(c.QueueURL); err != nil {
+			errs = append(errs, fmt.Errorf("queueURL: %w", err))
+		}
+	case !strings.HasPrefix(c.TopicARN, "arn:") || strings.Count(c.TopicARN, ":") != 5:
+		errs = append(errs, fmt.Errorf("topicARN: %q is not an SNS topic ARN", c.TopicARN))
+	}
+	if c.Timeout != "" {
+		if _, err := time.ParseDuration(c.Timeout); err != nil {
+			errs = append(errs, fmt.Errorf("timeout: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// region returns the configured region or the one the queue URL
+// (https://sqs.<region>.amazonaws.com/...) or topic ARN names.
+func (c *AWSSinkConfig) region() string {
+	if c.Region != "" {
+		return c.Region
+	}
+	if c.TopicARN != "" {
+		return strings.Split(c.TopicARN, ":")[3]
+	}
+	host := strings.TrimPrefix(strings.TrimPrefix(c.QueueURL, "https://"), "http://")
+	if parts := strings.Split(host, "."); len(parts) > 2 && parts[0] == "sqs" {
+		return parts[1]
+	}
+	return ""
+}
+
+type AWSSink struct {
+	name     string
+	queueURL string
+	topicARN string
+	fifo     bool
+	timeout  time.Duration
+	sqs      *sqs.Client
+	sns      *sns.Client
+}
+
+func NewAWSSink(cfg AWSSinkConfig) (*AWSSink, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSinkTimeout)
+	defer cancel()
+	opts := []func(*config.LoadOptions) error{config.WithHTTPClient(outboundClient)}
+	if region := cfg.region(); region != "" {
+		opts = append(opts, config.WithRegion(region))
+	}
+	awsCfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("loading AWS credentials for sink %s: %w", cfg.Name, err)
+	}
+	s := &AWSSink{
+		name:     cfg.Name,
+		queueURL: cfg.QueueURL,
+		topicARN: cfg.TopicARN,
+		fifo:     strings.HasSuffix(cfg.QueueURL+cfg.TopicARN, ".fifo"),
+		timeout:  defaultSinkTimeout,
+	}
+	if cfg.Timeout != "" {
+		s.timeout, _ = time.ParseDuration(cfg.Timeout)
+	}
+	if s.queueURL != "" {
+		s.sqs = sqs.NewFromConfig(awsCfg)
+	} else {
+		s.sns = sns.NewFromConfig(awsCfg)
+	}
+	return s, nil
+}
+
+func (s *AWSSink) Name() string { return s.name }
+
+// Send delivers e as a JSON message with the provider and event type as
+// message attributes, so SNS subscriptions and Lambda event source
+// mappings can filter on them.
+func (s *AWSSink) Send(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	var group, dedup *string
+	if s.fifo {
+		group = aws.String(e.Repository)
+		if e.ID != "" {
+			dedup = aws.String(e.Provider + "/" + e.ID + "/" + e.Repository + ":" + e.Tag)
+		}
+	}
+	if s.sqs != nil {
+		_, err = s.sqs.SendMessage(ctx, &sqs.SendMessageInput{
+			QueueUrl:               aws.String(s.queueURL),
+			MessageBody:            aws.String(string(body)),
+			MessageGroupId:         group,
+			MessageDeduplicationId: dedup,
+			MessageAttributes: map[string]sqstypes.MessageAttributeValue{
+				"provider": {DataType: aws.String("String"), StringValue: aws.String(e.Provider)},
+				"type":     {DataType: aws.String("String"), StringValue: aws.String(e.Type)},
+			},
+		})
+		return err
+	}
+	_, err = s.sns.Publish(ctx, &sns.PublishInput{
+		TopicArn:               aws.String(s.topicARN),
+		Message:                aws.String(string(body)),
+		MessageGroupId:         group,
+		MessageDeduplicationId: dedup,
+		MessageAttributes: map[string]snstypes.MessageAttributeValue{
+			"provider": {DataType: aws.String("String"), StringValue: aws.String(e.Provider)},
+			"type":     {DataType: aws.String("String"), StringValue: aws.String(e.Type)},
+		},
+	})
+	return err
+}
@@ -0,0 +1,13 @@
+//go:build no_aws
+
+package main
+
+import "fmt"
+
+type AWSSinkConfig struct {
+	omittedConfig
+}
+
+func (c *AWSSinkConfig) Validate() error { return fmt.Errorf("name: %w", errOmitted("aws")) }
+
+func NewAWSSink(AWSSinkConfig) (Sink, error) { return nil, errOmitted("aws") }
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"runtime/debug"
+	"runtime/metrics"
+	"sync/atomic"
+	"time"
+)
+
+const defaultBudgetInterval = 5 * time.Second
+
+// Pressure levels, in increasing order.
+const (
+	pressureNone int32 = iota
+	// pressureSoft sheds what is cheap to lose: caches shrink, request
+	// buffers stop being pooled and webhooks are no longer mirrored.
+	pressureSoft
+	// pressureHard also sheds low-priority work: dev events are dropped
+	// from the queue instead of being delivered.
+	pressureHard
+)
+
+var pressureNames = []string{"none", "soft", "hard"}
+
+var (
+	receiverHeap = newMetric("receiver_heap_bytes", "gauge",
+		"Heap memory in use by live objects at the last budget check.")
+	receiverGoroutines = newMetric("receiver_goroutines", "gauge",
+		"Goroutines at the last budget check.")
+	receiverPressure = newMetric("receiver_pressure_level", "gauge",
+		"Resource pressure: 0 none, 1 soft (caches shed), 2 hard (low-priority work shed).")
+	receiverShed = newMetric("receiver_shed_total", "counter",
+		"Work and cache entries dropped under resource pressure, by kind.", "kind")
+)
+
+// BudgetsConfig sets the watermarks the receiver throttles itself at, so
+// it degrades predictably instead of being OOM-killed. Set the memory
+// watermarks well below the container's limit: they are compared with the
+// live heap, which excludes runtime overhead and memory not yet collected.
+type BudgetsConfig struct {
+	// SoftMemoryBytes and HardMemoryBytes are heap sizes above which soft
+	// and hard pressure apply.
+	SoftMemoryBytes int64 `json:"softMemoryBytes,omitempty"`
+	HardMemoryBytes int64 `json:"hardMemoryBytes,omitempty"`
+	// MaxGoroutines puts the receiver under hard pressure above this many
+	// goroutines, which usually means a downstream call is stuck.
+	MaxGoroutines int    `json:"maxGoroutines,omitempty"`
+	Interval      string `json:"interval,omitempty"`
+
+	interval time.Duration
+}
+
+func (c *BudgetsConfig) Validate() error {
+	var errs []error
+	if c.SoftMemoryBytes < 0 || c.HardMemoryBytes < 0 || c.MaxGoroutines < 0 {
+		errs = append(errs, errors.New("budgets: limits must not be negative"))
+	}
+	if c.SoftMemoryBytes > 0 && c.HardMemoryBytes > 0 && c.SoftMemoryBytes >= c.HardMemoryBytes {
+		errs = append(errs, errors.New("budgets.softMemoryBytes: must be below hardMemoryBytes"))
+	}
+	if c.SoftMemoryBytes == 0 && c.HardMemoryBytes == 0 && c.MaxGoroutines == 0 {
+		errs = append(errs, errors.New("budgets: at least one limit is required"))
+	}
+	c.interval = defaultBudgetInterval
+	if c.Interval != "" {
+		d, err := time.ParseDuration(c.Interval)
+		if err != nil || d <= 0 {
+			errs = append(errs, errors.New("budgets.interval: must be a positive duration"))
+		}
+		c.interval = d
+	}
+	return errors.Join(errs...)
+}
+
+// Budgets samples memory and goroutines and sets the pressure level the
+// rest of the receiver checks.
+type Budgets struct {
+	cfg   BudgetsConfig
+	level atomic.Int32
+}
+
+// budgets is replaced by main when budgets are configured; without limits
+// the level stays at none.
+var budgets = &Budgets{}
+
+func NewBudgets(cfg BudgetsConfig) *Budgets {
+	return &Budgets{cfg: cfg}
+}
+
+// Level returns the current pressure level.
+func (b *Budgets) Level() int32 { return b.level.Load() }
+
+// shed reports whether work of kind should be skipped at the current
+// level, and counts it if so.
+func (b *Budgets) shed(kind string, at int32) bool {
+	if b.level.Load() < at {
+		return false
+	}
+	receiverShed.add(1, kind)
+	return true
+}
+
+// Run checks the watermarks every interval until ctx is done. With a hard
+// memory watermark the GC is also told to work harder as the heap
+// approaches it.
+func (b *Budgets) Run(ctx context.Context) {
+	if b.cfg.HardMemoryBytes > 0 {
+		debug.SetMemoryLimit(b.cfg.HardMemoryBytes)
+	}
+	samples := []metrics.Sample{
+		{Name: "/memory/classes/heap/objects:bytes"},
+		{Name: "/sched/goroutines:goroutines"},
+	}
+	t := time.NewTicker(b.cfg.interval)
+	defer t.Stop()
+	for {
+		metrics.Read(samples)
+		b.update(int64(samples[0].Value.Uint64()), int(samples[1].Value.Uint64()))
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (b *Budgets) update(heap int64, goroutines int) {
+	receiverHeap.set(float64(heap))
+	receiverGoroutines.set(float64(goroutines))
+
+	level := pressureNone
+	switch {
+	case b.cfg.HardMemoryBytes > 0 && heap >= b.cfg.HardMemoryBytes,
+		b.cfg.MaxGoroutines > 0 && goroutines >= b.cfg.MaxGoroutines:
+		level = pressureHard
+	case b.cfg.SoftMemoryBytes > 0 && heap >= b.cfg.SoftMemoryBytes:
+		level = pressureSoft
+	}
+	prev := b.level.Swap(level)
+	receiverPressure.set(float64(level))
+	if level == prev {
+		return
+	}
+	log.Printf("Resource pressure %s -> %s (heap %d bytes, %d goroutines)",
+		pressureNames[prev], pressureNames[level], heap, goroutines)
+	if level > prev {
+		b.shrinkCaches()
+	}
+}
+
+// shrinkCaches halves the event store and dedup cache. Entries dropped
+// from the dedup cache let a redelivery through as a new event, and
+// dropped events no longer show in /events.
+func (b *Budgets) shrinkCaches() {
+	n := store.shrink()
+	if dedup != nil {
+		n += dedup.shrink()
+	}
+	receiverShed.add(float64(n), "cache")
+	debug.FreeOSMemory()
+}
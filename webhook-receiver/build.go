@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// Providers and the sinks with large client libraries can be left out of
+// the binary with a no_<name> build tag, e.g. for a Docker Hub to Kargo
+// receiver:
+//
+//	go build -tags no_github,no_gitlab,no_nats,no_kafka,no_aws,no_redis
+//
+// The Docker Hub provider and the HTTP, Slack, Kargo and Argo Events sinks
+// are always built in.
+
+// compiledSinks are the optional sink kinds in this build; sink files add
+// themselves in init.
+var compiledSinks = []string{"argoEvents", "kargo", "http", "slack"}
+
+// omittedConfig stands in for the configuration of a sink left out of the
+// build. It accepts any fields, so the configuration still parses and
+// Validate can say what is missing.
+type omittedConfig struct {
+	Name string `json:"name"`
+}
+
+func (c *omittedConfig) UnmarshalJSON(b []byte) error {
+	var v struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	c.Name = v.Name
+	return nil
+}
+
+func errOmitted(tag string) error {
+	return fmt.Errorf("not built into this binary, which was built with -tags no_%s", tag)
+}
+
+// runProviders implements the `providers list` subcommand: it prints the
+// providers and sinks built in and, with -config, which providers the
+// configuration enables.
+func runProviders(args []string) int {
+	if len(args) == 0 || args[0] != "list" {
+		fmt.Fprintln(os.Stderr, "usage: webhook-receiver providers list [-config file]")
+		return 2
+	}
+	fs := flag.NewFlagSet("providers list", flag.ExitOnError)
+	flags := registerFlags(fs)
+	fs.Parse(args[1:])
+
+	cfg := &Config{Server: &ServerConfig{}}
+	if flags.config != "" {
+		var err error
+		if cfg, err = LoadConfig(flags.config, flags); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+			return 1
+		}
+	}
+	paths := make([]string, 0, len(providerRoutes))
+	for path := range providerRoutes {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROVIDER\tPATH\tENABLED")
+	for _, path := range paths {
+		p := providerRoutes[path]
+		fmt.Fprintf(tw, "%s\t%s\t%v\n", p.Name(), path, cfg.Server.providerEnabled(p.Name()))
+	}
+	for _, m := range cfg.Mappers {
+		fmt.Fprintf(tw, "%s\t%s\t%v\n", m.Name, m.path(), true)
+	}
+	tw.Flush()
+	fmt.Printf("\nSinks: %s\n", strings.Join(compiledSinks, ", "))
+	return 0
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CanaryConfig sends Percent of the matching events to a new target instead
+// of the stable sinks. The split is by event identity, so redeliveries of
+// the same image land on the same side.
+type CanaryConfig struct {
+	EventMatch
+	Percent    int               `json:"percent"`
+	ArgoEvents *ArgoEventsConfig `json:"argoEvents,omitempty"`
+}
+
+func (c *CanaryConfig) Validate() error {
+	var errs []error
+	if c.Percent < 0 || c.Percent > 100 {
+		errs = append(errs, errors.New("percent: must be between 0 and 100"))
+	}
+	if err := c.EventMatch.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.ArgoEvents == nil {
+		errs = append(errs, errors.New("a target is required"))
+	} else if err := c.ArgoEvents.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("argoEvents: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+const (
+	roleStable = "stable"
+	roleCanary = "canary"
+)
+
+// targetStats are the outcome counters compared between the two sides.
+type targetStats struct {
+	Events    int64   `json:"events"`
+	Failures  int64   `json:"failures"`
+	ErrorRate float64 `json:"errorRate"`
+	AvgMillis float64 `json:"avgMillis"`
+
+	totalTime time.Duration
+}
+
+type CanaryRouter struct {
+	match   EventMatch
+	percent int
+	target  Sink
+
+	mu    sync.Mutex
+	stats map[string]*targetStats
+}
+
+// canary is set by main when a canary target is configured.
+var canary *CanaryRouter
+
+func NewCanaryRouter(cfg CanaryConfig) (*CanaryRouter, error) {
+	target, err := NewArgoEventsSink(*cfg.ArgoEvents)
+	if err != nil {
+		return nil, err
+	}
+	return &CanaryRouter{
+		match:   cfg.EventMatch,
+		percent: cfg.Percent,
+		target:  target,
+		stats: map[string]*targetStats{
+			roleStable: {},
+			roleCanary: {},
+		},
+	}, nil
+}
+
+// selects reports whether a matching event falls in the canary share.
+func (c *CanaryRouter) selects(e Event) bool {
+	h := fnv.New32a()
+	h.Write([]byte(e.Provider + "/" + e.Repository + ":" + e.Tag + "@" + e.Digest))
+	return int(h.Sum32()%100) < c.percent
+}
+
+// route returns the sinks for e and the side they belong to. Events outside
+// the match are not counted in the comparison.
+func (c *CanaryRouter) route(e Event, stable []Sink) ([]Sink, string) {
+	// Events routing dropped stay dropped.
+	if len(stable) == 0 || !c.match.matches(e) {
+		return stable, ""
+	}
+	if c.selects(e) {
+		return []Sink{c.target}, roleCanary
+	}
+	return stable, roleStable
+}
+
+func (c *CanaryRouter) record(role string, took time.Duration, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.stats[role]
+	s.Events++
+	if err != nil {
+		s.Failures++
+	}
+	s.totalTime += took
+}
+
+// statsHandler serves GET /admin/canary with per-side outcomes.
+func (c *CanaryRouter) statsHandler(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	out := make(map[string]targetStats, len(c.stats))
+	for role, s := range c.stats {
+		v := *s
+		if v.Events > 0 {
+			v.ErrorRate = float64(v.Failures) / float64(v.Events)
+			v.AvgMillis = float64(v.totalTime.Milliseconds()) / float64(v.Events)
+		}
+		out[role] = v
+	}
+	c.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"percent": c.percent,
+		"targets": out,
+	})
+}
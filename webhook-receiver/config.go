@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	configVersion = "v1"
+	minSigningKey = 32
+)
+
+// Config is the receiver's versioned configuration file. Unknown fields are
+// rejected so that typos fail at load time instead of silently falling back
+// to defaults. Environment variables override values from the file.
+type Config struct {
+	Version string `json:"version"`
+	// Listeners default to a single dual-stack listener on the standard
+	// port.
+	Listeners   []ListenerConfig   `json:"listeners,omitempty"`
+	Server      *ServerConfig      `json:"server,omitempty"`
+	Log         *LogConfig         `json:"log,omitempty"`
+	Tracing     *TracingConfig     `json:"tracing,omitempty"`
+	OIDC        *OIDCConfig        `json:"oidc,omitempty"`
+	LinkSigning *LinkSigningConfig `json:"linkSigning,omitempty"`
+	StubsFile   string             `json:"stubsFile,omitempty"`
+	Features    *FeaturesConfig    `json:"features,omitempty"`
+	Sinks       *SinksConfig       `json:"sinks,omitempty"`
+	Routing     *RoutingConfig     `json:"routing,omitempty"`
+	Relay       *RelayConfig       `json:"relay,omitempty"`
+	Mirror      *MirrorConfig      `json:"mirror,omitempty"`
+	Dedup       *DedupConfig       `json:"dedup,omitempty"`
+	Queue       *QueueConfig       `json:"queue,omitempty"`
+	DLQ         *DLQConfig         `json:"dlq,omitempty"`
+	Store       *StoreConfig       `json:"store,omitempty"`
+	Archive     *ArchiveConfig     `json:"archive,omitempty"`
+	GAR         *GARConfig         `json:"gar,omitempty"`
+	DockerHub   *DockerHubConfig   `json:"dockerhub,omitempty"`
+	Tenants     []TenantConfig     `json:"tenants,omitempty"`
+	Incidents   *IncidentsConfig   `json:"incidents,omitempty"`
+	Mappers     []MapperConfig     `json:"mappers,omitempty"`
+	// VirtualHosts route requests by Host header, each with its own path
+	// prefix, tenant and external URL.
+	VirtualHosts []VirtualHostConfig `json:"virtualHosts,omitempty"`
+	// Auth selects a signing scheme per provider name, replacing the
+	// provider's built-in secret check.
+	Auth map[string]*AuthConfig `json:"auth,omitempty"`
+	// RedisConsumer delivers events published to a Redis Stream by
+	// another receiver's Redis sink.
+	RedisConsumer *RedisConsumerConfig `json:"redisConsumer,omitempty"`
+	// ProviderSecrets give built-in providers secrets of their own instead
+	// of server.secrets, by provider name.
+	ProviderSecrets map[string]*SecretsConfig `json:"providerSecrets,omitempty"`
+	// Budgets throttle the receiver under memory or goroutine pressure.
+	Budgets *BudgetsConfig `json:"budgets,omitempty"`
+
+	stubs *StubsFile
+}
+
+type LinkSigningConfig struct {
+	KeyFile string `json:"keyFile,omitempty"`
+	BaseURL string `json:"baseURL,omitempty"`
+
+	key string
+}
+
+// LoadConfig reads the config file at path (if any), applies environment
+// and command-line overrides and validates the result, including the files
+// it references. Files ending in .yaml or .yml are read as YAML.
+func LoadConfig(path string, flags *cliFlags) (*Config, error) {
+	cfg := &Config{Version: configVersion}
+	if path != "" {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if ext := filepath.Ext(path); ext == ".yaml" || ext == ".yml" {
+			if raw, err = yaml.YAMLToJSON(raw); err != nil {
+				return nil, fmt.Errorf("parsing %s: %w", path, err)
+			}
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(cfg); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+	}
+	cfg.applyEnv()
+	flags.apply(cfg)
+	return cfg, cfg.Validate()
+}
+
+func (c *Config) applyEnv() {
+	if v := os.Getenv("LISTEN_ADDRESS"); v != "" {
+		c.Listeners = nil
+		for _, addr := range splitList(v) {
+			c.Listeners = append(c.Listeners, ListenerConfig{Address: addr})
+		}
+	}
+	if cert, key := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE"); cert != "" || key != "" {
+		c.server().TLS = &TLSConfig{CertFile: cert, KeyFile: key}
+	}
+	if v := os.Getenv("PATH_PREFIX"); v != "" {
+		c.server().PathPrefix = v
+	}
+	if v := os.Getenv("WEBHOOK_SECRET_FILE"); v != "" {
+		c.server().SecretFile = v
+	}
+	if v := os.Getenv("READ_TIMEOUT"); v != "" {
+		c.server().ReadTimeout = v
+	}
+	if v := os.Getenv("WRITE_TIMEOUT"); v != "" {
+		c.server().WriteTimeout = v
+	}
+	if v := os.Getenv("SHUTDOWN_TIMEOUT"); v != "" {
+		c.server().ShutdownTimeout = v
+	}
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		c.logConfig().Level = v
+	}
+	if v := os.Getenv("LOG_FORMAT"); v != "" {
+		c.logConfig().Format = v
+	}
+	if v := os.Getenv("STUBS_FILE"); v != "" {
+		c.StubsFile = v
+	}
+	if v := os.Getenv("OIDC_ISSUER"); v != "" {
+		if c.OIDC == nil {
+			c.OIDC = &OIDCConfig{}
+		}
+		c.OIDC.Issuer = v
+	}
+	if c.OIDC != nil {
+		if v := os.Getenv("OIDC_AUDIENCE"); v != "" {
+			c.OIDC.Audience = v
+		}
+		if v := os.Getenv("OIDC_ROLES_CLAIM"); v != "" {
+			c.OIDC.RolesClaim = v
+		}
+		if v := os.Getenv("OIDC_READ_ROLES"); v != "" {
+			c.OIDC.ReadRoles = splitList(v)
+		}
+		if v := os.Getenv("OIDC_WRITE_ROLES"); v != "" {
+			c.OIDC.WriteRoles = splitList(v)
+		}
+	}
+	if v := os.Getenv("LINK_SIGNING_KEY"); v != "" {
+		if c.LinkSigning == nil {
+			c.LinkSigning = &LinkSigningConfig{}
+		}
+		c.LinkSigning.key = v
+	}
+	if v := os.Getenv("DASHBOARD_BASE_URL"); v != "" && c.LinkSigning != nil {
+		c.LinkSigning.BaseURL = v
+	}
+}
+
+// Validate checks every section and returns all problems found at once.
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Version != configVersion {
+		errs = append(errs, fmt.Errorf("version: unsupported %q (want %q)", c.Version, configVersion))
+	}
+
+	if err := c.server().Validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if c.Log != nil {
+		if err := c.Log.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if c.Tracing != nil {
+		if err := c.Tracing.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for i := range c.Listeners {
+		if err := c.Listeners[i].Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("listeners[%d].%w", i, err))
+		}
+	}
+
+	if o := c.OIDC; o != nil {
+		if u, err := url.Parse(o.Issuer); err != nil || u.Scheme != "https" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("oidc.issuer: must be an https URL"))
+		}
+		if o.Audience == "" {
+			errs = append(errs, errors.New("oidc.audience: required"))
+		}
+		if len(o.ReadRoles) == 0 && len(o.WriteRoles) == 0 {
+			errs = append(errs, errors.New("oidc: at least one of readRoles or writeRoles is required"))
+		}
+	}
+
+	if l := c.LinkSigning; l != nil {
+		if c.OIDC == nil {
+			errs = append(errs, errors.New("linkSigning: requires oidc, signed links only apply to admin endpoints"))
+		}
+		if l.KeyFile != "" {
+			b, err := os.ReadFile(l.KeyFile)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("linkSigning.keyFile: %w", err))
+			} else if l.key == "" {
+				l.key = strings.TrimSpace(string(b))
+			}
+		}
+		if len(l.key) < minSigningKey {
+			errs = append(errs, fmt.Errorf("linkSigning: key must be at least %d bytes", minSigningKey))
+		}
+		if l.BaseURL != "" {
+			if u, err := url.Parse(l.BaseURL); err != nil || u.Host == "" {
+				errs = append(errs, errors.New("linkSigning.baseURL: must be an absolute URL"))
+			}
+		}
+	}
+
+	if c.Features != nil {
+		if err := c.Features.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if c.Sinks != nil {
+		if err := c.Sinks.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if c.Routing != nil {
+		if err := c.Routing.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if c.Dedup != nil {
+		if err := c.Dedup.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if c.Relay != nil {
+		if err := c.Relay.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if c.Mirror != nil {
+		if err := c.Mirror.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if c.DLQ != nil {
+		if err := c.DLQ.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if c.Budgets != nil {
+		if err := c.Budgets.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if rc := c.RedisConsumer; rc != nil {
+		if err := rc.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("redisConsumer.%w", err))
+		}
+		if c.Sinks != nil {
+			errs = append(errs, rc.loops(c.Sinks.Redis)...)
+		}
+	}
+
+	if err := validateMappers(c.Mappers); err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(c.Auth) > 0 || len(c.ProviderSecrets) > 0 {
+		names := make(map[string]bool)
+		for _, p := range providerRoutes {
+			names[p.Name()] = true
+		}
+		for _, m := range c.Mappers {
+			names[m.Name] = true
+		}
+		for name, sc := range c.ProviderSecrets {
+			if !names[name] {
+				errs = append(errs, fmt.Errorf("providerSecrets.%s: unknown provider", name))
+				continue
+			}
+			if err := sc.Validate(); err != nil {
+				errs = append(errs, fmt.Errorf("providerSecrets.%s.%w", name, err))
+			}
+		}
+		for name, a := range c.Auth {
+			if !names[name] {
+				errs = append(errs, fmt.Errorf("auth.%s: unknown provider", name))
+				continue
+			}
+			if err := a.Validate(); err != nil {
+				errs = append(errs, fmt.Errorf("auth.%s.%w", name, err))
+			} else if a.Scheme == schemeDockerHubCallback && a.secrets == nil && !c.server().AllowedSources.covers(name) {
+				errs = append(errs, fmt.Errorf("auth.%s: %s needs secretFile, secrets or server.allowedSources.allowedCIDRs covering %s", name, a.Scheme, name))
+			}
+		}
+	}
+
+	if c.Queue != nil {
+		if err := c.Queue.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if c.Store != nil {
+		if err := c.Store.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if c.Archive != nil {
+		if err := c.Archive.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := validateTenants(c.Tenants, c.VirtualHosts); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := validateVirtualHosts(c.VirtualHosts, c.Tenants); err != nil {
+		errs = append(errs, err)
+	}
+
+	if c.Incidents != nil {
+		if err := c.Incidents.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if c.GAR != nil {
+		if err := c.GAR.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if c.DockerHub != nil {
+		if err := c.DockerHub.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if c.StubsFile != "" {
+		sf, err := LoadStubsFile(c.StubsFile)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("stubsFile: %w", err))
+		}
+		c.stubs = sf
+	}
+	return errors.Join(errs...)
+}
+
+// runValidate implements the `config validate` subcommand, also run as
+// `validate`: it loads and checks the configuration without starting any
+// servers.
+func runValidate(args []string) int {
+	fs := flag.NewFlagSet("config validate", flag.ExitOnError)
+	flags := registerFlags(fs)
+	fs.Parse(args)
+
+	if _, err := LoadConfig(flags.config, flags); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+		return 1
+	}
+	fmt.Println("Configuration is valid")
+	return 0
+}
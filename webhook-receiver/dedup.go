@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDedupTTL        = 10 * time.Minute
+	defaultDedupMaxEntries = 100000
+)
+
+// DedupConfig drops redeliveries of events already processed within TTL.
+// Events are keyed on the provider's delivery ID, or on repository, tag
+// and digest when there is none; events with neither an ID nor a digest
+// are never treated as duplicates, since a tag alone can legitimately be
+// pushed again.
+type DedupConfig struct {
+	TTL        string `json:"ttl,omitempty"`
+	MaxEntries int    `json:"maxEntries,omitempty"`
+
+	ttl time.Duration
+}
+
+func (c *DedupConfig) Validate() error {
+	c.ttl = defaultDedupTTL
+	if c.TTL != "" {
+		d, err := time.ParseDuration(c.TTL)
+		if err != nil || d <= 0 {
+			return errors.New("dedup.ttl: must be a positive duration")
+		}
+		c.ttl = d
+	}
+	if c.MaxEntries < 0 {
+		return errors.New("dedup.maxEntries: must not be negative")
+	}
+	return nil
+}
+
+type Dedup struct {
+	ttl time.Duration
+	max int
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// dedup is set by main when deduplication is configured.
+var dedup *Dedup
+
+func NewDedup(cfg DedupConfig) *Dedup {
+	d := &Dedup{ttl: cfg.ttl, max: cfg.MaxEntries, seen: make(map[string]time.Time)}
+	if d.max == 0 {
+		d.max = defaultDedupMaxEntries
+	}
+	return d
+}
+
+func dedupKey(e Event) string {
+	if e.ID != "" {
+		return e.Provider + "\x00id\x00" + e.ID
+	}
+	if e.Digest != "" {
+		return e.Provider + "\x00" + e.Repository + "\x00" + e.Tag + "\x00" + e.Digest
+	}
+	return ""
+}
+
+// Filter returns the events not seen within the TTL and marks them seen.
+// keys identifies what was marked, for Forget.
+func (d *Dedup) Filter(events []Event) (fresh []Event, duplicates int, keys []string) {
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.seen) >= d.max {
+		d.sweep(now)
+	}
+	for _, e := range events {
+		key := dedupKey(e)
+		if key == "" {
+			fresh = append(fresh, e)
+			continue
+		}
+		if at, ok := d.seen[key]; ok && now.Sub(at) < d.ttl {
+			duplicates++
+			continue
+		}
+		d.seen[key] = now
+		keys = append(keys, key)
+		fresh = append(fresh, e)
+	}
+	return fresh, duplicates, keys
+}
+
+// Forget unmarks keys, for events that were not processed after all and
+// will be redelivered.
+func (d *Dedup) Forget(keys []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, k := range keys {
+		delete(d.seen, k)
+	}
+}
+
+// Snapshot returns the entries still within the TTL and when each was
+// seen.
+func (d *Dedup) Snapshot() map[string]time.Time {
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := make(map[string]time.Time, len(d.seen))
+	for k, at := range d.seen {
+		if now.Sub(at) < d.ttl {
+			out[k] = at
+		}
+	}
+	return out
+}
+
+// Restore adds the entries of a Snapshot that are still within the TTL,
+// keeping the later time for keys already seen, and returns how many it
+// took.
+func (d *Dedup) Restore(entries map[string]time.Time) int {
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var n int
+	for k, at := range entries {
+		if now.Sub(at) >= d.ttl || len(d.seen) >= d.max {
+			continue
+		}
+		if prev, ok := d.seen[k]; !ok || at.After(prev) {
+			d.seen[k] = at
+		}
+		n++
+	}
+	return n
+}
+
+// sweep drops expired entries, and the oldest ones if the cache is still
+// full. The caller holds d.mu.
+func (d *Dedup) sweep(now time.Time) {
+	var oldestKey string
+	var oldest time.Time
+	for k, at := range d.seen {
+		if now.Sub(at) >= d.ttl {
+			delete(d.seen, k)
+		} else if oldestKey == "" || at.Before(oldest) {
+			oldestKey, oldest = k, at
+		}
+	}
+	if len(d.seen) >= d.max {
+		delete(d.seen, oldestKey)
+	}
+}
+
+// shrink drops the older half of the entries, to free memory. Events whose
+// entry is dropped are no longer recognised as duplicates.
+func (d *Dedup) shrink() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	times := make([]time.Time, 0, len(d.seen))
+	for _, at := range d.seen {
+		times = append(times, at)
+	}
+	if len(times) == 0 {
+		return 0
+	}
+	slices.SortFunc(times, time.Time.Compare)
+	cutoff := times[len(times)/2]
+	n := len(d.seen)
+	for k, at := range d.seen {
+		if at.Before(cutoff) {
+			delete(d.seen, k)
+		}
+	}
+	// Rebuild, since a map does not give back memory as it empties.
+	seen := make(map[string]time.Time, len(d.seen))
+	for k, at := range d.seen {
+		seen[k] = at
+	}
+	d.seen = seen
+	return n - len(d.seen)
+}
@@ -0,0 +1,97 @@
+//go:build !no_distribution
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	distributionPath = "/webhook/distribution"
+	// distributionEventsType is the envelope media type registry:2 sends.
+	distributionEventsType = "application/vnd.docker.distribution.events.v1+json"
+)
+
+func init() {
+	registerProvider(distributionPath, distributionProvider{})
+}
+
+// DistributionEnvelope is the notification body of the open source
+// registry (distribution/registry:2) and the mirrors built on it.
+type DistributionEnvelope struct {
+	Events []struct {
+		ID        string    `json:"id"`
+		Timestamp time.Time `json:"timestamp"`
+		Action    string    `json:"action"`
+		Target    struct {
+			MediaType  string `json:"mediaType"`
+			Digest     string `json:"digest"`
+			Repository string `json:"repository"`
+			URL        string `json:"url"`
+			Tag        string `json:"tag"`
+		} `json:"target"`
+		Request struct {
+			Host string `json:"host"`
+		} `json:"request"`
+	} `json:"events"`
+}
+
+// distributionProvider accepts events from a registry's `notifications`
+// endpoint. The registry sends the headers configured on the endpoint, so
+// the shared secret goes in the secret header there.
+type distributionProvider struct{}
+
+func (distributionProvider) Name() string { return "distribution" }
+
+func (p distributionProvider) Authenticate(r *http.Request, _ []byte) error {
+	return checkSecret(r, p.Name(), r.Header.Get(secretHeader))
+}
+
+func (distributionProvider) Parse(r *http.Request, body []byte) ([]Event, error) {
+	if ct := r.Header.Get("Content-Type"); ct != "" && !strings.HasPrefix(ct, distributionEventsType) &&
+		!strings.HasPrefix(ct, "application/json") {
+		log.Printf("Unexpected distribution notification content type %s", ct)
+	}
+	var env DistributionEnvelope
+	if err := json.Unmarshal(body, &env); err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	for _, e := range env.Events {
+		var kind string
+		switch e.Action {
+		case "push":
+			kind = EventPush
+		case "delete":
+			kind = EventDelete
+		default:
+			// pull and mount are too frequent to forward.
+			continue
+		}
+		// Layer blobs are reported individually; only manifests describe
+		// something a Warehouse can subscribe to. Deletes carry no media
+		// type.
+		mt := e.Target.MediaType
+		if kind == EventPush && !strings.Contains(mt, "manifest") && !strings.Contains(mt, "image.index") {
+			continue
+		}
+		events = append(events, Event{
+			ID:         e.ID,
+			Provider:   "distribution",
+			Type:       kind,
+			Registry:   e.Request.Host,
+			Repository: e.Target.Repository,
+			Tag:        e.Target.Tag,
+			Digest:     e.Target.Digest,
+			MediaType:  mt,
+			URL:        e.Target.URL,
+			Timestamp:  e.Timestamp,
+		})
+	}
+	return events, nil
+}
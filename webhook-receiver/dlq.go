@@ -0,0 +1,224 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	defaultSinkAttempts = 3
+	defaultSinkBackoff  = time.Second
+	defaultDLQCapacity  = 1000
+)
+
+// DLQConfig sets how hard delivery to a sink is tried before the event is
+// parked in the dead-letter queue for an operator to inspect and retry.
+type DLQConfig struct {
+	// MaxAttempts per sink, including the first.
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+	// Backoff before the second attempt, doubling after each further one.
+	Backoff string `json:"backoff,omitempty"`
+	// Capacity bounds the queue; the oldest entries are dropped beyond it.
+	Capacity int `json:"capacity,omitempty"`
+
+	backoff time.Duration
+}
+
+func (c *DLQConfig) Validate() error {
+	var errs []error
+	if c.MaxAttempts < 0 || c.Capacity < 0 {
+		errs = append(errs, errors.New("dlq: maxAttempts and capacity must not be negative"))
+	}
+	if c.Backoff != "" {
+		d, err := time.ParseDuration(c.Backoff)
+		if err != nil || d <= 0 {
+			errs = append(errs, errors.New("dlq.backoff: must be a positive duration"))
+		}
+		c.backoff = d
+	}
+	return errors.Join(errs...)
+}
+
+// DLQEntry is an event some sinks did not take after every attempt.
+type DLQEntry struct {
+	ID       uint64    `json:"id"`
+	Time     time.Time `json:"time"`
+	Event    Event     `json:"event"`
+	Sinks    []string  `json:"sinks"`
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error"`
+	// Tenant the event was resolved to when it was received.
+	Tenant string `json:"tenant,omitempty"`
+	// Seq of the event in the event store, if it was recorded there.
+	Seq uint64 `json:"seq,omitempty"`
+
+	header http.Header
+	host   *VirtualHostConfig
+}
+
+type DeadLetterQueue struct {
+	attempts int
+	backoff  time.Duration
+	capacity int
+
+	mu      sync.Mutex
+	entries []DLQEntry
+	seq     uint64
+}
+
+// dlq is replaced by main when the dead-letter queue is configured.
+var dlq = NewDeadLetterQueue(DLQConfig{})
+
+func NewDeadLetterQueue(cfg DLQConfig) *DeadLetterQueue {
+	q := &DeadLetterQueue{attempts: cfg.MaxAttempts, backoff: cfg.backoff, capacity: cfg.Capacity}
+	if q.attempts == 0 {
+		q.attempts = defaultSinkAttempts
+	}
+	if q.backoff == 0 {
+		q.backoff = defaultSinkBackoff
+	}
+	if q.capacity == 0 {
+		q.capacity = defaultDLQCapacity
+	}
+	return q
+}
+
+// send delivers e to s, retrying failures with backoff. It returns the
+// number of attempts made and the last error.
+func (q *DeadLetterQueue) send(ctx context.Context, s Sink, e Event) (int, error) {
+	backoff := q.backoff
+	for attempt := 1; ; attempt++ {
+		sctx, span := startSpan(ctx, "sink "+s.Name(), attribute.String("event.repository", e.Repository))
+		sctx, done := watchdog.start(sctx, "sink "+s.Name(), budgetSink)
+		err := s.Send(sctx, e)
+		done()
+		endSpan(span, err)
+		if err == nil || attempt == q.attempts {
+			return attempt, err
+		}
+		requestLogger(ctx).Warn("Sink failed, retrying", "sink", s.Name(), "attempt", attempt, "backoff", backoff, "error", err)
+		select {
+		case <-ctx.Done():
+			return attempt, err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// Add parks e for the sinks that failed. ctx supplies the request headers
+// routing rules need when it is retried, and the tenant and virtual host it
+// was received for.
+func (q *DeadLetterQueue) Add(ctx context.Context, e Event, sinks []string, attempts int, err error) {
+	seq, _ := storeSeq(ctx)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.seq++
+	q.entries = append(q.entries, DLQEntry{
+		ID:       q.seq,
+		Time:     time.Now().UTC(),
+		Event:    e,
+		Sinks:    sinks,
+		Attempts: attempts,
+		Error:    err.Error(),
+		Tenant:   tenants.Resolve(ctx, e),
+		Seq:      seq,
+		header:   requestHeaders(ctx),
+		host:     virtualHost(ctx),
+	})
+	if len(q.entries) > q.capacity {
+		dropped := q.entries[0]
+		q.entries = q.entries[1:]
+		log.Printf("Dead-letter queue full, dropping entry %d (%s:%s)", dropped.ID, dropped.Event.Repository, dropped.Event.Tag)
+	}
+}
+
+// take removes and returns entry id.
+func (q *DeadLetterQueue) take(id uint64) (DLQEntry, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	i := slices.IndexFunc(q.entries, func(d DLQEntry) bool { return d.ID == id })
+	if i < 0 {
+		return DLQEntry{}, false
+	}
+	d := q.entries[i]
+	q.entries = slices.Delete(q.entries, i, i+1)
+	return d, true
+}
+
+// restore puts back an entry that could not be requeued.
+func (q *DeadLetterQueue) restore(d DLQEntry) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	i, _ := slices.BinarySearchFunc(q.entries, d.ID, func(e DLQEntry, id uint64) int {
+		return cmp.Compare(e.ID, id)
+	})
+	q.entries = slices.Insert(q.entries, i, d)
+}
+
+// listHandler serves GET /admin/dlq, oldest entry first.
+func (q *DeadLetterQueue) listHandler(w http.ResponseWriter, r *http.Request) {
+	q.mu.Lock()
+	entries := slices.Clone(q.entries)
+	q.mu.Unlock()
+	if entries == nil {
+		entries = []DLQEntry{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"entries": entries})
+}
+
+// retryHandler serves POST /admin/dlq/{id}/retry, moving the entry back
+// onto the processing queue for the sinks that failed.
+func (q *DeadLetterQueue) retryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+	d, ok := q.take(id)
+	if !ok {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	ctx := withTenant(withHeaders(context.Background(), d.header), d.Tenant)
+	if d.host != nil {
+		ctx = context.WithValue(ctx, virtualHostKey{}, d.host)
+	}
+	if d.Seq != 0 {
+		ctx = withStoreSeq(ctx, d.Seq)
+	}
+	ctx = withRetrySinks(ctx, d.Sinks)
+	if !queue.Push(ctx, d.Event) {
+		q.restore(d)
+		http.Error(w, "Queue full", http.StatusServiceUnavailable)
+		return
+	}
+	log.Printf("Requeued dead letter %d (%s:%s) for %v", id, d.Event.Repository, d.Event.Tag, d.Sinks)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]any{"requeued": id, "sinks": d.Sinks})
+}
+
+type retrySinksKey struct{}
+
+// withRetrySinks limits delivery of a retried event to the named sinks,
+// so those that took it the first time do not get it twice.
+func withRetrySinks(ctx context.Context, names []string) context.Context {
+	return context.WithValue(ctx, retrySinksKey{}, names)
+}
+
+func retrySinks(ctx context.Context) ([]string, bool) {
+	names, ok := ctx.Value(retrySinksKey{}).([]string)
+	return names, ok
+}
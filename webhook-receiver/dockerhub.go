@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultCallbackTimeout = 10 * time.Second
+	defaultCallbackRetries = 3
+	maxCallbackRetries     = 10
+	callbackBackoff        = time.Second
+	callbackContext        = "kargo-webhook-receiver"
+)
+
+func init() {
+	registerProvider(webhookPath, dockerHubProvider{})
+}
+
+// DockerHubConfig enables validating deliveries through the callback_url of
+// the push payload. Docker Hub shows a delivery as validated once the
+// receiver reports a success state there; a webhook chain stops at the
+// first failure.
+type DockerHubConfig struct {
+	Callbacks bool `json:"callbacks"`
+	// CallbackTimeout bounds each attempt.
+	CallbackTimeout string `json:"callbackTimeout,omitempty"`
+	// CallbackRetries is the number of attempts after the first; server
+	// errors and network failures are retried with exponential backoff.
+	CallbackRetries *int `json:"callbackRetries,omitempty"`
+	// CallbackHosts are the hosts callback URLs may point at.
+	CallbackHosts []string `json:"callbackHosts,omitempty"`
+
+	timeout time.Duration
+	retries int
+}
+
+func (c *DockerHubConfig) Validate() error {
+	var errs []error
+	c.timeout = defaultCallbackTimeout
+	if c.CallbackTimeout != "" {
+		d, err := time.ParseDuration(c.CallbackTimeout)
+		if err != nil || d <= 0 {
+			errs = append(errs, errors.New("dockerhub.callbackTimeout: must be a positive duration"))
+		}
+		c.timeout = d
+	}
+	c.retries = defaultCallbackRetries
+	if r := c.CallbackRetries; r != nil {
+		if *r < 0 || *r > maxCallbackRetries {
+			errs = append(errs, fmt.Errorf("dockerhub.callbackRetries: must be between 0 and %d", maxCallbackRetries))
+		}
+		c.retries = *r
+	}
+	if len(c.CallbackHosts) == 0 {
+		c.CallbackHosts = []string{"registry.hub.docker.com"}
+	}
+	for i, h := range c.CallbackHosts {
+		if h == "" {
+			errs = append(errs, fmt.Errorf("dockerhub.callbackHosts[%d]: empty", i))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// dockerHubCallbacks is set by main when callbacks are enabled.
+var dockerHubCallbacks *callbackClient
+
+type callbackClient struct {
+	timeout time.Duration
+	retries int
+	hosts   map[string]bool
+}
+
+func newCallbackClient(cfg DockerHubConfig) *callbackClient {
+	c := &callbackClient{timeout: cfg.timeout, retries: cfg.retries, hosts: make(map[string]bool)}
+	for _, h := range cfg.CallbackHosts {
+		c.hosts[h] = true
+	}
+	return c
+}
+
+// acknowledge reports the delivery outcome of e to its callback URL, if it
+// has one. It does not block the caller.
+func acknowledge(e Event, failed error) {
+	if dockerHubCallbacks == nil || e.callbackURL == "" {
+		return
+	}
+	state, desc := outcomeSuccess, "Delivered"
+	if failed != nil {
+		state, desc = outcomeFailure, failed.Error()
+	}
+	goBackground(func() {
+		if err := dockerHubCallbacks.send(context.Background(), e.callbackURL, state, desc); err != nil {
+			log.Printf("Docker Hub callback for %s:%s failed: %v", e.Repository, e.Tag, err)
+		}
+	})
+}
+
+func (c *callbackClient) send(ctx context.Context, rawURL, state, desc string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "https" || !c.hosts[u.Hostname()] {
+		return fmt.Errorf("callback URL %q is not allowed", rawURL)
+	}
+	body, _ := json.Marshal(map[string]string{
+		"state":       state,
+		"description": desc,
+		"context":     callbackContext,
+	})
+
+	backoff := callbackBackoff
+	for attempt := 0; ; attempt++ {
+		retry, err := c.post(ctx, rawURL, body)
+		if err == nil || !retry || attempt == c.retries {
+			return err
+		}
+		log.Printf("Docker Hub callback attempt %d failed, retrying in %v: %v", attempt+1, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post makes one attempt and reports whether a failure is worth retrying.
+func (c *callbackClient) post(ctx context.Context, rawURL string, body []byte) (bool, error) {
+	ctx, done := watchdog.start(ctx, "dockerhub callback", c.timeout)
+	defer done()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := outboundClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return retry, fmt.Errorf("status %s", resp.Status)
+	}
+	return false, nil
+}
+
+type DockerHubPush struct {
+	PushData struct {
+		PushedAt json.Number `json:"pushed_at"`
+		Tag      string      `json:"tag"`
+	} `json:"push_data"`
+	Repository struct {
+		Name     string `json:"name"`
+		RepoName string `json:"repo_name"`
+	} `json:"repository"`
+	CallbackURL string `json:"callback_url"`
+}
+
+type dockerHubProvider struct{}
+
+func (dockerHubProvider) Name() string { return "dockerhub" }
+
+func (p dockerHubProvider) Authenticate(r *http.Request, _ []byte) error {
+	return checkSecret(r, p.Name(), r.Header.Get(secretHeader))
+}
+
+func (dockerHubProvider) Parse(_ *http.Request, body []byte) ([]Event, error) {
+	var push DockerHubPush
+	if err := json.Unmarshal(body, &push); err != nil {
+		return nil, err
+	}
+
+	ts := time.Now()
+	if secs, err := strconv.ParseFloat(push.PushData.PushedAt.String(), 64); err == nil && secs > 0 {
+		ts = time.Unix(int64(secs), 0)
+	}
+	return []Event{{
+		Provider:   "dockerhub",
+		Type:       EventPush,
+		Registry:   "docker.io",
+		Repository: push.Repository.RepoName,
+		Tag:        push.PushData.Tag,
+		Timestamp:  ts,
+
+		callbackURL: push.CallbackURL,
+	}}, nil
+}
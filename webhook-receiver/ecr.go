@@ -0,0 +1,166 @@
+//go:build !no_ecr
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+const (
+	ecrPath = "/webhook/ecr"
+
+	snsMessageTypeHeader = "X-Amz-Sns-Message-Type"
+	snsConfirmTimeout    = 10 * time.Second
+)
+
+// snsHostRe restricts subscription confirmation to SNS endpoints, so a
+// forged confirmation cannot make the receiver fetch arbitrary URLs.
+var snsHostRe = regexp.MustCompile(`^sns\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+
+func init() {
+	registerProvider(ecrPath, ecrProvider{})
+}
+
+// EventBridgeEvent is the envelope EventBridge delivers to API destinations
+// and publishes to SNS topics.
+type EventBridgeEvent struct {
+	ID         string    `json:"id"`
+	DetailType string    `json:"detail-type"`
+	Source     string    `json:"source"`
+	Account    string    `json:"account"`
+	Region     string    `json:"region"`
+	Time       time.Time `json:"time"`
+	Detail     struct {
+		Result         string `json:"result"`
+		ActionType     string `json:"action-type"`
+		RepositoryName string `json:"repository-name"`
+		ImageDigest    string `json:"image-digest"`
+		ImageTag       string `json:"image-tag"`
+		MediaType      string `json:"manifest-media-type"`
+	} `json:"detail"`
+}
+
+type snsMessage struct {
+	Type         string `json:"Type"`
+	MessageID    string `json:"MessageId"`
+	TopicArn     string `json:"TopicArn"`
+	Message      string `json:"Message"`
+	SubscribeURL string `json:"SubscribeURL"`
+}
+
+// ecrProvider accepts ECR "ECR Image Action" events, either sent directly
+// by an EventBridge API destination or relayed through an SNS topic. API
+// destinations send the secret in the connection's API key header; SNS
+// cannot add headers, so its subscription URL carries it in `code`.
+type ecrProvider struct{}
+
+func (ecrProvider) Name() string { return "ecr" }
+
+func (p ecrProvider) Authenticate(r *http.Request, _ []byte) error {
+	if code := r.URL.Query().Get("code"); code != "" {
+		return checkSecret(r, p.Name(), code)
+	}
+	return checkSecret(r, p.Name(), r.Header.Get(secretHeader))
+}
+
+// Handshake confirms SNS subscriptions by fetching the SubscribeURL.
+func (p ecrProvider) Handshake(w http.ResponseWriter, r *http.Request, body []byte) bool {
+	if r.Header.Get(snsMessageTypeHeader) != "SubscriptionConfirmation" {
+		return false
+	}
+	if err := p.Authenticate(r, body); err != nil {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return true
+	}
+	var msg snsMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return true
+	}
+	u, err := url.Parse(msg.SubscribeURL)
+	if err != nil || u.Scheme != "https" || !snsHostRe.MatchString(u.Host) {
+		log.Printf("Refusing SNS subscription confirmation URL %q", msg.SubscribeURL)
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), snsConfirmTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return true
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			err = fmt.Errorf("SNS returned %s", resp.Status)
+		}
+	}
+	if err != nil {
+		log.Printf("Confirming SNS subscription to %s failed: %v", msg.TopicArn, err)
+		http.Error(w, "Confirmation failed", http.StatusBadGateway)
+		return true
+	}
+	log.Printf("Confirmed SNS subscription to %s", msg.TopicArn)
+	w.WriteHeader(http.StatusOK)
+	return true
+}
+
+func (ecrProvider) Parse(r *http.Request, body []byte) ([]Event, error) {
+	switch r.Header.Get(snsMessageTypeHeader) {
+	case "":
+	case "Notification":
+		var msg snsMessage
+		if err := json.Unmarshal(body, &msg); err != nil {
+			return nil, err
+		}
+		body = []byte(msg.Message)
+	default:
+		log.Printf("Ignoring SNS %s message", r.Header.Get(snsMessageTypeHeader))
+		return nil, nil
+	}
+
+	var e EventBridgeEvent
+	if err := json.Unmarshal(body, &e); err != nil {
+		return nil, err
+	}
+	if e.Source != "aws.ecr" || e.DetailType != "ECR Image Action" {
+		log.Printf("Ignoring EventBridge %s event from %s", e.DetailType, e.Source)
+		return nil, nil
+	}
+	if e.Detail.Result != "SUCCESS" {
+		log.Printf("Ignoring failed ECR %s of %s", e.Detail.ActionType, e.Detail.RepositoryName)
+		return nil, nil
+	}
+
+	var kind string
+	switch e.Detail.ActionType {
+	case "PUSH":
+		kind = EventPush
+	case "DELETE":
+		kind = EventDelete
+	default:
+		log.Printf("Ignoring ECR action %s", e.Detail.ActionType)
+		return nil, nil
+	}
+	return []Event{{
+		ID:         e.ID,
+		Provider:   "ecr",
+		Type:       kind,
+		Registry:   fmt.Sprintf("%s.dkr.ecr.%s.amazonaws.com", e.Account, e.Region),
+		Repository: e.Detail.RepositoryName,
+		Tag:        e.Detail.ImageTag,
+		Digest:     e.Detail.ImageDigest,
+		MediaType:  e.Detail.MediaType,
+		Timestamp:  e.Time,
+	}}, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"time"
+)
+
+// Event types shared by all providers. EventPush and EventDelete refer to
+// artifacts (images, charts); the others come from source control.
+const (
+	EventPush        = "push"
+	EventDelete      = "delete"
+	EventCommit      = "commit"
+	EventPullRequest = "pull_request"
+	EventRelease     = "release"
+	EventPipeline    = "pipeline"
+	EventScan        = "scan"
+)
+
+var knownEventTypes = map[string]bool{
+	EventPush: true, EventDelete: true, EventCommit: true, EventPullRequest: true,
+	EventRelease: true, EventPipeline: true, EventScan: true,
+}
+
+// Event is the provider-independent form of a webhook delivery. Providers
+// convert their payloads into Events and everything downstream of parsing
+// works on this type only.
+type Event struct {
+	// ID is the provider's delivery or event ID, when it sends one.
+	ID         string `json:"id,omitempty"`
+	Provider   string `json:"provider"`
+	Type       string `json:"type"`
+	Registry   string `json:"registry,omitempty"`
+	Repository string `json:"repository"`
+	Tag        string `json:"tag,omitempty"`
+	Digest     string `json:"digest,omitempty"`
+	MediaType  string `json:"mediaType,omitempty"`
+	// Ref, Revision and Action describe source control events: the branch
+	// or tag, the commit SHA and what happened (opened, published, ...).
+	Ref      string `json:"ref,omitempty"`
+	Revision string `json:"revision,omitempty"`
+	Action   string `json:"action,omitempty"`
+	URL      string `json:"url,omitempty"`
+	// Severity is the highest vulnerability severity found, for EventScan.
+	Severity  string    `json:"severity,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	// Tags and Annotations are attached by routing rules or operators and
+	// forwarded with the event.
+	Tags        []string          `json:"tags,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// callbackURL is where the delivery outcome is reported, for senders
+	// that expect an acknowledgement (Docker Hub).
+	callbackURL string
+}
+
+// annotate adds tags and annotations to e without modifying ones it may
+// share with copies of the event. An empty annotation value removes the
+// annotation.
+func (e *Event) annotate(tags []string, annotations map[string]string) {
+	if len(tags) > 0 {
+		merged := slices.Clone(e.Tags)
+		for _, t := range tags {
+			if !slices.Contains(merged, t) {
+				merged = append(merged, t)
+			}
+		}
+		e.Tags = merged
+	}
+	if len(annotations) > 0 {
+		merged := maps.Clone(e.Annotations)
+		if merged == nil {
+			merged = make(map[string]string, len(annotations))
+		}
+		for k, v := range annotations {
+			if v == "" {
+				delete(merged, k)
+			} else {
+				merged[k] = v
+			}
+		}
+		e.Annotations = merged
+	}
+}
+
+// untag removes tag from e.
+func (e *Event) untag(tag string) {
+	e.Tags = slices.DeleteFunc(slices.Clone(e.Tags), func(t string) bool { return t == tag })
+}
+
+// dispatch hands parsed events to the rest of the pipeline. Sinks are fed
+// from the processing queue so a slow output never holds up the sender;
+// ctx is the request context, whose values but not cancellation carry over
+// to the deliveries.
+func dispatch(ctx context.Context, events []Event) {
+	logger := requestLogger(ctx)
+	for _, e := range events {
+		logger.Info("Event", "provider", e.Provider, "type", e.Type,
+			"repo", e.Repository, "tag", e.Tag, "digest", e.Digest)
+		queue.Push(withStoreSeq(ctx, store.Add(e, tenants.Resolve(ctx, e))), e)
+	}
+}
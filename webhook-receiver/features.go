@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const ofrepCacheTTL = 30 * time.Second
+
+// Flags guarding behaviors that operators may need to switch off without a
+// redeploy.
+const (
+	flagStubRecording = "stub-recording"
+	flagSignedLinks   = "signed-links"
+)
+
+type flagSpec struct {
+	Default     bool
+	Description string
+}
+
+var knownFlags = map[string]flagSpec{
+	flagStubRecording: {true, "record request bodies on stub endpoints"},
+	flagSignedLinks:   {true, "accept signed deep links in place of an OIDC token"},
+}
+
+type FeaturesConfig struct {
+	Flags map[string]bool `json:"flags,omitempty"`
+	// OFREPURL points at an OpenFeature Remote Evaluation Protocol endpoint
+	// (e.g. flagd) consulted before the static flag values.
+	OFREPURL string `json:"ofrepURL,omitempty"`
+}
+
+func (c *FeaturesConfig) Validate() error {
+	for name := range c.Flags {
+		if _, ok := knownFlags[name]; !ok {
+			return fmt.Errorf("features.flags: unknown flag %q", name)
+		}
+	}
+	if c.OFREPURL != "" {
+		if u, err := url.Parse(c.OFREPURL); err != nil || u.Host == "" {
+			return fmt.Errorf("features.ofrepURL: must be an absolute URL")
+		}
+	}
+	return nil
+}
+
+type cachedFlag struct {
+	value   bool
+	fetched time.Time
+}
+
+// FeatureFlags evaluates flags in order of precedence: runtime overrides set
+// through the admin API, the OpenFeature provider, static configuration and
+// finally the built-in default.
+type FeatureFlags struct {
+	static   map[string]bool
+	ofrepURL string
+	client   *http.Client
+
+	mu        sync.RWMutex
+	overrides map[string]bool
+	cache     map[string]cachedFlag
+}
+
+var features = NewFeatureFlags(FeaturesConfig{})
+
+func NewFeatureFlags(cfg FeaturesConfig) *FeatureFlags {
+	static := make(map[string]bool)
+	for k, v := range cfg.Flags {
+		static[k] = v
+	}
+	return &FeatureFlags{
+		static:    static,
+		ofrepURL:  strings.TrimSuffix(cfg.OFREPURL, "/"),
+		client:    &http.Client{Timeout: 2 * time.Second},
+		overrides: make(map[string]bool),
+		cache:     make(map[string]cachedFlag),
+	}
+}
+
+func (f *FeatureFlags) Enabled(name string) bool {
+	f.mu.RLock()
+	v, ok := f.overrides[name]
+	f.mu.RUnlock()
+	if ok {
+		return v
+	}
+	if f.ofrepURL != "" {
+		if v, ok := f.evaluateRemote(name); ok {
+			return v
+		}
+	}
+	if v, ok := f.static[name]; ok {
+		return v
+	}
+	return knownFlags[name].Default
+}
+
+// evaluateRemote asks the OFREP endpoint for a boolean flag, caching the
+// answer briefly so hot paths do not pay a round trip per request.
+func (f *FeatureFlags) evaluateRemote(name string) (bool, bool) {
+	f.mu.RLock()
+	c, ok := f.cache[name]
+	f.mu.RUnlock()
+	if ok && time.Since(c.fetched) < ofrepCacheTTL {
+		return c.value, true
+	}
+
+	ctx, done := watchdog.start(context.Background(), "ofrep", budgetOFREP)
+	defer done()
+	body, _ := json.Marshal(map[string]any{"context": map[string]string{"service": "webhook-receiver"}})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		f.ofrepURL+"/ofrep/v1/evaluate/flags/"+name, bytes.NewReader(body))
+	if err != nil {
+		return false, false
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		log.Printf("Feature flag %s: provider unavailable: %v", name, err)
+		return c.value, ok
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return c.value, ok
+	}
+
+	var out struct {
+		Value any `json:"value"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return c.value, ok
+	}
+	v, isBool := out.Value.(bool)
+	if !isBool {
+		return false, false
+	}
+	f.mu.Lock()
+	f.cache[name] = cachedFlag{value: v, fetched: time.Now()}
+	f.mu.Unlock()
+	return v, true
+}
+
+type flagStatus struct {
+	Name        string `json:"name"`
+	Enabled     bool   `json:"enabled"`
+	Overridden  bool   `json:"overridden"`
+	Description string `json:"description"`
+}
+
+// listHandler serves GET /admin/flags.
+func (f *FeatureFlags) listHandler(w http.ResponseWriter, r *http.Request) {
+	var out []flagStatus
+	for name, spec := range knownFlags {
+		f.mu.RLock()
+		_, overridden := f.overrides[name]
+		f.mu.RUnlock()
+		out = append(out, flagStatus{
+			Name:        name,
+			Enabled:     f.Enabled(name),
+			Overridden:  overridden,
+			Description: spec.Description,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// setHandler serves PUT /admin/flags/{name} with {"enabled": bool}, and
+// DELETE /admin/flags/{name} to drop the runtime override.
+func (f *FeatureFlags) setHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if _, ok := knownFlags[name]; !ok {
+		http.Error(w, "Unknown flag", http.StatusNotFound)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.Method == http.MethodDelete {
+		delete(f.overrides, name)
+		log.Printf("Feature flag %s override cleared", name)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var req struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Enabled == nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	f.overrides[name] = *req.Enabled
+	log.Printf("Feature flag %s set to %v at runtime", name, *req.Enabled)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTPSinkConfig forwards events as JSON to an arbitrary endpoint.
+type HTTPSinkConfig struct {
+	// Name identifies the sink in routing rules.
+	Name    string            `json:"name"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Timeout string            `json:"timeout,omitempty"`
+	// Transform sends a templated body instead of the event's JSON.
+	Transform *TransformConfig `json:"transform,omitempty"`
+}
+
+func (c *HTTPSinkConfig) Validate() error {
+	var errs []error
+	if c.Name == "" {
+		errs = append(errs, errors.New("name: required"))
+	}
+	if err := validateURL(c.URL); err != nil {
+		errs = append(errs, fmt.Errorf("url: %w", err))
+	}
+	if c.Timeout != "" {
+		if _, err := time.ParseDuration(c.Timeout); err != nil {
+			errs = append(errs, fmt.Errorf("timeout: %w", err))
+		}
+	}
+	if c.Transform != nil {
+		if err := c.Transform.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("transform: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+type HTTPSink struct {
+	name        string
+	url         string
+	headers     map[string]string
+	client      *http.Client
+	transform   *TransformConfig
+	contentType string
+}
+
+func NewHTTPSink(cfg HTTPSinkConfig) *HTTPSink {
+	s := &HTTPSink{
+		name:    cfg.Name,
+		url:     cfg.URL,
+		headers: cfg.Headers,
+		client:  &http.Client{Timeout: defaultSinkTimeout, Transport: outboundTransport},
+
+		transform:   cfg.Transform,
+		contentType: "application/json",
+	}
+	if cfg.Transform != nil {
+		s.contentType = cfg.Transform.contentType()
+	}
+	if cfg.Timeout != "" {
+		s.client.Timeout, _ = time.ParseDuration(cfg.Timeout)
+	}
+	return s
+}
+
+func (s *HTTPSink) Name() string { return s.name }
+
+func (s *HTTPSink) Send(ctx context.Context, e Event) error {
+	if s.transform != nil {
+		body, err := s.transform.Render(e)
+		if err != nil {
+			return fmt.Errorf("transform: %w", err)
+		}
+		return s.post(ctx, body)
+	}
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return s.post(ctx, body)
+}
+
+func (s *HTTPSink) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", s.contentType)
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s", s.name, resp.Status)
+	}
+	return nil
+}
+
+// SlackSinkConfig posts a one-line summary of each event to a Slack
+// incoming webhook.
+type SlackSinkConfig struct {
+	Name        string `json:"name"`
+	WebhookFile string `json:"webhookFile"`
+	// Transform renders the message payload, for example with blocks,
+	// instead of the summary.
+	Transform *TransformConfig `json:"transform,omitempty"`
+}
+
+func (c *SlackSinkConfig) Validate() error {
+	if c.Name == "" {
+		return errors.New("name: required")
+	}
+	u, err := readSecretFile(c.WebhookFile)
+	if err != nil {
+		return fmt.Errorf("webhookFile: %w", err)
+	}
+	if err := validateURL(u); err != nil {
+		return fmt.Errorf("webhookFile: %w", err)
+	}
+	if c.Transform != nil {
+		if err := c.Transform.Validate(); err != nil {
+			return fmt.Errorf("transform: %w", err)
+		}
+	}
+	return nil
+}
+
+type SlackSink struct {
+	*HTTPSink
+}
+
+func NewSlackSink(cfg SlackSinkConfig) (*SlackSink, error) {
+	u, err := readSecretFile(cfg.WebhookFile)
+	if err != nil {
+		return nil, err
+	}
+	return &SlackSink{NewHTTPSink(HTTPSinkConfig{Name: cfg.Name, URL: u, Transform: cfg.Transform})}, nil
+}
+
+func (s *SlackSink) Send(ctx context.Context, e Event) error {
+	if s.transform != nil {
+		return s.HTTPSink.Send(ctx, e)
+	}
+	ref := e.Repository
+	if e.Tag != "" {
+		ref += ":" + e.Tag
+	} else if e.Digest != "" {
+		ref += "@" + e.Digest
+	}
+	text := fmt.Sprintf("%s %s event for `%s`", e.Provider, e.Type, ref)
+	if e.URL != "" {
+		text += " (" + e.URL + ")"
+	}
+	if len(e.Tags) > 0 {
+		text += " [" + strings.Join(e.Tags, ", ") + "]"
+	}
+	// Readers without an OIDC token can open the stored event.
+	if seq, ok := storeSeq(ctx); ok && linkSigner != nil && features.Enabled(flagSignedLinks) {
+		link := linkSigner.Sign("/events/"+strconv.FormatUint(seq, 10), nil, defaultLinkTTL)
+		text += " <" + link + "|details>"
+	}
+	body, _ := json.Marshal(map[string]string{"text": text})
+	return s.post(ctx, body)
+}
@@ -0,0 +1,141 @@
+//go:build !no_gar
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	garPath      = "/webhook/gar"
+	googleIssuer = "https://accounts.google.com"
+)
+
+func init() {
+	registerProvider(garPath, garProvider{})
+}
+
+// GARConfig enables verification of the OIDC token Pub/Sub attaches to
+// authenticated push deliveries.
+type GARConfig struct {
+	// Audience is the audience set on the push subscription, by default
+	// its endpoint URL.
+	Audience string `json:"audience"`
+	// ServiceAccount, if set, must be the token's email claim.
+	ServiceAccount string `json:"serviceAccount,omitempty"`
+}
+
+func (c *GARConfig) Validate() error {
+	if c.Audience == "" {
+		return errors.New("gar.audience: required")
+	}
+	return nil
+}
+
+// garVerifier checks push tokens when GAR is configured; without it the
+// shared secret is expected in the subscription URL's `code` parameter.
+var (
+	garVerifier       *OIDCVerifier
+	garServiceAccount string
+)
+
+func configureGAR(cfg GARConfig) {
+	garVerifier = NewOIDCVerifier(OIDCConfig{Issuer: googleIssuer, Audience: cfg.Audience})
+	garServiceAccount = cfg.ServiceAccount
+	log.Printf("Verifying Pub/Sub push tokens for audience %s", cfg.Audience)
+}
+
+type pubsubPush struct {
+	Message struct {
+		// Data is base64 in the envelope; encoding/json decodes it.
+		Data        []byte    `json:"data"`
+		MessageID   string    `json:"messageId"`
+		PublishTime time.Time `json:"publishTime"`
+	} `json:"message"`
+	Subscription string `json:"subscription"`
+}
+
+// GARNotification is the message Artifact Registry publishes to the gcr
+// topic. Digest and Tag are full image references.
+type GARNotification struct {
+	Action string `json:"action"`
+	Digest string `json:"digest"`
+	Tag    string `json:"tag"`
+}
+
+// garProvider accepts Artifact Registry notifications delivered by a
+// Pub/Sub push subscription.
+type garProvider struct{}
+
+func (garProvider) Name() string { return "gar" }
+
+func (p garProvider) Authenticate(r *http.Request, _ []byte) error {
+	if garVerifier == nil {
+		return checkSecret(r, p.Name(), r.URL.Query().Get("code"))
+	}
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, bearerPrefix) {
+		return errMissingSecret
+	}
+	claims, err := garVerifier.Verify(r.Context(), strings.TrimPrefix(auth, bearerPrefix))
+	if err != nil {
+		log.Printf("Rejected Pub/Sub push token: %v", err)
+		return errInvalidSecret
+	}
+	if garServiceAccount != "" {
+		email, _ := claims["email"].(string)
+		verified, _ := claims["email_verified"].(bool)
+		if email != garServiceAccount || !verified {
+			log.Printf("Rejected Pub/Sub push from %q", email)
+			return errInvalidSecret
+		}
+	}
+	return nil
+}
+
+func (garProvider) Parse(_ *http.Request, body []byte) ([]Event, error) {
+	var push pubsubPush
+	if err := json.Unmarshal(body, &push); err != nil {
+		return nil, err
+	}
+	var n GARNotification
+	if err := json.Unmarshal(push.Message.Data, &n); err != nil {
+		return nil, fmt.Errorf("decoding message data: %w", err)
+	}
+
+	var kind string
+	switch n.Action {
+	case "INSERT":
+		kind = EventPush
+	case "DELETE":
+		kind = EventDelete
+	default:
+		log.Printf("Ignoring Artifact Registry action %s", n.Action)
+		return nil, nil
+	}
+
+	e := Event{
+		ID:        push.Message.MessageID,
+		Provider:  "gar",
+		Type:      kind,
+		Timestamp: push.Message.PublishTime,
+	}
+	ref := n.Digest
+	if ref == "" {
+		ref = n.Tag
+	}
+	if name, digest, ok := strings.Cut(n.Digest, "@"); ok {
+		ref, e.Digest = name, digest
+	}
+	if i := strings.LastIndex(n.Tag, ":"); i > strings.LastIndex(n.Tag, "/") {
+		ref, e.Tag = n.Tag[:i], n.Tag[i+1:]
+	}
+	e.Registry, e.Repository, _ = strings.Cut(ref, "/")
+	return []Event{e}, nil
+}
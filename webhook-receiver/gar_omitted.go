@@ -0,0 +1,15 @@
+//go:build no_gar
+
+package main
+
+import "fmt"
+
+// GARConfig is accepted so configurations parse in builds without the GAR
+// provider, and refused by Validate.
+type GARConfig struct {
+	omittedConfig
+}
+
+func (c *GARConfig) Validate() error { return fmt.Errorf("gar: %w", errOmitted("gar")) }
+
+func configureGAR(GARConfig) {}
@@ -0,0 +1,66 @@
+//go:build !no_gar
+
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGARAuthenticate(t *testing.T) {
+	iss := newTestIssuer(t)
+	const endpoint = "https://receiver.example.com/webhook/gar"
+	const sa = "pubsub-push@project.iam.gserviceaccount.com"
+	push := func(exp time.Time, email string, verified bool) Claims {
+		c := iss.claims(endpoint, exp)
+		c["email"], c["email_verified"] = email, verified
+		return c
+	}
+	hour := time.Now().Add(time.Hour)
+	valid := iss.token(t, "RS256", "rsa", push(hour, sa, true))
+
+	defer func(v *OIDCVerifier, s string, secrets *SecretSet) {
+		garVerifier, garServiceAccount, webhookSecrets = v, s, secrets
+	}(garVerifier, garServiceAccount, webhookSecrets)
+	webhookSecrets = staticSecrets("shared")
+
+	tests := []struct {
+		name     string
+		verifier bool
+		target   string
+		auth     string
+		wantErr  error
+	}{
+		{name: "valid", verifier: true, auth: "Bearer " + valid},
+		{name: "tampered", verifier: true, auth: "Bearer " + valid[:len(valid)-4] + "AAAA", wantErr: errInvalidSecret},
+		{name: "expired", verifier: true, auth: "Bearer " + iss.token(t, "RS256", "rsa", push(time.Now().Add(-time.Hour), sa, true)), wantErr: errInvalidSecret},
+		{name: "wrong algorithm", verifier: true, auth: "Bearer " + iss.token(t, "HS256", "rsa", push(hour, sa, true)), wantErr: errInvalidSecret},
+		{name: "other audience", verifier: true, auth: "Bearer " + iss.token(t, "RS256", "rsa", iss.claims("https://elsewhere.example.com", hour)), wantErr: errInvalidSecret},
+		{name: "other service account", verifier: true, auth: "Bearer " + iss.token(t, "RS256", "rsa", push(hour, "intruder@project.iam.gserviceaccount.com", true)), wantErr: errInvalidSecret},
+		{name: "unverified email", verifier: true, auth: "Bearer " + iss.token(t, "RS256", "rsa", push(hour, sa, false)), wantErr: errInvalidSecret},
+		{name: "no token", verifier: true, target: "/webhook/gar?code=shared", wantErr: errMissingSecret},
+		{name: "code without verifier", target: "/webhook/gar?code=shared"},
+		{name: "wrong code without verifier", target: "/webhook/gar?code=guess", wantErr: errInvalidSecret},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			garVerifier, garServiceAccount = nil, ""
+			if tt.verifier {
+				garVerifier = NewOIDCVerifier(OIDCConfig{Issuer: iss.URL, Audience: endpoint})
+				garServiceAccount = sa
+			}
+			target := tt.target
+			if target == "" {
+				target = garPath
+			}
+			r := httptest.NewRequest("POST", target, nil)
+			if tt.auth != "" {
+				r.Header.Set("Authorization", tt.auth)
+			}
+			if err := (garProvider{}).Authenticate(r, nil); err != tt.wantErr {
+				t.Errorf("Authenticate() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+//go:build !no_github
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	githubPath            = "/webhook/github"
+	githubEventHeader     = "X-GitHub-Event"
+	githubDeliveryHeader  = "X-GitHub-Delivery"
+	githubSignatureHeader = "X-Hub-Signature-256"
+)
+
+func init() {
+	registerProvider(githubPath, githubProvider{})
+}
+
+type githubRepository struct {
+	FullName string `json:"full_name"`
+	HTMLURL  string `json:"html_url"`
+}
+
+type GitHubPush struct {
+	Ref        string           `json:"ref"`
+	After      string           `json:"after"`
+	Deleted    bool             `json:"deleted"`
+	Compare    string           `json:"compare"`
+	Repository githubRepository `json:"repository"`
+	HeadCommit *struct {
+		Timestamp time.Time `json:"timestamp"`
+	} `json:"head_commit"`
+}
+
+type GitHubPullRequest struct {
+	Action      string `json:"action"`
+	Number      int    `json:"number"`
+	PullRequest struct {
+		HTMLURL   string    `json:"html_url"`
+		Merged    bool      `json:"merged"`
+		UpdatedAt time.Time `json:"updated_at"`
+		Head      struct {
+			Ref string `json:"ref"`
+			SHA string `json:"sha"`
+		} `json:"head"`
+	} `json:"pull_request"`
+	Repository githubRepository `json:"repository"`
+}
+
+type GitHubRelease struct {
+	Action  string `json:"action"`
+	Release struct {
+		TagName         string    `json:"tag_name"`
+		TargetCommitish string    `json:"target_commitish"`
+		HTMLURL         string    `json:"html_url"`
+		PublishedAt     time.Time `json:"published_at"`
+	} `json:"release"`
+	Repository githubRepository `json:"repository"`
+}
+
+type GitHubPackage struct {
+	Action  string `json:"action"`
+	Package struct {
+		Name           string `json:"name"`
+		Namespace      string `json:"namespace"`
+		PackageType    string `json:"package_type"`
+		PackageVersion struct {
+			Name              string    `json:"name"`
+			HTMLURL           string    `json:"html_url"`
+			UpdatedAt         time.Time `json:"updated_at"`
+			ContainerMetadata struct {
+				Tag struct {
+					Name   string `json:"name"`
+					Digest string `json:"digest"`
+				} `json:"tag"`
+			} `json:"container_metadata"`
+		} `json:"package_version"`
+		Registry struct {
+			URL string `json:"url"`
+		} `json:"registry"`
+	} `json:"package"`
+}
+
+// githubProvider accepts repository and organization webhooks from GitHub.
+// Deliveries are signed with HMAC-SHA256 over the body and the event name
+// is carried in X-GitHub-Event.
+type githubProvider struct{}
+
+func (githubProvider) Name() string { return "github" }
+
+func (p githubProvider) Authenticate(r *http.Request, body []byte) error {
+	sig := r.Header.Get(githubSignatureHeader)
+	if sig == "" {
+		return errMissingSecret
+	}
+	got, err := hex.DecodeString(strings.TrimPrefix(sig, "sha256="))
+	if err != nil {
+		return errInvalidSecret
+	}
+	if !secretsFor(r, p.Name()).signed(sha256.New, body, got) {
+		return errInvalidSecret
+	}
+	return nil
+}
+
+func (githubProvider) Parse(r *http.Request, body []byte) ([]Event, error) {
+	id := r.Header.Get(githubDeliveryHeader)
+	switch name := r.Header.Get(githubEventHeader); name {
+	case "ping":
+		return nil, nil
+	case "push":
+		var p GitHubPush
+		if err := json.Unmarshal(body, &p); err != nil {
+			return nil, err
+		}
+		e := Event{
+			ID:         id,
+			Provider:   "github",
+			Type:       EventCommit,
+			Registry:   "github.com",
+			Repository: p.Repository.FullName,
+			Ref:        p.Ref,
+			Revision:   p.After,
+			URL:        p.Compare,
+			Timestamp:  time.Now(),
+		}
+		if tag, ok := strings.CutPrefix(p.Ref, "refs/tags/"); ok {
+			e.Tag = tag
+		}
+		if p.Deleted {
+			e.Type = EventDelete
+			e.Revision = ""
+		} else if p.HeadCommit != nil {
+			e.Timestamp = p.HeadCommit.Timestamp
+		}
+		return []Event{e}, nil
+
+	case "pull_request":
+		var p GitHubPullRequest
+		if err := json.Unmarshal(body, &p); err != nil {
+			return nil, err
+		}
+		action := p.Action
+		if action == "closed" && p.PullRequest.Merged {
+			action = "merged"
+		}
+		return []Event{{
+			ID:         id,
+			Provider:   "github",
+			Type:       EventPullRequest,
+			Registry:   "github.com",
+			Repository: p.Repository.FullName,
+			Ref:        p.PullRequest.Head.Ref,
+			Revision:   p.PullRequest.Head.SHA,
+			Action:     action,
+			URL:        p.PullRequest.HTMLURL,
+			Timestamp:  p.PullRequest.UpdatedAt,
+		}}, nil
+
+	case "release":
+		var p GitHubRelease
+		if err := json.Unmarshal(body, &p); err != nil {
+			return nil, err
+		}
+		ts := p.Release.PublishedAt
+		if ts.IsZero() {
+			ts = time.Now()
+		}
+		return []Event{{
+			ID:         id,
+			Provider:   "github",
+			Type:       EventRelease,
+			Registry:   "github.com",
+			Repository: p.Repository.FullName,
+			Tag:        p.Release.TagName,
+			Ref:        p.Release.TargetCommitish,
+			Action:     p.Action,
+			URL:        p.Release.HTMLURL,
+			Timestamp:  ts,
+		}}, nil
+
+	case "package", "registry_package":
+		var p GitHubPackage
+		if err := json.Unmarshal(body, &p); err != nil {
+			return nil, err
+		}
+		pkg := p.Package
+		if pkg.PackageType != "CONTAINER" && pkg.PackageType != "container" {
+			log.Printf("Ignoring GitHub %s package %s", pkg.PackageType, pkg.Name)
+			return nil, nil
+		}
+		digest := pkg.PackageVersion.ContainerMetadata.Tag.Digest
+		if digest == "" {
+			digest = pkg.PackageVersion.Name
+		}
+		registry := strings.TrimPrefix(strings.TrimPrefix(pkg.Registry.URL, "https://"), "http://")
+		if registry == "" {
+			registry = "ghcr.io"
+		}
+		return []Event{{
+			ID:         id,
+			Provider:   "github",
+			Type:       EventPush,
+			Registry:   strings.TrimSuffix(registry, "/"),
+			Repository: strings.ToLower(pkg.Namespace + "/" + pkg.Name),
+			Tag:        pkg.PackageVersion.ContainerMetadata.Tag.Name,
+			Digest:     digest,
+			Action:     p.Action,
+			URL:        pkg.PackageVersion.HTMLURL,
+			Timestamp:  pkg.PackageVersion.UpdatedAt,
+		}}, nil
+
+	case "":
+		return nil, fmt.Errorf("missing %s header", githubEventHeader)
+	default:
+		log.Printf("Ignoring GitHub %s event", name)
+		return nil, nil
+	}
+}
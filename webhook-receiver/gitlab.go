@@ -0,0 +1,146 @@
+//go:build !no_gitlab
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	gitlabPath          = "/webhook/gitlab"
+	gitlabEventHeader   = "X-Gitlab-Event"
+	gitlabTokenHeader   = "X-Gitlab-Token"
+	gitlabUUIDHeader    = "X-Gitlab-Event-UUID"
+	gitlabZeroRevision  = "0000000000000000000000000000000000000000"
+	gitlabTimeFormat    = "2006-01-02 15:04:05 MST"
+	gitlabDefaultDomain = "gitlab.com"
+)
+
+func init() {
+	registerProvider(gitlabPath, gitlabProvider{})
+}
+
+type gitlabProject struct {
+	PathWithNamespace string `json:"path_with_namespace"`
+	WebURL            string `json:"web_url"`
+}
+
+// GitLabPush covers both "Push Hook" and "Tag Push Hook" payloads.
+type GitLabPush struct {
+	ObjectKind string        `json:"object_kind"`
+	Ref        string        `json:"ref"`
+	After      string        `json:"after"`
+	Project    gitlabProject `json:"project"`
+	Commits    []struct {
+		URL       string    `json:"url"`
+		Timestamp time.Time `json:"timestamp"`
+	} `json:"commits"`
+}
+
+type GitLabPipeline struct {
+	ObjectAttributes struct {
+		ID         int    `json:"id"`
+		Ref        string `json:"ref"`
+		Tag        bool   `json:"tag"`
+		SHA        string `json:"sha"`
+		Status     string `json:"status"`
+		FinishedAt string `json:"finished_at"`
+		URL        string `json:"url"`
+	} `json:"object_attributes"`
+	Project gitlabProject `json:"project"`
+}
+
+// gitlabProvider accepts project and group webhooks from GitLab. GitLab
+// does not sign deliveries; it sends the configured secret token verbatim
+// in X-Gitlab-Token.
+type gitlabProvider struct{}
+
+func (gitlabProvider) Name() string { return "gitlab" }
+
+func (p gitlabProvider) Authenticate(r *http.Request, _ []byte) error {
+	return checkSecret(r, p.Name(), r.Header.Get(gitlabTokenHeader))
+}
+
+func (gitlabProvider) Parse(r *http.Request, body []byte) ([]Event, error) {
+	id := r.Header.Get(gitlabUUIDHeader)
+	switch name := r.Header.Get(gitlabEventHeader); name {
+	case "Push Hook", "Tag Push Hook":
+		var p GitLabPush
+		if err := json.Unmarshal(body, &p); err != nil {
+			return nil, err
+		}
+		e := Event{
+			ID:         id,
+			Provider:   "gitlab",
+			Type:       EventCommit,
+			Registry:   gitlabHost(p.Project.WebURL),
+			Repository: p.Project.PathWithNamespace,
+			Ref:        p.Ref,
+			Revision:   p.After,
+			Timestamp:  time.Now(),
+		}
+		if tag, ok := strings.CutPrefix(p.Ref, "refs/tags/"); ok {
+			e.Tag = tag
+		}
+		if p.After == gitlabZeroRevision {
+			e.Type = EventDelete
+			e.Revision = ""
+		} else if n := len(p.Commits); n > 0 {
+			// Commits are listed oldest first.
+			e.URL = p.Commits[n-1].URL
+			e.Timestamp = p.Commits[n-1].Timestamp
+		}
+		return []Event{e}, nil
+
+	case "Pipeline Hook":
+		var p GitLabPipeline
+		if err := json.Unmarshal(body, &p); err != nil {
+			return nil, err
+		}
+		attrs := p.ObjectAttributes
+		ts, err := time.Parse(gitlabTimeFormat, attrs.FinishedAt)
+		if err != nil {
+			ts = time.Now()
+		}
+		e := Event{
+			ID:         id,
+			Provider:   "gitlab",
+			Type:       EventPipeline,
+			Registry:   gitlabHost(p.Project.WebURL),
+			Repository: p.Project.PathWithNamespace,
+			Ref:        attrs.Ref,
+			Revision:   attrs.SHA,
+			Action:     attrs.Status,
+			URL:        attrs.URL,
+			Timestamp:  ts,
+		}
+		if attrs.Tag {
+			e.Tag = attrs.Ref
+		}
+		return []Event{e}, nil
+
+	case "":
+		return nil, fmt.Errorf("missing %s header", gitlabEventHeader)
+	default:
+		log.Printf("Ignoring GitLab %s event", name)
+		return nil, nil
+	}
+}
+
+// gitlabHost returns the instance host from a project URL, so events from
+// self-managed GitLab are distinguishable from gitlab.com.
+func gitlabHost(webURL string) string {
+	host := strings.TrimPrefix(strings.TrimPrefix(webURL, "https://"), "http://")
+	if i := strings.IndexByte(host, '/'); i >= 0 {
+		host = host[:i]
+	}
+	if host == "" {
+		return gitlabDefaultDomain
+	}
+	return host
+}
@@ -0,0 +1,109 @@
+//go:build !no_harbor
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const harborPath = "/webhook/harbor"
+
+// harborSeverity ranks the severities Harbor reports in scan overviews.
+var harborSeverity = map[string]int{
+	"None": 1, "Unknown": 2, "Negligible": 3, "Low": 4, "Medium": 5, "High": 6, "Critical": 7,
+}
+
+func init() {
+	registerProvider(harborPath, harborProvider{})
+}
+
+type harborScanOverview struct {
+	ScanStatus string `json:"scan_status"`
+	Severity   string `json:"severity"`
+}
+
+type HarborEvent struct {
+	Type      string `json:"type"`
+	OccurAt   int64  `json:"occur_at"`
+	EventData struct {
+		Resources []struct {
+			Digest      string `json:"digest"`
+			Tag         string `json:"tag"`
+			ResourceURL string `json:"resource_url"`
+			// ScanOverview is keyed by report MIME type.
+			ScanOverview map[string]harborScanOverview `json:"scan_overview"`
+		} `json:"resources"`
+		Repository struct {
+			RepoFullName string `json:"repo_full_name"`
+		} `json:"repository"`
+	} `json:"event_data"`
+}
+
+// harborProvider accepts Harbor 2.x webhooks for artifact pushes, deletes
+// and vulnerability scans. Harbor sends the policy's auth header value
+// verbatim in Authorization.
+type harborProvider struct{}
+
+func (harborProvider) Name() string { return "harbor" }
+
+func (p harborProvider) Authenticate(r *http.Request, _ []byte) error {
+	return checkSecret(r, p.Name(), r.Header.Get("Authorization"))
+}
+
+func (harborProvider) Parse(_ *http.Request, body []byte) ([]Event, error) {
+	var p HarborEvent
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, err
+	}
+
+	var kind string
+	switch p.Type {
+	case "PUSH_ARTIFACT":
+		kind = EventPush
+	case "DELETE_ARTIFACT":
+		kind = EventDelete
+	case "SCANNING_COMPLETED", "SCANNING_FAILED":
+		kind = EventScan
+	default:
+		log.Printf("Ignoring Harbor %s event", p.Type)
+		return nil, nil
+	}
+
+	ts := time.Unix(p.OccurAt, 0)
+	if p.OccurAt == 0 {
+		ts = time.Now()
+	}
+	var events []Event
+	for _, res := range p.EventData.Resources {
+		registry, _, _ := strings.Cut(res.ResourceURL, "/")
+		e := Event{
+			Provider:   "harbor",
+			Type:       kind,
+			Registry:   registry,
+			Repository: p.EventData.Repository.RepoFullName,
+			Tag:        res.Tag,
+			Digest:     res.Digest,
+			Timestamp:  ts,
+		}
+		if kind == EventScan {
+			e.Action = "failed"
+			if p.Type == "SCANNING_COMPLETED" {
+				e.Action = "completed"
+			}
+			for _, o := range res.ScanOverview {
+				if harborSeverity[o.Severity] > harborSeverity[e.Severity] {
+					e.Severity = o.Severity
+				}
+				if o.ScanStatus != "Success" {
+					e.Action = "failed"
+				}
+			}
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	healthCheckTimeout = 5 * time.Second
+	slackCheckURL      = "https://slack.com/api/api.test"
+	slackCheckTTL      = 30 * time.Second
+)
+
+// healthCheck is one named component check.
+type healthCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// HealthChecks serves a kube-apiserver style health endpoint: /<name>
+// runs every check and /<name>/<check> a single one. ?verbose lists each
+// check, as JSON when the client accepts it, and ?exclude=<check> skips
+// checks.
+type HealthChecks struct {
+	name   string
+	checks []healthCheck
+}
+
+var (
+	livez  = &HealthChecks{name: "healthz"}
+	readyz = &HealthChecks{name: "readyz"}
+)
+
+func (h *HealthChecks) Add(name string, check func(ctx context.Context) error) {
+	h.checks = append(h.checks, healthCheck{name, check})
+}
+
+type checkResult struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+func (h *HealthChecks) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	checks := h.checks
+	if sub := strings.TrimPrefix(r.URL.Path, "/"+h.name+"/"); sub != r.URL.Path {
+		i := slices.IndexFunc(checks, func(c healthCheck) bool { return c.name == sub })
+		if i < 0 {
+			http.NotFound(w, r)
+			return
+		}
+		checks = checks[i : i+1]
+	}
+	exclude := r.URL.Query()["exclude"]
+
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+	results := make([]checkResult, 0, len(checks))
+	healthy := true
+	for _, c := range checks {
+		if slices.Contains(exclude, c.name) {
+			continue
+		}
+		res := checkResult{Name: c.name, OK: true}
+		if err := c.check(ctx); err != nil {
+			res.OK, res.Error, healthy = false, err.Error(), false
+		}
+		results = append(results, res)
+	}
+
+	status := http.StatusOK
+	if !healthy {
+		status = http.StatusServiceUnavailable
+	}
+	if !r.URL.Query().Has("verbose") {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(status)
+		if healthy {
+			fmt.Fprint(w, "ok")
+		} else {
+			fmt.Fprintf(w, "%s check failed", h.name)
+		}
+		return
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]any{"ok": healthy, "checks": results})
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	for _, res := range results {
+		if res.OK {
+			fmt.Fprintf(w, "[+]%s ok\n", res.Name)
+		} else {
+			fmt.Fprintf(w, "[-]%s failed: %s\n", res.Name, res.Error)
+		}
+	}
+	for _, name := range exclude {
+		fmt.Fprintf(w, "[+]%s excluded: ok\n", name)
+	}
+	if healthy {
+		fmt.Fprintf(w, "%s check passed\n", h.name)
+	} else {
+		fmt.Fprintf(w, "%s check failed\n", h.name)
+	}
+}
+
+// queueCheck fails while the processing queue is full, since new events are
+// then dropped or evict others.
+func queueCheck(context.Context) error {
+	if n := queue.Len(); n >= queue.capacity {
+		return fmt.Errorf("queue full (%d events)", n)
+	}
+	return nil
+}
+
+// slackCheck probes the Slack API. Probes run often, so the outcome is
+// reused for slackCheckTTL.
+type slackCheck struct {
+	mu      sync.Mutex
+	checked time.Time
+	err     error
+}
+
+func (s *slackCheck) check(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Since(s.checked) < slackCheckTTL {
+		return s.err
+	}
+	s.err = s.probe(ctx)
+	s.checked = time.Now()
+	return s.err
+}
+
+func (s *slackCheck) probe(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, slackCheckURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := outboundClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Slack API returned %s", resp.Status)
+	}
+	return nil
+}
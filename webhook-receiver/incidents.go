@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	recentLogLines     = 200
+	maxIncidents       = 100
+	incidentPostBudget = 5 * time.Second
+)
+
+type IncidentsConfig struct {
+	// SlackWebhookFile holds a Slack incoming webhook URL that incident
+	// summaries are posted to.
+	SlackWebhookFile string `json:"slackWebhookFile,omitempty"`
+
+	slackWebhook string
+}
+
+func (c *IncidentsConfig) Validate() error {
+	if c.SlackWebhookFile == "" {
+		return nil
+	}
+	u, err := readSecretFile(c.SlackWebhookFile)
+	if err != nil {
+		return fmt.Errorf("incidents.slackWebhookFile: %w", err)
+	}
+	if err := validateURL(u); err != nil {
+		return fmt.Errorf("incidents.slackWebhookFile: %w", err)
+	}
+	c.slackWebhook = u
+	return nil
+}
+
+// Incident is the report captured when a handler or worker panics.
+type Incident struct {
+	ID      string           `json:"id"`
+	Time    time.Time        `json:"time"`
+	Where   string           `json:"where"`
+	Panic   string           `json:"panic"`
+	Stack   string           `json:"stack"`
+	Request *IncidentRequest `json:"request,omitempty"`
+	Event   *Event           `json:"event,omitempty"`
+	Logs    []string         `json:"logs"`
+}
+
+type IncidentRequest struct {
+	Method     string `json:"method"`
+	Path       string `json:"path"`
+	RemoteAddr string `json:"remoteAddr"`
+	UserAgent  string `json:"userAgent,omitempty"`
+}
+
+// logRing keeps the last lines written to the standard logger so incident
+// reports show what led up to the panic.
+type logRing struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+var recentLogs = &logRing{}
+
+func (l *logRing) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		l.lines = append(l.lines, line)
+	}
+	if over := len(l.lines) - recentLogLines; over > 0 {
+		l.lines = l.lines[over:]
+	}
+	return len(p), nil
+}
+
+func (l *logRing) snapshot() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.lines...)
+}
+
+// incidentLog holds recent incident reports for GET /admin/incidents.
+type incidentLog struct {
+	slackWebhook string
+
+	mu        sync.Mutex
+	seq       int
+	incidents []Incident
+}
+
+var incidents = &incidentLog{}
+
+func (l *incidentLog) report(where string, v any, req *IncidentRequest, e *Event) {
+	inc := Incident{
+		Time:    time.Now().UTC(),
+		Where:   where,
+		Panic:   fmt.Sprint(v),
+		Stack:   string(debug.Stack()),
+		Request: req,
+		Event:   e,
+		Logs:    recentLogs.snapshot(),
+	}
+	l.mu.Lock()
+	l.seq++
+	inc.ID = fmt.Sprintf("inc-%d-%d", inc.Time.Unix(), l.seq)
+	l.incidents = append(l.incidents, inc)
+	if over := len(l.incidents) - maxIncidents; over > 0 {
+		l.incidents = l.incidents[over:]
+	}
+	l.mu.Unlock()
+
+	log.Printf("PANIC in %s (incident %s): %s", where, inc.ID, inc.Panic)
+	if l.slackWebhook != "" {
+		goBackground(func() { l.post(inc) })
+	}
+}
+
+func (l *incidentLog) post(inc Incident) {
+	text := fmt.Sprintf(":rotating_light: webhook-receiver panic in %s (incident `%s`): %s", inc.Where, inc.ID, inc.Panic)
+	if inc.Event != nil {
+		text += fmt.Sprintf("\nEvent: %s %s %s:%s", inc.Event.Provider, inc.Event.Type, inc.Event.Repository, inc.Event.Tag)
+	}
+	body, _ := json.Marshal(map[string]string{"text": text})
+
+	ctx, done := watchdog.start(context.Background(), "incident slack", incidentPostBudget)
+	defer done()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, l.slackWebhook, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := outboundClient.Do(req)
+	if err != nil {
+		log.Printf("Posting incident %s to Slack failed: %v", inc.ID, err)
+		return
+	}
+	resp.Body.Close()
+}
+
+// recoverHandler turns a panicking request into a 500 and an incident
+// report.
+func recoverHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				// Deliberate abort of the response; let net/http handle it.
+				panic(v)
+			}
+			incidents.report("handler "+r.URL.Path, v, &IncidentRequest{
+				Method:     r.Method,
+				Path:       r.URL.Path,
+				RemoteAddr: r.RemoteAddr,
+				UserAgent:  r.UserAgent(),
+			}, nil)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// recoverEvent reports a panic while processing e; call it deferred.
+func recoverEvent(where string, e Event) {
+	if v := recover(); v != nil {
+		incidents.report(where, v, nil, &e)
+	}
+}
+
+func (l *incidentLog) listHandler(w http.ResponseWriter, r *http.Request) {
+	l.mu.Lock()
+	out := append([]Incident{}, l.incidents...)
+	l.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
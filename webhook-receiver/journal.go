@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// journalMigrations are applied in order, like archiveMigrations. Append
+// only.
+var journalMigrations = []string{
+	`CREATE TABLE queued (
+		id       INTEGER PRIMARY KEY AUTOINCREMENT,
+		priority INTEGER NOT NULL,
+		event    TEXT NOT NULL,
+		header   TEXT NOT NULL,
+		callback TEXT NOT NULL DEFAULT ''
+	);`,
+}
+
+// queueJournal persists queued events in SQLite from Push until their
+// delivery finishes, so events accepted before a crash or a shutdown that
+// ran out of time are delivered after the restart.
+type queueJournal struct {
+	db *sql.DB
+}
+
+func openQueueJournal(path string) (*queueJournal, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	if err := migrateDB(db, "queue journal", journalMigrations); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrating %s: %w", path, err)
+	}
+	return &queueJournal{db: db}, nil
+}
+
+// add records an event with the request headers routing rules and sinks
+// may use, and returns its journal ID. Credentials are redacted as in the
+// archive, so a rule matching on one of them does not match after a
+// restart.
+func (j *queueJournal) add(item queuedEvent) (int64, error) {
+	ej, _ := json.Marshal(item.event)
+	hj, _ := json.Marshal(redactHeaders(requestHeaders(item.ctx)))
+	res, err := j.db.Exec(`INSERT INTO queued (priority, event, header, callback) VALUES (?, ?, ?, ?)`,
+		item.priority, string(ej), string(hj), item.event.callbackURL)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (j *queueJournal) remove(id int64) error {
+	_, err := j.db.Exec(`DELETE FROM queued WHERE id = ?`, id)
+	return err
+}
+
+// load returns the journalled events in the order they were queued. The
+// request context is gone; only the headers are restored.
+func (j *queueJournal) load() ([]queuedEvent, error) {
+	rows, err := j.db.Query(`SELECT id, priority, event, header, callback FROM queued ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []queuedEvent
+	for rows.Next() {
+		var item queuedEvent
+		var event, header string
+		if err := rows.Scan(&item.journalID, &item.priority, &event, &header, &item.event.callbackURL); err != nil {
+			return nil, err
+		}
+		var h http.Header
+		// Unmarshal leaves the unexported callback URL alone.
+		if err := json.Unmarshal([]byte(event), &item.event); err != nil {
+			return nil, fmt.Errorf("event %d: %w", item.journalID, err)
+		}
+		json.Unmarshal([]byte(header), &h)
+		item.ctx = withHeaders(context.Background(), h)
+		out = append(out, item)
+	}
+	return out, rows.Err()
+}
+
+func (j *queueJournal) Close() error { return j.db.Close() }
@@ -0,0 +1,255 @@
+//go:build !no_kafka
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/linkedin/goavro/v2"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl/plain"
+)
+
+func init() { compiledSinks = append(compiledSinks, "kafka") }
+
+const defaultKafkaKey = "{{.Repository}}"
+
+// eventAvroSchema is the Avro form of Event. Optional strings are empty
+// rather than null, as in the JSON form.
+const eventAvroSchema = `{
+  "type": "record",
+  "name": "WebhookEvent",
+  "namespace": "io.kargo.webhook",
+  "fields": [
+    {"name": "id", "type": "string", "default": ""},
+    {"name": "provider", "type": "string"},
+    {"name": "type", "type": "string"},
+    {"name": "registry", "type": "string", "default": ""},
+    {"name": "repository", "type": "string"},
+    {"name": "tag", "type": "string", "default": ""},
+    {"name": "digest", "type": "string", "default": ""},
+    {"name": "mediaType", "type": "string", "default": ""},
+    {"name": "ref", "type": "string", "default": ""},
+    {"name": "revision", "type": "string", "default": ""},
+    {"name": "action", "type": "string", "default": ""},
+    {"name": "url", "type": "string", "default": ""},
+    {"name": "severity", "type": "string", "default": ""},
+    {"name": "timestamp", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+    {"name": "tags", "type": {"type": "array", "items": "string"}, "default": []},
+    {"name": "annotations", "type": {"type": "map", "values": "string"}, "default": {}}
+  ]
+}`
+
+// KafkaSinkConfig produces events to a Kafka topic, to feed existing event
+// pipelines.
+type KafkaSinkConfig struct {
+	// Name identifies the sink in routing rules.
+	Name    string   `json:"name"`
+	Brokers []string `json:"brokers"`
+	Topic   string   `json:"topic"`
+	// Key is a text/template executed with the Event; the repository by
+	// default, so each repository's events stay in order on one partition.
+	Key string `json:"key,omitempty"`
+	// Format is "json" (the default) or "avro". Avro values use the
+	// Confluent wire format with the schema registered in SchemaRegistry
+	// under the subject <topic>-value.
+	Format         string `json:"format,omitempty"`
+	SchemaRegistry string `json:"schemaRegistry,omitempty"`
+	// TLS enables TLS to the brokers. With Username, SASL/PLAIN is used
+	// with the password read from PasswordFile.
+	TLS          bool   `json:"tls,omitempty"`
+	Username     string `json:"username,omitempty"`
+	PasswordFile string `json:"passwordFile,omitempty"`
+	Timeout      string `json:"timeout,omitempty"`
+
+	key *template.Template
+}
+
+func (c *KafkaSinkConfig) Validate() error {
+	var errs []error
+	if c.Name == "" {
+		errs = append(errs, errors.New("name: required"))
+	}
+	if len(c.Brokers) == 0 {
+		errs = append(errs, errors.New("brokers: required"))
+	}
+	if c.Topic == "" {
+		errs = append(errs, errors.New("topic: required"))
+	}
+	key := c.Key
+	if key == "" {
+		key = defaultKafkaKey
+	}
+	var err error
+	if c.key, err = template.New("key").Parse(key); err != nil {
+		errs = append(errs, fmt.Errorf("key: %w", err))
+	}
+	switch c.Format {
+	case "", "json":
+		if c.SchemaRegistry != "" {
+			errs = append(errs, errors.New("schemaRegistry: only used with format avro"))
+		}
+	case "avro":
+		if err := validateURL(c.SchemaRegistry); err != nil {
+			errs = append(errs, fmt.Errorf("schemaRegistry: %w", err))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("format: %q is not json or avro", c.Format))
+	}
+	if (c.Username == "") != (c.PasswordFile == "") {
+		errs = append(errs, errors.New("username, passwordFile: must be set together"))
+	} else if c.PasswordFile != "" {
+		if _, err := readSecretFile(c.PasswordFile); err != nil {
+			errs = append(errs, fmt.Errorf("passwordFile: %w", err))
+		}
+	}
+	if c.Timeout != "" {
+		if _, err := time.ParseDuration(c.Timeout); err != nil {
+			errs = append(errs, fmt.Errorf("timeout: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+type KafkaSink struct {
+	name    string
+	key     *template.Template
+	timeout time.Duration
+	writer  *kafka.Writer
+
+	// codec and schemaID are set for Avro.
+	codec    *goavro.Codec
+	schemaID uint32
+}
+
+// NewKafkaSink sets up the producer and, for Avro, registers the event
+// schema. Brokers are not contacted until the first event.
+func NewKafkaSink(cfg KafkaSinkConfig) (*KafkaSink, error) {
+	transport := &kafka.Transport{}
+	if cfg.TLS {
+		transport.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if cfg.Username != "" {
+		password, err := readSecretFile(cfg.PasswordFile)
+		if err != nil {
+			return nil, err
+		}
+		transport.SASL = plain.Mechanism{Username: cfg.Username, Password: password}
+	}
+	s := &KafkaSink{
+		name:    cfg.Name,
+		key:     cfg.key,
+		timeout: defaultSinkTimeout,
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(cfg.Brokers...),
+			Topic:        cfg.Topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll,
+			Transport:    transport,
+		},
+	}
+	if cfg.Timeout != "" {
+		s.timeout, _ = time.ParseDuration(cfg.Timeout)
+	}
+	if cfg.Format == "avro" {
+		codec, err := goavro.NewCodec(eventAvroSchema)
+		if err != nil {
+			return nil, err
+		}
+		id, err := registerSchema(cfg.SchemaRegistry, cfg.Topic+"-value", eventAvroSchema)
+		if err != nil {
+			return nil, fmt.Errorf("registering schema for sink %s: %w", cfg.Name, err)
+		}
+		s.codec, s.schemaID = codec, id
+	}
+	return s, nil
+}
+
+// registerSchema registers schema under subject, which returns the ID of
+// the existing version if it is already registered.
+func registerSchema(registry, subject, schema string) (uint32, error) {
+	body, _ := json.Marshal(map[string]string{"schema": schema})
+	ctx, cancel := context.WithTimeout(context.Background(), defaultSinkTimeout)
+	defer cancel()
+	url := strings.TrimSuffix(registry, "/") + "/subjects/" + subject + "/versions"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+	resp, err := outboundClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("schema registry returned %s", resp.Status)
+	}
+	var out struct {
+		ID uint32 `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return 0, err
+	}
+	return out.ID, nil
+}
+
+func (s *KafkaSink) Name() string { return s.name }
+
+// Send produces e and waits until all in-sync replicas have it.
+func (s *KafkaSink) Send(ctx context.Context, e Event) error {
+	var key strings.Builder
+	if err := s.key.Execute(&key, e); err != nil {
+		return fmt.Errorf("key: %w", err)
+	}
+	value, err := s.encode(e)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	return s.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(key.String()),
+		Value: value,
+		Headers: []kafka.Header{
+			{Key: "X-Event-Provider", Value: []byte(e.Provider)},
+			{Key: "X-Event-Type", Value: []byte(e.Type)},
+		},
+	})
+}
+
+func (s *KafkaSink) encode(e Event) ([]byte, error) {
+	if s.codec == nil {
+		return json.Marshal(e)
+	}
+	tags := make([]any, len(e.Tags))
+	for i, t := range e.Tags {
+		tags[i] = t
+	}
+	annotations := make(map[string]any, len(e.Annotations))
+	for k, v := range e.Annotations {
+		annotations[k] = v
+	}
+	native := map[string]any{
+		"id": e.ID, "provider": e.Provider, "type": e.Type, "registry": e.Registry,
+		"repository": e.Repository, "tag": e.Tag, "digest": e.Digest, "mediaType": e.MediaType,
+		"ref": e.Ref, "revision": e.Revision, "action": e.Action, "url": e.URL,
+		"severity": e.Severity, "timestamp": e.Timestamp, "tags": tags, "annotations": annotations,
+	}
+	// Confluent wire format: magic byte 0 and the big-endian schema ID.
+	header := make([]byte, 5)
+	binary.BigEndian.PutUint32(header[1:], s.schemaID)
+	return s.codec.BinaryFromNative(header, native)
+}
+
+func (s *KafkaSink) Close() error { return s.writer.Close() }
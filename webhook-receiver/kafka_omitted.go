@@ -0,0 +1,13 @@
+//go:build no_kafka
+
+package main
+
+import "fmt"
+
+type KafkaSinkConfig struct {
+	omittedConfig
+}
+
+func (c *KafkaSinkConfig) Validate() error { return fmt.Errorf("name: %w", errOmitted("kafka")) }
+
+func NewKafkaSink(KafkaSinkConfig) (Sink, error) { return nil, errOmitted("kafka") }
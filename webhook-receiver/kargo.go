@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const refreshWarehousePath = "/akuity.io.kargo.service.v1alpha1.KargoService/RefreshWarehouse"
+
+type KargoConfig struct {
+	// APIURL is the Kargo API server, e.g. https://kargo.example.com.
+	APIURL    string `json:"apiURL"`
+	TokenFile string `json:"tokenFile,omitempty"`
+	Timeout   string `json:"timeout,omitempty"`
+	// Warehouses map events to the Warehouses subscribed to them. Every
+	// matching rule triggers a refresh.
+	Warehouses []WarehouseRule `json:"warehouses"`
+	// Debounce, if set, delays each Warehouse's refresh by this window
+	// and folds the events arriving meanwhile into it, so a burst of tags
+	// from a CI matrix build costs one refresh. Coalesced events are
+	// annotated in the event store with the refresh that covered them.
+	Debounce string `json:"debounce,omitempty"`
+}
+
+// WarehouseRule refreshes Project/Warehouse for the events it matches.
+// Rules without a type only match pushes.
+type WarehouseRule struct {
+	EventMatch
+	Project   string `json:"project"`
+	Warehouse string `json:"warehouse"`
+}
+
+func (c *KargoConfig) Validate() error {
+	var errs []error
+	if err := validateURL(c.APIURL); err != nil {
+		errs = append(errs, fmt.Errorf("apiURL: %w", err))
+	}
+	if c.TokenFile != "" {
+		if _, err := readSecretFile(c.TokenFile); err != nil {
+			errs = append(errs, fmt.Errorf("tokenFile: %w", err))
+		}
+	}
+	if c.Timeout != "" {
+		if _, err := time.ParseDuration(c.Timeout); err != nil {
+			errs = append(errs, fmt.Errorf("timeout: %w", err))
+		}
+	}
+	if c.Debounce != "" {
+		if d, err := time.ParseDuration(c.Debounce); err != nil || d <= 0 {
+			errs = append(errs, errors.New("debounce: must be a positive duration"))
+		}
+	}
+	if len(c.Warehouses) == 0 {
+		errs = append(errs, errors.New("warehouses: at least one rule is required"))
+	}
+	for i, r := range c.Warehouses {
+		if r.Project == "" || r.Warehouse == "" {
+			errs = append(errs, fmt.Errorf("warehouses[%d]: project and warehouse are required", i))
+		}
+		if err := r.EventMatch.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("warehouses[%d]: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r WarehouseRule) matches(e Event) bool {
+	if r.Type == "" && e.Type != EventPush {
+		return false
+	}
+	return r.EventMatch.matches(e)
+}
+
+// KargoSink asks Kargo to refresh the Warehouses an event concerns, so new
+// artifacts are discovered immediately instead of at the next poll.
+type KargoSink struct {
+	apiURL   string
+	token    string
+	rules    []WarehouseRule
+	client   *http.Client
+	debounce time.Duration
+
+	mu      sync.Mutex
+	pending map[warehouseRef]*pendingRefresh
+}
+
+type warehouseRef struct{ project, name string }
+
+// pendingRefresh collects the events a debounced refresh will cover.
+type pendingRefresh struct {
+	events []string
+	seqs   []uint64
+}
+
+func NewKargoSink(cfg KargoConfig) (*KargoSink, error) {
+	s := &KargoSink{
+		apiURL:  strings.TrimSuffix(cfg.APIURL, "/"),
+		rules:   cfg.Warehouses,
+		client:  &http.Client{Timeout: defaultSinkTimeout, Transport: outboundTransport},
+		pending: make(map[warehouseRef]*pendingRefresh),
+	}
+	if cfg.Timeout != "" {
+		s.client.Timeout, _ = time.ParseDuration(cfg.Timeout)
+	}
+	if cfg.Debounce != "" {
+		s.debounce, _ = time.ParseDuration(cfg.Debounce)
+	}
+	if cfg.TokenFile != "" {
+		token, err := readSecretFile(cfg.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		s.token = token
+	}
+	return s, nil
+}
+
+func (s *KargoSink) Name() string { return "kargo" }
+
+func (s *KargoSink) Send(ctx context.Context, e Event) error {
+	seen := make(map[warehouseRef]bool)
+	var errs []error
+	for _, r := range s.rules {
+		w := warehouseRef{r.Project, r.Warehouse}
+		if seen[w] || !r.matches(e) {
+			continue
+		}
+		seen[w] = true
+		if s.debounce > 0 {
+			s.coalesce(ctx, w, e)
+			continue
+		}
+		if err := s.refresh(ctx, w.project, w.name); err != nil {
+			errs = append(errs, fmt.Errorf("refreshing %s/%s: %w", w.project, w.name, err))
+			continue
+		}
+		log.Printf("Refreshed Warehouse %s/%s for %s:%s", w.project, w.name, e.Repository, e.Tag)
+	}
+	return errors.Join(errs...)
+}
+
+// coalesce adds e to w's pending refresh, scheduling one if there is
+// none. Refresh failures then surface in the log and the event store
+// rather than in e's delivery.
+func (s *KargoSink) coalesce(ctx context.Context, w warehouseRef, e Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.pending[w]
+	if !ok {
+		p = &pendingRefresh{}
+		s.pending[w] = p
+		time.AfterFunc(s.debounce, func() { goBackground(func() { s.flush(w) }) })
+	}
+	p.events = append(p.events, e.Repository+":"+e.Tag)
+	if seq, ok := storeSeq(ctx); ok {
+		p.seqs = append(p.seqs, seq)
+	}
+}
+
+// flush refreshes w once for the events collected in the window.
+func (s *KargoSink) flush(w warehouseRef) {
+	s.mu.Lock()
+	p := s.pending[w]
+	delete(s.pending, w)
+	s.mu.Unlock()
+
+	at := time.Now().UTC()
+	err := s.refresh(context.Background(), w.project, w.name)
+	annotations := map[string]string{
+		"kargo.refresh":   fmt.Sprintf("%s/%s at %s", w.project, w.name, at.Format(time.RFC3339)),
+		"kargo.coalesced": strconv.Itoa(len(p.events)),
+	}
+	if err != nil {
+		annotations["kargo.refreshError"] = err.Error()
+		log.Printf("Refreshing Warehouse %s/%s for %d coalesced events failed: %v", w.project, w.name, len(p.events), err)
+	} else {
+		log.Printf("Refreshed Warehouse %s/%s once for %d events: %s", w.project, w.name, len(p.events), strings.Join(p.events, ", "))
+	}
+	for _, seq := range p.seqs {
+		store.Annotate(seq, nil, annotations)
+	}
+}
+
+func (s *KargoSink) refresh(ctx context.Context, project, name string) error {
+	body, _ := json.Marshal(map[string]string{"project": project, "name": name})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.apiURL+refreshWarehousePath, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Kargo API returned %s", resp.Status)
+	}
+	return nil
+}
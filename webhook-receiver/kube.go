@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+)
+
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// kubeAPI calls the API server the pod runs against with the pod's service
+// account.
+type kubeAPI struct {
+	base      string
+	token     string
+	namespace string
+	client    *http.Client
+}
+
+func inClusterAPI() (*kubeAPI, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" {
+		return nil, errors.New("not running in a Kubernetes cluster")
+	}
+	token, err := readSecretFile(serviceAccountDir + "/token")
+	if err != nil {
+		return nil, err
+	}
+	namespace, err := readSecretFile(serviceAccountDir + "/namespace")
+	if err != nil {
+		return nil, err
+	}
+	ca, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(ca)
+	return &kubeAPI{
+		base:      "https://" + net.JoinHostPort(host, port),
+		token:     token,
+		namespace: namespace,
+		// No client timeout, since watches are long-lived; callers bound
+		// requests with their context.
+		client: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}},
+		},
+	}, nil
+}
+
+// do sends a GET for path and returns the response if it is a 200.
+func (k *kubeAPI) do(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.base+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+k.token)
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &kubeError{path: path, status: resp.StatusCode}
+	}
+	return resp, nil
+}
+
+// get decodes the object at path into out.
+func (k *kubeAPI) get(ctx context.Context, path string, out any) error {
+	ctx, cancel := context.WithTimeout(ctx, defaultSinkTimeout)
+	defer cancel()
+	resp, err := k.do(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+type kubeError struct {
+	path   string
+	status int
+}
+
+func (e *kubeError) Error() string {
+	return fmt.Sprintf("GET %s: API server returned %d %s", e.path, e.status, http.StatusText(e.status))
+}
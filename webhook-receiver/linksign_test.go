@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLinkSignerValid(t *testing.T) {
+	s := NewLinkSigner(strings.Repeat("k", 32), "https://receiver.example.com")
+	other := NewLinkSigner(strings.Repeat("x", 32), "https://receiver.example.com")
+	signed := s.Sign("/events/42", url.Values{"view": {"raw"}}, time.Hour)
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		want   bool
+	}{
+		{name: "valid", url: signed, want: true},
+		{name: "other path", url: strings.Replace(signed, "/events/42", "/events/43", 1)},
+		{name: "view swapped for state export", url: strings.Replace(signed, "/events/42", "/admin/state", 1)},
+		{name: "tampered query", url: strings.Replace(signed, "view=raw", "view=full", 1)},
+		{name: "added query", url: signed + "&limit=1000"},
+		{name: "extended expiry", url: strings.Replace(signed, "exp=", "exp=9", 1)},
+		{name: "expired", url: s.Sign("/events/42", nil, -time.Minute)},
+		{name: "other key", url: other.Sign("/events/42", url.Values{"view": {"raw"}}, time.Hour)},
+		{name: "not a GET", method: http.MethodPost, url: signed},
+		{name: "no signature", url: "https://receiver.example.com/events/42"},
+		{name: "path outside the views", url: s.sign("https://receiver.example.com", "/admin/dlq", nil, time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			r := httptest.NewRequest(method, tt.url, nil)
+			if got := s.Valid(r); got != tt.want {
+				t.Errorf("Valid(%s %s) = %v, want %v", method, tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinkSignerMintAllowList(t *testing.T) {
+	s := NewLinkSigner(strings.Repeat("k", 32), "https://receiver.example.com")
+	for path, want := range map[string]int{
+		"/events/42":           http.StatusOK,
+		"/admin/deliveries/7":  http.StatusOK,
+		"/admin/state":         http.StatusBadRequest,
+		"/admin/dlq":           http.StatusBadRequest,
+		"/events":              http.StatusBadRequest,
+		"/events/stream":       http.StatusBadRequest,
+		"/events/42/tags":      http.StatusBadRequest,
+		"/admin/deliveries/7x": http.StatusBadRequest,
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/admin/links", strings.NewReader(`{"path":"`+path+`"}`))
+		w := httptest.NewRecorder()
+		s.mintHandler(w, r)
+		if w.Code != want {
+			t.Errorf("minting %s: status %d, want %d", path, w.Code, want)
+		}
+	}
+}
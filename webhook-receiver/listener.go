@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const proxyHeaderTimeout = 5 * time.Second
+
+// ListenerConfig describes one socket the receiver serves on.
+type ListenerConfig struct {
+	// Address is host:port; use "[::]:8080" for dual-stack or an explicit
+	// IPv4/IPv6 address to bind a single family.
+	Address string `json:"address"`
+	// Network is tcp (default), tcp4 or tcp6.
+	Network string `json:"network,omitempty"`
+	// ReusePort sets SO_REUSEPORT so a new process can bind alongside the
+	// old one during a restart.
+	ReusePort bool `json:"reusePort,omitempty"`
+	// ProxyProtocol expects a PROXY protocol v1 or v2 header on every
+	// connection, as sent by L4 load balancers, and reports the client
+	// address it carries as the remote address.
+	ProxyProtocol bool `json:"proxyProtocol,omitempty"`
+}
+
+func (c *ListenerConfig) Validate() error {
+	if _, _, err := net.SplitHostPort(c.Address); err != nil {
+		return fmt.Errorf("address: %w", err)
+	}
+	switch c.Network {
+	case "", "tcp", "tcp4", "tcp6":
+	default:
+		return fmt.Errorf("network: must be tcp, tcp4 or tcp6")
+	}
+	if c.ReusePort && !reusePortSupported {
+		return errors.New("reusePort: not supported on this platform")
+	}
+	return nil
+}
+
+func (c *ListenerConfig) Listen(ctx context.Context) (net.Listener, error) {
+	network := c.Network
+	if network == "" {
+		network = "tcp"
+	}
+	lc := net.ListenConfig{}
+	if c.ReusePort {
+		lc.Control = setReusePort
+	}
+	l, err := lc.Listen(ctx, network, c.Address)
+	if err != nil {
+		return nil, err
+	}
+	if c.ProxyProtocol {
+		l = &proxyListener{Listener: l}
+	}
+	return l, nil
+}
+
+type proxyListener struct {
+	net.Listener
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &proxyConn{Conn: c, r: bufio.NewReader(c)}, nil
+}
+
+// proxyConn parses the PROXY header on first use, so a slow client cannot
+// stall Accept for everyone else.
+type proxyConn struct {
+	net.Conn
+	r *bufio.Reader
+
+	once   sync.Once
+	remote net.Addr
+	err    error
+}
+
+func (c *proxyConn) init() {
+	c.once.Do(func() {
+		c.Conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+		c.remote, c.err = readProxyHeader(c.r)
+		c.Conn.SetReadDeadline(time.Time{})
+		if c.err != nil {
+			c.Conn.Close()
+		}
+	})
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.r.Read(b)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.init()
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// readProxyHeader consumes a PROXY protocol header and returns the source
+// address it declares, or nil for LOCAL/UNKNOWN connections such as load
+// balancer health checks.
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	peek, err := r.Peek(len(proxyV2Signature))
+	if err != nil {
+		return nil, fmt.Errorf("reading PROXY header: %w", err)
+	}
+	if bytes.Equal(peek, proxyV2Signature) {
+		return readProxyV2(r)
+	}
+	if bytes.HasPrefix(peek, []byte("PROXY ")) {
+		return readProxyV1(r)
+	}
+	return nil, errors.New("missing PROXY header")
+}
+
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	// The v1 header is at most 107 bytes including CRLF.
+	line, err := r.ReadSlice('\n')
+	if err != nil || len(line) > 107 || !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("malformed PROXY v1 header")
+	}
+	fields := strings.Fields(string(line))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, errors.New("malformed PROXY v1 header")
+	}
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.Atoi(fields[4])
+	if ip == nil || err != nil || port < 0 || port > 65535 {
+		return nil, errors.New("malformed PROXY v1 address")
+	}
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
+
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	var hdr [16]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	if hdr[12]>>4 != 2 {
+		return nil, errors.New("unsupported PROXY version")
+	}
+	body := make([]byte, binary.BigEndian.Uint16(hdr[14:16]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	if hdr[12]&0x0f == 0 {
+		// LOCAL command: the connection was made by the proxy itself.
+		return nil, nil
+	}
+
+	switch hdr[13] >> 4 {
+	case 1: // AF_INET
+		if len(body) < 12 {
+			return nil, errors.New("short PROXY v2 address")
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:4]), Port: int(binary.BigEndian.Uint16(body[8:10]))}, nil
+	case 2: // AF_INET6
+		if len(body) < 36 {
+			return nil, errors.New("short PROXY v2 address")
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:16]), Port: int(binary.BigEndian.Uint16(body[32:34]))}, nil
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+)
+
+// proxyV2 builds a PROXY header of the given version with command cmd
+// (0 LOCAL, 1 PROXY) and family fam (1 AF_INET, 2 AF_INET6) over the
+// address block addrs.
+func proxyV2(version, cmd, fam byte, addrs []byte) string {
+	hdr := append([]byte{}, proxyV2Signature...)
+	hdr = append(hdr, version<<4|cmd, fam<<4|1, 0, 0)
+	binary.BigEndian.PutUint16(hdr[14:16], uint16(len(addrs)))
+	return string(append(hdr, addrs...))
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	inet := []byte{203, 0, 113, 7, 10, 0, 0, 1, 0x1f, 0x90, 0x00, 0x50}
+	inet6 := make([]byte, 36)
+	copy(inet6, net.ParseIP("2001:db8::7"))
+	copy(inet6[16:], net.ParseIP("2001:db8::1"))
+	binary.BigEndian.PutUint16(inet6[32:], 8080)
+
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{name: "v1 TCP4", in: "PROXY TCP4 203.0.113.7 10.0.0.1 8080 80\r\nGET /", want: "203.0.113.7:8080"},
+		{name: "v1 TCP6", in: "PROXY TCP6 2001:db8::7 2001:db8::1 8080 443\r\nGET /", want: "[2001:db8::7]:8080"},
+		{name: "v1 UNKNOWN", in: "PROXY UNKNOWN\r\nGET /"},
+		{name: "v1 without CRLF", in: "PROXY TCP4 203.0.113.7 10.0.0.1 8080 80\nGET /", wantErr: true},
+		{name: "v1 bad address", in: "PROXY TCP4 203.0.113.x 10.0.0.1 8080 80\r\n", wantErr: true},
+		{name: "v1 bad port", in: "PROXY TCP4 203.0.113.7 10.0.0.1 70000 80\r\n", wantErr: true},
+		{name: "v1 other protocol", in: "PROXY UDP4 203.0.113.7 10.0.0.1 8080 80\r\n", wantErr: true},
+		{name: "v1 too long", in: "PROXY TCP4 " + strings.Repeat("1", 100) + " 10.0.0.1 8080 80\r\n", wantErr: true},
+		{name: "v2 IPv4", in: proxyV2(2, 1, 1, inet) + "GET /", want: "203.0.113.7:8080"},
+		{name: "v2 IPv6", in: proxyV2(2, 1, 2, inet6) + "GET /", want: "[2001:db8::7]:8080"},
+		{name: "v2 LOCAL", in: proxyV2(2, 0, 0, nil) + "GET /"},
+		{name: "v2 unspecified family", in: proxyV2(2, 1, 0, nil) + "GET /"},
+		{name: "v2 wrong version", in: proxyV2(1, 1, 1, inet), wantErr: true},
+		{name: "v2 short IPv4 block", in: proxyV2(2, 1, 1, inet[:8]), wantErr: true},
+		{name: "v2 short IPv6 block", in: proxyV2(2, 1, 2, inet6[:20]), wantErr: true},
+		{name: "v2 truncated", in: proxyV2(2, 1, 1, inet)[:20], wantErr: true},
+		{name: "no header", in: "GET / HTTP/1.1\r\n\r\n", wantErr: true},
+		{name: "too short", in: "PRO", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReader(strings.NewReader(tt.in))
+			addr, err := readProxyHeader(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			got := ""
+			if addr != nil {
+				got = addr.String()
+			}
+			if got != tt.want {
+				t.Errorf("addr = %q, want %q", got, tt.want)
+			}
+			if err == nil {
+				if rest, _ := r.ReadString(0); rest != "GET /" {
+					t.Errorf("left %q after the header", rest)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+)
+
+const (
+	requestIDHeader = "X-Request-Id"
+	maxRequestID    = 128
+)
+
+// LogConfig selects the log level and output format. Request headers and
+// payloads are only logged at debug level.
+type LogConfig struct {
+	// Level is debug, info (the default), warn or error.
+	Level string `json:"level,omitempty"`
+	// Format is text (the default) or json.
+	Format string `json:"format,omitempty"`
+
+	level slog.Level
+}
+
+func (c *LogConfig) Validate() error {
+	var errs []error
+	if c.Level != "" {
+		if err := c.level.UnmarshalText([]byte(c.Level)); err != nil {
+			errs = append(errs, errors.New("log.level: must be debug, info, warn or error"))
+		}
+	}
+	switch c.Format {
+	case "", "text", "json":
+	default:
+		errs = append(errs, errors.New("log.format: must be text or json"))
+	}
+	return errors.Join(errs...)
+}
+
+// setupLogging makes the default slog logger write to w. Messages from the
+// standard log package go through it too, at info level.
+func setupLogging(c LogConfig, w io.Writer) {
+	opts := &slog.HandlerOptions{Level: c.level}
+	var h slog.Handler = slog.NewTextHandler(w, opts)
+	if c.Format == "json" {
+		h = slog.NewJSONHandler(w, opts)
+	}
+	slog.SetDefault(slog.New(h))
+}
+
+type requestIDKey struct{}
+
+// requestIDs gives every request an ID, reusing X-Request-Id when a proxy
+// in front already set a plausible one, and echoes it in the response so
+// senders can quote it.
+func requestIDs(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// validRequestID keeps IDs that would garble log lines out.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestID {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// requestLogger returns the default logger, with the request ID when ctx
+// carries one, and the trace ID when it is traced. Queued deliveries keep
+// the request's context values, so their log lines share the IDs.
+func requestLogger(ctx context.Context) *slog.Logger {
+	logger := slog.Default()
+	if id, ok := ctx.Value(requestIDKey{}).(string); ok {
+		logger = logger.With("request_id", id)
+	}
+	if id, ok := traceID(ctx); ok {
+		logger = logger.With("trace_id", id)
+	}
+	return logger
+}
+
+func (c *Config) logConfig() *LogConfig {
+	if c.Log == nil {
+		c.Log = &LogConfig{}
+	}
+	return c.Log
+}
@@ -1,89 +1,357 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
+	"flag"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 )
 
 const (
 	port         = "8080"
 	webhookPath  = "/webhook"
 	secretHeader = "X-Webhook-Secret"
-	expectedSecret = "my-super-secret-123"
 )
 
-type DockerHubPush struct {
-	PushData struct {
-		PushedAt string `json:"pushed_at"`
-		Tag      string `json:"tag"`
-	} `json:"push_data"`
-	Repository struct {
-		Name     string `json:"name"`
-		RepoName string `json:"repo_name"`
-	} `json:"repository"`
-	CallbackURL string `json:"callback_url"`
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
 }
 
-func webhookHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+// adminMux serves the operator APIs under /admin, /events and /dlq. They
+// expose payload contents and replay capability, so they are only mounted
+// when OIDC is configured.
+var adminMux = http.NewServeMux()
 
-	if secret := r.Header.Get(secretHeader); secret != "" {
-		if secret != expectedSecret {
-			log.Printf("Invalid secret: %s", secret)
-			http.Error(w, "Forbidden", http.StatusForbidden)
-			return
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
 		}
-	} else {
-		http.Error(w, "Missing secret header", http.StatusUnauthorized)
-		return
+	}
+	return out
+}
+
+func main() {
+	if len(os.Args) > 2 && os.Args[1] == "config" && os.Args[2] == "validate" {
+		os.Exit(runValidate(os.Args[3:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		os.Exit(runValidate(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "providers" {
+		os.Exit(runProviders(os.Args[2:]))
 	}
 
-	body, err := io.ReadAll(r.Body)
+	logOutput := io.MultiWriter(os.Stderr, recentLogs)
+	log.SetOutput(logOutput)
+	flags := registerFlags(flag.CommandLine)
+	flag.Parse()
+	cfg, err := LoadConfig(flags.config, flags)
 	if err != nil {
-		log.Printf("Error reading body: %v", err)
-		http.Error(w, "Bad request", http.StatusBadRequest)
-		return
+		log.Fatalf("Invalid configuration: %v", err)
 	}
-	defer r.Body.Close()
+	setupLogging(*cfg.logConfig(), logOutput)
+	var flushTraces func(context.Context) error
+	if cfg.Tracing != nil {
+		if flushTraces, err = setupTracing(context.Background(), *cfg.Tracing); err != nil {
+			log.Fatalf("Configuring tracing: %v", err)
+		}
+		log.Printf("Exporting traces to %s", cfg.Tracing.Endpoint)
+	}
+	webhookSecrets = watchSecrets("webhooks", *cfg.Server.secrets)
 
-	log.Printf("Webhook received at: %s", r.Header.Get("Date"))
-	log.Printf("Headers: %v", r.Header)
-	log.Printf("Raw body: %s", string(body))
+	if cfg.Features != nil {
+		features = NewFeatureFlags(*cfg.Features)
+	}
+	adminMux.HandleFunc("GET /admin/flags", features.listHandler)
+	adminMux.HandleFunc("PUT /admin/flags/{name}", features.setHandler)
+	adminMux.HandleFunc("DELETE /admin/flags/{name}", features.setHandler)
 
-	var prettyJSON map[string]interface{}
-	if json.Unmarshal(body, &prettyJSON) == nil {
-		prettyBytes, _ := json.MarshalIndent(prettyJSON, "", "  ")
-		log.Printf("Pretty payload:\n%s", string(prettyBytes))
+	if cfg.Sinks != nil {
+		if sinks, err = cfg.Sinks.Build(); err != nil {
+			log.Fatalf("Configuring sinks: %v", err)
+		}
+		for _, s := range sinks {
+			log.Printf("Forwarding events to sink %s", s.Name())
+		}
+		if cfg.Sinks.Canary != nil {
+			if canary, err = NewCanaryRouter(*cfg.Sinks.Canary); err != nil {
+				log.Fatalf("Configuring canary: %v", err)
+			}
+			adminMux.HandleFunc("GET /admin/canary", canary.statsHandler)
+			log.Printf("Routing %d%% of matching events to canary %s", cfg.Sinks.Canary.Percent, canary.target.Name())
+		}
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Webhook received successfully",
-	})
-}
+	if cfg.Routing != nil {
+		if router, err = NewRouter(*cfg.Routing, sinks); err != nil {
+			log.Fatalf("Configuring routing: %v", err)
+		}
+		go router.Watch(context.Background())
+		if router.crd != nil {
+			// The API server calls this, so it is not behind OIDC.
+			http.HandleFunc("POST /admission/webhookroutes", router.admissionHandler)
+			log.Printf("Routing events by WebhookRoutes; admission webhook: POST /admission/webhookroutes")
+		} else {
+			log.Printf("Routing events by rules in %s", cfg.Routing.RulesFile)
+		}
+	}
 
-func healthHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("OK"))
-}
+	if cfg.Budgets != nil {
+		budgets = NewBudgets(*cfg.Budgets)
+		go budgets.Run(context.Background())
+		log.Printf("Throttling at %d/%d bytes of heap and %d goroutines",
+			cfg.Budgets.SoftMemoryBytes, cfg.Budgets.HardMemoryBytes, cfg.Budgets.MaxGoroutines)
+	}
 
-func main() {
-	http.HandleFunc(webhookPath, webhookHandler)
+	if cfg.Dedup != nil {
+		dedup = NewDedup(*cfg.Dedup)
+		log.Printf("Dropping duplicate events within %v", cfg.Dedup.ttl)
+	}
+
+	if cfg.Relay != nil {
+		relay = NewRelay(*cfg.Relay)
+		for _, t := range cfg.Relay.Targets {
+			log.Printf("Relaying webhooks to %s (%s)", t.Name, t.URL)
+		}
+	}
+
+	if cfg.Mirror != nil {
+		mirror = NewMirror(*cfg.Mirror)
+		log.Printf("Mirroring %d%% of webhooks to %s", mirror.percent, mirror.url)
+	}
+
+	queueCfg := QueueConfig{}
+	if cfg.Queue != nil {
+		queueCfg = *cfg.Queue
+	}
+	queue = NewEventQueue(queueCfg)
+	if path := queueCfg.JournalPath; path != "" {
+		n, err := queue.OpenJournal(path)
+		if err != nil {
+			log.Fatalf("Opening queue journal: %v", err)
+		}
+		log.Printf("Journalling queued events in %s, %d restored", path, n)
+	}
+	if cfg.DLQ != nil {
+		dlq = NewDeadLetterQueue(*cfg.DLQ)
+	}
+	adminMux.HandleFunc("GET /admin/dlq", dlq.listHandler)
+	adminMux.HandleFunc("POST /admin/dlq/{id}/retry", dlq.retryHandler)
+	queueCtx, stopQueue := context.WithCancel(context.Background())
+	queue.Start(queueCtx)
+	consumerCtx, stopConsumers := context.WithCancel(context.Background())
+	if cfg.RedisConsumer != nil {
+		consumer, err := NewRedisConsumer(*cfg.RedisConsumer)
+		if err != nil {
+			log.Fatalf("Configuring Redis consumer: %v", err)
+		}
+		goConsumer(func() {
+			consumer.Run(consumerCtx)
+			consumer.Close()
+		})
+		log.Printf("Delivering events from Redis stream %s as %s in group %s", consumer.stream, consumer.consumer, consumer.group)
+	}
+	adminMux.HandleFunc("GET /admin/watchdog", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(watchdog.Overruns())
+	})
+	if cfg.Store != nil {
+		store = NewEventStore(*cfg.Store)
+	}
+	adminMux.HandleFunc("GET /events", store.eventsHandler)
+	adminMux.HandleFunc("GET /events/stream", store.streamHandler)
+	adminMux.HandleFunc("GET /events/{seq}", store.getHandler)
+	adminMux.HandleFunc("POST /events/{seq}/tags", store.tagHandler)
+	adminMux.HandleFunc("DELETE /events/{seq}/tags/{tag}", store.untagHandler)
+	if cfg.Archive != nil {
+		if archive, err = OpenArchive(*cfg.Archive); err != nil {
+			log.Fatalf("Opening archive: %v", err)
+		}
+		go archive.Run(context.Background())
+		adminMux.HandleFunc("GET /admin/deliveries", archive.listHandler)
+		adminMux.HandleFunc("GET /admin/deliveries/{id}", archive.getHandler)
+		adminMux.HandleFunc("POST /admin/replay/{id}", replayHandler)
+		log.Printf("Archiving deliveries in %s", cfg.Archive.Path)
+	}
+	if len(cfg.Tenants) > 0 {
+		tenants = NewTenants(cfg.Tenants)
+		if err := tenants.Setup(sinks); err != nil {
+			log.Fatalf("Configuring tenants: %v", err)
+		}
+		log.Printf("Accounting events for %d tenants", len(cfg.Tenants))
+	}
+	adminMux.HandleFunc("GET /admin/tenants", tenants.usageHandler)
+	if cfg.Incidents != nil {
+		incidents.slackWebhook = cfg.Incidents.slackWebhook
+	}
+	adminMux.HandleFunc("GET /admin/incidents", incidents.listHandler)
+	state := stateHandler{cfg: cfg}
+	adminMux.HandleFunc("GET /admin/state", state.export)
+	adminMux.HandleFunc("POST /admin/state", state.restore)
+
+	if d := cfg.DockerHub; d != nil && d.Callbacks {
+		dockerHubCallbacks = newCallbackClient(*d)
+		log.Printf("Acknowledging Docker Hub deliveries (timeout %v, %d retries)", d.timeout, d.retries)
+	}
+	if cfg.GAR != nil {
+		configureGAR(*cfg.GAR)
+	}
+	if cfg.Server.MaxBodyBytes > 0 {
+		maxBodyBytes = cfg.Server.MaxBodyBytes
+	}
+	trustedProxies = cfg.Server.trustedProxies
+	if sf := cfg.Server.AllowedSources; sf != nil {
+		sourceFilter = NewSourceFilter(*sf)
+		go sourceFilter.Run(context.Background())
+		log.Printf("Accepting webhooks from %d configured ranges (GitHub hook ranges: %v)", len(sf.allowed), sf.GitHubMeta != nil)
+	}
+	if rl := cfg.Server.RateLimit; rl != nil {
+		rateLimiter = NewRateLimiter(*rl)
+		log.Printf("Rate limiting webhooks to %g/s per source (burst %g)", rateLimiter.rate, rateLimiter.burst)
+	}
+	for name, sc := range cfg.ProviderSecrets {
+		providerSecrets[name] = watchSecrets(name, *sc)
+	}
+	for name, a := range cfg.Auth {
+		var secrets *SecretSet
+		if a.secrets != nil {
+			secrets = watchSecrets(name, *a.secrets)
+		}
+		providerAuth[name] = a.authenticator(secrets)
+		log.Printf("Authenticating %s webhooks with %s", name, a.Scheme)
+	}
+	for path, p := range providerRoutes {
+		if !cfg.Server.providerEnabled(p.Name()) {
+			delete(providerRoutes, path)
+		}
+	}
+	for _, m := range cfg.Mappers {
+		registerProvider(m.path(), newMapperProvider(m))
+	}
+	for path, p := range providerRoutes {
+		http.Handle(path, instrumentProvider(p.Name(), traceProvider(p.Name(), sourceFilter.Middleware(p.Name(), rateLimiter.Middleware(providerHandler(p))))))
+		log.Printf("Webhook endpoint: POST %s (%s)", path, p.Name())
+	}
 	http.HandleFunc("/health", healthHandler)
+	http.HandleFunc("GET /metrics", metricsHandler)
+	livez.Add("ping", func(context.Context) error { return nil })
+	readyz.Add("ping", func(context.Context) error { return nil })
+	readyz.Add("queue", queueCheck)
+	readyz.Add("shutdown", shutdownCheck)
+	if archive != nil {
+		readyz.Add("store", archive.db.PingContext)
+	}
+	usesSlack := incidents.slackWebhook != ""
+	for _, s := range sinks {
+		switch s := s.(type) {
+		case *SlackSink:
+			usesSlack = true
+		case *NATSSink:
+			readyz.Add("nats-"+s.Name(), s.check)
+		}
+	}
+	if usesSlack {
+		readyz.Add("slack", (&slackCheck{}).check)
+	}
+	for _, h := range []*HealthChecks{livez, readyz} {
+		http.Handle("/"+h.name, h)
+		http.Handle("/"+h.name+"/", h)
+	}
+
+	if cfg.stubs != nil {
+		stubs := NewStubRegistry(cfg.stubs.Stubs)
+		stubs.Register(http.DefaultServeMux)
+		adminMux.HandleFunc("GET /admin/stubs", stubs.recordingsHandler)
+	}
+
+	if cfg.OIDC != nil {
+		verifier := NewOIDCVerifier(*cfg.OIDC)
+		protected := verifier.Middleware(adminMux)
+		if l := cfg.LinkSigning; l != nil {
+			linkSigner = NewLinkSigner(l.key, l.BaseURL)
+			adminMux.HandleFunc("POST /admin/links", linkSigner.mintHandler)
+			protected = linkSigner.Middleware(adminMux, protected)
+		}
+		for _, prefix := range []string{"/admin/", "/events", "/events/", "/dlq", "/dlq/"} {
+			http.Handle(prefix, protected)
+		}
+		log.Printf("Admin endpoints: /admin, /events, /dlq (OIDC issuer %s)", cfg.OIDC.Issuer)
+	} else {
+		log.Printf("OIDC not configured, admin endpoints disabled")
+	}
+
+	listeners := cfg.Listeners
+	if len(listeners) == 0 {
+		listeners = []ListenerConfig{{Address: ":" + port}}
+	}
+	log.Printf("Health endpoints: GET /health, /healthz, /readyz; metrics: GET /metrics")
 
-	log.Printf("Starting webhook receiver on port %s", port)
-	log.Printf("Webhook endpoint: POST %s", webhookPath)
-	log.Printf("Health endpoint: GET /health")
+	var handler http.Handler = http.DefaultServeMux
+	tenantPaths := make(map[string]*tenantPathConfig)
+	for _, t := range cfg.Tenants {
+		if !t.Path {
+			continue
+		}
+		tp := &tenantPathConfig{name: t.Name}
+		if t.Secrets != nil {
+			tp.secrets = watchSecrets("tenant "+t.Name, *t.Secrets)
+		}
+		tenantPaths[t.Name] = tp
+		log.Printf("Tenant %s: webhooks at %s/%s/", t.Name, webhookPath, t.Name)
+	}
+	if len(tenantPaths) > 0 {
+		handler = newTenantRouter(handler, tenantPaths)
+	}
+	if prefix := cfg.Server.PathPrefix; prefix != "" {
+		log.Printf("Serving below path prefix %s", prefix)
+	}
+	for _, vh := range cfg.VirtualHosts {
+		log.Printf("Virtual host %s: prefix %q, tenant %q, links %s", vh.Host, vh.PathPrefix, vh.Tenant, vh.baseURL())
+	}
+	if cfg.Server.PathPrefix != "" || len(cfg.VirtualHosts) > 0 {
+		handler = newVHostRouter(handler, cfg.Server.PathPrefix, cfg.VirtualHosts)
+	}
+	handler = requestIDs(recoverHandler(handler))
+	srv := &http.Server{
+		Handler:      handler,
+		ReadTimeout:  cfg.Server.readTimeout,
+		WriteTimeout: cfg.Server.writeTimeout,
+		IdleTimeout:  cfg.Server.idleTimeout,
+	}
+	srv.RegisterOnShutdown(store.closeStreams)
+	errc := make(chan error, len(listeners))
+	for _, lc := range listeners {
+		l, err := lc.Listen(context.Background())
+		if err != nil {
+			log.Fatalf("Listening on %s: %v", lc.Address, err)
+		}
+		log.Printf("Starting webhook receiver on %s (tls=%v, reusePort=%v, proxyProtocol=%v)",
+			l.Addr(), cfg.Server.TLS != nil, lc.ReusePort, lc.ProxyProtocol)
+		go func() {
+			if t := cfg.Server.TLS; t != nil {
+				errc <- srv.ServeTLS(l, t.CertFile, t.KeyFile)
+			} else {
+				errc <- srv.Serve(l)
+			}
+		}()
+	}
 
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
+	sig, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	select {
+	case err := <-errc:
 		log.Fatal(err)
+	case <-sig.Done():
 	}
+	stop()
+	shutdown(srv, cfg.Server.shutdownTimeout, stopConsumers, stopQueue, flushTraces)
 }
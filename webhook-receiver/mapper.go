@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MapperConfig defines a provider for an unsupported sender by mapping
+// JSONPath expressions onto event fields.
+type MapperConfig struct {
+	// Name is the provider name; the mapper is served at
+	// /webhook/mapped/<name> unless Path is set.
+	Name string `json:"name"`
+	Path string `json:"path,omitempty"`
+	// Items selects an array in the payload; each element becomes one
+	// event and the field paths are evaluated against it. Without Items the
+	// payload is a single event.
+	Items string `json:"items,omitempty"`
+	// Type is the event type when Fields.Type is not set or empty.
+	Type   string       `json:"type,omitempty"`
+	Fields MapperFields `json:"fields"`
+	// TimestampFormat is a Go time layout; by default RFC 3339 strings and
+	// Unix seconds or milliseconds are accepted.
+	TimestampFormat string `json:"timestampFormat,omitempty"`
+}
+
+// MapperFields holds a JSONPath expression (e.g. "$.push_data.tag") per
+// event field.
+type MapperFields struct {
+	ID         string `json:"id,omitempty"`
+	Type       string `json:"type,omitempty"`
+	Registry   string `json:"registry,omitempty"`
+	Repository string `json:"repository"`
+	Tag        string `json:"tag,omitempty"`
+	Digest     string `json:"digest,omitempty"`
+	MediaType  string `json:"mediaType,omitempty"`
+	Action     string `json:"action,omitempty"`
+	URL        string `json:"url,omitempty"`
+	Timestamp  string `json:"timestamp,omitempty"`
+}
+
+func (f *MapperFields) each(fn func(name, expr string)) {
+	for _, p := range []struct{ name, expr string }{
+		{"id", f.ID}, {"type", f.Type}, {"registry", f.Registry}, {"repository", f.Repository},
+		{"tag", f.Tag}, {"digest", f.Digest}, {"mediaType", f.MediaType}, {"action", f.Action},
+		{"url", f.URL}, {"timestamp", f.Timestamp},
+	} {
+		if p.expr != "" {
+			fn(p.name, p.expr)
+		}
+	}
+}
+
+func (c *MapperConfig) path() string {
+	if c.Path != "" {
+		return c.Path
+	}
+	return "/webhook/mapped/" + c.Name
+}
+
+func validateMappers(cfgs []MapperConfig) error {
+	var errs []error
+	seen := make(map[string]bool)
+	for _, p := range providerRoutes {
+		seen[p.Name()] = true
+	}
+	for i, m := range cfgs {
+		prefix := fmt.Sprintf("mappers[%d]", i)
+		if m.Name == "" {
+			errs = append(errs, fmt.Errorf("%s.name: required", prefix))
+		} else if seen[m.Name] {
+			errs = append(errs, fmt.Errorf("%s.name: %q is already a provider", prefix, m.Name))
+		}
+		seen[m.Name] = true
+		if _, ok := providerRoutes[m.path()]; ok || !strings.HasPrefix(m.path(), "/") {
+			errs = append(errs, fmt.Errorf("%s.path: %q is not available", prefix, m.path()))
+		}
+		if m.Type != "" && !knownEventTypes[m.Type] {
+			errs = append(errs, fmt.Errorf("%s.type: unknown event type %q", prefix, m.Type))
+		}
+		if m.Fields.Repository == "" {
+			errs = append(errs, fmt.Errorf("%s.fields.repository: required", prefix))
+		}
+		if m.Items != "" {
+			if _, err := compileJSONPath(m.Items); err != nil {
+				errs = append(errs, fmt.Errorf("%s.items: %w", prefix, err))
+			}
+		}
+		m.Fields.each(func(name, expr string) {
+			if _, err := compileJSONPath(expr); err != nil {
+				errs = append(errs, fmt.Errorf("%s.fields.%s: %w", prefix, name, err))
+			}
+		})
+	}
+	return errors.Join(errs...)
+}
+
+// mapperProvider is a Provider built from a MapperConfig. It authenticates
+// with the secret header unless an auth scheme is configured for its name.
+type mapperProvider struct {
+	cfg    MapperConfig
+	items  jsonPath
+	fields map[string]jsonPath
+}
+
+func newMapperProvider(cfg MapperConfig) *mapperProvider {
+	p := &mapperProvider{cfg: cfg, fields: make(map[string]jsonPath)}
+	if cfg.Items != "" {
+		p.items, _ = compileJSONPath(cfg.Items)
+	}
+	cfg.Fields.each(func(name, expr string) {
+		p.fields[name], _ = compileJSONPath(expr)
+	})
+	return p
+}
+
+func (p *mapperProvider) Name() string { return p.cfg.Name }
+
+func (p *mapperProvider) Authenticate(r *http.Request, _ []byte) error {
+	return checkSecret(r, p.Name(), r.Header.Get(secretHeader))
+}
+
+func (p *mapperProvider) Parse(_ *http.Request, body []byte) ([]Event, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	items := []any{doc}
+	if p.cfg.Items != "" {
+		v, ok := p.items.lookup(doc)
+		list, isList := v.([]any)
+		if !ok || !isList {
+			return nil, fmt.Errorf("%s does not select an array", p.cfg.Items)
+		}
+		items = list
+	}
+
+	var events []Event
+	for i, item := range items {
+		e, err := p.event(item)
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %w", i, err)
+		}
+		if e.Repository == "" {
+			log.Printf("Mapper %s: item %d has no repository, skipping", p.cfg.Name, i)
+			continue
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+func (p *mapperProvider) event(item any) (Event, error) {
+	get := func(name string) string {
+		path, ok := p.fields[name]
+		if !ok {
+			return ""
+		}
+		v, _ := path.lookup(item)
+		switch v := v.(type) {
+		case string:
+			return v
+		case json.Number:
+			return v.String()
+		case bool:
+			return strconv.FormatBool(v)
+		}
+		return ""
+	}
+
+	e := Event{
+		ID:         get("id"),
+		Provider:   p.cfg.Name,
+		Type:       get("type"),
+		Registry:   get("registry"),
+		Repository: get("repository"),
+		Tag:        get("tag"),
+		Digest:     get("digest"),
+		MediaType:  get("mediaType"),
+		Action:     get("action"),
+		URL:        get("url"),
+		Timestamp:  time.Now(),
+	}
+	if e.Type == "" {
+		e.Type = p.cfg.Type
+	}
+	if e.Type == "" {
+		e.Type = EventPush
+	}
+	if raw := get("timestamp"); raw != "" {
+		ts, err := p.parseTime(raw)
+		if err != nil {
+			return Event{}, fmt.Errorf("timestamp: %w", err)
+		}
+		e.Timestamp = ts
+	}
+	return e, nil
+}
+
+func (p *mapperProvider) parseTime(raw string) (time.Time, error) {
+	if p.cfg.TimestampFormat != "" {
+		return time.Parse(p.cfg.TimestampFormat, raw)
+	}
+	if n, err := strconv.ParseFloat(raw, 64); err == nil {
+		// Values this large are milliseconds.
+		if n > 1e12 {
+			return time.UnixMilli(int64(n)), nil
+		}
+		return time.Unix(int64(n), 0), nil
+	}
+	return time.Parse(time.RFC3339Nano, raw)
+}
+
+// jsonPath is a compiled JSONPath subset: $ followed by .name, ['name']
+// and [index] steps.
+type jsonPath []any
+
+func compileJSONPath(expr string) (jsonPath, error) {
+	rest, ok := strings.CutPrefix(expr, "$")
+	if !ok {
+		return nil, fmt.Errorf("%q must start with $", expr)
+	}
+	var out jsonPath
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("%q: empty name", expr)
+			}
+			out = append(out, rest[:end])
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("%q: unterminated [", expr)
+			}
+			inner := rest[1:end]
+			rest = rest[end+1:]
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				out = append(out, inner[1:len(inner)-1])
+				continue
+			}
+			i, err := strconv.Atoi(inner)
+			if err != nil || i < 0 {
+				return nil, fmt.Errorf("%q: invalid index %q", expr, inner)
+			}
+			out = append(out, i)
+		default:
+			return nil, fmt.Errorf("%q: unexpected %q", expr, rest[0])
+		}
+	}
+	return out, nil
+}
+
+func (p jsonPath) lookup(v any) (any, bool) {
+	for _, step := range p {
+		switch step := step.(type) {
+		case string:
+			m, ok := v.(map[string]any)
+			if !ok {
+				return nil, false
+			}
+			if v, ok = m[step]; !ok {
+				return nil, false
+			}
+		case int:
+			list, ok := v.([]any)
+			if !ok || step >= len(list) {
+				return nil, false
+			}
+			v = list[step]
+		}
+	}
+	return v, true
+}
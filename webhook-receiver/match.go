@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"path"
+)
+
+// EventMatch selects events by provider, type, repository and tag.
+// Repository and Tag are path.Match globs; empty fields match anything.
+type EventMatch struct {
+	Provider   string `json:"provider,omitempty"`
+	Repository string `json:"repository,omitempty"`
+	Tag        string `json:"tag,omitempty"`
+	Type       string `json:"type,omitempty"`
+}
+
+func (m EventMatch) matches(e Event) bool {
+	if m.Provider != "" && m.Provider != e.Provider {
+		return false
+	}
+	if m.Type != "" && m.Type != e.Type {
+		return false
+	}
+	if m.Repository != "" {
+		if ok, _ := path.Match(m.Repository, e.Repository); !ok {
+			return false
+		}
+	}
+	if m.Tag != "" {
+		if ok, _ := path.Match(m.Tag, e.Tag); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (m EventMatch) Validate() error {
+	for _, glob := range []string{m.Repository, m.Tag} {
+		if _, err := path.Match(glob, ""); err != nil {
+			return fmt.Errorf("bad pattern %q", glob)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prometheus metrics for the webhook endpoints, served in the text
+// exposition format at /metrics.
+var (
+	webhookRequests = newMetric("webhook_requests_total", "counter",
+		"Webhook requests by provider and HTTP status.", "provider", "code")
+	webhookOutcomes = newMetric("webhook_deliveries_total", "counter",
+		"Webhook deliveries by provider and outcome (accepted, rejected, invalid, ...).", "provider", "outcome")
+	webhookDuration = newMetric("webhook_request_duration_seconds", "histogram",
+		"Time taken to handle a webhook request.", "provider").
+		withBuckets(0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10)
+	webhookPayloadSize = newMetric("webhook_payload_bytes", "histogram",
+		"Size of webhook request bodies.", "provider").
+		withBuckets(256, 1024, 4096, 16384, 65536, 262144, 1048576, 4194304)
+	webhookInFlight = newMetric("webhook_requests_in_flight", "gauge",
+		"Webhook requests currently being handled.")
+)
+
+var allMetrics []*metric
+
+// metric is a family of series of one type, one per combination of label
+// values.
+type metric struct {
+	name, kind, help string
+	labels           []string
+	buckets          []float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labels []string
+	value  float64
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+}
+
+func newMetric(name, kind, help string, labels ...string) *metric {
+	m := &metric{name: name, kind: kind, help: help, labels: labels, series: make(map[string]*series)}
+	allMetrics = append(allMetrics, m)
+	return m
+}
+
+func (m *metric) withBuckets(b ...float64) *metric {
+	m.buckets = b
+	return m
+}
+
+// get returns the series for labels. The caller holds m.mu.
+func (m *metric) get(labels []string) *series {
+	key := strings.Join(labels, "\xff")
+	s, ok := m.series[key]
+	if !ok {
+		s = &series{labels: labels}
+		if m.buckets != nil {
+			s.counts = make([]uint64, len(m.buckets)+1)
+		}
+		m.series[key] = s
+	}
+	return s
+}
+
+// add adds v to a counter or gauge.
+func (m *metric) add(v float64, labels ...string) {
+	m.mu.Lock()
+	m.get(labels).value += v
+	m.mu.Unlock()
+}
+
+// set sets a gauge to v.
+func (m *metric) set(v float64, labels ...string) {
+	m.mu.Lock()
+	m.get(labels).value = v
+	m.mu.Unlock()
+}
+
+// observe records v in a histogram.
+func (m *metric) observe(v float64, labels ...string) {
+	i, _ := slices.BinarySearch(m.buckets, v)
+	m.mu.Lock()
+	s := m.get(labels)
+	s.counts[i]++
+	s.value++
+	s.sum += v
+	m.mu.Unlock()
+}
+
+func (m *metric) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+	keys := make([]string, 0, len(m.series))
+	for k := range m.series {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	if len(m.labels) == 0 && len(keys) == 0 {
+		fmt.Fprintf(w, "%s 0\n", m.name)
+	}
+	for _, k := range keys {
+		s := m.series[k]
+		labels := formatLabels(m.labels, s.labels)
+		if m.buckets == nil {
+			fmt.Fprintf(w, "%s%s %s\n", m.name, braces(labels), formatFloat(s.value))
+			continue
+		}
+		var cumulative uint64
+		for i, le := range m.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, braces(joinLabels(labels, `le="`+formatFloat(le)+`"`)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %s\n", m.name, braces(joinLabels(labels, `le="+Inf"`)), formatFloat(s.value))
+		fmt.Fprintf(w, "%s_sum%s %s\n", m.name, braces(labels), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %s\n", m.name, braces(labels), formatFloat(s.value))
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(names, values []string) string {
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + `="` + labelEscaper.Replace(values[i]) + `"`
+	}
+	return strings.Join(parts, ",")
+}
+
+func joinLabels(labels, extra string) string {
+	if labels == "" {
+		return extra
+	}
+	return labels + "," + extra
+}
+
+func braces(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	for _, m := range allMetrics {
+		m.write(w)
+	}
+}
+
+// statusWriter remembers the status code written through it.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// instrumentProvider counts, times and tracks in-flight requests to a
+// provider's endpoint.
+func instrumentProvider(provider string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		webhookInFlight.add(1)
+		defer webhookInFlight.add(-1)
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		webhookRequests.add(1, provider, strconv.Itoa(sw.status))
+		webhookDuration.observe(time.Since(start).Seconds(), provider)
+	})
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+const defaultMirrorInFlight = 16
+
+var webhookMirrored = newMetric("webhook_mirrored_total", "counter",
+	"Webhooks copied to the mirror target by provider and outcome (sent, failed, dropped).", "provider", "outcome")
+
+// MirrorConfig copies a fraction of the webhooks that passed
+// authentication and parsing to a second receiver, typically staging, to
+// try new parser or routing versions on real traffic. Copies are sent once,
+// without retries, and their outcome never affects the response to the
+// sender.
+type MirrorConfig struct {
+	// URL is the base URL of the mirror receiver; the delivery's path is
+	// appended so the copy reaches the same provider endpoint.
+	URL string `json:"url"`
+	// Percent of deliveries mirrored, 100 by default.
+	Percent *int   `json:"percent,omitempty"`
+	Timeout string `json:"timeout,omitempty"`
+	// Providers limits mirroring to deliveries of these providers.
+	Providers []string `json:"providers,omitempty"`
+	// MaxInFlight bounds concurrent copies; deliveries arriving while the
+	// mirror is saturated are not mirrored.
+	MaxInFlight int `json:"maxInFlight,omitempty"`
+
+	timeout time.Duration
+}
+
+func (c *MirrorConfig) Validate() error {
+	var errs []error
+	if err := validateURL(c.URL); err != nil {
+		errs = append(errs, fmt.Errorf("mirror.url: %w", err))
+	}
+	if p := c.Percent; p != nil && (*p < 0 || *p > 100) {
+		errs = append(errs, errors.New("mirror.percent: must be between 0 and 100"))
+	}
+	if c.MaxInFlight < 0 {
+		errs = append(errs, errors.New("mirror.maxInFlight: must not be negative"))
+	}
+	c.timeout = defaultSinkTimeout
+	if c.Timeout != "" {
+		d, err := time.ParseDuration(c.Timeout)
+		if err != nil || d <= 0 {
+			errs = append(errs, errors.New("mirror.timeout: must be a positive duration"))
+		}
+		c.timeout = d
+	}
+	return errors.Join(errs...)
+}
+
+type Mirror struct {
+	url       string
+	percent   int
+	timeout   time.Duration
+	providers []string
+	slots     chan struct{}
+}
+
+// mirror is set by main when a mirror target is configured.
+var mirror *Mirror
+
+func NewMirror(cfg MirrorConfig) *Mirror {
+	m := &Mirror{url: strings.TrimSuffix(cfg.URL, "/"), percent: 100, timeout: cfg.timeout, providers: cfg.Providers}
+	if cfg.Percent != nil {
+		m.percent = *cfg.Percent
+	}
+	n := cfg.MaxInFlight
+	if n == 0 {
+		n = defaultMirrorInFlight
+	}
+	m.slots = make(chan struct{}, n)
+	return m
+}
+
+// Copy sends a sample of provider's deliveries to the mirror in the
+// background. body is copied, so the caller may reuse it.
+func (m *Mirror) Copy(provider string, req *http.Request, body []byte) {
+	if len(m.providers) > 0 && !slices.Contains(m.providers, provider) {
+		return
+	}
+	if m.percent < 100 && rand.IntN(100) >= m.percent {
+		return
+	}
+	if budgets.shed("mirror", pressureSoft) {
+		webhookMirrored.add(1, provider, "dropped")
+		return
+	}
+	select {
+	case m.slots <- struct{}{}:
+	default:
+		webhookMirrored.add(1, provider, "dropped")
+		return
+	}
+	header := make(http.Header)
+	for k, v := range req.Header {
+		if !hopHeaders[k] {
+			header[k] = v
+		}
+	}
+	header.Set("X-Webhook-Mirror", "true")
+	body = bytes.Clone(body)
+	target := m.url + req.URL.Path
+	ctx := context.WithoutCancel(req.Context())
+	goBackground(func() {
+		defer func() { <-m.slots }()
+		if err := m.send(ctx, target, header, body); err != nil {
+			webhookMirrored.add(1, provider, "failed")
+			log.Printf("Mirroring %s delivery failed: %v", provider, err)
+			return
+		}
+		webhookMirrored.add(1, provider, "sent")
+	})
+}
+
+func (m *Mirror) send(ctx context.Context, target string, header http.Header, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header = header
+	resp, err := outboundClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("mirror returned %s", resp.Status)
+	}
+	return nil
+}
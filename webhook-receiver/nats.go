@@ -0,0 +1,180 @@
+//go:build !no_nats
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+func init() { compiledSinks = append(compiledSinks, "nats") }
+
+const defaultNATSSubject = "webhooks.{{.Provider}}.{{.Type}}"
+
+// NATSSinkConfig publishes events to NATS JetStream, so other services can
+// consume registry events from a stream instead of polling.
+type NATSSinkConfig struct {
+	// Name identifies the sink in routing rules.
+	Name string `json:"name"`
+	// URL is the server to connect to; several may be given separated by
+	// commas.
+	URL string `json:"url"`
+	// Subject is a text/template executed with the Event, for example
+	// "registry.{{.Provider}}.{{.Repository}}". A stream must capture the
+	// resulting subjects, or publishing fails.
+	Subject string `json:"subject,omitempty"`
+	// CredentialsFile is a NATS .creds file; TokenFile holds a token.
+	CredentialsFile string `json:"credentialsFile,omitempty"`
+	TokenFile       string `json:"tokenFile,omitempty"`
+	Timeout         string `json:"timeout,omitempty"`
+
+	subject *template.Template
+}
+
+func (c *NATSSinkConfig) Validate() error {
+	var errs []error
+	if c.Name == "" {
+		errs = append(errs, errors.New("name: required"))
+	}
+	for _, u := range strings.Split(c.URL, ",") {
+		if u = strings.TrimSpace(u); !strings.HasPrefix(u, "nats://") && !strings.HasPrefix(u, "tls://") {
+			errs = append(errs, fmt.Errorf("url: %q is not a nats:// or tls:// URL", u))
+		}
+	}
+	subject := c.Subject
+	if subject == "" {
+		subject = defaultNATSSubject
+	}
+	var err error
+	if c.subject, err = template.New("subject").Parse(subject); err != nil {
+		errs = append(errs, fmt.Errorf("subject: %w", err))
+	}
+	if c.CredentialsFile != "" && c.TokenFile != "" {
+		errs = append(errs, errors.New("credentialsFile, tokenFile: only one may be set"))
+	}
+	if c.TokenFile != "" {
+		if _, err := readSecretFile(c.TokenFile); err != nil {
+			errs = append(errs, fmt.Errorf("tokenFile: %w", err))
+		}
+	}
+	if c.Timeout != "" {
+		if _, err := time.ParseDuration(c.Timeout); err != nil {
+			errs = append(errs, fmt.Errorf("timeout: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+type NATSSink struct {
+	name    string
+	subject *template.Template
+	timeout time.Duration
+	conn    *nats.Conn
+	js      jetstream.JetStream
+}
+
+// NewNATSSink connects to the server. The client reconnects on its own
+// after that; while it is disconnected publishes fail and are retried like
+// those of any other sink.
+func NewNATSSink(cfg NATSSinkConfig) (*NATSSink, error) {
+	opts := []nats.Option{nats.Name("kargo-webhook-receiver"), nats.MaxReconnects(-1)}
+	if cfg.CredentialsFile != "" {
+		opts = append(opts, nats.UserCredentials(cfg.CredentialsFile))
+	}
+	if cfg.TokenFile != "" {
+		token, err := readSecretFile(cfg.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, nats.Token(token))
+	}
+	conn, err := nats.Connect(cfg.URL, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to NATS for sink %s: %w", cfg.Name, err)
+	}
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	s := &NATSSink{name: cfg.Name, subject: cfg.subject, timeout: defaultSinkTimeout, conn: conn, js: js}
+	if cfg.Timeout != "" {
+		s.timeout, _ = time.ParseDuration(cfg.Timeout)
+	}
+	return s, nil
+}
+
+func (s *NATSSink) Name() string { return s.name }
+
+// Send publishes e and waits for the stream's acknowledgement. Events with
+// a delivery ID carry it as Nats-Msg-Id, so the stream discards the copies
+// a retried delivery would otherwise publish again.
+func (s *NATSSink) Send(ctx context.Context, e Event) error {
+	subject, err := s.subjectFor(e)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	msg := nats.NewMsg(subject)
+	msg.Data = body
+	msg.Header.Set("Content-Type", "application/json")
+	msg.Header.Set("X-Event-Provider", e.Provider)
+	msg.Header.Set("X-Event-Type", e.Type)
+	var opts []jetstream.PublishOpt
+	if e.ID != "" {
+		opts = append(opts, jetstream.WithMsgID(e.Provider+"/"+e.ID+"/"+e.Repository+":"+e.Tag))
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	if _, err := s.js.PublishMsg(ctx, msg, opts...); err != nil {
+		return fmt.Errorf("publishing to %s: %w", subject, err)
+	}
+	return nil
+}
+
+// subjectFor executes the subject template for e. Template output is
+// taken apart into tokens and characters NATS gives a meaning to are
+// replaced, so a repository name cannot address a wildcard or produce an
+// empty token.
+func (s *NATSSink) subjectFor(e Event) (string, error) {
+	var b strings.Builder
+	if err := s.subject.Execute(&b, e); err != nil {
+		return "", fmt.Errorf("subject: %w", err)
+	}
+	tokens := strings.Split(b.String(), ".")
+	for i, t := range tokens {
+		t = strings.Map(func(r rune) rune {
+			if r == '*' || r == '>' || r <= ' ' {
+				return '_'
+			}
+			return r
+		}, t)
+		if t == "" {
+			t = "_"
+		}
+		tokens[i] = t
+	}
+	return strings.Join(tokens, "."), nil
+}
+
+// check reports whether the connection is up, for the readiness probe.
+func (s *NATSSink) check(context.Context) error {
+	if !s.conn.IsConnected() {
+		return fmt.Errorf("sink %s: %s", s.name, s.conn.Status())
+	}
+	return nil
+}
+
+// Close flushes pending publishes and closes the connection.
+func (s *NATSSink) Close() error { return s.conn.Drain() }
@@ -0,0 +1,22 @@
+//go:build no_nats
+
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+type NATSSinkConfig struct {
+	omittedConfig
+}
+
+func (c *NATSSinkConfig) Validate() error { return fmt.Errorf("name: %w", errOmitted("nats")) }
+
+type NATSSink struct {
+	Sink
+}
+
+func NewNATSSink(NATSSinkConfig) (*NATSSink, error) { return nil, errOmitted("nats") }
+
+func (s *NATSSink) check(context.Context) error { return nil }
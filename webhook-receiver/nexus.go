@@ -0,0 +1,100 @@
+//go:build !no_nexus
+
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	nexusPath            = "/webhook/nexus"
+	nexusSignatureHeader = "X-Nexus-Webhook-Signature"
+	nexusDeliveryHeader  = "X-Nexus-Webhook-Delivery"
+	nexusWebhookIDHeader = "X-Nexus-Webhook-ID"
+)
+
+func init() {
+	registerProvider(nexusPath, nexusProvider{})
+}
+
+type nexusComponentEvent struct {
+	Timestamp      string `json:"timestamp"`
+	RepositoryName string `json:"repositoryName"`
+	Action         string `json:"action"`
+	Component      struct {
+		Format  string `json:"format"`
+		Name    string `json:"name"`
+		Group   string `json:"group"`
+		Version string `json:"version"`
+	} `json:"component"`
+}
+
+// nexusProvider accepts Sonatype Nexus Repository component webhooks
+// (rm:repository:component) for docker and helm repositories. Nexus signs
+// the body with HMAC-SHA1 using the webhook's secret key.
+type nexusProvider struct{}
+
+func (nexusProvider) Name() string { return "nexus" }
+
+func (p nexusProvider) Authenticate(r *http.Request, body []byte) error {
+	got := r.Header.Get(nexusSignatureHeader)
+	if got == "" {
+		return errMissingSecret
+	}
+	sig, err := hex.DecodeString(got)
+	if err != nil || !secretsFor(r, p.Name()).signed(sha1.New, body, sig) {
+		return errInvalidSecret
+	}
+	return nil
+}
+
+func (nexusProvider) Parse(r *http.Request, body []byte) ([]Event, error) {
+	if id := r.Header.Get(nexusWebhookIDHeader); id != "" && id != "rm:repository:component" {
+		log.Printf("Ignoring Nexus %s webhook", id)
+		return nil, nil
+	}
+
+	var p nexusComponentEvent
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, err
+	}
+	if p.Component.Format != "docker" && p.Component.Format != "helm" {
+		log.Printf("Ignoring Nexus %s component event", p.Component.Format)
+		return nil, nil
+	}
+
+	var kind string
+	switch p.Action {
+	case "CREATED", "UPDATED":
+		kind = EventPush
+	case "DELETED":
+		kind = EventDelete
+	default:
+		log.Printf("Ignoring Nexus component action %s", p.Action)
+		return nil, nil
+	}
+
+	ts, err := time.Parse("2006-01-02T15:04:05.000-0700", p.Timestamp)
+	if err != nil {
+		ts = time.Now()
+	}
+	repo := p.Component.Name
+	if p.Component.Group != "" {
+		repo = p.Component.Group + "/" + repo
+	}
+	return []Event{{
+		ID:         r.Header.Get(nexusDeliveryHeader),
+		Provider:   "nexus",
+		Type:       kind,
+		Registry:   p.RepositoryName,
+		Repository: repo,
+		Tag:        p.Component.Version,
+		MediaType:  p.Component.Format,
+		Timestamp:  ts,
+	}}, nil
+}
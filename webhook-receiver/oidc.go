@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	permRead  = "read"
+	permWrite = "write"
+
+	clockSkew        = time.Minute
+	jwksMinRefresh   = time.Minute
+	discoveryPath    = "/.well-known/openid-configuration"
+	bearerPrefix     = "Bearer "
+	claimsCtxKey     = ctxKey("oidc-claims")
+	defaultRoleClaim = "roles"
+)
+
+type ctxKey string
+
+type OIDCConfig struct {
+	Issuer     string   `json:"issuer"`
+	Audience   string   `json:"audience"`
+	RolesClaim string   `json:"rolesClaim,omitempty"`
+	ReadRoles  []string `json:"readRoles,omitempty"`
+	WriteRoles []string `json:"writeRoles,omitempty"`
+}
+
+// OIDCVerifier validates bearer tokens issued by a single OIDC provider and
+// maps their role claims onto the read/write permissions of the admin APIs.
+type OIDCVerifier struct {
+	cfg    OIDCConfig
+	client *http.Client
+
+	mu          sync.RWMutex
+	keys        map[string]crypto.PublicKey
+	lastRefresh time.Time
+}
+
+type Claims map[string]any
+
+func NewOIDCVerifier(cfg OIDCConfig) *OIDCVerifier {
+	if cfg.RolesClaim == "" {
+		cfg.RolesClaim = defaultRoleClaim
+	}
+	return &OIDCVerifier{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+		keys:   make(map[string]crypto.PublicKey),
+	}
+}
+
+// Verify checks the token signature against the issuer's JWKS and validates
+// the iss, aud, exp and nbf claims.
+func (v *OIDCVerifier) Verify(ctx context.Context, token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("decoding header: %w", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("decoding signature: %w", err)
+	}
+
+	key, err := v.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	switch header.Alg {
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("key %q is not an RSA key", header.Kid)
+		}
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig); err != nil {
+			return nil, errors.New("invalid signature")
+		}
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(sig) != 64 {
+			return nil, fmt.Errorf("key %q is not a P-256 key", header.Kid)
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(pub, digest[:], r, s) {
+			return nil, errors.New("invalid signature")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported alg %q", header.Alg)
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("decoding claims: %w", err)
+	}
+	if iss, _ := claims["iss"].(string); iss != v.cfg.Issuer {
+		return nil, fmt.Errorf("unexpected issuer %q", iss)
+	}
+	if !claims.hasAudience(v.cfg.Audience) {
+		return nil, errors.New("token not issued for this audience")
+	}
+	now := time.Now()
+	if exp, ok := claims["exp"].(float64); !ok || now.After(time.Unix(int64(exp), 0).Add(clockSkew)) {
+		return nil, errors.New("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(clockSkew).Before(time.Unix(int64(nbf), 0)) {
+		return nil, errors.New("token not yet valid")
+	}
+	return claims, nil
+}
+
+// Permissions returns the set of permissions granted by the token's roles.
+// Write roles imply read access.
+func (v *OIDCVerifier) Permissions(claims Claims) map[string]bool {
+	perms := make(map[string]bool)
+	for _, role := range claims.strings(v.cfg.RolesClaim) {
+		for _, r := range v.cfg.WriteRoles {
+			if r == role {
+				perms[permWrite] = true
+				perms[permRead] = true
+			}
+		}
+		for _, r := range v.cfg.ReadRoles {
+			if r == role {
+				perms[permRead] = true
+			}
+		}
+	}
+	return perms
+}
+
+// Middleware requires a valid bearer token on every request. Safe methods
+// need the read permission, everything else needs write.
+func (v *OIDCVerifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, bearerPrefix) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="webhook-receiver"`)
+			http.Error(w, "Missing bearer token", http.StatusUnauthorized)
+			return
+		}
+
+		claims, err := v.Verify(r.Context(), strings.TrimPrefix(auth, bearerPrefix))
+		if err != nil {
+			log.Printf("Rejected admin token: %v", err)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="webhook-receiver", error="invalid_token"`)
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			return
+		}
+
+		need := permWrite
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			need = permRead
+		}
+		if !v.Permissions(claims)[need] {
+			log.Printf("Denied %s %s for %v: missing %s permission", r.Method, r.URL.Path, claims["sub"], need)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		log.Printf("Admin request %s %s by %v", r.Method, r.URL.Path, claims["sub"])
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), claimsCtxKey, claims)))
+	})
+}
+
+func (v *OIDCVerifier) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	v.mu.RLock()
+	key, ok := v.keys[kid]
+	stale := time.Since(v.lastRefresh) > jwksMinRefresh
+	v.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+	if !stale {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if err := v.refreshKeys(ctx); err != nil {
+		return nil, fmt.Errorf("refreshing JWKS: %w", err)
+	}
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if key, ok := v.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+// refreshKeys fetches the JWKS at most once per jwksMinRefresh. The fetch
+// runs without the lock, so verifications with known keys carry on while
+// it waits on the issuer; callers that find a refresh under way do not
+// wait for it.
+func (v *OIDCVerifier) refreshKeys(ctx context.Context) error {
+	v.mu.Lock()
+	if time.Since(v.lastRefresh) < jwksMinRefresh {
+		v.mu.Unlock()
+		return nil
+	}
+	v.lastRefresh = time.Now()
+	v.mu.Unlock()
+
+	var discovery struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := v.getJSON(ctx, strings.TrimSuffix(v.cfg.Issuer, "/")+discoveryPath, &discovery); err != nil {
+		return err
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Crv string `json:"crv"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := v.getJSON(ctx, discovery.JWKSURI, &jwks); err != nil {
+		return err
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range jwks.Keys {
+		switch {
+		case k.Kty == "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(k.N)
+			e, errE := base64.RawURLEncoding.DecodeString(k.E)
+			if errN != nil || errE != nil {
+				continue
+			}
+			keys[k.Kid] = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+		case k.Kty == "EC" && k.Crv == "P-256":
+			x, errX := base64.RawURLEncoding.DecodeString(k.X)
+			y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+			if errX != nil || errY != nil {
+				continue
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{
+				Curve: elliptic.P256(),
+				X:     new(big.Int).SetBytes(x),
+				Y:     new(big.Int).SetBytes(y),
+			}
+		}
+	}
+	v.mu.Lock()
+	v.keys = keys
+	v.mu.Unlock()
+	return nil
+}
+
+func (v *OIDCVerifier) getJSON(ctx context.Context, url string, out any) error {
+	ctx, done := watchdog.start(ctx, "oidc discovery", budgetJWKS)
+	defer done()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c Claims) hasAudience(aud string) bool {
+	for _, a := range c.strings("aud") {
+		if a == aud {
+			return true
+		}
+	}
+	return false
+}
+
+// strings returns the string values of a claim, following dotted paths into
+// nested objects (e.g. "realm_access.roles").
+func (c Claims) strings(path string) []string {
+	var cur any = map[string]any(c)
+	for _, p := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil
+		}
+		cur = m[p]
+	}
+	switch val := cur.(type) {
+	case string:
+		return []string{val}
+	case []any:
+		var out []string
+		for _, item := range val {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func decodeSegment(seg string, out any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
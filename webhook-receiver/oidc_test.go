@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testIssuer is an OIDC provider serving discovery and a JWKS with one RSA
+// and one P-256 key.
+type testIssuer struct {
+	*httptest.Server
+	rsa *rsa.PrivateKey
+	ec  *ecdsa.PrivateKey
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+	rk, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ek, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss := &testIssuer{rsa: rk, ec: ek}
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	mux := http.NewServeMux()
+	mux.HandleFunc(discoveryPath, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"jwks_uri": iss.URL + "/jwks"})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{
+			{"kid": "rsa", "kty": "RSA", "n": b64(rk.N.Bytes()), "e": b64(big.NewInt(int64(rk.E)).Bytes())},
+			{"kid": "ec", "kty": "EC", "crv": "P-256", "x": b64(ek.X.FillBytes(make([]byte, 32))), "y": b64(ek.Y.FillBytes(make([]byte, 32)))},
+		}})
+	})
+	iss.Server = httptest.NewServer(mux)
+	t.Cleanup(iss.Close)
+	return iss
+}
+
+// token signs claims with the issuer's key for alg, naming kid.
+func (iss *testIssuer) token(t *testing.T, alg, kid string, claims Claims) string {
+	t.Helper()
+	seg := func(v any) string {
+		b, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	signed := seg(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"}) + "." + seg(claims)
+	digest := sha256.Sum256([]byte(signed))
+	var sig []byte
+	switch alg {
+	case "RS256":
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, iss.rsa, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case "ES256":
+		r, s, err := ecdsa.Sign(rand.Reader, iss.ec, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	default:
+		sig = []byte("unsigned")
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func (iss *testIssuer) claims(aud string, exp time.Time) Claims {
+	return Claims{"iss": iss.URL, "aud": aud, "sub": "alice", "exp": float64(exp.Unix())}
+}
+
+func TestOIDCVerify(t *testing.T) {
+	iss := newTestIssuer(t)
+	v := NewOIDCVerifier(OIDCConfig{Issuer: iss.URL, Audience: "receiver"})
+	hour := time.Now().Add(time.Hour)
+	valid := iss.token(t, "RS256", "rsa", iss.claims("receiver", hour))
+	parts := strings.Split(valid, ".")
+	// rekey replaces the header of tok, keeping its claims and signature.
+	rekey := func(tok, alg, kid string) string {
+		h, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid})
+		return base64.RawURLEncoding.EncodeToString(h) + tok[strings.Index(tok, "."):]
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{name: "valid RS256", token: valid, ok: true},
+		{name: "valid ES256", token: iss.token(t, "ES256", "ec", iss.claims("receiver", hour)), ok: true},
+		{name: "audience list", token: iss.token(t, "RS256", "rsa", Claims{"iss": iss.URL, "aud": []any{"other", "receiver"}, "exp": float64(hour.Unix())}), ok: true},
+		{name: "tampered claims", token: parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"iss":"`+iss.URL+`","aud":"receiver","sub":"admin","exp":9999999999}`)) + "." + parts[2]},
+		{name: "tampered signature", token: parts[0] + "." + parts[1] + "." + strings.Repeat("A", len(parts[2]))},
+		{name: "expired", token: iss.token(t, "RS256", "rsa", iss.claims("receiver", time.Now().Add(-time.Hour)))},
+		{name: "not yet valid", token: iss.token(t, "RS256", "rsa", Claims{"iss": iss.URL, "aud": "receiver", "exp": float64(hour.Unix()), "nbf": float64(hour.Unix())})},
+		{name: "no expiry", token: iss.token(t, "RS256", "rsa", Claims{"iss": iss.URL, "aud": "receiver"})},
+		{name: "other audience", token: iss.token(t, "RS256", "rsa", iss.claims("someone-else", hour))},
+		{name: "other issuer", token: iss.token(t, "RS256", "rsa", Claims{"iss": "https://evil.example.com", "aud": "receiver", "exp": float64(hour.Unix())})},
+		{name: "alg none", token: iss.token(t, "none", "rsa", iss.claims("receiver", hour))},
+		{name: "alg HS256", token: iss.token(t, "HS256", "rsa", iss.claims("receiver", hour))},
+		{name: "RS256 signature relabelled ES256", token: rekey(valid, "ES256", "rsa")},
+		{name: "ES256 signature under the RSA key", token: rekey(iss.token(t, "ES256", "ec", iss.claims("receiver", hour)), "ES256", "rsa")},
+		{name: "unknown key", token: iss.token(t, "RS256", "rotated", iss.claims("receiver", hour))},
+		{name: "malformed", token: "not-a-jwt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := v.Verify(context.Background(), tt.token)
+			if (err == nil) != tt.ok {
+				t.Errorf("Verify() error = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
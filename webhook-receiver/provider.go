@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxPooledBuffer keeps the occasional huge payload from pinning memory in
+// the buffer pool.
+const maxPooledBuffer = 1 << 20
+
+var (
+	errMissingSecret = errors.New("missing secret")
+	errInvalidSecret = errors.New("invalid secret")
+)
+
+// Provider parses the webhook format of one registry or CI system.
+type Provider interface {
+	Name() string
+	// Authenticate checks the credentials carried by the delivery and
+	// returns errMissingSecret or errInvalidSecret on failure.
+	Authenticate(r *http.Request, body []byte) error
+	// Parse converts a delivery into zero or more events.
+	Parse(r *http.Request, body []byte) ([]Event, error)
+}
+
+// handshaker is implemented by providers whose senders verify the endpoint
+// before delivering events. Handshake reports whether it has fully handled
+// the request.
+type handshaker interface {
+	Handshake(w http.ResponseWriter, r *http.Request, body []byte) bool
+}
+
+// providerRoutes maps webhook paths to providers. Provider files register
+// themselves from init.
+var providerRoutes = map[string]Provider{}
+
+func registerProvider(path string, p Provider) {
+	if _, ok := providerRoutes[path]; ok {
+		panic("provider already registered for " + path)
+	}
+	providerRoutes[path] = p
+}
+
+// abuseProtection implements the OPTIONS validation handshake of the
+// CloudEvents HTTP webhook spec, which Event Grid also uses.
+func abuseProtection(w http.ResponseWriter, r *http.Request, authenticate func() error) bool {
+	if r.Method != http.MethodOptions {
+		return false
+	}
+	origin := r.Header.Get("WebHook-Request-Origin")
+	if origin == "" {
+		return false
+	}
+	if err := authenticate(); err != nil {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return true
+	}
+	w.Header().Set("WebHook-Allowed-Origin", origin)
+	w.Header().Set("WebHook-Allowed-Rate", "*")
+	w.WriteHeader(http.StatusOK)
+	return true
+}
+
+// checkSecret compares a plaintext secret sent to provider with r.
+func checkSecret(r *http.Request, provider, got string) error {
+	return secretsFor(r, provider).check(got)
+}
+
+// buffers are reused for request bodies and payload logging. Providers
+// must not retain the body slice past Parse.
+var buffers = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+func getBuffer() *bytes.Buffer {
+	b := buffers.Get().(*bytes.Buffer)
+	b.Reset()
+	return b
+}
+
+// putBuffer returns b to the pool unless it is oversized or the receiver
+// is short of memory, when it is left to the GC.
+func putBuffer(b *bytes.Buffer) {
+	if b.Cap() <= maxPooledBuffer && budgets.Level() < pressureSoft {
+		buffers.Put(b)
+	}
+}
+
+func providerHandler(p Provider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost && r.Method != http.MethodOptions {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		logger := requestLogger(r.Context()).With("provider", p.Name())
+		buf := getBuffer()
+		defer putBuffer(buf)
+		if _, err := buf.ReadFrom(io.LimitReader(r.Body, maxBodyBytes+1)); err != nil {
+			logger.Warn("Error reading body", "error", err)
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		defer r.Body.Close()
+		if int64(buf.Len()) > maxBodyBytes {
+			logger.Warn("Request body too large", "limit", maxBodyBytes)
+			webhookOutcomes.add(1, p.Name(), verdictTooLarge)
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		body := buf.Bytes()
+		received := time.Now()
+		webhookPayloadSize.observe(float64(len(body)), p.Name())
+
+		if h, ok := p.(handshaker); ok && h.Handshake(w, r, body) {
+			logger.Info("Completed endpoint handshake")
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		record := func(verdict string, status int, detail string, events int) {
+			level := slog.LevelInfo
+			if verdict == verdictRejected || verdict == verdictInvalid {
+				level = slog.LevelWarn
+			}
+			attrs := []any{"outcome", verdict, "status", status, "events", events}
+			if detail != "" {
+				attrs = append(attrs, "detail", detail)
+			}
+			logger.Log(r.Context(), level, "Webhook handled", attrs...)
+			webhookOutcomes.add(1, p.Name(), verdict)
+			if archive == nil {
+				return
+			}
+			_, err := archive.Record(Delivery{
+				ReceivedAt: received,
+				Provider:   p.Name(),
+				Path:       r.URL.Path,
+				RemoteAddr: r.RemoteAddr,
+				Header:     r.Header,
+				Body:       body,
+				Verdict:    verdict,
+				Status:     status,
+				Detail:     detail,
+				Events:     events,
+			})
+			if err != nil {
+				logger.Error("Archiving delivery", "error", err)
+			}
+		}
+
+		authenticate := p.Authenticate
+		if a, ok := providerAuth[p.Name()]; ok {
+			authenticate = a
+		}
+		if err := authenticate(r, body); err != nil {
+			if errors.Is(err, errMissingSecret) {
+				record(verdictRejected, http.StatusUnauthorized, err.Error(), 0)
+				http.Error(w, "Missing secret", http.StatusUnauthorized)
+			} else {
+				record(verdictRejected, http.StatusForbidden, err.Error(), 0)
+				http.Error(w, "Forbidden", http.StatusForbidden)
+			}
+			return
+		}
+
+		if relay != nil {
+			relay.Forward(p.Name(), r, body)
+		}
+
+		if logger.Enabled(r.Context(), slog.LevelDebug) {
+			logger.Debug("Webhook received", "remote_addr", r.RemoteAddr, "headers", redactHeaders(r.Header))
+			logPayload(logger, body)
+		}
+
+		events, err := p.Parse(r, body)
+		if err != nil {
+			record(verdictInvalid, http.StatusBadRequest, err.Error(), 0)
+			http.Error(w, "Unsupported payload", http.StatusBadRequest)
+			return
+		}
+		if mirror != nil {
+			mirror.Copy(p.Name(), r, body)
+		}
+		var duplicates int
+		var marked []string
+		if dedup != nil {
+			events, duplicates, marked = dedup.Filter(events)
+			if duplicates > 0 {
+				logger.Info("Ignoring duplicate events", "duplicates", duplicates)
+			}
+		}
+		admitted, rejected, retryAfter := tenants.Admit(r.Context(), events)
+		if retryAfter > 0 || (rejected > 0 && len(admitted) == 0) {
+			// The sender will redeliver; that must not count as a duplicate.
+			if dedup != nil {
+				dedup.Forget(marked)
+			}
+		}
+		if retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+			record(verdictThrottled, http.StatusTooManyRequests, "", len(events))
+			http.Error(w, "Quota exceeded", http.StatusTooManyRequests)
+			return
+		}
+		if rejected > 0 && len(admitted) == 0 {
+			record(verdictOverQuota, http.StatusForbidden, "", len(events))
+			http.Error(w, "Quota exceeded", http.StatusForbidden)
+			return
+		}
+		dispatch(withHeaders(r.Context(), r.Header), admitted)
+		// Delivery to the sinks happens on the queue's workers; 202 tells
+		// the sender its events were queued rather than delivered.
+		status := http.StatusOK
+		if len(admitted) > 0 {
+			status = http.StatusAccepted
+		}
+		if len(events) == 0 && duplicates > 0 {
+			record(verdictDuplicate, status, "", 0)
+		} else {
+			record(verdictAccepted, status, "", len(admitted))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		resp := map[string]any{
+			"message": "Webhook received successfully",
+			"events":  len(admitted),
+		}
+		if rejected > 0 {
+			resp["rejected"] = rejected
+		}
+		if duplicates > 0 {
+			resp["duplicates"] = duplicates
+		}
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// logPayload logs body at debug level, compacted onto one line if it is
+// JSON and verbatim otherwise. Compacting works on the raw bytes, so the
+// payload is only decoded once, by the provider.
+func logPayload(logger *slog.Logger, body []byte) {
+	compact := getBuffer()
+	defer putBuffer(compact)
+	if json.Compact(compact, body) == nil {
+		logger.Debug("Payload", "body", compact.String())
+		return
+	}
+	logger.Debug("Raw body", "body", string(body))
+}
@@ -0,0 +1,65 @@
+//go:build !no_quay
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const quayPath = "/webhook/quay"
+
+func init() {
+	registerProvider(quayPath, quayProvider{})
+}
+
+type QuayPush struct {
+	Repository  string   `json:"repository"`
+	DockerURL   string   `json:"docker_url"`
+	Homepage    string   `json:"homepage"`
+	UpdatedTags []string `json:"updated_tags"`
+}
+
+// quayProvider accepts Quay "Push to Repository" notifications. Quay does
+// not sign them, so like Docker Hub the shared secret is expected in the
+// secret header, set through the notification's custom headers.
+type quayProvider struct{}
+
+func (quayProvider) Name() string { return "quay" }
+
+func (p quayProvider) Authenticate(r *http.Request, _ []byte) error {
+	return checkSecret(r, p.Name(), r.Header.Get(secretHeader))
+}
+
+func (quayProvider) Parse(_ *http.Request, body []byte) ([]Event, error) {
+	var push QuayPush
+	if err := json.Unmarshal(body, &push); err != nil {
+		return nil, err
+	}
+	if len(push.UpdatedTags) == 0 {
+		log.Printf("Ignoring Quay notification for %s without updated tags", push.Repository)
+		return nil, nil
+	}
+
+	registry, repo, ok := strings.Cut(push.DockerURL, "/")
+	if !ok {
+		registry, repo = "quay.io", push.Repository
+	}
+	now := time.Now()
+	events := make([]Event, 0, len(push.UpdatedTags))
+	for _, tag := range push.UpdatedTags {
+		events = append(events, Event{
+			Provider:   "quay",
+			Type:       EventPush,
+			Registry:   registry,
+			Repository: repo,
+			Tag:        tag,
+			URL:        push.Homepage,
+			Timestamp:  now,
+		})
+	}
+	return events, nil
+}
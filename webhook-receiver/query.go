@@ -0,0 +1,497 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	maxQueryLength = 1024
+	maxQueryDepth  = 32
+)
+
+// Query is a compiled /events filter. The syntax is a small subset of CEL:
+//
+//	provider == "harbor" && event.tag.startsWith("v") && !delivered
+//
+// Fields are the Event's JSON names, optionally prefixed with "event.",
+// plus delivered (bool), seq (number), tenant and error (strings). Strings support
+// ==, !=, <, <=, >, >= and the methods startsWith, endsWith, contains and
+// matches (RE2); conditions combine with &&, || and !. Tags are tested with
+// "in" and annotations read as fields:
+//
+//	"hotfix" in tags && annotations.owner == "payments"
+type Query struct {
+	match func(*StoredEvent) bool
+}
+
+// Match reports whether e satisfies the query. The empty query matches
+// everything.
+func (q *Query) Match(e *StoredEvent) bool {
+	return q.match == nil || q.match(e)
+}
+
+type queryKind int
+
+const (
+	kindString queryKind = iota
+	kindBool
+	kindNumber
+	kindList
+)
+
+func (k queryKind) String() string {
+	return [...]string{"string", "bool", "number", "list"}[k]
+}
+
+// queryExpr is a typed expression; only the function for its kind is set.
+type queryExpr struct {
+	kind queryKind
+	str  func(*StoredEvent) string
+	cond func(*StoredEvent) bool
+	num  func(*StoredEvent) float64
+	list func(*StoredEvent) []string
+}
+
+func stringField(f func(*StoredEvent) string) queryExpr {
+	return queryExpr{kind: kindString, str: f}
+}
+
+var queryFields = map[string]queryExpr{
+	"id":         stringField(func(e *StoredEvent) string { return e.Event.ID }),
+	"provider":   stringField(func(e *StoredEvent) string { return e.Event.Provider }),
+	"type":       stringField(func(e *StoredEvent) string { return e.Event.Type }),
+	"registry":   stringField(func(e *StoredEvent) string { return e.Event.Registry }),
+	"repository": stringField(func(e *StoredEvent) string { return e.Event.Repository }),
+	"tag":        stringField(func(e *StoredEvent) string { return e.Event.Tag }),
+	"digest":     stringField(func(e *StoredEvent) string { return e.Event.Digest }),
+	"mediaType":  stringField(func(e *StoredEvent) string { return e.Event.MediaType }),
+	"ref":        stringField(func(e *StoredEvent) string { return e.Event.Ref }),
+	"revision":   stringField(func(e *StoredEvent) string { return e.Event.Revision }),
+	"action":     stringField(func(e *StoredEvent) string { return e.Event.Action }),
+	"url":        stringField(func(e *StoredEvent) string { return e.Event.URL }),
+	"severity":   stringField(func(e *StoredEvent) string { return e.Event.Severity }),
+	"error":      stringField(func(e *StoredEvent) string { return e.Error }),
+	"tenant":     stringField(func(e *StoredEvent) string { return e.Tenant }),
+	"delivered":  {kind: kindBool, cond: func(e *StoredEvent) bool { return e.Delivered }},
+	"seq":        {kind: kindNumber, num: func(e *StoredEvent) float64 { return float64(e.Seq) }},
+	"tags":       {kind: kindList, list: func(e *StoredEvent) []string { return e.Event.Tags }},
+}
+
+// ParseQuery compiles src. Queries are bounded in length and nesting so a
+// caller cannot make the server do unbounded work per event.
+func ParseQuery(src string) (*Query, error) {
+	if strings.TrimSpace(src) == "" {
+		return &Query{}, nil
+	}
+	if len(src) > maxQueryLength {
+		return nil, fmt.Errorf("longer than %d characters", maxQueryLength)
+	}
+	toks, err := lexQuery(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{toks: toks}
+	x, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at offset %d", t.text, t.pos)
+	}
+	if x.kind != kindBool {
+		return nil, fmt.Errorf("query must be a condition, not a %s", x.kind)
+	}
+	return &Query{match: x.cond}, nil
+}
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp
+)
+
+type queryToken struct {
+	kind tokKind
+	text string
+	pos  int
+}
+
+var queryOps = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")", "."}
+
+func lexQuery(src string) ([]queryToken, error) {
+	var toks []queryToken
+	for i := 0; i < len(src); {
+		c, size := utf8.DecodeRuneInString(src[i:])
+		switch {
+		case unicode.IsSpace(c):
+			i += size
+		case c == '"' || c == '\'':
+			s, n, err := lexString(src[i:])
+			if err != nil {
+				return nil, fmt.Errorf("%w at offset %d", err, i)
+			}
+			toks = append(toks, queryToken{tokString, s, i})
+			i += n
+		case isDigit(c):
+			j := i
+			for j < len(src) && (isDigit(rune(src[j])) || src[j] == '.') {
+				j++
+			}
+			toks = append(toks, queryToken{tokNumber, src[i:j], i})
+			i = j
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(src) {
+				r, n := utf8.DecodeRuneInString(src[j:])
+				if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+					break
+				}
+				j += n
+			}
+			toks = append(toks, queryToken{tokIdent, src[i:j], i})
+			i = j
+		default:
+			op := ""
+			for _, o := range queryOps {
+				if strings.HasPrefix(src[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at offset %d", c, i)
+			}
+			toks = append(toks, queryToken{tokOp, op, i})
+			i += len(op)
+		}
+	}
+	return append(toks, queryToken{kind: tokEOF, pos: len(src)}), nil
+}
+
+func isDigit(c rune) bool { return '0' <= c && c <= '9' }
+
+// lexString reads the string literal src starts with, in either quote, and
+// returns its value and length. Escapes are Go's, plus \' in both quotes.
+func lexString(src string) (string, int, error) {
+	quote := src[0]
+	var b strings.Builder
+	b.WriteByte('"')
+	for j := 1; j < len(src); j++ {
+		switch c := src[j]; {
+		case c == quote:
+			s, err := strconv.Unquote(b.String() + `"`)
+			if err != nil {
+				return "", 0, errors.New("invalid string")
+			}
+			return s, j + 1, nil
+		case c == '\\' && j+1 < len(src):
+			j++
+			if src[j] == '\'' {
+				b.WriteByte('\'')
+			} else {
+				b.WriteByte('\\')
+				b.WriteByte(src[j])
+			}
+		case c == '"':
+			b.WriteString(`\"`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, errors.New("unterminated string")
+}
+
+type queryParser struct {
+	toks  []queryToken
+	pos   int
+	depth int
+}
+
+func (p *queryParser) peek() queryToken { return p.toks[p.pos] }
+
+func (p *queryParser) next() queryToken {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *queryParser) accept(op string) bool {
+	if t := p.peek(); t.kind == tokOp && t.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *queryParser) expect(op string) error {
+	if !p.accept(op) {
+		t := p.peek()
+		return fmt.Errorf("expected %q at offset %d", op, t.pos)
+	}
+	return nil
+}
+
+func (p *queryParser) or() (queryExpr, error) {
+	x, err := p.and()
+	for err == nil && p.accept("||") {
+		var y queryExpr
+		if y, err = p.and(); err == nil {
+			x, err = logical("||", x, y)
+		}
+	}
+	return x, err
+}
+
+func (p *queryParser) and() (queryExpr, error) {
+	x, err := p.unary()
+	for err == nil && p.accept("&&") {
+		var y queryExpr
+		if y, err = p.unary(); err == nil {
+			x, err = logical("&&", x, y)
+		}
+	}
+	return x, err
+}
+
+func logical(op string, x, y queryExpr) (queryExpr, error) {
+	if x.kind != kindBool || y.kind != kindBool {
+		return queryExpr{}, fmt.Errorf("%s needs conditions on both sides", op)
+	}
+	a, b := x.cond, y.cond
+	if op == "&&" {
+		return queryExpr{kind: kindBool, cond: func(e *StoredEvent) bool { return a(e) && b(e) }}, nil
+	}
+	return queryExpr{kind: kindBool, cond: func(e *StoredEvent) bool { return a(e) || b(e) }}, nil
+}
+
+func (p *queryParser) unary() (queryExpr, error) {
+	if !p.accept("!") {
+		return p.comparison()
+	}
+	if p.depth++; p.depth > maxQueryDepth {
+		return queryExpr{}, errors.New("query is nested too deeply")
+	}
+	x, err := p.unary()
+	p.depth--
+	if err != nil {
+		return x, err
+	}
+	if x.kind != kindBool {
+		return queryExpr{}, errors.New("! needs a condition")
+	}
+	f := x.cond
+	return queryExpr{kind: kindBool, cond: func(e *StoredEvent) bool { return !f(e) }}, nil
+}
+
+func (p *queryParser) comparison() (queryExpr, error) {
+	x, err := p.primary()
+	if err != nil {
+		return x, err
+	}
+	t := p.peek()
+	if t.kind == tokIdent && t.text == "in" {
+		p.next()
+		return p.in(x, t)
+	}
+	if t.kind != tokOp {
+		return x, nil
+	}
+	switch t.text {
+	case "==", "!=", "<", "<=", ">", ">=":
+	default:
+		return x, nil
+	}
+	p.next()
+	y, err := p.primary()
+	if err != nil {
+		return y, err
+	}
+	if x.kind != y.kind || x.kind == kindList {
+		return queryExpr{}, fmt.Errorf("cannot compare %s with %s at offset %d", x.kind, y.kind, t.pos)
+	}
+
+	var cmp func(*StoredEvent) int
+	switch x.kind {
+	case kindString:
+		a, b := x.str, y.str
+		cmp = func(e *StoredEvent) int { return strings.Compare(a(e), b(e)) }
+	case kindNumber:
+		a, b := x.num, y.num
+		cmp = func(e *StoredEvent) int {
+			switch u, v := a(e), b(e); {
+			case u < v:
+				return -1
+			case u > v:
+				return 1
+			}
+			return 0
+		}
+	case kindBool:
+		if t.text != "==" && t.text != "!=" {
+			return queryExpr{}, fmt.Errorf("%s is not defined for bool at offset %d", t.text, t.pos)
+		}
+		a, b := x.cond, y.cond
+		cmp = func(e *StoredEvent) int {
+			if a(e) == b(e) {
+				return 0
+			}
+			return 1
+		}
+	}
+
+	var test func(int) bool
+	switch t.text {
+	case "==":
+		test = func(c int) bool { return c == 0 }
+	case "!=":
+		test = func(c int) bool { return c != 0 }
+	case "<":
+		test = func(c int) bool { return c < 0 }
+	case "<=":
+		test = func(c int) bool { return c <= 0 }
+	case ">":
+		test = func(c int) bool { return c > 0 }
+	case ">=":
+		test = func(c int) bool { return c >= 0 }
+	}
+	return queryExpr{kind: kindBool, cond: func(e *StoredEvent) bool { return test(cmp(e)) }}, nil
+}
+
+// in parses the right-hand side of `x in list`.
+func (p *queryParser) in(x queryExpr, t queryToken) (queryExpr, error) {
+	y, err := p.primary()
+	if err != nil {
+		return y, err
+	}
+	if x.kind != kindString || y.kind != kindList {
+		return queryExpr{}, fmt.Errorf("in needs a string and a list at offset %d, not %s and %s", t.pos, x.kind, y.kind)
+	}
+	v, list := x.str, y.list
+	return queryExpr{kind: kindBool, cond: func(e *StoredEvent) bool { return slices.Contains(list(e), v(e)) }}, nil
+}
+
+func (p *queryParser) primary() (queryExpr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokString:
+		s := t.text
+		return stringField(func(*StoredEvent) string { return s }), nil
+	case tokNumber:
+		n, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return queryExpr{}, fmt.Errorf("invalid number %q at offset %d", t.text, t.pos)
+		}
+		return queryExpr{kind: kindNumber, num: func(*StoredEvent) float64 { return n }}, nil
+	case tokIdent:
+		return p.field(t)
+	case tokOp:
+		if t.text == "(" {
+			if p.depth++; p.depth > maxQueryDepth {
+				return queryExpr{}, errors.New("query is nested too deeply")
+			}
+			x, err := p.or()
+			p.depth--
+			if err != nil {
+				return x, err
+			}
+			return x, p.expect(")")
+		}
+	case tokEOF:
+		return queryExpr{}, errors.New("unexpected end of query")
+	}
+	return queryExpr{}, fmt.Errorf("unexpected %q at offset %d", t.text, t.pos)
+}
+
+func (p *queryParser) field(t queryToken) (queryExpr, error) {
+	switch t.text {
+	case "true", "false":
+		v := t.text == "true"
+		return queryExpr{kind: kindBool, cond: func(*StoredEvent) bool { return v }}, nil
+	case "event":
+		if err := p.expect("."); err != nil {
+			return queryExpr{}, err
+		}
+		if t = p.next(); t.kind != tokIdent {
+			return queryExpr{}, fmt.Errorf("expected a field name at offset %d", t.pos)
+		}
+	case "annotations":
+		if err := p.expect("."); err != nil {
+			return queryExpr{}, err
+		}
+		key := p.next()
+		if key.kind != tokIdent {
+			return queryExpr{}, fmt.Errorf("expected an annotation key at offset %d", key.pos)
+		}
+		return p.methods(stringField(func(e *StoredEvent) string { return e.Event.Annotations[key.text] }))
+	}
+	x, ok := queryFields[t.text]
+	if !ok {
+		return queryExpr{}, fmt.Errorf("unknown field %q", t.text)
+	}
+	return p.methods(x)
+}
+
+// methods parses any method calls chained on x.
+func (p *queryParser) methods(x queryExpr) (queryExpr, error) {
+	for p.accept(".") {
+		if x.kind != kindString {
+			return queryExpr{}, fmt.Errorf("%s has no methods", x.kind)
+		}
+		var err error
+		if x, err = p.method(x); err != nil {
+			return x, err
+		}
+	}
+	return x, nil
+}
+
+// method parses a string method call; the argument must be a literal.
+func (p *queryParser) method(recv queryExpr) (queryExpr, error) {
+	name := p.next()
+	if name.kind != tokIdent {
+		return queryExpr{}, fmt.Errorf("expected a method name at offset %d", name.pos)
+	}
+	if err := p.expect("("); err != nil {
+		return queryExpr{}, err
+	}
+	arg := p.next()
+	if arg.kind != tokString {
+		return queryExpr{}, fmt.Errorf("%s takes a string literal at offset %d", name.text, arg.pos)
+	}
+	if err := p.expect(")"); err != nil {
+		return queryExpr{}, err
+	}
+
+	s, v := recv.str, arg.text
+	var f func(*StoredEvent) bool
+	switch name.text {
+	case "startsWith":
+		f = func(e *StoredEvent) bool { return strings.HasPrefix(s(e), v) }
+	case "endsWith":
+		f = func(e *StoredEvent) bool { return strings.HasSuffix(s(e), v) }
+	case "contains":
+		f = func(e *StoredEvent) bool { return strings.Contains(s(e), v) }
+	case "matches":
+		re, err := regexp.Compile(v)
+		if err != nil {
+			return queryExpr{}, fmt.Errorf("matches: %w", err)
+		}
+		f = func(e *StoredEvent) bool { return re.MatchString(s(e)) }
+	default:
+		return queryExpr{}, fmt.Errorf("unknown method %q", name.text)
+	}
+	return queryExpr{kind: kindBool, cond: f}, nil
+}
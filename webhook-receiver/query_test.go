@@ -0,0 +1,107 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLexQueryStrings(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{name: "double quoted", in: `"v1.2"`, want: "v1.2"},
+		{name: "single quoted", in: `'v1.2'`, want: "v1.2"},
+		{name: "escaped double quote", in: `"say \"hi\""`, want: `say "hi"`},
+		{name: "escaped single quote", in: `'it\'s'`, want: "it's"},
+		{name: "escaped single quote in double quotes", in: `"it\'s"`, want: "it's"},
+		{name: "double quote in single quotes", in: `'say "hi"'`, want: `say "hi"`},
+		{name: "escaped backslash", in: `'a\\'`, want: `a\`},
+		{name: "newline and unicode escapes", in: `"a\nbé"`, want: "a\nbé"},
+		{name: "non-ASCII", in: `'équipe'`, want: "équipe"},
+		{name: "unterminated", in: `"abc`, wantErr: true},
+		{name: "trailing backslash", in: `'abc\`, wantErr: true},
+		{name: "bad escape", in: `"\q"`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			toks, err := lexQuery(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("lexQuery() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if len(toks) != 2 || toks[0].kind != tokString || toks[0].text != tt.want {
+				t.Errorf("lexQuery() = %+v, want one string %q", toks, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	e := &StoredEvent{
+		Seq:    7,
+		Tenant: "payments",
+		Event: Event{
+			Provider:    "harbor",
+			Repository:  "team-a/app",
+			Tag:         "v1.2",
+			Tags:        []string{"hotfix"},
+			Annotations: map[string]string{"owner": "payments", "équipe": "paiements"},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		q       string
+		want    bool
+		wantErr bool
+	}{
+		{name: "empty", q: " ", want: true},
+		{name: "equality", q: `provider == "harbor"`, want: true},
+		{name: "event prefix and method", q: `event.tag.startsWith("v") && !delivered`, want: true},
+		{name: "and binds tighter than or", q: `provider == "harbor" || provider == "quay" && tag == "nope"`, want: true},
+		{name: "and before or on the left", q: `provider == "quay" && tag == "nope" || seq == 7`, want: true},
+		{name: "not binds tighter than and", q: `!delivered && provider == "quay"`, want: false},
+		{name: "parentheses", q: `!(delivered || provider == "quay")`, want: true},
+		{name: "number comparison", q: `seq >= 7 && seq < 7.5`, want: true},
+		{name: "string ordering", q: `tag > "v1.10"`, want: true},
+		{name: "in tags", q: `"hotfix" in tags && !("rollback" in tags)`, want: true},
+		{name: "annotation", q: `annotations.owner == tenant`, want: true},
+		{name: "non-ASCII annotation key", q: `annotations.équipe == 'paiements'`, want: true},
+		{name: "escaped quote", q: `tag != 'it\'s'`, want: true},
+		{name: "matches", q: `repository.matches("^team-[a-z]/")`, want: true},
+		{name: "bool equality", q: `delivered == false`, want: true},
+		{name: "not a condition", q: `provider`, wantErr: true},
+		{name: "type mismatch", q: `seq == "7"`, wantErr: true},
+		{name: "ordering on bool", q: `delivered < true`, wantErr: true},
+		{name: "unknown field", q: `registryy == "x"`, wantErr: true},
+		{name: "unknown method", q: `tag.hasPrefix("v")`, wantErr: true},
+		{name: "method on number", q: `seq.contains("7")`, wantErr: true},
+		{name: "bad regexp", q: `tag.matches("(")`, wantErr: true},
+		{name: "trailing tokens", q: `delivered delivered`, wantErr: true},
+		{name: "unbalanced", q: `(delivered`, wantErr: true},
+		{name: "unexpected character", q: `tag == "v" # comment`, wantErr: true},
+		{name: "nesting at the limit", q: strings.Repeat("(", maxQueryDepth) + "delivered" + strings.Repeat(")", maxQueryDepth), want: false},
+		{name: "nested too deeply", q: strings.Repeat("(", maxQueryDepth+1) + "delivered" + strings.Repeat(")", maxQueryDepth+1), wantErr: true},
+		{name: "negated too deeply", q: strings.Repeat("!", maxQueryDepth+1) + "delivered", wantErr: true},
+		{name: "too long", q: `tag == "` + strings.Repeat("v", maxQueryLength) + `"`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := ParseQuery(tt.q)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseQuery() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := q.Match(e); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
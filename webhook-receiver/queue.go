@@ -0,0 +1,376 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultQueueWorkers  = 4
+	defaultQueueCapacity = 1000
+)
+
+// Environments in priority order, highest first.
+var environmentRank = map[string]int{"prod": 0, "staging": 1, "dev": 2}
+
+const (
+	outcomeFailure = "failure"
+	outcomeSuccess = "success"
+)
+
+// PriorityRule assigns an environment and outcome to the events it matches.
+type PriorityRule struct {
+	EventMatch
+	Environment string `json:"environment"`
+	Outcome     string `json:"outcome,omitempty"`
+}
+
+// priority returns the class of the rule: prod before staging before dev,
+// and within an environment failures before successes. Lower is sooner.
+func (r PriorityRule) priority() int {
+	p := environmentRank[r.Environment] * 2
+	if r.Outcome != outcomeFailure {
+		p++
+	}
+	return p
+}
+
+type QueueConfig struct {
+	Workers  int `json:"workers,omitempty"`
+	Capacity int `json:"capacity,omitempty"`
+	// Priorities are evaluated in order; the first match wins. Events no
+	// rule matches are treated as dev successes.
+	Priorities []PriorityRule `json:"priorities,omitempty"`
+	// JournalPath, if set, is a SQLite file queued events are kept in until
+	// delivered, so they survive a restart.
+	JournalPath string `json:"journalPath,omitempty"`
+}
+
+func (c *QueueConfig) Validate() error {
+	var errs []error
+	if c.Workers < 0 || c.Capacity < 0 {
+		errs = append(errs, errors.New("queue: workers and capacity must not be negative"))
+	}
+	for i, r := range c.Priorities {
+		if _, ok := environmentRank[r.Environment]; !ok {
+			errs = append(errs, fmt.Errorf("queue.priorities[%d].environment: must be prod, staging or dev", i))
+		}
+		if r.Outcome != "" && r.Outcome != outcomeFailure && r.Outcome != outcomeSuccess {
+			errs = append(errs, fmt.Errorf("queue.priorities[%d].outcome: must be failure or success", i))
+		}
+		if err := r.EventMatch.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("queue.priorities[%d]: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+type queuedEvent struct {
+	ctx       context.Context
+	event     Event
+	priority  int
+	seq       uint64
+	journalID int64
+}
+
+type eventHeap []queuedEvent
+
+func (h eventHeap) Len() int { return len(h) }
+func (h eventHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority < h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+func (h eventHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *eventHeap) Push(x any)   { *h = append(*h, x.(queuedEvent)) }
+func (h *eventHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// EventQueue feeds events to the sinks from a bounded priority queue, so a
+// backlog of routine pushes cannot delay production failures. When full, a
+// new event evicts the lowest-priority queued one if it outranks it and is
+// dropped otherwise.
+type EventQueue struct {
+	workers  int
+	capacity int
+	rules    []PriorityRule
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	items   eventHeap
+	seq     uint64
+	active  int
+	journal *queueJournal
+}
+
+// queue is the processing queue started by main.
+var queue *EventQueue
+
+func NewEventQueue(cfg QueueConfig) *EventQueue {
+	q := &EventQueue{
+		workers:  cfg.Workers,
+		capacity: cfg.Capacity,
+		rules:    cfg.Priorities,
+	}
+	if q.workers == 0 {
+		q.workers = defaultQueueWorkers
+	}
+	if q.capacity == 0 {
+		q.capacity = defaultQueueCapacity
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *EventQueue) classify(e Event) int {
+	for _, r := range q.rules {
+		if r.matches(e) {
+			return r.priority()
+		}
+	}
+	return PriorityRule{Environment: "dev"}.priority()
+}
+
+// Push enqueues e and reports whether it was accepted. The event outlives
+// the request that carried it, so only ctx's values are kept.
+func (q *EventQueue) Push(ctx context.Context, e Event) bool {
+	item := queuedEvent{ctx: context.WithoutCancel(ctx), event: e, priority: q.classify(e)}
+	if item.priority >= environmentRank["dev"]*2 && budgets.shed("queue", pressureHard) {
+		log.Printf("Under resource pressure, dropping low-priority %s:%s", e.Repository, e.Tag)
+		return false
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) >= q.capacity {
+		lowest := 0
+		for i := range q.items {
+			if q.items.Less(lowest, i) {
+				lowest = i
+			}
+		}
+		if q.items[lowest].priority <= item.priority {
+			log.Printf("Queue full, dropping %s:%s", e.Repository, e.Tag)
+			return false
+		}
+		evicted := heap.Remove(&q.items, lowest).(queuedEvent)
+		q.unjournal(evicted)
+		log.Printf("Queue full, evicting %s:%s for higher-priority %s:%s",
+			evicted.event.Repository, evicted.event.Tag, e.Repository, e.Tag)
+	}
+	if q.journal != nil {
+		id, err := q.journal.add(item)
+		if err != nil {
+			log.Printf("Journalling %s:%s failed, queueing in memory only: %v", e.Repository, e.Tag, err)
+		}
+		item.journalID = id
+	}
+	q.seq++
+	item.seq = q.seq
+	heap.Push(&q.items, item)
+	q.cond.Broadcast()
+	return true
+}
+
+// OpenJournal persists the queue in the SQLite file at path and queues the
+// events left in it by the previous run. It returns how many there were.
+func (q *EventQueue) OpenJournal(path string) (int, error) {
+	j, err := openQueueJournal(path)
+	if err != nil {
+		return 0, err
+	}
+	items, err := j.load()
+	if err != nil {
+		j.Close()
+		return 0, fmt.Errorf("loading %s: %w", path, err)
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.journal = j
+	for _, item := range items {
+		q.seq++
+		item.seq = q.seq
+		heap.Push(&q.items, item)
+	}
+	return len(items), nil
+}
+
+// unjournal forgets a delivered or evicted event.
+func (q *EventQueue) unjournal(item queuedEvent) {
+	if q.journal == nil || item.journalID == 0 {
+		return
+	}
+	if err := q.journal.remove(item.journalID); err != nil {
+		log.Printf("Removing %s:%s from the queue journal: %v", item.event.Repository, item.event.Tag, err)
+	}
+}
+
+// CloseJournal closes the journal; events still in it are delivered on the
+// next start.
+func (q *EventQueue) CloseJournal() error {
+	if q.journal == nil {
+		return nil
+	}
+	return q.journal.Close()
+}
+
+// Start runs the workers until ctx is done.
+func (q *EventQueue) Start(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		q.mu.Lock()
+		q.cond.Broadcast()
+		q.mu.Unlock()
+	}()
+	for i := 0; i < q.workers; i++ {
+		go q.work(ctx)
+	}
+}
+
+func (q *EventQueue) work(ctx context.Context) {
+	for {
+		q.mu.Lock()
+		for len(q.items) == 0 && ctx.Err() == nil {
+			q.cond.Wait()
+		}
+		if ctx.Err() != nil {
+			q.mu.Unlock()
+			return
+		}
+		item := heap.Pop(&q.items).(queuedEvent)
+		q.active++
+		q.mu.Unlock()
+
+		func() {
+			defer recoverEvent("queue worker", item.event)
+			deliver(item.ctx, item.event)
+		}()
+		q.unjournal(item)
+
+		q.mu.Lock()
+		q.active--
+		q.cond.Broadcast()
+		q.mu.Unlock()
+	}
+}
+
+// Drain waits until every queued event has been delivered, or ctx is done.
+// Events pushed meanwhile are waited for too, so the caller should stop
+// accepting them first.
+func (q *EventQueue) Drain(ctx context.Context) error {
+	stop := context.AfterFunc(ctx, func() {
+		q.mu.Lock()
+		q.cond.Broadcast()
+		q.mu.Unlock()
+	})
+	defer stop()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.items) > 0 || q.active > 0 {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		q.cond.Wait()
+	}
+	return nil
+}
+
+// Len returns the number of queued events.
+func (q *EventQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// Snapshot returns the queued events in the order they would be delivered.
+func (q *EventQueue) Snapshot() []Event {
+	q.mu.Lock()
+	items := append(eventHeap(nil), q.items...)
+	q.mu.Unlock()
+	sort.Sort(items)
+	out := make([]Event, len(items))
+	for i, item := range items {
+		out[i] = item.event
+	}
+	return out
+}
+
+// selectTargets picks the sinks for e among all: the routing rules of rt
+// first, then the canary split among the sinks they chose. e receives the
+// tags and annotations of the matching rule.
+func selectTargets(ctx context.Context, e *Event, all []Sink, rt *Router, c *CanaryRouter) ([]Sink, string) {
+	targets := all
+	if rt != nil {
+		var rule *RouteRule
+		targets, rule = rt.route(*e, requestHeaders(ctx))
+		if rule != nil && (len(rule.Tags) > 0 || len(rule.Annotations) > 0) {
+			e.annotate(rule.Tags, rule.Annotations)
+			if seq, ok := storeSeq(ctx); ok {
+				store.Annotate(seq, rule.Tags, rule.Annotations)
+			}
+		}
+	}
+	if c == nil {
+		return targets, ""
+	}
+	return c.route(*e, targets)
+}
+
+// deliver sends e to every sink, or to the canary target if it is selected.
+// Each call gets its own budget derived from ctx.
+func deliver(ctx context.Context, e Event) {
+	logger := requestLogger(ctx).With("provider", e.Provider, "repo", e.Repository, "tag", e.Tag)
+	tenant := tenants.Resolve(ctx, e)
+	if !tenants.Forward(tenant) {
+		logger.Warn("Tenant over forward quota, not delivering", "tenant", tenant)
+		if seq, ok := storeSeq(ctx); ok {
+			store.Delivered(seq, errQuotaExceeded)
+		}
+		acknowledge(e, errQuotaExceeded)
+		return
+	}
+
+	all, rt := tenants.Outputs(tenant)
+	targets, role := selectTargets(ctx, &e, all, rt, canary)
+	if names, ok := retrySinks(ctx); ok {
+		targets = slices.DeleteFunc(slices.Clone(targets), func(s Sink) bool { return !slices.Contains(names, s.Name()) })
+	}
+
+	start := time.Now()
+	var failed error
+	var failedSinks []string
+	var attempts int
+	for _, s := range targets {
+		n, err := dlq.send(ctx, s, e)
+		if err != nil {
+			logger.Warn("Sink failed", "sink", s.Name(), "attempts", n, "error", err)
+			failed = err
+			failedSinks = append(failedSinks, s.Name())
+			attempts = max(attempts, n)
+		}
+	}
+	if role != "" {
+		canary.record(role, time.Since(start), failed)
+	}
+	if failed == nil {
+		logger.Debug("Delivered", "sinks", len(targets), "duration", time.Since(start))
+	} else {
+		dlq.Add(ctx, e, failedSinks, attempts, failed)
+	}
+	if seq, ok := storeSeq(ctx); ok {
+		store.Delivered(seq, failed)
+	}
+	acknowledge(e, failed)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestSelectTargetsRoutingAndCanary(t *testing.T) {
+	all := []Sink{testSink("kargo"), testSink("audit"), testSink("slack")}
+	rt := &Router{sinks: map[string]Sink{}, all: all}
+	for _, s := range all {
+		rt.sinks[s.Name()] = s
+	}
+	table := &RouteTable{
+		Rules: []RouteRule{
+			{EventMatch: EventMatch{Repository: "team-a/*"}, Sinks: []string{"kargo"}, Tags: []string{"team-a"}},
+			{EventMatch: EventMatch{Repository: "scratch/*"}, Sinks: []string{}},
+		},
+		Default: []string{"audit"},
+	}
+	if err := table.compile(); err != nil {
+		t.Fatal(err)
+	}
+	rt.table.Store(table)
+
+	canaryTarget := testSink("canary")
+	always := &CanaryRouter{percent: 100, target: canaryTarget, stats: map[string]*targetStats{roleStable: {}, roleCanary: {}}}
+	never := &CanaryRouter{percent: 0, target: canaryTarget, stats: map[string]*targetStats{roleStable: {}, roleCanary: {}}}
+	teamB := &CanaryRouter{match: EventMatch{Repository: "team-b/*"}, percent: 100, target: canaryTarget, stats: map[string]*targetStats{roleStable: {}, roleCanary: {}}}
+
+	tests := []struct {
+		name     string
+		repo     string
+		rt       *Router
+		canary   *CanaryRouter
+		want     []string
+		wantRole string
+		wantTags []string
+	}{
+		{name: "no routing, no canary", repo: "team-a/app", want: []string{"kargo", "audit", "slack"}},
+		{name: "routing only", repo: "team-a/app", rt: rt, want: []string{"kargo"}, wantTags: []string{"team-a"}},
+		{name: "routing default", repo: "team-b/app", rt: rt, want: []string{"audit"}},
+		{name: "canary keeps routed sinks on stable side", repo: "team-a/app", rt: rt, canary: never, want: []string{"kargo"}, wantRole: roleStable, wantTags: []string{"team-a"}},
+		{name: "canary replaces routed sinks", repo: "team-a/app", rt: rt, canary: always, want: []string{"canary"}, wantRole: roleCanary, wantTags: []string{"team-a"}},
+		{name: "canary outside its match", repo: "team-a/app", rt: rt, canary: teamB, want: []string{"kargo"}, wantTags: []string{"team-a"}},
+		{name: "canary does not revive dropped events", repo: "scratch/app", rt: rt, canary: always, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := Event{Provider: "dockerhub", Type: EventPush, Repository: tt.repo, Tag: "v1"}
+			got, role := selectTargets(context.Background(), &e, all, tt.rt, tt.canary)
+			if names := sinkNames(got); !slices.Equal(names, tt.want) {
+				t.Errorf("targets = %v, want %v", names, tt.want)
+			}
+			if role != tt.wantRole {
+				t.Errorf("role = %q, want %q", role, tt.wantRole)
+			}
+			if !slices.Equal(e.Tags, tt.wantTags) {
+				t.Errorf("tags = %v, want %v", e.Tags, tt.wantTags)
+			}
+		})
+	}
+}
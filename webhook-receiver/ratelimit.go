@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultMaxBodyBytes matches GitHub's cap on webhook payloads, the largest
+// of the supported senders.
+const defaultMaxBodyBytes = 25 << 20
+
+const rateLimitPruneInterval = time.Minute
+
+// verdictTooLarge is counted like the archive verdicts, but oversized
+// bodies are not archived.
+const verdictTooLarge = "too_large"
+
+// maxBodyBytes caps webhook request bodies; main sets it from the config.
+var maxBodyBytes int64 = defaultMaxBodyBytes
+
+// RateLimitConfig limits webhook requests per source IP with a token
+// bucket. Behind a load balancer, enable the PROXY protocol on the
+// listener or list the balancer in server.trustedProxies, so the source is
+// the sender rather than the balancer.
+type RateLimitConfig struct {
+	// RequestsPerSecond is the sustained rate allowed per source.
+	RequestsPerSecond float64 `json:"requestsPerSecond"`
+	// Burst is the bucket size, RequestsPerSecond rounded up by default.
+	Burst int `json:"burst,omitempty"`
+}
+
+func (c *RateLimitConfig) Validate() error {
+	var errs []error
+	if c.RequestsPerSecond <= 0 {
+		errs = append(errs, errors.New("server.rateLimit.requestsPerSecond: must be positive"))
+	}
+	if c.Burst < 0 {
+		errs = append(errs, errors.New("server.rateLimit.burst: must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type RateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastPrune time.Time
+}
+
+// rateLimiter is set by main when rate limiting is configured.
+var rateLimiter *RateLimiter
+
+func NewRateLimiter(cfg RateLimitConfig) *RateLimiter {
+	burst := float64(cfg.Burst)
+	if burst == 0 {
+		burst = math.Ceil(cfg.RequestsPerSecond)
+	}
+	return &RateLimiter{rate: cfg.RequestsPerSecond, burst: burst, buckets: make(map[string]*tokenBucket)}
+}
+
+// allow takes a token from source's bucket. If there is none it returns
+// how long until there will be.
+func (l *RateLimiter) allow(source string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.lastPrune) >= rateLimitPruneInterval {
+		l.prune(now)
+	}
+	b, ok := l.buckets[source]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[source] = b
+	}
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// prune drops buckets that have refilled, which are indistinguishable from
+// new ones. The caller holds l.mu.
+func (l *RateLimiter) prune(now time.Time) {
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	for source, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, source)
+		}
+	}
+	l.lastPrune = now
+}
+
+// Middleware answers 429 to sources over their rate. Requests whose source
+// cannot be worked out are counted against their peer's address. A nil
+// limiter lets everything through.
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		source, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			source = r.RemoteAddr
+		}
+		if addr, ok := sourceAddr(r); ok {
+			source = addr.String()
+		}
+		if ok, wait := l.allow(source, time.Now()); !ok {
+			requestLogger(r.Context()).Warn("Rate limit exceeded", "source", source)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
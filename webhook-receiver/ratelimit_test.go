@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	l := NewRateLimiter(RateLimitConfig{RequestsPerSecond: 2, Burst: 3})
+	t0 := time.Now()
+	at := func(d time.Duration) time.Time { return t0.Add(d) }
+
+	steps := []struct {
+		name     string
+		source   string
+		now      time.Time
+		want     bool
+		wantWait time.Duration
+	}{
+		{name: "burst 1", source: "a", now: at(0), want: true},
+		{name: "burst 2", source: "a", now: at(0), want: true},
+		{name: "burst 3", source: "a", now: at(0), want: true},
+		{name: "burst spent", source: "a", now: at(0), wantWait: 500 * time.Millisecond},
+		{name: "other source has its own bucket", source: "b", now: at(0), want: true},
+		{name: "partly refilled", source: "a", now: at(250 * time.Millisecond), wantWait: 250 * time.Millisecond},
+		{name: "refilled one token", source: "a", now: at(500 * time.Millisecond), want: true},
+		{name: "spent again", source: "a", now: at(500 * time.Millisecond), wantWait: 500 * time.Millisecond},
+		{name: "refill is capped at burst 1", source: "a", now: at(time.Hour), want: true},
+		{name: "refill is capped at burst 2", source: "a", now: at(time.Hour), want: true},
+		{name: "refill is capped at burst 3", source: "a", now: at(time.Hour), want: true},
+		{name: "refill is capped at burst", source: "a", now: at(time.Hour), wantWait: 500 * time.Millisecond},
+	}
+	for _, s := range steps {
+		ok, wait := l.allow(s.source, s.now)
+		if ok != s.want || (wait-s.wantWait).Abs() > time.Millisecond {
+			t.Errorf("%s: allow() = %v, %v, want %v, %v", s.name, ok, wait, s.want, s.wantWait)
+		}
+	}
+}
+
+func TestRateLimiterMiddleware(t *testing.T) {
+	defer func(p []netip.Prefix) { trustedProxies = p }(trustedProxies)
+	trustedProxies = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	tests := []struct {
+		name       string
+		remote     []string
+		forwarded  string
+		wantStatus int
+		wantRetry  string
+	}{
+		{name: "within burst", remote: []string{"203.0.113.7:1000"}, wantStatus: http.StatusOK},
+		{name: "over the rate", remote: []string{"203.0.113.7:1000", "203.0.113.7:1001"}, wantStatus: http.StatusTooManyRequests, wantRetry: "4"},
+		{name: "other sources", remote: []string{"203.0.113.7:1000", "203.0.113.8:1000"}, wantStatus: http.StatusOK},
+		{name: "forwarded sources behind a proxy", remote: []string{"10.0.0.1:1000", "10.0.0.1:1001"}, forwarded: "203.0.113.7", wantStatus: http.StatusTooManyRequests, wantRetry: "4"},
+		{name: "unparsable source keyed by peer host", remote: []string{"10.0.0.1:1000", "10.0.0.1:1001"}, forwarded: "garbage", wantStatus: http.StatusTooManyRequests, wantRetry: "4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewRateLimiter(RateLimitConfig{RequestsPerSecond: 0.25, Burst: 1})
+			h := l.Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+			var rec *httptest.ResponseRecorder
+			for _, remote := range tt.remote {
+				r := httptest.NewRequest("POST", "/webhook/github", nil)
+				r.RemoteAddr = remote
+				if tt.forwarded != "" {
+					r.Header.Set("X-Forwarded-For", tt.forwarded)
+				}
+				rec = httptest.NewRecorder()
+				h.ServeHTTP(rec, r)
+			}
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Retry-After"); got != tt.wantRetry {
+				t.Errorf("Retry-After = %q, want %q", got, tt.wantRetry)
+			}
+		})
+	}
+}
@@ -0,0 +1,297 @@
+//go:build !no_redis
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func init() { compiledSinks = append(compiledSinks, "redis") }
+
+const (
+	defaultRedisGroup     = "kargo-webhook-receiver"
+	defaultRedisClaimIdle = time.Minute
+	redisReadBlock        = 5 * time.Second
+)
+
+// RedisConnConfig is how the Redis sink and consumer connect.
+type RedisConnConfig struct {
+	// Address is host:port.
+	Address      string `json:"address"`
+	DB           int    `json:"db,omitempty"`
+	Username     string `json:"username,omitempty"`
+	PasswordFile string `json:"passwordFile,omitempty"`
+	TLS          bool   `json:"tls,omitempty"`
+	Stream       string `json:"stream"`
+}
+
+func (c *RedisConnConfig) Validate() error {
+	var errs []error
+	if c.Address == "" {
+		errs = append(errs, errors.New("address: required"))
+	}
+	if c.Stream == "" {
+		errs = append(errs, errors.New("stream: required"))
+	}
+	if c.PasswordFile != "" {
+		if _, err := readSecretFile(c.PasswordFile); err != nil {
+			errs = append(errs, fmt.Errorf("passwordFile: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *RedisConnConfig) client() (*redis.Client, error) {
+	opts := &redis.Options{Addr: c.Address, DB: c.DB, Username: c.Username}
+	if c.PasswordFile != "" {
+		password, err := readSecretFile(c.PasswordFile)
+		if err != nil {
+			return nil, err
+		}
+		opts.Password = password
+	}
+	if c.TLS {
+		opts.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	return redis.NewClient(opts), nil
+}
+
+// RedisSinkConfig appends events to a Redis Stream, which another
+// receiver's consumer (RedisConsumerConfig) or any other service can read.
+type RedisSinkConfig struct {
+	// Name identifies the sink in routing rules.
+	Name string `json:"name"`
+	RedisConnConfig
+	// MaxLen trims the stream to about this many entries; unbounded by
+	// default.
+	MaxLen int64 `json:"maxLen,omitempty"`
+}
+
+func (c *RedisSinkConfig) Validate() error {
+	var errs []error
+	if c.Name == "" {
+		errs = append(errs, errors.New("name: required"))
+	}
+	if err := c.RedisConnConfig.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.MaxLen < 0 {
+		errs = append(errs, errors.New("maxLen: must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+type RedisSink struct {
+	name   string
+	stream string
+	maxLen int64
+	client *redis.Client
+}
+
+func NewRedisSink(cfg RedisSinkConfig) (*RedisSink, error) {
+	client, err := cfg.client()
+	if err != nil {
+		return nil, err
+	}
+	return &RedisSink{name: cfg.Name, stream: cfg.Stream, maxLen: cfg.MaxLen, client: client}, nil
+}
+
+func (s *RedisSink) Name() string { return s.name }
+
+// Send adds e to the stream as JSON in the event field, with the provider
+// and type alongside for consumers that filter without decoding.
+func (s *RedisSink) Send(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return s.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: s.stream,
+		MaxLen: s.maxLen,
+		Approx: s.maxLen > 0,
+		Values: map[string]any{"event": body, "provider": e.Provider, "type": e.Type},
+	}).Err()
+}
+
+func (s *RedisSink) Close() error { return s.client.Close() }
+
+// RedisConsumerConfig makes this receiver deliver the events another
+// receiver published to a Redis Stream, in addition to its own webhooks.
+// Instances in the same consumer group share the stream, each entry going
+// to one of them.
+type RedisConsumerConfig struct {
+	RedisConnConfig
+	Group string `json:"group,omitempty"`
+	// Consumer names this instance in the group, the hostname by default.
+	// It must be stable across restarts for entries read but not yet
+	// acknowledged before a crash to be replayed.
+	Consumer string `json:"consumer,omitempty"`
+	// ClaimIdle is how long an entry may stay unacknowledged by another
+	// consumer before this one takes it over.
+	ClaimIdle string `json:"claimIdle,omitempty"`
+
+	claimIdle time.Duration
+}
+
+func (c *RedisConsumerConfig) Validate() error {
+	var errs []error
+	if err := c.RedisConnConfig.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	c.claimIdle = defaultRedisClaimIdle
+	if c.ClaimIdle != "" {
+		d, err := time.ParseDuration(c.ClaimIdle)
+		if err != nil || d <= 0 {
+			errs = append(errs, errors.New("claimIdle: must be a positive duration"))
+		}
+		c.claimIdle = d
+	}
+	return errors.Join(errs...)
+}
+
+// loops returns an error for each of sinks that publishes to the stream c
+// reads.
+func (c *RedisConsumerConfig) loops(sinks []RedisSinkConfig) []error {
+	var errs []error
+	for i, r := range sinks {
+		if r.Address == c.Address && r.DB == c.DB && r.Stream == c.Stream {
+			errs = append(errs, fmt.Errorf("sinks.redis[%d]: publishes to the stream redisConsumer reads, which would loop", i))
+		}
+	}
+	return errs
+}
+
+type RedisConsumer struct {
+	stream    string
+	group     string
+	consumer  string
+	claimIdle time.Duration
+	client    *redis.Client
+}
+
+func NewRedisConsumer(cfg RedisConsumerConfig) (*RedisConsumer, error) {
+	client, err := cfg.client()
+	if err != nil {
+		return nil, err
+	}
+	c := &RedisConsumer{stream: cfg.Stream, group: cfg.Group, consumer: cfg.Consumer, claimIdle: cfg.claimIdle, client: client}
+	if c.group == "" {
+		c.group = defaultRedisGroup
+	}
+	if c.consumer == "" {
+		if c.consumer, err = os.Hostname(); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Run delivers stream entries until ctx is done. It first replays the
+// entries this consumer read but did not acknowledge before it last
+// stopped, then takes over entries other consumers have left idle for
+// claimIdle, then reads new ones. An entry is acknowledged once it has
+// been delivered; sinks that failed have it in the dead-letter queue.
+func (c *RedisConsumer) Run(ctx context.Context) {
+	err := c.client.XGroupCreateMkStream(ctx, c.stream, c.group, "$").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		log.Printf("Creating consumer group %s on %s failed: %v", c.group, c.stream, err)
+	}
+	from := "0"
+	lastClaim := time.Time{}
+	for ctx.Err() == nil {
+		if time.Since(lastClaim) >= c.claimIdle {
+			c.claim(ctx)
+			lastClaim = time.Now()
+		}
+		streams, err := c.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    c.group,
+			Consumer: c.consumer,
+			Streams:  []string{c.stream, from},
+			Count:    16,
+			Block:    redisReadBlock,
+		}).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			if ctx.Err() == nil {
+				log.Printf("Reading %s failed: %v", c.stream, err)
+				time.Sleep(redisReadBlock)
+			}
+			continue
+		}
+		var n int
+		for _, s := range streams {
+			n += len(s.Messages)
+			for _, m := range s.Messages {
+				if ctx.Err() != nil {
+					// Left pending for another consumer to claim.
+					break
+				}
+				c.handle(ctx, m)
+			}
+		}
+		// Once the pending entries are worked off, read new ones.
+		if from == "0" && n == 0 {
+			from = ">"
+		}
+	}
+}
+
+// claim takes over and delivers entries idle in other consumers.
+func (c *RedisConsumer) claim(ctx context.Context) {
+	start := "0-0"
+	for {
+		msgs, next, err := c.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   c.stream,
+			Group:    c.group,
+			Consumer: c.consumer,
+			MinIdle:  c.claimIdle,
+			Start:    start,
+			Count:    16,
+		}).Result()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Claiming idle entries of %s failed: %v", c.stream, err)
+			}
+			return
+		}
+		for _, m := range msgs {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Took over stream entry %s from an idle consumer", m.ID)
+			c.handle(ctx, m)
+		}
+		if next == "0-0" {
+			return
+		}
+		start = next
+	}
+}
+
+func (c *RedisConsumer) handle(ctx context.Context, m redis.XMessage) {
+	raw, _ := m.Values["event"].(string)
+	var e Event
+	if err := json.Unmarshal([]byte(raw), &e); err != nil {
+		log.Printf("Dropping stream entry %s: %v", m.ID, err)
+	} else {
+		func() {
+			defer recoverEvent("stream consumer", e)
+			deliver(context.Background(), e)
+		}()
+	}
+	// Acknowledge even when stopping, since the entry was delivered.
+	if err := c.client.XAck(context.WithoutCancel(ctx), c.stream, c.group, m.ID).Err(); err != nil {
+		log.Printf("Acknowledging stream entry %s failed: %v", m.ID, err)
+	}
+}
+
+func (c *RedisConsumer) Close() error { return c.client.Close() }
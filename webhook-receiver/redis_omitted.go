@@ -0,0 +1,34 @@
+//go:build no_redis
+
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+type RedisSinkConfig struct {
+	omittedConfig
+}
+
+func (c *RedisSinkConfig) Validate() error { return fmt.Errorf("name: %w", errOmitted("redis")) }
+
+func NewRedisSink(RedisSinkConfig) (Sink, error) { return nil, errOmitted("redis") }
+
+type RedisConsumerConfig struct {
+	omittedConfig
+}
+
+func (c *RedisConsumerConfig) Validate() error { return fmt.Errorf("stream: %w", errOmitted("redis")) }
+
+func (c *RedisConsumerConfig) loops([]RedisSinkConfig) []error { return nil }
+
+type RedisConsumer struct {
+	stream, consumer, group string
+}
+
+func NewRedisConsumer(RedisConsumerConfig) (*RedisConsumer, error) { return nil, errOmitted("redis") }
+
+func (c *RedisConsumer) Run(context.Context) {}
+
+func (c *RedisConsumer) Close() error { return nil }
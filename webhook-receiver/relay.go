@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRelayAttempts = 5
+	relayBackoff         = time.Second
+	maxRelayBackoff      = time.Minute
+)
+
+// Headers that describe the hop rather than the delivery are not relayed.
+var hopHeaders = map[string]bool{
+	"Connection": true, "Content-Length": true, "Host": true, "Keep-Alive": true,
+	"Proxy-Authorization": true, "Te": true, "Trailer": true, "Transfer-Encoding": true, "Upgrade": true,
+}
+
+// RelayConfig relays authenticated webhooks unchanged to downstream URLs,
+// making the receiver a fan-out proxy in front of other consumers.
+type RelayConfig struct {
+	Targets []RelayTarget `json:"targets"`
+	// MaxAttempts per target, including the first. Network errors, 5xx
+	// and 429 responses are retried with exponential backoff; other
+	// failures go to the dead letter log straight away.
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+	// DeadLetterFile, if set, receives one JSON line per delivery that
+	// could not be relayed, with the body, so it can be resent by hand.
+	DeadLetterFile string `json:"deadLetterFile,omitempty"`
+}
+
+type RelayTarget struct {
+	Name    string `json:"name"`
+	URL     string `json:"url"`
+	Timeout string `json:"timeout,omitempty"`
+	// Providers limits the target to deliveries of these providers.
+	Providers []string `json:"providers,omitempty"`
+
+	timeout time.Duration
+}
+
+func (c *RelayConfig) Validate() error {
+	var errs []error
+	if len(c.Targets) == 0 {
+		errs = append(errs, errors.New("relay.targets: at least one target is required"))
+	}
+	if c.MaxAttempts < 0 {
+		errs = append(errs, errors.New("relay.maxAttempts: must not be negative"))
+	}
+	seen := make(map[string]bool)
+	for i := range c.Targets {
+		t := &c.Targets[i]
+		if t.Name == "" || seen[t.Name] {
+			errs = append(errs, fmt.Errorf("relay.targets[%d].name: must be set and unique", i))
+		}
+		seen[t.Name] = true
+		if err := validateURL(t.URL); err != nil {
+			errs = append(errs, fmt.Errorf("relay.targets[%d].url: %w", i, err))
+		}
+		t.timeout = defaultSinkTimeout
+		if t.Timeout != "" {
+			d, err := time.ParseDuration(t.Timeout)
+			if err != nil || d <= 0 {
+				errs = append(errs, fmt.Errorf("relay.targets[%d].timeout: must be a positive duration", i))
+			}
+			t.timeout = d
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// DeadLetter is a delivery a target did not accept.
+type DeadLetter struct {
+	Time     time.Time   `json:"time"`
+	Target   string      `json:"target"`
+	Provider string      `json:"provider"`
+	Path     string      `json:"path"`
+	Header   http.Header `json:"header"`
+	Body     []byte      `json:"body"`
+	Attempts int         `json:"attempts"`
+	Error    string      `json:"error"`
+}
+
+type Relay struct {
+	targets     []RelayTarget
+	maxAttempts int
+	deadLetters string
+
+	mu sync.Mutex // serialises dead letter writes
+}
+
+// relay is set by main when relay targets are configured.
+var relay *Relay
+
+func NewRelay(cfg RelayConfig) *Relay {
+	r := &Relay{targets: cfg.Targets, maxAttempts: cfg.MaxAttempts, deadLetters: cfg.DeadLetterFile}
+	if r.maxAttempts == 0 {
+		r.maxAttempts = defaultRelayAttempts
+	}
+	return r
+}
+
+// Forward relays a delivery of provider to every target in the background.
+// body is copied, so the caller may reuse it.
+func (r *Relay) Forward(provider string, req *http.Request, body []byte) {
+	header := make(http.Header)
+	for k, v := range req.Header {
+		if !hopHeaders[k] {
+			header[k] = v
+		}
+	}
+	body = bytes.Clone(body)
+	ctx := context.WithoutCancel(req.Context())
+	for _, t := range r.targets {
+		if len(t.Providers) > 0 && !slices.Contains(t.Providers, provider) {
+			continue
+		}
+		goBackground(func() { r.deliver(ctx, t, provider, req.URL.Path, header, body) })
+	}
+}
+
+func (r *Relay) deliver(ctx context.Context, t RelayTarget, provider, path string, header http.Header, body []byte) {
+	backoff := relayBackoff
+	var err error
+	attempt := 1
+	for ; ; attempt++ {
+		var retry bool
+		retry, err = r.post(ctx, t, header, body)
+		if err == nil {
+			return
+		}
+		if !retry || attempt == r.maxAttempts {
+			break
+		}
+		log.Printf("Relay to %s failed (attempt %d), retrying in %v: %v", t.Name, attempt, backoff, err)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, maxRelayBackoff)
+	}
+
+	log.Printf("Dead letter: %s delivery to %s for %s after %d attempts: %v", provider, t.Name, path, attempt, err)
+	r.deadLetter(DeadLetter{
+		Time:     time.Now().UTC(),
+		Target:   t.Name,
+		Provider: provider,
+		Path:     path,
+		Header:   header,
+		Body:     body,
+		Attempts: attempt,
+		Error:    err.Error(),
+	})
+}
+
+// post makes one attempt and reports whether a failure is worth retrying.
+func (r *Relay) post(ctx context.Context, t RelayTarget, header http.Header, body []byte) (bool, error) {
+	ctx, done := watchdog.start(ctx, "relay "+t.Name, t.timeout)
+	defer done()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header = header.Clone()
+
+	resp, err := outboundClient.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return retry, fmt.Errorf("%s returned %s", t.Name, resp.Status)
+	}
+	return false, nil
+}
+
+func (r *Relay) deadLetter(d DeadLetter) {
+	if r.deadLetters == "" {
+		return
+	}
+	line, _ := json.Marshal(d)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f, err := os.OpenFile(r.deadLetters, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		log.Printf("Writing dead letter: %v", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		log.Printf("Writing dead letter: %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// replayHandler serves POST /admin/replay/{id}: the archived delivery is
+// parsed again by its provider and the events dispatched as if it had just
+// arrived, e.g. after a sink was down. Authentication is not repeated, so
+// deliveries that failed it cannot be replayed; tenant quotas are not
+// charged again either.
+func replayHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
+	d, err := archive.Get(r.Context(), id)
+	if err != nil {
+		log.Printf("Reading delivery %d: %v", id, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if d == nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if d.Verdict == verdictRejected {
+		http.Error(w, "Delivery failed authentication and cannot be replayed", http.StatusConflict)
+		return
+	}
+	p, ok := providerRoutes[d.Path]
+	if !ok {
+		http.Error(w, "No provider is served at "+d.Path+" any more", http.StatusConflict)
+		return
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, d.Path, bytes.NewReader(d.Body))
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	req.Header = d.Header
+	req.RemoteAddr = d.RemoteAddr
+	events, err := p.Parse(req, d.Body)
+	if err != nil {
+		http.Error(w, "Unsupported payload: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	log.Printf("Replaying delivery %d (%s, %d events) for %s", id, p.Name(), len(events), r.RemoteAddr)
+	dispatch(withHeaders(r.Context(), d.Header), events)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"replayed": id,
+		"events":   len(events),
+	})
+}
@@ -0,0 +1,20 @@
+package main
+
+import "syscall"
+
+const reusePortSupported = true
+
+// soReusePort is SO_REUSEPORT, which the syscall package does not define
+// for Linux.
+const soReusePort = 0xf
+
+func setReusePort(network, address string, c syscall.RawConn) error {
+	var serr error
+	err := c.Control(func(fd uintptr) {
+		serr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, soReusePort, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return serr
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	webhookRouteAPI = "/apis/webhooks.kargo.akuity.io/v1alpha1"
+	// routeWatchTimeout is how long the API server keeps a watch open
+	// before the receiver lists again.
+	routeWatchTimeout = 5 * time.Minute
+	routeRetryDelay   = 10 * time.Second
+)
+
+// RouteCRDConfig reads routing rules from WebhookRoute objects instead of
+// a file. Teams manage routes for their own namespace under RBAC; the
+// receiver needs list and watch on webhookroutes in each namespace read.
+type RouteCRDConfig struct {
+	// Namespaces to read WebhookRoutes from; all namespaces by default.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Default is the sinks for events no route matches, as in a rules file.
+	Default []string `json:"default,omitempty"`
+}
+
+// WebhookRoute is a namespaced set of routing rules. Rules of all routes
+// are evaluated ordered by namespace and name, then in order within each
+// route.
+type WebhookRoute struct {
+	Metadata struct {
+		Namespace       string `json:"namespace"`
+		Name            string `json:"name"`
+		ResourceVersion string `json:"resourceVersion,omitempty"`
+	} `json:"metadata"`
+	Spec json.RawMessage `json:"spec"`
+}
+
+type WebhookRouteSpec struct {
+	Rules []RouteRule `json:"rules"`
+}
+
+func (wr *WebhookRoute) key() string { return wr.Metadata.Namespace + "/" + wr.Metadata.Name }
+
+// table compiles the route's rules, naming each after the route so logs
+// and annotations say where a match came from. Unknown fields are rejected
+// like in a rules file.
+func (wr *WebhookRoute) table(sinks map[string]Sink) (*RouteTable, error) {
+	var spec WebhookRouteSpec
+	dec := json.NewDecoder(bytes.NewReader(wr.Spec))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&spec); err != nil {
+		return nil, fmt.Errorf("spec: %w", err)
+	}
+	if len(spec.Rules) == 0 {
+		return nil, errors.New("spec.rules: required")
+	}
+	t := &RouteTable{Rules: spec.Rules}
+	for i := range t.Rules {
+		r := &t.Rules[i]
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("%s[%d]", wr.key(), i)
+		} else {
+			r.Name = wr.key() + "/" + r.Name
+		}
+	}
+	err := t.compile()
+	if err == nil {
+		err = t.check(sinks)
+	}
+	return t, err
+}
+
+// routeWatcher keeps the router's table in step with the WebhookRoutes in
+// its namespaces, by listing them and then following changes, as an
+// informer would.
+type routeWatcher struct {
+	api    *kubeAPI
+	cfg    RouteCRDConfig
+	router *Router
+
+	mu     sync.Mutex
+	routes map[string]*RouteTable
+}
+
+func newRouteWatcher(cfg RouteCRDConfig, router *Router) (*routeWatcher, error) {
+	api, err := inClusterAPI()
+	if err != nil {
+		return nil, err
+	}
+	return &routeWatcher{api: api, cfg: cfg, router: router, routes: make(map[string]*RouteTable)}, nil
+}
+
+// Run follows each namespace until ctx is done.
+func (w *routeWatcher) Run(ctx context.Context) {
+	scopes := []string{webhookRouteAPI + "/webhookroutes"}
+	if len(w.cfg.Namespaces) > 0 {
+		scopes = scopes[:0]
+		for _, ns := range w.cfg.Namespaces {
+			scopes = append(scopes, webhookRouteAPI+"/namespaces/"+ns+"/webhookroutes")
+		}
+	}
+	var wg sync.WaitGroup
+	for _, scope := range scopes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.follow(ctx, scope)
+		}()
+	}
+	wg.Wait()
+}
+
+// follow lists the routes in scope, then watches from the list's resource
+// version until the watch ends, and starts over.
+func (w *routeWatcher) follow(ctx context.Context, scope string) {
+	for ctx.Err() == nil {
+		version, err := w.list(ctx, scope)
+		if err == nil {
+			err = w.watch(ctx, scope, version)
+		}
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Following WebhookRoutes at %s failed, retrying: %v", scope, err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(routeRetryDelay):
+			}
+		}
+	}
+}
+
+func (w *routeWatcher) list(ctx context.Context, scope string) (string, error) {
+	var list struct {
+		Metadata struct {
+			ResourceVersion string `json:"resourceVersion"`
+		} `json:"metadata"`
+		Items []WebhookRoute `json:"items"`
+	}
+	if err := w.api.get(ctx, scope, &list); err != nil {
+		return "", err
+	}
+	w.mu.Lock()
+	for key := range w.routes {
+		if w.inScope(key, scope) {
+			delete(w.routes, key)
+		}
+	}
+	for i := range list.Items {
+		w.set(&list.Items[i])
+	}
+	w.mu.Unlock()
+	w.apply()
+	return list.Metadata.ResourceVersion, nil
+}
+
+// inScope reports whether the route key was listed from scope.
+func (w *routeWatcher) inScope(key, scope string) bool {
+	if len(w.cfg.Namespaces) == 0 {
+		return true
+	}
+	ns, _, _ := strings.Cut(key, "/")
+	return scope == webhookRouteAPI+"/namespaces/"+ns+"/webhookroutes"
+}
+
+func (w *routeWatcher) watch(ctx context.Context, scope, version string) error {
+	q := url.Values{
+		"watch":               {"1"},
+		"resourceVersion":     {version},
+		"allowWatchBookmarks": {"true"},
+		"timeoutSeconds":      {fmt.Sprint(int(routeWatchTimeout.Seconds()))},
+	}
+	ctx, cancel := context.WithTimeout(ctx, routeWatchTimeout+time.Minute)
+	defer cancel()
+	resp, err := w.api.do(ctx, scope+"?"+q.Encode())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var ev struct {
+			Type   string          `json:"type"`
+			Object json.RawMessage `json:"object"`
+		}
+		if err := dec.Decode(&ev); err != nil {
+			// The API server ends the watch after timeoutSeconds.
+			return nil
+		}
+		var wr WebhookRoute
+		if err := json.Unmarshal(ev.Object, &wr); err != nil {
+			return err
+		}
+		switch ev.Type {
+		case "ADDED", "MODIFIED":
+			w.mu.Lock()
+			w.set(&wr)
+			w.mu.Unlock()
+		case "DELETED":
+			w.mu.Lock()
+			delete(w.routes, wr.key())
+			w.mu.Unlock()
+			log.Printf("WebhookRoute %s deleted", wr.key())
+		case "BOOKMARK":
+			continue
+		case "ERROR":
+			// Usually 410 Gone: the version is too old to watch from, so
+			// list again.
+			return fmt.Errorf("watch error: %s", ev.Object)
+		}
+		w.apply()
+	}
+}
+
+// set compiles wr into the routes. An invalid route, which the admission
+// webhook should have refused, is left out. The caller holds w.mu.
+func (w *routeWatcher) set(wr *WebhookRoute) {
+	t, err := wr.table(w.router.sinks)
+	if err != nil {
+		delete(w.routes, wr.key())
+		log.Printf("Ignoring WebhookRoute %s: %v", wr.key(), err)
+		return
+	}
+	w.routes[wr.key()] = t
+}
+
+// apply makes the routes the router's table.
+func (w *routeWatcher) apply() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	keys := make([]string, 0, len(w.routes))
+	for k := range w.routes {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	t := &RouteTable{Default: w.cfg.Default}
+	for _, k := range keys {
+		t.Rules = append(t.Rules, w.routes[k].Rules...)
+	}
+	w.router.table.Store(t)
+	log.Printf("Routing by %d rules from %d WebhookRoutes", len(t.Rules), len(keys))
+}
+
+// admissionReview is the part of an admission.k8s.io/v1 AdmissionReview
+// the webhook reads and writes.
+type admissionReview struct {
+	APIVersion string             `json:"apiVersion"`
+	Kind       string             `json:"kind"`
+	Request    *admissionRequest  `json:"request,omitempty"`
+	Response   *admissionResponse `json:"response,omitempty"`
+}
+
+type admissionRequest struct {
+	UID    string       `json:"uid"`
+	Object WebhookRoute `json:"object"`
+}
+
+type admissionResponse struct {
+	UID     string           `json:"uid"`
+	Allowed bool             `json:"allowed"`
+	Status  *admissionStatus `json:"status,omitempty"`
+}
+
+type admissionStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// admissionHandler validates WebhookRoutes for the API server, refusing
+// rules that would not compile or name sinks this receiver lacks.
+func (r *Router) admissionHandler(w http.ResponseWriter, req *http.Request) {
+	var review admissionReview
+	if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, 1<<20)).Decode(&review); err != nil || review.Request == nil {
+		http.Error(w, "Invalid AdmissionReview", http.StatusBadRequest)
+		return
+	}
+	resp := &admissionResponse{UID: review.Request.UID, Allowed: true}
+	// Deletes carry no object and are always allowed.
+	if obj := review.Request.Object; obj.Spec != nil {
+		if _, err := obj.table(r.sinks); err != nil {
+			resp.Allowed = false
+			resp.Status = &admissionStatus{Code: http.StatusUnprocessableEntity, Message: err.Error()}
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(admissionReview{APIVersion: review.APIVersion, Kind: review.Kind, Response: resp})
+}
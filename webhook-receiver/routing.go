@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync/atomic"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+const defaultRoutesReload = 10 * time.Second
+
+type RoutingConfig struct {
+	// RulesFile holds a RouteTable. It is re-read when it changes, so
+	// rules can be edited without a restart; an invalid edit is logged
+	// and the previous rules stay in effect.
+	RulesFile      string `json:"rulesFile,omitempty"`
+	ReloadInterval string `json:"reloadInterval,omitempty"`
+	// Kubernetes takes the rules from WebhookRoute objects instead of
+	// RulesFile, when running in-cluster.
+	Kubernetes *RouteCRDConfig `json:"kubernetes,omitempty"`
+
+	interval time.Duration
+}
+
+func (c *RoutingConfig) Validate() error {
+	var errs []error
+	switch {
+	case c.Kubernetes != nil:
+		if c.RulesFile != "" {
+			errs = append(errs, errors.New("routing: rulesFile and kubernetes are mutually exclusive"))
+		}
+		t := RouteTable{Default: c.Kubernetes.Default}
+		if err := t.compile(); err != nil {
+			errs = append(errs, fmt.Errorf("routing.kubernetes: %w", err))
+		}
+	default:
+		if _, err := LoadRouteTable(c.RulesFile); err != nil {
+			errs = append(errs, fmt.Errorf("routing.rulesFile: %w", err))
+		}
+	}
+	c.interval = defaultRoutesReload
+	if c.ReloadInterval != "" {
+		d, err := time.ParseDuration(c.ReloadInterval)
+		if err != nil || d <= 0 {
+			errs = append(errs, errors.New("routing.reloadInterval: must be a positive duration"))
+		}
+		c.interval = d
+	}
+	return errors.Join(errs...)
+}
+
+// RouteRule sends the events it matches to the named sinks.
+type RouteRule struct {
+	Name string `json:"name,omitempty"`
+	EventMatch
+	// TagRegex must match the whole tag.
+	TagRegex string `json:"tagRegex,omitempty"`
+	// Headers must all be present on the delivery with these values.
+	Headers map[string]string `json:"headers,omitempty"`
+	Sinks   []string          `json:"sinks"`
+	// Tags and Annotations are added to the events the rule matches, so
+	// they can be filtered on in /events and are forwarded to the sinks.
+	Tags        []string          `json:"tags,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	tagRe *regexp.Regexp
+}
+
+// RouteTable is the content of the rules file. Rules are evaluated in
+// order and the first match wins. Events no rule matches go to Default, or
+// to every sink when Default is omitted; an empty list drops them.
+type RouteTable struct {
+	Rules   []RouteRule `json:"rules"`
+	Default []string    `json:"default,omitempty"`
+}
+
+// LoadRouteTable reads and compiles a rules file; .yaml and .yml files are
+// read as YAML.
+func LoadRouteTable(path string) (*RouteTable, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if ext := filepath.Ext(path); ext == ".yaml" || ext == ".yml" {
+		if raw, err = yaml.YAMLToJSON(raw); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+	}
+	var t RouteTable
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&t); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return &t, t.compile()
+}
+
+func (t *RouteTable) compile() error {
+	var errs []error
+	for i := range t.Rules {
+		r := &t.Rules[i]
+		if err := r.EventMatch.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("rules[%d]: %w", i, err))
+		}
+		if r.TagRegex != "" {
+			re, err := regexp.Compile("^(?:" + r.TagRegex + ")$")
+			if err != nil {
+				errs = append(errs, fmt.Errorf("rules[%d].tagRegex: %w", i, err))
+			}
+			r.tagRe = re
+		}
+		if r.Sinks == nil {
+			errs = append(errs, fmt.Errorf("rules[%d].sinks: required", i))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// check reports sink names in t that are not in available.
+func (t *RouteTable) check(available map[string]Sink) error {
+	var errs []error
+	for i, r := range t.Rules {
+		for _, name := range r.Sinks {
+			if available[name] == nil {
+				errs = append(errs, fmt.Errorf("rules[%d].sinks: unknown sink %q", i, name))
+			}
+		}
+	}
+	for _, name := range t.Default {
+		if available[name] == nil {
+			errs = append(errs, fmt.Errorf("default: unknown sink %q", name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *RouteRule) matches(e Event, h http.Header) bool {
+	if !r.EventMatch.matches(e) {
+		return false
+	}
+	if r.tagRe != nil && !r.tagRe.MatchString(e.Tag) {
+		return false
+	}
+	for k, v := range r.Headers {
+		if h.Get(k) != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Router picks the sinks for each event from the current route table.
+type Router struct {
+	path     string
+	interval time.Duration
+	sinks    map[string]Sink
+	all      []Sink
+
+	table   atomic.Pointer[RouteTable]
+	modTime time.Time
+	// crd is set when the rules come from WebhookRoutes.
+	crd *routeWatcher
+}
+
+// router is set by main when routing is configured.
+var router *Router
+
+func NewRouter(cfg RoutingConfig, all []Sink) (*Router, error) {
+	r := &Router{path: cfg.RulesFile, interval: cfg.interval, sinks: make(map[string]Sink), all: all}
+	r.sinks[logSinkName] = logSink{}
+	for _, s := range all {
+		r.sinks[s.Name()] = s
+	}
+	if c := cfg.Kubernetes; c != nil {
+		t := &RouteTable{Default: c.Default}
+		if err := t.check(r.sinks); err != nil {
+			return nil, err
+		}
+		r.table.Store(t)
+		var err error
+		if r.crd, err = newRouteWatcher(*c, r); err != nil {
+			return nil, err
+		}
+		return r, nil
+	}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Router) reload() error {
+	fi, err := os.Stat(r.path)
+	if err != nil {
+		return err
+	}
+	t, err := LoadRouteTable(r.path)
+	if err == nil {
+		err = t.check(r.sinks)
+	}
+	if err != nil {
+		return err
+	}
+	r.table.Store(t)
+	r.modTime = fi.ModTime()
+	return nil
+}
+
+// Watch re-reads the rules file whenever its modification time changes,
+// or follows the WebhookRoutes, until ctx is done.
+func (r *Router) Watch(ctx context.Context) {
+	if r.crd != nil {
+		r.crd.Run(ctx)
+		return
+	}
+	tick := time.NewTicker(r.interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+		fi, err := os.Stat(r.path)
+		if err != nil || fi.ModTime().Equal(r.modTime) {
+			continue
+		}
+		if err := r.reload(); err != nil {
+			log.Printf("Keeping previous routing rules, %s is invalid: %v", r.path, err)
+			// Don't log again until the file changes.
+			r.modTime = fi.ModTime()
+			continue
+		}
+		log.Printf("Reloaded %d routing rules from %s", len(r.table.Load().Rules), r.path)
+	}
+}
+
+// route returns the sinks for e, delivered with request headers h, and the
+// rule that selected them (nil for the default).
+func (r *Router) route(e Event, h http.Header) ([]Sink, *RouteRule) {
+	t := r.table.Load()
+	names := t.Default
+	var rule *RouteRule
+	for i := range t.Rules {
+		if t.Rules[i].matches(e, h) {
+			rule = &t.Rules[i]
+			names = rule.Sinks
+			break
+		}
+	}
+	if rule == nil && names == nil {
+		return r.all, nil
+	}
+	out := make([]Sink, 0, len(names))
+	for _, name := range names {
+		out = append(out, r.sinks[name])
+	}
+	return out, rule
+}
+
+type headersKey struct{}
+
+// withHeaders keeps the delivery's request headers for routing.
+func withHeaders(ctx context.Context, h http.Header) context.Context {
+	return context.WithValue(ctx, headersKey{}, h)
+}
+
+func requestHeaders(ctx context.Context) http.Header {
+	h, _ := ctx.Value(headersKey{}).(http.Header)
+	return h
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testSink is a Sink that only has a name.
+type testSink string
+
+func (s testSink) Name() string                      { return string(s) }
+func (s testSink) Send(context.Context, Event) error { return nil }
+
+func sinkNames(sinks []Sink) []string {
+	var out []string
+	for _, s := range sinks {
+		out = append(out, s.Name())
+	}
+	return out
+}
+
+func ruleName(r *RouteRule) string {
+	if r == nil {
+		return ""
+	}
+	return r.Name
+}
+
+func writeRules(t *testing.T, name, content string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(p, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestRouterRoute(t *testing.T) {
+	all := []Sink{testSink("kargo"), testSink("audit"), testSink("slack")}
+	rules := `
+rules:
+- name: releases
+  repository: team-a/*
+  tagRegex: v[0-9]+\.[0-9]+
+  sinks: [kargo, slack]
+- name: canary header
+  headers: {X-Canary: "1"}
+  sinks: [log]
+- name: scratch
+  repository: scratch/*
+  sinks: []
+- name: team-a
+  repository: team-a/*
+  sinks: [audit]
+`
+	r, err := NewRouter(RoutingConfig{RulesFile: writeRules(t, "rules.yaml", rules)}, all)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		repo     string
+		tag      string
+		headers  http.Header
+		want     []string
+		wantRule string
+	}{
+		{name: "first match wins", repo: "team-a/app", tag: "v1.2", want: []string{"kargo", "slack"}, wantRule: "releases"},
+		{name: "tag regex matches the whole tag", repo: "team-a/app", tag: "v1.2-rc1", want: []string{"audit"}, wantRule: "team-a"},
+		{name: "header rule", repo: "team-b/app", tag: "v1", headers: http.Header{"X-Canary": {"1"}}, want: []string{"log"}, wantRule: "canary header"},
+		{name: "header value differs", repo: "team-b/app", tag: "v1", headers: http.Header{"X-Canary": {"0"}}, want: []string{"kargo", "audit", "slack"}},
+		{name: "empty sink list drops", repo: "scratch/app", tag: "v1", want: nil, wantRule: "scratch"},
+		{name: "no match and no default goes everywhere", repo: "team-b/app", tag: "v1", want: []string{"kargo", "audit", "slack"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := Event{Provider: "dockerhub", Type: EventPush, Repository: tt.repo, Tag: tt.tag}
+			got, rule := r.route(e, tt.headers)
+			if names := sinkNames(got); !slices.Equal(names, tt.want) {
+				t.Errorf("route() = %v, want %v", names, tt.want)
+			}
+			if name := ruleName(rule); name != tt.wantRule {
+				t.Errorf("route() rule = %q, want %q", name, tt.wantRule)
+			}
+		})
+	}
+
+	// A reload swaps the table in place; unmatched events now use the
+	// default.
+	if err := os.WriteFile(r.path, []byte("rules: []\ndefault: [audit]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := r.route(Event{Repository: "team-a/app", Tag: "v1.2"}, nil); !slices.Equal(sinkNames(got), []string{"audit"}) {
+		t.Errorf("route() after reload = %v, want [audit]", sinkNames(got))
+	}
+}
+
+func TestLoadRouteTableErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		wantErr string
+	}{
+		{name: "unknown field", file: "rules.yaml", content: "rules:\n- repo: x\n  sinks: [audit]\n", wantErr: "unknown field"},
+		{name: "missing sinks", file: "rules.yaml", content: "rules:\n- repository: x\n", wantErr: "rules[0].sinks: required"},
+		{name: "bad tag regex", file: "rules.json", content: `{"rules": [{"tagRegex": "(", "sinks": ["audit"]}]}`, wantErr: "rules[0].tagRegex"},
+		{name: "unknown sink", file: "rules.yaml", content: "rules:\n- sinks: [pagerduty]\ndefault: [nowhere]\n", wantErr: `unknown sink "pagerduty"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRouter(RoutingConfig{RulesFile: writeRules(t, tt.file, tt.content)}, []Sink{testSink("audit")})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("NewRouter() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
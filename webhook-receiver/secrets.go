@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"hash"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultSecretsRefresh = 30 * time.Second
+	// secretsWatchInterval is how often secret files are checked for
+	// changes between full refreshes.
+	secretsWatchInterval = time.Second
+)
+
+// SecretsConfig is where a provider's secrets come from. Every secret found
+// is accepted, so a secret is rotated without downtime by adding the new
+// one, reconfiguring the sender and then removing the old one. Files are
+// re-read within a second of changing, including when the kubelet swaps a
+// mounted Secret's ..data link; every source is also re-read every Refresh.
+// When reading fails the previous secrets stay in effect.
+type SecretsConfig struct {
+	// Files hold one secret per non-empty line. A Kubernetes Secret
+	// mounted as a volume is read this way, one file per key.
+	Files []string `json:"files,omitempty"`
+	// Kubernetes reads a Secret through the API server with the pod's
+	// service account, which needs get on it.
+	Kubernetes *KubernetesSecretRef `json:"kubernetes,omitempty"`
+	Refresh    string               `json:"refresh,omitempty"`
+
+	refresh time.Duration
+}
+
+type KubernetesSecretRef struct {
+	// Namespace defaults to the pod's.
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	// Keys limits the secrets to these keys of the Secret; by default
+	// every key's value is a secret.
+	Keys []string `json:"keys,omitempty"`
+}
+
+func (c *SecretsConfig) Validate() error {
+	var errs []error
+	if len(c.Files) == 0 && c.Kubernetes == nil {
+		errs = append(errs, errors.New("files or kubernetes is required"))
+	}
+	for i, path := range c.Files {
+		if secrets, err := readSecretLines(path); err != nil {
+			errs = append(errs, fmt.Errorf("files[%d]: %w", i, err))
+		} else if len(secrets) == 0 {
+			errs = append(errs, fmt.Errorf("files[%d]: empty", i))
+		}
+	}
+	if k := c.Kubernetes; k != nil && k.Name == "" {
+		errs = append(errs, errors.New("kubernetes.name: required"))
+	}
+	c.refresh = defaultSecretsRefresh
+	if c.Refresh != "" {
+		d, err := time.ParseDuration(c.Refresh)
+		if err != nil || d < time.Second {
+			errs = append(errs, errors.New("refresh: must be a duration of at least 1s"))
+		}
+		c.refresh = d
+	}
+	return errors.Join(errs...)
+}
+
+func readSecretLines(path string) ([]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, line := range strings.Split(string(b), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			out = append(out, line)
+		}
+	}
+	return out, nil
+}
+
+// SecretSet is the secrets a provider accepts at the moment.
+type SecretSet struct {
+	name    string
+	cfg     SecretsConfig
+	secrets atomic.Pointer[[]string]
+	// files is the state of cfg.Files as of the last load.
+	files []os.FileInfo
+}
+
+// staticSecrets accepts only secrets, none if there are none, and is never
+// refreshed.
+func staticSecrets(secrets ...string) *SecretSet {
+	s := &SecretSet{}
+	s.secrets.Store(&secrets)
+	return s
+}
+
+// NewSecretSet loads the secrets for name, which appears in logs, from
+// cfg. Run keeps them up to date.
+func NewSecretSet(ctx context.Context, name string, cfg SecretsConfig) (*SecretSet, error) {
+	s := &SecretSet{name: name, cfg: cfg, files: statFiles(cfg.Files)}
+	secrets, err := s.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(secrets) == 0 {
+		return nil, fmt.Errorf("no secrets found for %s", name)
+	}
+	s.secrets.Store(&secrets)
+	return s, nil
+}
+
+func (s *SecretSet) load(ctx context.Context) ([]string, error) {
+	var out []string
+	for _, path := range s.cfg.Files {
+		secrets, err := readSecretLines(path)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, secrets...)
+	}
+	if k := s.cfg.Kubernetes; k != nil {
+		secrets, err := readKubernetesSecret(ctx, *k)
+		if err != nil {
+			return nil, fmt.Errorf("reading Secret %s: %w", k.Name, err)
+		}
+		out = append(out, secrets...)
+	}
+	slices.Sort(out)
+	return slices.Compact(out), nil
+}
+
+// Run re-reads the sources until ctx is done: every Refresh, and whenever
+// a file changes. A static set returns at once.
+func (s *SecretSet) Run(ctx context.Context) {
+	if s.cfg.refresh == 0 {
+		return
+	}
+	watch := time.NewTicker(secretsWatchInterval)
+	defer watch.Stop()
+	refresh := time.NewTicker(s.cfg.refresh)
+	defer refresh.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-watch.C:
+			now := statFiles(s.cfg.Files)
+			if sameFiles(s.files, now) {
+				continue
+			}
+			s.files = now
+		case <-refresh.C:
+		}
+		secrets, err := s.load(ctx)
+		switch {
+		case err != nil:
+			log.Printf("Refreshing secrets for %s failed, keeping the current ones: %v", s.name, err)
+		case len(secrets) == 0:
+			log.Printf("No secrets found for %s, keeping the current ones", s.name)
+		case !slices.Equal(secrets, *s.secrets.Load()):
+			s.secrets.Store(&secrets)
+			log.Printf("Secrets for %s changed, %d now accepted", s.name, len(secrets))
+		}
+	}
+}
+
+// statFiles stats paths, following links; a file that cannot be stat'ed
+// is nil.
+func statFiles(paths []string) []os.FileInfo {
+	out := make([]os.FileInfo, len(paths))
+	for i, path := range paths {
+		out[i], _ = os.Stat(path)
+	}
+	return out
+}
+
+// sameFiles reports whether no file changed between two statFiles calls.
+// Replacing a file, as the kubelet does, changes its identity; editing it
+// in place changes its size or modification time.
+func sameFiles(a, b []os.FileInfo) bool {
+	return slices.EqualFunc(a, b, func(x, y os.FileInfo) bool {
+		if x == nil || y == nil {
+			return x == y
+		}
+		return os.SameFile(x, y) && x.Size() == y.Size() && x.ModTime().Equal(y.ModTime())
+	})
+}
+
+// check compares a plaintext secret from a delivery.
+func (s *SecretSet) check(got string) error {
+	if got == "" {
+		return errMissingSecret
+	}
+	ok := slices.ContainsFunc(*s.secrets.Load(), func(secret string) bool {
+		return subtle.ConstantTimeCompare([]byte(got), []byte(secret)) == 1
+	})
+	if !ok {
+		return errInvalidSecret
+	}
+	return nil
+}
+
+// signed reports whether sig is the HMAC of body under one of the secrets.
+func (s *SecretSet) signed(h func() hash.Hash, body, sig []byte) bool {
+	return slices.ContainsFunc(*s.secrets.Load(), func(secret string) bool {
+		m := hmac.New(h, []byte(secret))
+		m.Write(body)
+		return hmac.Equal(sig, m.Sum(nil))
+	})
+}
+
+// readKubernetesSecret gets ref from the API server the pod runs against.
+func readKubernetesSecret(ctx context.Context, ref KubernetesSecretRef) ([]string, error) {
+	api, err := inClusterAPI()
+	if err != nil {
+		return nil, err
+	}
+	namespace := ref.Namespace
+	if namespace == "" {
+		namespace = api.namespace
+	}
+	var secret struct {
+		// Data values are base64 in the API and decoded by Unmarshal.
+		Data map[string][]byte `json:"data"`
+	}
+	if err := api.get(ctx, "/api/v1/namespaces/"+namespace+"/secrets/"+ref.Name, &secret); err != nil {
+		return nil, err
+	}
+	var out []string
+	for key, value := range secret.Data {
+		if len(ref.Keys) > 0 && !slices.Contains(ref.Keys, key) {
+			continue
+		}
+		if v := strings.TrimSpace(string(value)); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
+
+// watchSecrets loads the secrets for name and keeps them up to date in the
+// background. It exits if none can be loaded.
+func watchSecrets(name string, cfg SecretsConfig) *SecretSet {
+	s, err := NewSecretSet(context.Background(), name, cfg)
+	if err != nil {
+		log.Fatalf("Loading secrets for %s: %v", name, err)
+	}
+	go s.Run(context.Background())
+	log.Printf("Accepting %d secrets for %s, refreshed every %v", len(*s.secrets.Load()), name, cfg.refresh)
+	return s
+}
+
+// providerSecrets are the secrets configured per provider name; the others
+// check webhookSecrets.
+var providerSecrets = map[string]*SecretSet{}
+
+// secretsFor returns the secrets r, delivered to provider, is checked
+// against: the tenant's for tenant paths, else the provider's or the
+// server's.
+func secretsFor(r *http.Request, provider string) *SecretSet {
+	if s, ok := providerSecrets[provider]; ok {
+		return requestSecrets(r, s)
+	}
+	return requestSecrets(r, webhookSecrets)
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	defaultReadTimeout  = 30 * time.Second
+	defaultWriteTimeout = 30 * time.Second
+	defaultIdleTimeout  = 2 * time.Minute
+)
+
+// webhookSecrets are the shared secrets checked by providers that have
+// none of their own. Until main loads the configured ones, every request
+// is rejected.
+var webhookSecrets = staticSecrets()
+
+// ServerConfig covers the HTTP server shared by all listeners.
+type ServerConfig struct {
+	// PathPrefix is stripped from incoming paths, for running behind an
+	// ingress that mounts the receiver below /.
+	PathPrefix string `json:"pathPrefix,omitempty"`
+	// SecretFile is shorthand for Secrets with just this file.
+	SecretFile string         `json:"secretFile,omitempty"`
+	Secrets    *SecretsConfig `json:"secrets,omitempty"`
+	TLS        *TLSConfig     `json:"tls,omitempty"`
+
+	ReadTimeout  string `json:"readTimeout,omitempty"`
+	WriteTimeout string `json:"writeTimeout,omitempty"`
+	IdleTimeout  string `json:"idleTimeout,omitempty"`
+	// ShutdownTimeout bounds draining on SIGTERM; keep it below the pod's
+	// terminationGracePeriodSeconds.
+	ShutdownTimeout string `json:"shutdownTimeout,omitempty"`
+	// MaxBodyBytes caps webhook request bodies; larger ones get a 413.
+	MaxBodyBytes int64            `json:"maxBodyBytes,omitempty"`
+	RateLimit    *RateLimitConfig `json:"rateLimit,omitempty"`
+	// TrustedProxies are the addresses or CIDRs of proxies in front of the
+	// receiver whose X-Forwarded-For header is believed.
+	TrustedProxies []string            `json:"trustedProxies,omitempty"`
+	AllowedSources *SourceFilterConfig `json:"allowedSources,omitempty"`
+	// Providers limits the built-in webhook endpoints to these providers;
+	// all of those built in are served by default.
+	Providers []string `json:"providers,omitempty"`
+
+	secrets                                *SecretsConfig
+	readTimeout, writeTimeout, idleTimeout time.Duration
+	shutdownTimeout                        time.Duration
+	trustedProxies                         []netip.Prefix
+}
+
+type TLSConfig struct {
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+}
+
+func (c *ServerConfig) Validate() error {
+	var errs []error
+	if c.PathPrefix != "" && (!strings.HasPrefix(c.PathPrefix, "/") || strings.HasSuffix(c.PathPrefix, "/")) {
+		errs = append(errs, errors.New("server.pathPrefix: must start and must not end with /"))
+	}
+	switch {
+	case c.SecretFile != "" && c.Secrets != nil:
+		errs = append(errs, errors.New("server.secretFile: cannot be combined with server.secrets"))
+	case c.SecretFile != "":
+		if secrets, err := readSecretLines(c.SecretFile); err != nil {
+			errs = append(errs, fmt.Errorf("server.secretFile: %w", err))
+		} else if len(secrets) == 0 {
+			errs = append(errs, errors.New("server.secretFile: empty"))
+		}
+		c.secrets = &SecretsConfig{Files: []string{c.SecretFile}, refresh: defaultSecretsRefresh}
+	case c.Secrets != nil:
+		if err := c.Secrets.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("server.secrets.%w", err))
+		}
+		c.secrets = c.Secrets
+	default:
+		errs = append(errs, errors.New("server.secretFile: required unless server.secrets is set (or -secret-file, WEBHOOK_SECRET_FILE)"))
+	}
+	if t := c.TLS; t != nil {
+		if _, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile); err != nil {
+			errs = append(errs, fmt.Errorf("server.tls: %w", err))
+		}
+	}
+	if c.MaxBodyBytes < 0 {
+		errs = append(errs, errors.New("server.maxBodyBytes: must not be negative"))
+	}
+	if c.RateLimit != nil {
+		if err := c.RateLimit.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	var err error
+	if c.trustedProxies, err = parsePrefixes(c.TrustedProxies); err != nil {
+		errs = append(errs, fmt.Errorf("server.trustedProxies: %w", err))
+	}
+	if c.AllowedSources != nil {
+		if err := c.AllowedSources.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(c.Providers) > 0 {
+		built := make(map[string]bool)
+		for _, p := range providerRoutes {
+			built[p.Name()] = true
+		}
+		for _, name := range c.Providers {
+			if !built[name] {
+				errs = append(errs, fmt.Errorf("server.providers: %q is not a provider in this build", name))
+			}
+		}
+	}
+
+	for _, d := range []struct {
+		name string
+		raw  string
+		out  *time.Duration
+		def  time.Duration
+	}{
+		{"readTimeout", c.ReadTimeout, &c.readTimeout, defaultReadTimeout},
+		{"writeTimeout", c.WriteTimeout, &c.writeTimeout, defaultWriteTimeout},
+		{"idleTimeout", c.IdleTimeout, &c.idleTimeout, defaultIdleTimeout},
+		{"shutdownTimeout", c.ShutdownTimeout, &c.shutdownTimeout, defaultShutdownTimeout},
+	} {
+		*d.out = d.def
+		if d.raw == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.raw)
+		if err != nil || v <= 0 {
+			errs = append(errs, fmt.Errorf("server.%s: must be a positive duration", d.name))
+			continue
+		}
+		*d.out = v
+	}
+	return errors.Join(errs...)
+}
+
+// providerEnabled reports whether the built-in provider name is served.
+func (c *ServerConfig) providerEnabled(name string) bool {
+	return len(c.Providers) == 0 || slices.Contains(c.Providers, name)
+}
+
+// cliFlags are the command-line settings. They take precedence over the
+// environment, which takes precedence over the config file.
+type cliFlags struct {
+	config       string
+	listen       string
+	tlsCert      string
+	tlsKey       string
+	pathPrefix   string
+	secretFile   string
+	readTimeout  string
+	writeTimeout string
+	logLevel     string
+	logFormat    string
+}
+
+func registerFlags(fs *flag.FlagSet) *cliFlags {
+	f := &cliFlags{}
+	fs.StringVar(&f.config, "config", os.Getenv("CONFIG_FILE"), "config file (JSON or YAML)")
+	fs.StringVar(&f.listen, "listen", "", "comma-separated listen addresses, replacing the configured listeners")
+	fs.StringVar(&f.tlsCert, "tls-cert", "", "TLS certificate file")
+	fs.StringVar(&f.tlsKey, "tls-key", "", "TLS key file")
+	fs.StringVar(&f.pathPrefix, "path-prefix", "", "path prefix to strip from requests")
+	fs.StringVar(&f.secretFile, "secret-file", "", "file holding the shared webhook secrets, one per line (re-read while running)")
+	fs.StringVar(&f.readTimeout, "read-timeout", "", "maximum duration for reading a request")
+	fs.StringVar(&f.writeTimeout, "write-timeout", "", "maximum duration for writing a response")
+	fs.StringVar(&f.logLevel, "log-level", "", "log level: debug, info, warn or error")
+	fs.StringVar(&f.logFormat, "log-format", "", "log format: text or json")
+	return f
+}
+
+func (f *cliFlags) apply(c *Config) {
+	if f == nil {
+		return
+	}
+	if f.listen != "" {
+		c.Listeners = nil
+		for _, addr := range splitList(f.listen) {
+			c.Listeners = append(c.Listeners, ListenerConfig{Address: addr})
+		}
+	}
+	s := c.server()
+	if f.tlsCert != "" || f.tlsKey != "" {
+		s.TLS = &TLSConfig{CertFile: f.tlsCert, KeyFile: f.tlsKey}
+	}
+	if f.pathPrefix != "" {
+		s.PathPrefix = f.pathPrefix
+	}
+	if f.secretFile != "" {
+		s.SecretFile = f.secretFile
+	}
+	if f.readTimeout != "" {
+		s.ReadTimeout = f.readTimeout
+	}
+	if f.writeTimeout != "" {
+		s.WriteTimeout = f.writeTimeout
+	}
+	if f.logLevel != "" {
+		c.logConfig().Level = f.logLevel
+	}
+	if f.logFormat != "" {
+		c.logConfig().Format = f.logFormat
+	}
+}
+
+// server returns the server section, creating it if needed.
+func (c *Config) server() *ServerConfig {
+	if c.Server == nil {
+		c.Server = &ServerConfig{}
+	}
+	return c.Server
+}
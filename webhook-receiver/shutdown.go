@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const defaultShutdownTimeout = 30 * time.Second
+
+// background tracks fire-and-forget work started on behalf of a delivery
+// (relays, callbacks, incident posts) so shutdown can wait for it.
+var background sync.WaitGroup
+
+// goBackground runs f in a goroutine tracked by background.
+func goBackground(f func()) {
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		f()
+	}()
+}
+
+// consumers tracks the loops pulling events from outside the server, such
+// as the Redis stream consumer, so shutdown can stop them before it drains
+// the queue.
+var consumers sync.WaitGroup
+
+// goConsumer runs f in a goroutine tracked by consumers.
+func goConsumer(f func()) {
+	consumers.Add(1)
+	go func() {
+		defer consumers.Done()
+		f()
+	}()
+}
+
+// waitFor waits for wg until ctx is done, reporting whether it finished.
+func waitFor(ctx context.Context, wg *sync.WaitGroup) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// shuttingDown fails the readiness check once SIGTERM is received, so
+// load balancers stop sending traffic while the receiver drains.
+var shuttingDown atomic.Bool
+
+func shutdownCheck(context.Context) error {
+	if shuttingDown.Load() {
+		return errors.New("shutting down")
+	}
+	return nil
+}
+
+// shutdown drains the receiver within timeout: the server stops accepting
+// connections and finishes in-flight requests while the consumers stop
+// reading, then the queue is worked off, background work waits to
+// complete, sinks holding connections are closed and traces and the
+// archive are flushed. Whatever has not finished when timeout runs out is
+// abandoned and logged.
+func shutdown(srv *http.Server, timeout time.Duration, stopConsumers, stopQueue context.CancelFunc, flushTraces func(context.Context) error) {
+	shuttingDown.Store(true)
+	log.Printf("Shutting down, draining for up to %v", timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	stopConsumers()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("Closing server: %v", err)
+	}
+	if !waitFor(ctx, &consumers) {
+		log.Printf("Consumers still delivering at shutdown")
+	}
+	if err := queue.Drain(ctx); err != nil {
+		log.Printf("Queue not drained, %d events undelivered: %v", queue.Len(), err)
+	}
+	stopQueue()
+	if err := queue.CloseJournal(); err != nil {
+		log.Printf("Closing queue journal: %v", err)
+	}
+
+	if !waitFor(ctx, &background) {
+		log.Printf("Background deliveries still running at shutdown")
+	}
+
+	for _, s := range sinks {
+		if c, ok := s.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				log.Printf("Closing sink %s: %v", s.Name(), err)
+			}
+		}
+	}
+	if flushTraces != nil {
+		if err := flushTraces(ctx); err != nil {
+			log.Printf("Flushing traces: %v", err)
+		}
+	}
+	if archive != nil {
+		if err := archive.Close(); err != nil {
+			log.Printf("Closing archive: %v", err)
+		}
+	}
+	log.Printf("Shutdown complete")
+}
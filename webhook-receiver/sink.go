@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const defaultSinkTimeout = 10 * time.Second
+
+// Sink receives every event after parsing.
+type Sink interface {
+	Name() string
+	Send(ctx context.Context, e Event) error
+}
+
+// sinks are the outputs configured at startup.
+var sinks []Sink
+
+type SinksConfig struct {
+	ArgoEvents *ArgoEventsConfig `json:"argoEvents,omitempty"`
+	Kargo      *KargoConfig      `json:"kargo,omitempty"`
+	Canary     *CanaryConfig     `json:"canary,omitempty"`
+	// HTTP and Slack sinks are named so routing rules can refer to them.
+	HTTP  []HTTPSinkConfig  `json:"http,omitempty"`
+	Slack []SlackSinkConfig `json:"slack,omitempty"`
+	NATS  []NATSSinkConfig  `json:"nats,omitempty"`
+	Kafka []KafkaSinkConfig `json:"kafka,omitempty"`
+	AWS   []AWSSinkConfig   `json:"aws,omitempty"`
+	Redis []RedisSinkConfig `json:"redis,omitempty"`
+}
+
+func (c *SinksConfig) Validate() error {
+	var errs []error
+	names := map[string]bool{"argo-events": true, "kargo": true, logSinkName: true}
+	named := func(kind string, i int, name string) {
+		if names[name] {
+			errs = append(errs, fmt.Errorf("sinks.%s[%d].name: %q is already taken", kind, i, name))
+		}
+		names[name] = true
+	}
+	for i := range c.HTTP {
+		if err := c.HTTP[i].Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("sinks.http[%d].%w", i, err))
+		}
+		named("http", i, c.HTTP[i].Name)
+	}
+	for i := range c.Slack {
+		if err := c.Slack[i].Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("sinks.slack[%d].%w", i, err))
+		}
+		named("slack", i, c.Slack[i].Name)
+	}
+	for i := range c.NATS {
+		if err := c.NATS[i].Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("sinks.nats[%d].%w", i, err))
+		}
+		named("nats", i, c.NATS[i].Name)
+	}
+	for i := range c.Kafka {
+		if err := c.Kafka[i].Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("sinks.kafka[%d].%w", i, err))
+		}
+		named("kafka", i, c.Kafka[i].Name)
+	}
+	for i := range c.AWS {
+		if err := c.AWS[i].Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("sinks.aws[%d].%w", i, err))
+		}
+		named("aws", i, c.AWS[i].Name)
+	}
+	for i := range c.Redis {
+		if err := c.Redis[i].Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("sinks.redis[%d].%w", i, err))
+		}
+		named("redis", i, c.Redis[i].Name)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	if c.ArgoEvents != nil {
+		if err := c.ArgoEvents.Validate(); err != nil {
+			return fmt.Errorf("sinks.argoEvents: %w", err)
+		}
+	}
+	if c.Kargo != nil {
+		if err := c.Kargo.Validate(); err != nil {
+			return fmt.Errorf("sinks.kargo: %w", err)
+		}
+	}
+	if c.Canary != nil {
+		if err := c.Canary.Validate(); err != nil {
+			return fmt.Errorf("sinks.canary: %w", err)
+		}
+	}
+	return nil
+}
+
+// Build instantiates the configured sinks.
+func (c *SinksConfig) Build() ([]Sink, error) {
+	var out []Sink
+	if c.ArgoEvents != nil {
+		s, err := NewArgoEventsSink(*c.ArgoEvents)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	if c.Kargo != nil {
+		s, err := NewKargoSink(*c.Kargo)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	for _, cfg := range c.HTTP {
+		out = append(out, NewHTTPSink(cfg))
+	}
+	for _, cfg := range c.Slack {
+		s, err := NewSlackSink(cfg)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	for _, cfg := range c.NATS {
+		s, err := NewNATSSink(cfg)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	for _, cfg := range c.Kafka {
+		s, err := NewKafkaSink(cfg)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	for _, cfg := range c.AWS {
+		s, err := NewAWSSink(cfg)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	for _, cfg := range c.Redis {
+		s, err := NewRedisSink(cfg)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+const logSinkName = "log"
+
+// logSink only logs the event. It is available to routing rules but not
+// part of the default sinks, since dispatch already logs every event.
+type logSink struct{}
+
+func (logSink) Name() string { return logSinkName }
+
+func (logSink) Send(_ context.Context, e Event) error {
+	log.Printf("Routed event: provider=%s type=%s repo=%s tag=%s", e.Provider, e.Type, e.Repository, e.Tag)
+	return nil
+}
+
+func validateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not an absolute http(s) URL", raw)
+	}
+	return nil
+}
+
+func readSecretFile(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultGitHubMetaURL     = "https://api.github.com/meta"
+	defaultGitHubMetaRefresh = time.Hour
+)
+
+// trustedProxies are the proxies whose X-Forwarded-For is believed when
+// working out where a request came from; main sets them from the config.
+var trustedProxies []netip.Prefix
+
+// SourceFilterConfig only admits webhooks from the listed source ranges.
+type SourceFilterConfig struct {
+	AllowedCIDRs []string `json:"allowedCIDRs,omitempty"`
+	// GitHubMeta adds the hook ranges GitHub publishes in its meta API,
+	// refreshed periodically.
+	GitHubMeta *GitHubMetaConfig `json:"githubMeta,omitempty"`
+	// Providers limits filtering to these providers' endpoints; by default
+	// every webhook endpoint is filtered.
+	Providers []string `json:"providers,omitempty"`
+
+	allowed []netip.Prefix
+}
+
+type GitHubMetaConfig struct {
+	// URL is the meta endpoint, for GitHub Enterprise Server.
+	URL     string `json:"url,omitempty"`
+	Refresh string `json:"refresh,omitempty"`
+
+	refresh time.Duration
+}
+
+func (c *SourceFilterConfig) Validate() error {
+	var errs []error
+	var err error
+	if c.allowed, err = parsePrefixes(c.AllowedCIDRs); err != nil {
+		errs = append(errs, fmt.Errorf("server.allowedSources.allowedCIDRs: %w", err))
+	}
+	if m := c.GitHubMeta; m != nil {
+		if m.URL == "" {
+			m.URL = defaultGitHubMetaURL
+		} else if err := validateURL(m.URL); err != nil {
+			errs = append(errs, fmt.Errorf("server.allowedSources.githubMeta.url: %w", err))
+		}
+		m.refresh = defaultGitHubMetaRefresh
+		if m.Refresh != "" {
+			d, err := time.ParseDuration(m.Refresh)
+			if err != nil || d < time.Minute {
+				errs = append(errs, errors.New("server.allowedSources.githubMeta.refresh: must be a duration of at least 1m"))
+			}
+			m.refresh = d
+		}
+	} else if len(c.AllowedCIDRs) == 0 {
+		errs = append(errs, errors.New("server.allowedSources: allowedCIDRs or githubMeta is required"))
+	}
+	return errors.Join(errs...)
+}
+
+// covers reports whether requests for provider are limited to the static
+// allowed ranges.
+func (c *SourceFilterConfig) covers(provider string) bool {
+	return c != nil && len(c.AllowedCIDRs) > 0 && (len(c.Providers) == 0 || slices.Contains(c.Providers, provider))
+}
+
+// parsePrefixes accepts CIDRs and bare addresses.
+func parsePrefixes(raw []string) ([]netip.Prefix, error) {
+	out := make([]netip.Prefix, 0, len(raw))
+	for _, s := range raw {
+		if !strings.Contains(s, "/") {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, fmt.Errorf("%q is not an address or CIDR", s)
+			}
+			out = append(out, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an address or CIDR", s)
+		}
+		out = append(out, p.Masked())
+	}
+	return out, nil
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// sourceAddr is the address a request came from. The connection's peer is
+// used unless it is a trusted proxy, in which case X-Forwarded-For is
+// followed from the right past any further trusted proxies. Hops a client
+// added itself are never reached, so they cannot be spoofed.
+func sourceAddr(r *http.Request) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	addr = addr.Unmap()
+	if !containsAddr(trustedProxies, addr) {
+		return addr, true
+	}
+	var hops []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			return netip.Addr{}, false
+		}
+		addr = hop.Unmap()
+		if !containsAddr(trustedProxies, addr) {
+			break
+		}
+	}
+	return addr, true
+}
+
+type SourceFilter struct {
+	static    []netip.Prefix
+	meta      *GitHubMetaConfig
+	providers []string
+
+	github atomic.Pointer[[]netip.Prefix]
+}
+
+// sourceFilter is set by main when allowed sources are configured.
+var sourceFilter *SourceFilter
+
+func NewSourceFilter(cfg SourceFilterConfig) *SourceFilter {
+	return &SourceFilter{static: cfg.allowed, meta: cfg.GitHubMeta, providers: cfg.Providers}
+}
+
+func (f *SourceFilter) allowed(addr netip.Addr) bool {
+	if containsAddr(f.static, addr) {
+		return true
+	}
+	if github := f.github.Load(); github != nil {
+		return containsAddr(*github, addr)
+	}
+	return false
+}
+
+// Run keeps the GitHub hook ranges up to date. Until the first fetch
+// succeeds only the static ranges are allowed; after that a failed refresh
+// keeps the last ranges fetched.
+func (f *SourceFilter) Run(ctx context.Context) {
+	if f.meta == nil {
+		return
+	}
+	for {
+		if err := f.refresh(ctx); err != nil {
+			log.Printf("Fetching GitHub hook ranges failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(f.meta.refresh):
+		}
+	}
+}
+
+func (f *SourceFilter) refresh(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, defaultSinkTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.meta.URL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	resp, err := outboundClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", f.meta.URL, resp.Status)
+	}
+	var meta struct {
+		Hooks []string `json:"hooks"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&meta); err != nil {
+		return err
+	}
+	ranges, err := parsePrefixes(meta.Hooks)
+	if err != nil {
+		return err
+	}
+	if len(ranges) == 0 {
+		return errors.New("no hook ranges in response")
+	}
+	f.github.Store(&ranges)
+	return nil
+}
+
+// Middleware answers 403 to requests for provider from sources outside
+// the allowed ranges. A nil filter lets everything through.
+func (f *SourceFilter) Middleware(provider string, next http.Handler) http.Handler {
+	if f == nil || (len(f.providers) > 0 && !slices.Contains(f.providers, provider)) {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addr, ok := sourceAddr(r)
+		if !ok || !f.allowed(addr) {
+			requestLogger(r.Context()).Warn("Source not allowed", "provider", provider,
+				"remote_addr", r.RemoteAddr, "forwarded_for", r.Header.Get("X-Forwarded-For"))
+			webhookOutcomes.add(1, provider, verdictRejected)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
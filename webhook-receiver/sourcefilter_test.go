@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestSourceAddr(t *testing.T) {
+	defer func(p []netip.Prefix) { trustedProxies = p }(trustedProxies)
+	trustedProxies = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("fd00::/8")}
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded []string
+		want      string
+		wantOK    bool
+	}{
+		{name: "direct peer", remote: "203.0.113.7:1234", want: "203.0.113.7", wantOK: true},
+		{name: "untrusted peer ignores forwarded", remote: "203.0.113.7:1234", forwarded: []string{"198.51.100.1"}, want: "203.0.113.7", wantOK: true},
+		{name: "trusted peer", remote: "10.0.0.1:1234", forwarded: []string{"203.0.113.7"}, want: "203.0.113.7", wantOK: true},
+		{name: "spoofed leftmost hop", remote: "10.0.0.1:1234", forwarded: []string{"198.51.100.1, 203.0.113.7"}, want: "203.0.113.7", wantOK: true},
+		{name: "chain of trusted proxies", remote: "10.0.0.1:1234", forwarded: []string{"198.51.100.1, 203.0.113.7, 10.0.0.3", "10.0.0.2"}, want: "203.0.113.7", wantOK: true},
+		{name: "all hops trusted", remote: "10.0.0.1:1234", forwarded: []string{"10.0.0.3, 10.0.0.2"}, want: "10.0.0.3", wantOK: true},
+		{name: "trusted peer without forwarded", remote: "10.0.0.1:1234", want: "10.0.0.1", wantOK: true},
+		{name: "malformed hop", remote: "10.0.0.1:1234", forwarded: []string{"203.0.113.7, not-an-ip"}},
+		{name: "malformed hop past the source", remote: "10.0.0.1:1234", forwarded: []string{"not-an-ip, 203.0.113.7"}, want: "203.0.113.7", wantOK: true},
+		{name: "hop with port", remote: "10.0.0.1:1234", forwarded: []string{"203.0.113.7:80"}},
+		{name: "IPv4-mapped peer", remote: "[::ffff:203.0.113.7]:1234", want: "203.0.113.7", wantOK: true},
+		{name: "IPv4-mapped trusted peer", remote: "[::ffff:10.0.0.1]:1234", forwarded: []string{"203.0.113.7"}, want: "203.0.113.7", wantOK: true},
+		{name: "IPv4-mapped hop", remote: "10.0.0.1:1234", forwarded: []string{"::ffff:10.0.0.2, ::ffff:203.0.113.7"}, want: "203.0.113.7", wantOK: true},
+		{name: "IPv6", remote: "[fd00::1]:1234", forwarded: []string{"2001:db8::7"}, want: "2001:db8::7", wantOK: true},
+		{name: "peer without port", remote: "203.0.113.7", want: "203.0.113.7", wantOK: true},
+		{name: "unparsable peer", remote: "pipe"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/webhook/github", nil)
+			r.RemoteAddr = tt.remote
+			for _, v := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			addr, ok := sourceAddr(r)
+			if ok != tt.wantOK {
+				t.Fatalf("sourceAddr() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && addr.String() != tt.want {
+				t.Errorf("sourceAddr() = %s, want %s", addr, tt.want)
+			}
+		})
+	}
+}
+
+func TestSourceFilterMiddleware(t *testing.T) {
+	defer func(p []netip.Prefix) { trustedProxies = p }(trustedProxies)
+	trustedProxies = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	cfg := SourceFilterConfig{AllowedCIDRs: []string{"192.0.2.0/24", "2001:db8::7"}, Providers: []string{"github"}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	f := NewSourceFilter(cfg)
+	meta := NewSourceFilter(SourceFilterConfig{})
+	meta.github.Store(&[]netip.Prefix{netip.MustParsePrefix("140.82.112.0/20")})
+
+	tests := []struct {
+		name      string
+		filter    *SourceFilter
+		provider  string
+		remote    string
+		forwarded string
+		want      int
+	}{
+		{name: "allowed range", filter: f, provider: "github", remote: "192.0.2.10:1234", want: http.StatusOK},
+		{name: "allowed address", filter: f, provider: "github", remote: "[2001:db8::7]:1234", want: http.StatusOK},
+		{name: "outside the ranges", filter: f, provider: "github", remote: "203.0.113.7:1234", want: http.StatusForbidden},
+		{name: "IPv4-mapped address in range", filter: f, provider: "github", remote: "[::ffff:192.0.2.10]:1234", want: http.StatusOK},
+		{name: "forwarded through a trusted proxy", filter: f, provider: "github", remote: "10.0.0.1:1234", forwarded: "192.0.2.10", want: http.StatusOK},
+		{name: "spoofed leftmost hop", filter: f, provider: "github", remote: "10.0.0.1:1234", forwarded: "192.0.2.10, 203.0.113.7", want: http.StatusForbidden},
+		{name: "malformed hop", filter: f, provider: "github", remote: "10.0.0.1:1234", forwarded: "192.0.2.10, bogus", want: http.StatusForbidden},
+		{name: "provider not filtered", filter: f, provider: "harbor", remote: "203.0.113.7:1234", want: http.StatusOK},
+		{name: "GitHub hook range", filter: meta, provider: "github", remote: "140.82.115.1:1234", want: http.StatusOK},
+		{name: "outside GitHub hook ranges", filter: meta, provider: "github", remote: "203.0.113.7:1234", want: http.StatusForbidden},
+		{name: "nil filter", provider: "github", remote: "203.0.113.7:1234", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := tt.filter.Middleware(tt.provider, http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+			r := httptest.NewRequest("POST", "/webhook/"+tt.provider, nil)
+			r.RemoteAddr = tt.remote
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
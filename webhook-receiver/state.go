@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const stateVersion = "v1"
+
+// State is the portable dump served by GET /admin/state and accepted by
+// POST /admin/state, used to clone a receiver into another cluster or to
+// rehearse disaster recovery. Config is the effective configuration with
+// credentials blanked (see sanitizeConfig) and Routes the routing rules in
+// effect; both are informational on import, since the target instance is
+// configured through its own CONFIG_FILE. Dedup holds when each recently
+// seen delivery was processed, so redeliveries of those are still dropped
+// after a move.
+type State struct {
+	Version    string               `json:"version"`
+	ExportedAt time.Time            `json:"exportedAt"`
+	Config     json.RawMessage      `json:"config,omitempty"`
+	Routes     *RouteTable          `json:"routes,omitempty"`
+	Dedup      map[string]time.Time `json:"dedup,omitempty"`
+	Queue      []Event              `json:"queue"`
+}
+
+type stateHandler struct {
+	cfg *Config
+}
+
+func (h stateHandler) export(w http.ResponseWriter, r *http.Request) {
+	st := State{
+		Version:    stateVersion,
+		ExportedAt: time.Now().UTC(),
+		Queue:      queue.Snapshot(),
+	}
+	cfg, err := sanitizeConfig(h.cfg)
+	if err != nil {
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	st.Config = cfg
+	if router != nil {
+		st.Routes = router.table.Load()
+	}
+	if dedup != nil {
+		st.Dedup = dedup.Snapshot()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="receiver-state.json"`)
+	json.NewEncoder(w).Encode(st)
+}
+
+// sanitizeConfig returns cfg as JSON with anything that may carry a
+// credential blanked: header values, fields named like secrets, tokens,
+// passwords or credentials (including the names of files holding them),
+// and the user info and query of URLs.
+func sanitizeConfig(cfg *Config) (json.RawMessage, error) {
+	raw, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(sanitizeValue("", v))
+}
+
+func sanitizeValue(key string, v any) any {
+	lower := strings.ToLower(key)
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			if lower == "headers" {
+				v[k] = redacted
+				continue
+			}
+			v[k] = sanitizeValue(k, child)
+		}
+		return v
+	case []any:
+		for i, child := range v {
+			v[i] = sanitizeValue(key, child)
+		}
+		return v
+	case string:
+		for _, word := range []string{"secret", "token", "password", "credential"} {
+			if strings.Contains(lower, word) && v != "" {
+				return redacted
+			}
+		}
+		if lower == "url" || strings.HasSuffix(lower, "url") {
+			return sanitizeURL(v)
+		}
+	}
+	return v
+}
+
+const redacted = "REDACTED"
+
+func sanitizeURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return redacted
+	}
+	if u.User != nil {
+		u.User = url.User(redacted)
+	}
+	if u.RawQuery != "" {
+		q := u.Query()
+		for k := range q {
+			q.Set(k, redacted)
+		}
+		u.RawQuery = q.Encode()
+	}
+	return u.String()
+}
+
+// restore re-enqueues the pending events from an exported State. Events
+// that no longer fit in the queue are reported as dropped.
+func (h stateHandler) restore(w http.ResponseWriter, r *http.Request) {
+	var st State
+	if err := json.NewDecoder(r.Body).Decode(&st); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	if st.Version != stateVersion {
+		http.Error(w, "Unsupported state version", http.StatusBadRequest)
+		return
+	}
+	var exported struct {
+		Version string `json:"version"`
+	}
+	if st.Config != nil && json.Unmarshal(st.Config, &exported) == nil && exported.Version != h.cfg.Version {
+		log.Printf("Imported state was exported with config version %s, running %s",
+			exported.Version, h.cfg.Version)
+	}
+	if dedup != nil && len(st.Dedup) > 0 {
+		n := dedup.Restore(st.Dedup)
+		log.Printf("Imported %d of %d dedup entries", n, len(st.Dedup))
+	}
+
+	var queued, dropped int
+	for _, e := range st.Queue {
+		if queue.Push(r.Context(), e) {
+			queued++
+		} else {
+			dropped++
+		}
+	}
+	log.Printf("Imported state from %s: %d events queued, %d dropped",
+		st.ExportedAt.Format(time.RFC3339), queued, dropped)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"queued": queued, "dropped": dropped})
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultStoreCapacity = 10000
+	defaultEventsLimit   = 100
+	maxEventsLimit       = 1000
+
+	storeSubscriberBuffer = 64
+	streamKeepAlive       = 30 * time.Second
+)
+
+type StoreConfig struct {
+	// Capacity is the number of most recent events kept; older ones are
+	// discarded first.
+	Capacity int `json:"capacity,omitempty"`
+}
+
+func (c *StoreConfig) Validate() error {
+	if c.Capacity < 0 {
+		return errors.New("store.capacity: must not be negative")
+	}
+	return nil
+}
+
+// StoredEvent is an event as recorded by the receiver, with its delivery
+// outcome.
+type StoredEvent struct {
+	Seq        uint64    `json:"seq"`
+	ReceivedAt time.Time `json:"receivedAt"`
+	Event      Event     `json:"event"`
+	Tenant     string    `json:"tenant,omitempty"`
+	Delivered  bool      `json:"delivered"`
+	Error      string    `json:"error,omitempty"`
+
+	size int64
+}
+
+// EventStore keeps the most recent events in memory for the /events API.
+type EventStore struct {
+	capacity int
+
+	mu     sync.Mutex
+	events []StoredEvent
+	seq    uint64
+	subs   map[chan StoredEvent]*Query
+}
+
+// store records every dispatched event.
+var store = NewEventStore(StoreConfig{})
+
+func NewEventStore(cfg StoreConfig) *EventStore {
+	s := &EventStore{capacity: cfg.Capacity}
+	if s.capacity == 0 {
+		s.capacity = defaultStoreCapacity
+	}
+	return s
+}
+
+// Add records e as pending and returns its sequence number. The encoded
+// size of the event counts towards tenant's stored bytes while it is held.
+func (s *EventStore) Add(e Event, tenant string) uint64 {
+	b, _ := json.Marshal(e)
+	size := int64(len(b))
+	tenants.Stored(tenant, size)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	s.events = append(s.events, StoredEvent{Seq: s.seq, ReceivedAt: time.Now().UTC(), Event: e, Tenant: tenant, size: size})
+	s.publish(s.events[len(s.events)-1])
+	s.trim(s.capacity)
+	return s.seq
+}
+
+// trim discards the oldest events beyond n and returns how many. The
+// caller holds s.mu.
+func (s *EventStore) trim(n int) int {
+	over := len(s.events) - n
+	if over <= 0 {
+		return 0
+	}
+	for _, old := range s.events[:over] {
+		tenants.Stored(old.Tenant, -old.size)
+	}
+	s.events = s.events[over:]
+	return over
+}
+
+// shrink discards the older half of the events held, to free memory.
+func (s *EventStore) shrink() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := s.trim(len(s.events) / 2)
+	// Copy so the backing array holding the discarded events is collected.
+	s.events = slices.Clone(s.events)
+	return n
+}
+
+// index returns the position of event seq, or -1 if it is no longer held.
+// The caller holds s.mu.
+func (s *EventStore) index(seq uint64) int {
+	if len(s.events) == 0 || seq < s.events[0].Seq {
+		return -1
+	}
+	i := int(seq - s.events[0].Seq)
+	if i >= len(s.events) {
+		return -1
+	}
+	return i
+}
+
+// Delivered records the outcome of delivering event seq, if it is still
+// held.
+func (s *EventStore) Delivered(seq uint64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.index(seq)
+	if i < 0 {
+		return
+	}
+	s.events[i].Delivered = err == nil
+	s.events[i].Error = ""
+	if err != nil {
+		s.events[i].Error = err.Error()
+	}
+	s.publish(s.events[i])
+}
+
+// Annotate adds tags and annotations to event seq; see Event.annotate. It
+// reports false if the event is no longer held.
+func (s *EventStore) Annotate(seq uint64, tags []string, annotations map[string]string) (StoredEvent, bool) {
+	return s.update(seq, func(e *Event) { e.annotate(tags, annotations) })
+}
+
+// Untag removes tag from event seq.
+func (s *EventStore) Untag(seq uint64, tag string) (StoredEvent, bool) {
+	return s.update(seq, func(e *Event) { e.untag(tag) })
+}
+
+func (s *EventStore) update(seq uint64, f func(*Event)) (StoredEvent, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.index(seq)
+	if i < 0 {
+		return StoredEvent{}, false
+	}
+	se := &s.events[i]
+	f(&se.Event)
+	b, _ := json.Marshal(se.Event)
+	size := int64(len(b))
+	tenants.Stored(se.Tenant, size-se.size)
+	se.size = size
+	s.publish(*se)
+	return *se, true
+}
+
+// Subscribe returns a channel receiving events matching q as they are
+// added and whenever they change afterwards (delivered, tagged), so an
+// event can be received more than once. Events are dropped for
+// subscribers that fall behind. cancel must be called when done.
+func (s *EventStore) Subscribe(q *Query) (events <-chan StoredEvent, cancel func()) {
+	ch := make(chan StoredEvent, storeSubscriberBuffer)
+	s.mu.Lock()
+	if s.subs == nil {
+		s.subs = make(map[chan StoredEvent]*Query)
+	}
+	s.subs[ch] = q
+	s.mu.Unlock()
+	return ch, func() {
+		s.mu.Lock()
+		delete(s.subs, ch)
+		s.mu.Unlock()
+	}
+}
+
+// closeStreams ends every subscription, for server shutdown: streams would
+// otherwise hold it up until the grace period runs out.
+func (s *EventStore) closeStreams() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.subs {
+		close(ch)
+		delete(s.subs, ch)
+	}
+}
+
+// publish sends e to matching subscribers. The caller holds s.mu.
+func (s *EventStore) publish(e StoredEvent) {
+	for ch, q := range s.subs {
+		if !q.Match(&e) {
+			continue
+		}
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Query returns up to limit events matching q, newest first, starting
+// below the sequence number before (0 for the newest).
+func (s *EventStore) Query(q *Query, before uint64, limit int) []StoredEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []StoredEvent
+	for i := len(s.events) - 1; i >= 0 && len(out) < limit; i-- {
+		e := s.events[i]
+		if before != 0 && e.Seq >= before {
+			continue
+		}
+		if q.Match(&e) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+type storeSeqKey struct{}
+
+func withStoreSeq(ctx context.Context, seq uint64) context.Context {
+	return context.WithValue(ctx, storeSeqKey{}, seq)
+}
+
+func storeSeq(ctx context.Context) (uint64, bool) {
+	seq, ok := ctx.Value(storeSeqKey{}).(uint64)
+	return seq, ok
+}
+
+// eventsHandler serves GET /events?q=&limit=&cursor=. q is a filter
+// expression (see Query); cursor is the next value of a previous page.
+func (s *EventStore) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	q, err := ParseQuery(params.Get("q"))
+	if err != nil {
+		http.Error(w, "Invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := defaultEventsLimit
+	if v := params.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 || limit > maxEventsLimit {
+			http.Error(w, "limit must be between 1 and "+strconv.Itoa(maxEventsLimit), http.StatusBadRequest)
+			return
+		}
+	}
+	var before uint64
+	if v := params.Get("cursor"); v != "" {
+		if before, err = strconv.ParseUint(v, 10, 64); err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+	}
+
+	page := s.Query(q, before, limit)
+	out := struct {
+		Events []StoredEvent `json:"events"`
+		Next   string        `json:"next,omitempty"`
+	}{Events: page}
+	if out.Events == nil {
+		out.Events = []StoredEvent{}
+	}
+	if len(page) == limit {
+		out.Next = strconv.FormatUint(page[len(page)-1].Seq, 10)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+func parseSeq(w http.ResponseWriter, r *http.Request) (uint64, bool) {
+	seq, err := strconv.ParseUint(r.PathValue("seq"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid seq", http.StatusBadRequest)
+		return 0, false
+	}
+	return seq, true
+}
+
+func writeStoredEvent(w http.ResponseWriter, e StoredEvent, ok bool) {
+	if !ok {
+		http.Error(w, "Event is no longer stored", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(e)
+}
+
+// getHandler serves GET /events/{seq}, the view signed links in
+// notifications point at.
+func (s *EventStore) getHandler(w http.ResponseWriter, r *http.Request) {
+	seq, ok := parseSeq(w, r)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	var e StoredEvent
+	i := s.index(seq)
+	if i >= 0 {
+		e = s.events[i]
+	}
+	s.mu.Unlock()
+	writeStoredEvent(w, e, i >= 0)
+}
+
+// tagHandler serves POST /events/{seq}/tags with a body of
+// {"tags": [...], "annotations": {...}}. Tags are added to the existing
+// ones; an annotation with an empty value is removed.
+func (s *EventStore) tagHandler(w http.ResponseWriter, r *http.Request) {
+	seq, ok := parseSeq(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Tags        []string          `json:"tags"`
+		Annotations map[string]string `json:"annotations"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+		http.Error(w, "Invalid body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if slices.Contains(req.Tags, "") {
+		http.Error(w, "Tags must not be empty", http.StatusBadRequest)
+		return
+	}
+	e, ok := s.Annotate(seq, req.Tags, req.Annotations)
+	writeStoredEvent(w, e, ok)
+}
+
+// untagHandler serves DELETE /events/{seq}/tags/{tag}.
+func (s *EventStore) untagHandler(w http.ResponseWriter, r *http.Request) {
+	seq, ok := parseSeq(w, r)
+	if !ok {
+		return
+	}
+	e, ok := s.Untag(seq, r.PathValue("tag"))
+	writeStoredEvent(w, e, ok)
+}
+
+// streamHandler serves GET /events/stream?q= as server-sent events, one
+// StoredEvent per message; see Subscribe.
+func (s *EventStore) streamHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := ParseQuery(r.URL.Query().Get("q"))
+	if err != nil {
+		http.Error(w, "Invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	rc := http.NewResponseController(w)
+	// The stream outlives the server's write timeout.
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	events, cancel := s.Subscribe(q)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			b, _ := json.Marshal(e)
+			fmt.Fprintf(w, "id: %d\ndata: %s\n\n", e.Seq, b)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
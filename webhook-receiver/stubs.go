@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultStubRecordLimit = 100
+
+// StubConfig is one path served in stub mode: the receiver answers with a
+// canned response and records the request instead of processing it. This
+// lets a new provider be pointed at production while its parser is written.
+type StubConfig struct {
+	Path        string            `json:"path"`
+	Status      int               `json:"status"`
+	ContentType string            `json:"contentType"`
+	Headers     map[string]string `json:"headers"`
+	Body        string            `json:"body"`
+	// Record is the number of most recent requests kept for inspection.
+	Record int `json:"record"`
+}
+
+type StubsFile struct {
+	Stubs []StubConfig `json:"stubs"`
+}
+
+type RecordedRequest struct {
+	ReceivedAt time.Time   `json:"receivedAt"`
+	Method     string      `json:"method"`
+	Path       string      `json:"path"`
+	RemoteAddr string      `json:"remoteAddr"`
+	Headers    http.Header `json:"headers"`
+	Body       string      `json:"body"`
+}
+
+type stub struct {
+	cfg StubConfig
+
+	mu       sync.Mutex
+	recorded []RecordedRequest
+}
+
+type StubRegistry struct {
+	stubs map[string]*stub
+}
+
+func LoadStubsFile(path string) (*StubsFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var sf StubsFile
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&sf); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return &sf, sf.Validate()
+}
+
+func (sf *StubsFile) Validate() error {
+	seen := make(map[string]bool)
+	for i, s := range sf.Stubs {
+		if s.Path == "" || s.Path[0] != '/' {
+			return fmt.Errorf("stubs[%d]: path must start with /", i)
+		}
+		if _, ok := providerRoutes[s.Path]; ok || reservedPath(s.Path) {
+			return fmt.Errorf("stubs[%d]: %s is served by the receiver itself", i, s.Path)
+		}
+		if seen[s.Path] {
+			return fmt.Errorf("stubs[%d]: duplicate path %s", i, s.Path)
+		}
+		seen[s.Path] = true
+		if s.Status != 0 && (s.Status < 100 || s.Status > 599) {
+			return fmt.Errorf("stubs[%d]: invalid status %d", i, s.Status)
+		}
+		if s.Record < 0 {
+			return fmt.Errorf("stubs[%d]: record must not be negative", i)
+		}
+	}
+	return nil
+}
+
+func NewStubRegistry(cfgs []StubConfig) *StubRegistry {
+	reg := &StubRegistry{stubs: make(map[string]*stub)}
+	for _, cfg := range cfgs {
+		if cfg.Status == 0 {
+			cfg.Status = http.StatusOK
+		}
+		if cfg.Record == 0 {
+			cfg.Record = defaultStubRecordLimit
+		}
+		reg.stubs[cfg.Path] = &stub{cfg: cfg}
+	}
+	return reg
+}
+
+// Register mounts every stub path on mux.
+func (reg *StubRegistry) Register(mux *http.ServeMux) {
+	for path, s := range reg.stubs {
+		mux.Handle(path, s)
+		log.Printf("Stub endpoint: %s (status %d)", path, s.cfg.Status)
+	}
+}
+
+func (s *stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if features.Enabled(flagStubRecording) {
+		s.mu.Lock()
+		s.recorded = append(s.recorded, RecordedRequest{
+			ReceivedAt: time.Now(),
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			RemoteAddr: r.RemoteAddr,
+			Headers:    r.Header.Clone(),
+			Body:       string(body),
+		})
+		if over := len(s.recorded) - s.cfg.Record; over > 0 {
+			s.recorded = s.recorded[over:]
+		}
+		s.mu.Unlock()
+	}
+
+	log.Printf("Stubbed %s %s (%d bytes)", r.Method, r.URL.Path, len(body))
+
+	for k, v := range s.cfg.Headers {
+		w.Header().Set(k, v)
+	}
+	if s.cfg.ContentType != "" {
+		w.Header().Set("Content-Type", s.cfg.ContentType)
+	}
+	w.WriteHeader(s.cfg.Status)
+	w.Write([]byte(s.cfg.Body))
+}
+
+// recordingsHandler serves GET /admin/stubs, returning the recorded requests
+// per stub path, optionally filtered with ?path=.
+func (reg *StubRegistry) recordingsHandler(w http.ResponseWriter, r *http.Request) {
+	out := make(map[string][]RecordedRequest)
+	for path, s := range reg.stubs {
+		if p := r.URL.Query().Get("path"); p != "" && p != path {
+			continue
+		}
+		s.mu.Lock()
+		out[path] = append([]RecordedRequest(nil), s.recorded...)
+		s.mu.Unlock()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+// reservedPath reports whether path is one of the receiver's own health or
+// metrics endpoints.
+func reservedPath(path string) bool {
+	for _, p := range []string{"/health", "/healthz", "/readyz", "/metrics"} {
+		if path == p || strings.HasPrefix(path, p+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	enforceWarn     = "warn"
+	enforceThrottle = "throttle"
+	enforceReject   = "reject"
+)
+
+var errQuotaExceeded = errors.New("tenant quota exceeded")
+
+var tenantNameRe = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+var webhookTenantRequests = newMetric("webhook_tenant_requests_total", "counter",
+	"Webhook requests to tenant paths by tenant, provider and HTTP status.", "tenant", "provider", "code")
+
+// TenantConfig groups the events of one team. An event received on a
+// virtual host bound to a tenant or on the tenant's webhook paths belongs
+// to it; otherwise it belongs to the first tenant with a matching rule.
+// Events no tenant matches are unaccounted.
+type TenantConfig struct {
+	Name  string       `json:"name"`
+	Match []EventMatch `json:"match"`
+	Quota *QuotaConfig `json:"quota,omitempty"`
+	// Path serves the webhook endpoints for the tenant below
+	// /webhook/<name>, e.g. /webhook/team-a/github.
+	Path bool `json:"path,omitempty"`
+	// Secrets are checked instead of the server's and providers' secrets
+	// for deliveries to the tenant's paths.
+	Secrets *SecretsConfig `json:"secrets,omitempty"`
+	// Sinks limits the tenant's events to these sinks, all by default.
+	// Routing routes them by rules of its own, which can only name those
+	// sinks; without it the global routing rules do not apply.
+	Sinks   []string       `json:"sinks,omitempty"`
+	Routing *RoutingConfig `json:"routing,omitempty"`
+}
+
+// QuotaConfig limits a tenant per UTC day; zero means unlimited.
+type QuotaConfig struct {
+	EventsPerDay   int64 `json:"eventsPerDay,omitempty"`
+	ForwardsPerDay int64 `json:"forwardsPerDay,omitempty"`
+	// StoredBytes bounds the tenant's share of the event store.
+	StoredBytes int64 `json:"storedBytes,omitempty"`
+	// Enforcement is warn (log only), throttle (answer 429 with
+	// Retry-After so the sender redelivers after the reset) or reject
+	// (answer 403 and drop the events). Over the forward quota, events are
+	// recorded but not sent to sinks under both throttle and reject.
+	Enforcement string `json:"enforcement,omitempty"`
+}
+
+func validateTenants(cfgs []TenantConfig, vhosts []VirtualHostConfig) error {
+	var errs []error
+	bound := make(map[string]bool)
+	for _, v := range vhosts {
+		bound[v.Tenant] = true
+	}
+	seen := make(map[string]bool)
+	for i, t := range cfgs {
+		if t.Name == "" {
+			errs = append(errs, fmt.Errorf("tenants[%d].name: required", i))
+		} else if seen[t.Name] {
+			errs = append(errs, fmt.Errorf("tenants[%d].name: duplicate %q", i, t.Name))
+		}
+		seen[t.Name] = true
+		if len(t.Match) == 0 && !bound[t.Name] && !t.Path {
+			errs = append(errs, fmt.Errorf("tenants[%d].match: at least one rule is required unless the tenant has a path or a virtual host is bound to it", i))
+		}
+		if t.Path {
+			if !tenantNameRe.MatchString(t.Name) {
+				errs = append(errs, fmt.Errorf("tenants[%d].name: must be lowercase letters, digits and dashes to be used as a path", i))
+			} else if _, ok := providerRoutes[webhookPath+"/"+t.Name]; ok || t.Name == "mapped" {
+				errs = append(errs, fmt.Errorf("tenants[%d].name: %q is taken by a provider endpoint", i, t.Name))
+			}
+		}
+		if t.Secrets != nil {
+			if !t.Path {
+				errs = append(errs, fmt.Errorf("tenants[%d].secrets: requires path", i))
+			} else if err := t.Secrets.Validate(); err != nil {
+				errs = append(errs, fmt.Errorf("tenants[%d].secrets.%w", i, err))
+			}
+		}
+		if t.Routing != nil {
+			if err := t.Routing.Validate(); err != nil {
+				errs = append(errs, fmt.Errorf("tenants[%d].%w", i, err))
+			}
+		}
+		for j, m := range t.Match {
+			if err := m.Validate(); err != nil {
+				errs = append(errs, fmt.Errorf("tenants[%d].match[%d]: %w", i, j, err))
+			}
+		}
+		if q := t.Quota; q != nil {
+			if q.EventsPerDay < 0 || q.ForwardsPerDay < 0 || q.StoredBytes < 0 {
+				errs = append(errs, fmt.Errorf("tenants[%d].quota: limits must not be negative", i))
+			}
+			switch q.Enforcement {
+			case "", enforceWarn, enforceThrottle, enforceReject:
+			default:
+				errs = append(errs, fmt.Errorf("tenants[%d].quota.enforcement: must be warn, throttle or reject", i))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// TenantUsage is a tenant's consumption in the current window.
+type TenantUsage struct {
+	Tenant      string       `json:"tenant"`
+	WindowStart time.Time    `json:"windowStart"`
+	Events      int64        `json:"events"`
+	Forwards    int64        `json:"forwards"`
+	StoredBytes int64        `json:"storedBytes"`
+	Rejected    int64        `json:"rejected"`
+	Quota       *QuotaConfig `json:"quota,omitempty"`
+}
+
+// Tenants tracks usage against the configured quotas.
+type Tenants struct {
+	cfgs []TenantConfig
+	// outputs are the sinks and routing of tenants that have their own,
+	// set up by Setup.
+	outputs map[string]*tenantOutputs
+
+	mu    sync.Mutex
+	usage map[string]*TenantUsage
+}
+
+type tenantOutputs struct {
+	sinks  []Sink
+	router *Router
+}
+
+// tenants is replaced by main when tenants are configured.
+var tenants = NewTenants(nil)
+
+func NewTenants(cfgs []TenantConfig) *Tenants {
+	t := &Tenants{cfgs: cfgs, usage: make(map[string]*TenantUsage)}
+	for i := range cfgs {
+		t.usage[cfgs[i].Name] = &TenantUsage{Tenant: cfgs[i].Name, Quota: cfgs[i].Quota}
+	}
+	return t
+}
+
+// Of returns the tenant e belongs to, or "".
+func (t *Tenants) Of(e Event) string {
+	for _, cfg := range t.cfgs {
+		for _, m := range cfg.Match {
+			if m.matches(e) {
+				return cfg.Name
+			}
+		}
+	}
+	return ""
+}
+
+// Resolve returns the tenant of e received with ctx: the tenant set by
+// withTenant, then that of the virtual host it arrived on, if bound, then
+// that of the tenant path, or else Of(e).
+func (t *Tenants) Resolve(ctx context.Context, e Event) string {
+	if name, ok := ctx.Value(tenantKey{}).(string); ok {
+		return name
+	}
+	if vh := virtualHost(ctx); vh != nil && vh.Tenant != "" {
+		return vh.Tenant
+	}
+	if tp := tenantPath(ctx); tp != nil {
+		return tp.name
+	}
+	return t.Of(e)
+}
+
+// Setup builds the sinks and routers of the tenants that configure them
+// out of all, the configured sinks.
+func (t *Tenants) Setup(all []Sink) error {
+	t.outputs = make(map[string]*tenantOutputs)
+	for _, cfg := range t.cfgs {
+		if len(cfg.Sinks) == 0 && cfg.Routing == nil {
+			continue
+		}
+		out := &tenantOutputs{sinks: all}
+		if len(cfg.Sinks) > 0 {
+			out.sinks = nil
+			for _, name := range cfg.Sinks {
+				i := slices.IndexFunc(all, func(s Sink) bool { return s.Name() == name })
+				switch {
+				case name == logSinkName:
+					out.sinks = append(out.sinks, logSink{})
+				case i < 0:
+					return fmt.Errorf("tenant %s: unknown sink %q", cfg.Name, name)
+				default:
+					out.sinks = append(out.sinks, all[i])
+				}
+			}
+		}
+		if cfg.Routing != nil {
+			r, err := NewRouter(*cfg.Routing, out.sinks)
+			if err != nil {
+				return fmt.Errorf("tenant %s: %w", cfg.Name, err)
+			}
+			go r.Watch(context.Background())
+			out.router = r
+		}
+		t.outputs[cfg.Name] = out
+	}
+	return nil
+}
+
+// Outputs returns the sinks and router for tenant's events, or the global
+// ones if it has none of its own.
+func (t *Tenants) Outputs(tenant string) ([]Sink, *Router) {
+	if out, ok := t.outputs[tenant]; ok {
+		return out.sinks, out.router
+	}
+	return sinks, router
+}
+
+// current returns the usage of tenant for today, resetting counters at UTC
+// midnight. The caller holds t.mu.
+func (t *Tenants) current(tenant string, now time.Time) *TenantUsage {
+	u := t.usage[tenant]
+	if u == nil {
+		return nil
+	}
+	if day := now.UTC().Truncate(24 * time.Hour); !u.WindowStart.Equal(day) {
+		u.WindowStart, u.Events, u.Forwards, u.Rejected = day, 0, 0, 0
+	}
+	return u
+}
+
+func enforcement(q *QuotaConfig) string {
+	if q.Enforcement == "" {
+		return enforceWarn
+	}
+	return q.Enforcement
+}
+
+// Admit counts events against their tenants' quotas and returns those to
+// dispatch. If any event is over a throttled quota, nothing is counted and
+// retryAfter tells the sender when to redeliver the whole batch.
+func (t *Tenants) Admit(ctx context.Context, events []Event) (admitted []Event, rejected int, retryAfter time.Duration) {
+	if len(t.cfgs) == 0 {
+		return events, 0, 0
+	}
+	now := time.Now()
+	owners := make([]string, len(events))
+	for i, e := range events {
+		owners[i] = t.Resolve(ctx, e)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	over := func(u *TenantUsage, extra int64) bool {
+		q := u.Quota
+		return (q.EventsPerDay > 0 && u.Events+extra >= q.EventsPerDay) ||
+			(q.StoredBytes > 0 && u.StoredBytes >= q.StoredBytes)
+	}
+
+	pending := make(map[string]int64)
+	for _, owner := range owners {
+		u := t.current(owner, now)
+		if u == nil || u.Quota == nil {
+			continue
+		}
+		if over(u, pending[owner]) && enforcement(u.Quota) == enforceThrottle {
+			return nil, 0, u.WindowStart.Add(24 * time.Hour).Sub(now)
+		}
+		pending[owner]++
+	}
+
+	for i, e := range events {
+		u := t.current(owners[i], now)
+		if u != nil && u.Quota != nil && over(u, 0) {
+			if enforcement(u.Quota) == enforceReject {
+				u.Rejected++
+				rejected++
+				log.Printf("Tenant %s over quota, rejecting %s:%s", u.Tenant, e.Repository, e.Tag)
+				continue
+			}
+			log.Printf("Tenant %s over quota (%d events today, %d bytes stored)", u.Tenant, u.Events, u.StoredBytes)
+		}
+		if u != nil {
+			u.Events++
+		}
+		admitted = append(admitted, e)
+	}
+	return admitted, rejected, 0
+}
+
+// Forward counts a delivery to the sinks for tenant and reports whether it
+// may go ahead.
+func (t *Tenants) Forward(tenant string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	u := t.current(tenant, time.Now())
+	if u == nil {
+		return true
+	}
+	if q := u.Quota; q != nil && q.ForwardsPerDay > 0 && u.Forwards >= q.ForwardsPerDay {
+		if enforcement(q) != enforceWarn {
+			return false
+		}
+		log.Printf("Tenant %s over forward quota (%d today)", tenant, u.Forwards)
+	}
+	u.Forwards++
+	return true
+}
+
+// Stored adjusts the bytes tenant holds in the event store.
+func (t *Tenants) Stored(tenant string, delta int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if u := t.usage[tenant]; u != nil {
+		u.StoredBytes += delta
+	}
+}
+
+// usageHandler serves GET /admin/tenants, optionally filtered with
+// ?tenant=.
+func (t *Tenants) usageHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("tenant")
+	now := time.Now()
+
+	t.mu.Lock()
+	out := []TenantUsage{}
+	for tenant := range t.usage {
+		if name == "" || name == tenant {
+			out = append(out, *t.current(tenant, now))
+		}
+	}
+	t.mu.Unlock()
+	if name != "" && len(out) == 0 {
+		http.Error(w, "Unknown tenant", http.StatusNotFound)
+		return
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Tenant < out[j].Tenant })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(out)
+}
+
+type tenantKey struct{}
+
+// withTenant fixes the tenant Resolve returns for ctx, for events handled
+// outside the request they arrived with.
+func withTenant(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, name)
+}
+
+// tenantPathConfig is a tenant served below /webhook/<name>.
+type tenantPathConfig struct {
+	name    string
+	secrets *SecretSet
+}
+
+type tenantPathKey struct{}
+
+// tenantPath returns the tenant whose path the request was received on, or
+// nil.
+func tenantPath(ctx context.Context) *tenantPathConfig {
+	tp, _ := ctx.Value(tenantPathKey{}).(*tenantPathConfig)
+	return tp
+}
+
+// tenantRouter serves /webhook/<tenant>/... as /webhook/..., recording the
+// tenant in the request context.
+type tenantRouter struct {
+	next    http.Handler
+	tenants map[string]*tenantPathConfig
+}
+
+func newTenantRouter(next http.Handler, tenants map[string]*tenantPathConfig) *tenantRouter {
+	return &tenantRouter{next: next, tenants: tenants}
+}
+
+func (t *tenantRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rest, ok := strings.CutPrefix(r.URL.Path, webhookPath+"/")
+	if !ok {
+		t.next.ServeHTTP(w, r)
+		return
+	}
+	name, sub, _ := strings.Cut(rest, "/")
+	tp := t.tenants[name]
+	if tp == nil {
+		t.next.ServeHTTP(w, r)
+		return
+	}
+	path := webhookPath
+	if sub != "" {
+		path += "/" + sub
+	}
+	r2 := r.WithContext(context.WithValue(r.Context(), tenantPathKey{}, tp))
+	r2.URL = new(url.URL)
+	*r2.URL = *r.URL
+	r2.URL.Path, r2.URL.RawPath = path, ""
+
+	provider := "unknown"
+	if p, ok := providerRoutes[path]; ok {
+		provider = p.Name()
+	}
+	sw := &statusWriter{ResponseWriter: w}
+	t.next.ServeHTTP(sw, r2)
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	webhookTenantRequests.add(1, tp.name, provider, strconv.Itoa(sw.status))
+}
+
+// requestSecrets returns the secrets of the tenant whose path r was
+// received on, if it has its own, or else fallback.
+func requestSecrets(r *http.Request, fallback *SecretSet) *SecretSet {
+	if tp := tenantPath(r.Context()); tp != nil && tp.secrets != nil {
+		return tp.secrets
+	}
+	return fallback
+}
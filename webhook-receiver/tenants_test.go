@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func tenantEvents(repos ...string) []Event {
+	var out []Event
+	for _, r := range repos {
+		out = append(out, Event{Provider: "dockerhub", Type: EventPush, Repository: r, Tag: "v1"})
+	}
+	return out
+}
+
+func TestTenantsAdmit(t *testing.T) {
+	tests := []struct {
+		name         string
+		quota        QuotaConfig
+		stored       int64
+		batches      [][]Event
+		wantAdmitted []int
+		wantRejected []int
+		wantRetry    []bool
+		wantEvents   int64
+	}{
+		{
+			name:         "warn admits over quota",
+			quota:        QuotaConfig{EventsPerDay: 2},
+			batches:      [][]Event{tenantEvents("team-a/x", "team-a/y", "team-a/z")},
+			wantAdmitted: []int{3}, wantRejected: []int{0}, wantRetry: []bool{false},
+			wantEvents: 3,
+		},
+		{
+			name:         "reject drops events over quota",
+			quota:        QuotaConfig{EventsPerDay: 2, Enforcement: enforceReject},
+			batches:      [][]Event{tenantEvents("team-a/x", "team-a/y", "team-a/z"), tenantEvents("team-a/x")},
+			wantAdmitted: []int{2, 0}, wantRejected: []int{1, 1}, wantRetry: []bool{false, false},
+			wantEvents: 2,
+		},
+		{
+			name:         "throttle refuses the batch that crosses the quota",
+			quota:        QuotaConfig{EventsPerDay: 2, Enforcement: enforceThrottle},
+			batches:      [][]Event{tenantEvents("team-a/x", "team-a/y"), tenantEvents("team-a/z")},
+			wantAdmitted: []int{2, 0}, wantRejected: []int{0, 0}, wantRetry: []bool{false, true},
+			wantEvents: 2,
+		},
+		{
+			name:         "throttle counts nothing from a refused batch",
+			quota:        QuotaConfig{EventsPerDay: 2, Enforcement: enforceThrottle},
+			batches:      [][]Event{tenantEvents("team-a/x", "team-a/y", "team-a/z")},
+			wantAdmitted: []int{0}, wantRejected: []int{0}, wantRetry: []bool{true},
+			wantEvents: 0,
+		},
+		{
+			name:         "stored bytes quota",
+			quota:        QuotaConfig{StoredBytes: 100, Enforcement: enforceReject},
+			stored:       100,
+			batches:      [][]Event{tenantEvents("team-a/x")},
+			wantAdmitted: []int{0}, wantRejected: []int{1}, wantRetry: []bool{false},
+			wantEvents: 0,
+		},
+		{
+			name:         "other tenants are not counted",
+			quota:        QuotaConfig{EventsPerDay: 1, Enforcement: enforceReject},
+			batches:      [][]Event{tenantEvents("team-b/x", "team-b/y", "team-a/x")},
+			wantAdmitted: []int{3}, wantRejected: []int{0}, wantRetry: []bool{false},
+			wantEvents: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quota := tt.quota
+			ts := NewTenants([]TenantConfig{{Name: "team-a", Match: []EventMatch{{Repository: "team-a/*"}}, Quota: &quota}})
+			ts.Stored("team-a", tt.stored)
+			for i, batch := range tt.batches {
+				admitted, rejected, retry := ts.Admit(context.Background(), batch)
+				if len(admitted) != tt.wantAdmitted[i] || rejected != tt.wantRejected[i] {
+					t.Errorf("batch %d: admitted %d, rejected %d, want %d, %d", i, len(admitted), rejected, tt.wantAdmitted[i], tt.wantRejected[i])
+				}
+				if (retry > 0) != tt.wantRetry[i] || retry > 24*time.Hour {
+					t.Errorf("batch %d: retryAfter = %s, want retry %v", i, retry, tt.wantRetry[i])
+				}
+			}
+			if got := ts.usage["team-a"].Events; got != tt.wantEvents {
+				t.Errorf("events counted = %d, want %d", got, tt.wantEvents)
+			}
+		})
+	}
+}
+
+func TestTenantsForward(t *testing.T) {
+	for _, tt := range []struct {
+		enforcement string
+		want        []bool
+	}{
+		{enforceWarn, []bool{true, true}},
+		{enforceThrottle, []bool{true, false}},
+		{enforceReject, []bool{true, false}},
+	} {
+		t.Run(tt.enforcement, func(t *testing.T) {
+			ts := NewTenants([]TenantConfig{{Name: "team-a", Match: []EventMatch{{Repository: "team-a/*"}}, Quota: &QuotaConfig{ForwardsPerDay: 1, Enforcement: tt.enforcement}}})
+			for i, want := range tt.want {
+				if got := ts.Forward("team-a"); got != want {
+					t.Errorf("forward %d = %v, want %v", i, got, want)
+				}
+			}
+			if !ts.Forward("") {
+				t.Error("forward without a tenant was refused")
+			}
+		})
+	}
+}
+
+func TestTenantsDayRollover(t *testing.T) {
+	ts := NewTenants([]TenantConfig{{Name: "team-a", Match: []EventMatch{{Repository: "team-a/*"}}, Quota: &QuotaConfig{EventsPerDay: 1, ForwardsPerDay: 1, Enforcement: enforceReject}}})
+	ts.Stored("team-a", 10)
+	if admitted, _, _ := ts.Admit(context.Background(), tenantEvents("team-a/x")); len(admitted) != 1 || !ts.Forward("team-a") {
+		t.Fatal("first event of the day was not admitted")
+	}
+	if admitted, rejected, _ := ts.Admit(context.Background(), tenantEvents("team-a/x")); len(admitted) != 0 || rejected != 1 || ts.Forward("team-a") {
+		t.Fatal("second event of the day was admitted")
+	}
+
+	// Move the window to yesterday, as if UTC midnight had passed.
+	u := ts.usage["team-a"]
+	u.WindowStart = u.WindowStart.Add(-24 * time.Hour)
+	if admitted, _, _ := ts.Admit(context.Background(), tenantEvents("team-a/x")); len(admitted) != 1 || !ts.Forward("team-a") {
+		t.Fatal("event after the day rolled over was not admitted")
+	}
+	if u.Events != 1 || u.Forwards != 1 || u.Rejected != 0 || u.StoredBytes != 10 {
+		t.Errorf("usage after rollover = %+v, want 1 event, 1 forward, 0 rejected, 10 bytes", *u)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const defaultServiceName = "kargo-webhook-receiver"
+
+// TracingConfig exports OpenTelemetry spans over OTLP/HTTP. Trace context
+// is propagated in W3C traceparent headers whether or not spans are
+// exported, so a registry's trace carries through to the sinks.
+type TracingConfig struct {
+	// Endpoint is the collector's traces URL, e.g.
+	// http://otel-collector:4318/v1/traces.
+	Endpoint    string            `json:"endpoint"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	ServiceName string            `json:"serviceName,omitempty"`
+	// SampleRatio is the fraction of new traces recorded, 1 by default.
+	// Traces started upstream follow the sender's sampling decision.
+	SampleRatio *float64 `json:"sampleRatio,omitempty"`
+}
+
+func (c *TracingConfig) Validate() error {
+	var errs []error
+	if u, err := url.Parse(c.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, errors.New("tracing.endpoint: must be an http or https URL"))
+	}
+	if r := c.SampleRatio; r != nil && (*r < 0 || *r > 1) {
+		errs = append(errs, errors.New("tracing.sampleRatio: must be between 0 and 1"))
+	}
+	return errors.Join(errs...)
+}
+
+// tracer resolves against the global provider when used, so it picks up
+// setupTracing's provider and is a no-op without one.
+var tracer = otel.Tracer("kargo-webhook-receiver")
+
+func init() {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+}
+
+// setupTracing installs an exporting tracer provider. The returned function
+// flushes buffered spans.
+func setupTracing(ctx context.Context, cfg TracingConfig) (func(context.Context) error, error) {
+	exp, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(cfg.Endpoint), otlptracehttp.WithHeaders(cfg.Headers))
+	if err != nil {
+		return nil, err
+	}
+	name, ratio := cfg.ServiceName, 1.0
+	if name == "" {
+		name = defaultServiceName
+	}
+	if cfg.SampleRatio != nil {
+		ratio = *cfg.SampleRatio
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", name))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// traceProvider starts the server span for a provider's endpoint, as a
+// child of the sender's trace if it sent one.
+func traceProvider(provider string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, "webhook "+provider,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("url.path", r.URL.Path),
+				attribute.String("webhook.provider", provider),
+			))
+		defer span.End()
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		span.SetAttributes(attribute.Int("http.response.status_code", sw.status))
+		if sw.status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(sw.status))
+		}
+	})
+}
+
+// tracedTransport records a client span for each outbound request and
+// passes the trace context on in its headers.
+type tracedTransport struct {
+	base http.RoundTripper
+}
+
+// outboundTransport is used by every client the receiver calls out with.
+var outboundTransport http.RoundTripper = tracedTransport{base: http.DefaultTransport}
+
+// outboundClient replaces http.DefaultClient for calls without a
+// client-level timeout.
+var outboundClient = &http.Client{Transport: outboundTransport}
+
+func (t tracedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := tracer.Start(req.Context(), "HTTP "+req.Method+" "+req.URL.Host,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("server.address", req.URL.Host),
+			attribute.String("url.path", req.URL.Path),
+		))
+	defer span.End()
+	// RoundTrippers must not modify the caller's request.
+	req = req.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= 400 {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+	return resp, nil
+}
+
+// startSpan starts an internal span; end it with endSpan.
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan records err, if any, and ends span.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// traceID returns the trace ctx belongs to, for log correlation.
+func traceID(ctx context.Context) (string, bool) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return "", false
+	}
+	return sc.TraceID().String(), true
+}
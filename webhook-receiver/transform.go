@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// transformFuncs are available to payload templates in addition to the
+// text/template builtins. json is the one to reach for: it encodes any
+// value, quoting strings, so fields land in the output as valid JSON.
+var transformFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"join":       strings.Join,
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"replace":    strings.ReplaceAll,
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"default": func(def string, s string) string {
+		if s == "" {
+			return def
+		}
+		return s
+	},
+}
+
+// TransformConfig reshapes the payload a sink sends with a text/template
+// executed with the Event, instead of the event's own JSON. For example,
+// a Slack message with blocks:
+//
+//	{"blocks": [{"type": "section", "text": {"type": "mrkdwn",
+//	  "text": {{json (printf "*%s* pushed `%s:%s`" .Provider .Repository .Tag)}}}}]}
+type TransformConfig struct {
+	// Template is the template inline; TemplateFile reads it from a file.
+	Template     string `json:"template,omitempty"`
+	TemplateFile string `json:"templateFile,omitempty"`
+	// ContentType of the output, application/json by default. JSON output
+	// is checked before it is sent, so a template that renders invalid
+	// JSON fails the delivery instead of reaching the endpoint.
+	ContentType string `json:"contentType,omitempty"`
+
+	tmpl *template.Template
+}
+
+func (c *TransformConfig) Validate() error {
+	if (c.Template == "") == (c.TemplateFile == "") {
+		return errors.New("exactly one of template and templateFile is required")
+	}
+	text := c.Template
+	if c.TemplateFile != "" {
+		b, err := os.ReadFile(c.TemplateFile)
+		if err != nil {
+			return fmt.Errorf("templateFile: %w", err)
+		}
+		text = string(b)
+	}
+	var err error
+	if c.tmpl, err = template.New("transform").Funcs(transformFuncs).Parse(text); err != nil {
+		return err
+	}
+	// Rendering a sample catches references to fields Event lacks.
+	if _, err := c.Render(Event{Provider: "example", Type: "push", Repository: "example/app", Tag: "v1"}); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *TransformConfig) contentType() string {
+	if c.ContentType == "" {
+		return "application/json"
+	}
+	return c.ContentType
+}
+
+// Render executes the template for e.
+func (c *TransformConfig) Render(e Event) ([]byte, error) {
+	var b bytes.Buffer
+	if err := c.tmpl.Execute(&b, e); err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(c.contentType(), "json") && !json.Valid(b.Bytes()) {
+		return nil, fmt.Errorf("output is not valid JSON: %.200s", b.String())
+	}
+	return b.Bytes(), nil
+}
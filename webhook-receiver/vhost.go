@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// VirtualHostConfig lets one deployment serve several ingress hostnames.
+// Requests are matched on the Host header.
+type VirtualHostConfig struct {
+	// Host is the hostname without port, e.g. hooks.team-a.example.com.
+	Host string `json:"host"`
+	// PathPrefix replaces server.pathPrefix for requests to this host.
+	PathPrefix string `json:"pathPrefix,omitempty"`
+	// Tenant attributes every event received on this host to the named
+	// tenant, ahead of the tenants' match rules.
+	Tenant string `json:"tenant,omitempty"`
+	// BaseURL is the external URL links for this host are built from. It
+	// defaults to https://<host><pathPrefix>.
+	BaseURL string `json:"baseURL,omitempty"`
+}
+
+func (c *VirtualHostConfig) baseURL() string {
+	if c.BaseURL != "" {
+		return strings.TrimSuffix(c.BaseURL, "/")
+	}
+	return "https://" + c.Host + c.PathPrefix
+}
+
+func validateVirtualHosts(cfgs []VirtualHostConfig, tenantCfgs []TenantConfig) error {
+	var errs []error
+	known := make(map[string]bool)
+	for _, t := range tenantCfgs {
+		known[t.Name] = true
+	}
+	seen := make(map[string]bool)
+	for i, v := range cfgs {
+		prefix := fmt.Sprintf("virtualHosts[%d]", i)
+		host := strings.ToLower(v.Host)
+		switch {
+		case host == "":
+			errs = append(errs, fmt.Errorf("%s.host: required", prefix))
+		case strings.ContainsAny(host, ":/"):
+			errs = append(errs, fmt.Errorf("%s.host: must be a hostname without scheme or port", prefix))
+		case seen[host]:
+			errs = append(errs, fmt.Errorf("%s.host: duplicate %q", prefix, v.Host))
+		}
+		seen[host] = true
+		if v.PathPrefix != "" && (!strings.HasPrefix(v.PathPrefix, "/") || strings.HasSuffix(v.PathPrefix, "/")) {
+			errs = append(errs, fmt.Errorf("%s.pathPrefix: must start and must not end with /", prefix))
+		}
+		if v.Tenant != "" && !known[v.Tenant] {
+			errs = append(errs, fmt.Errorf("%s.tenant: unknown tenant %q", prefix, v.Tenant))
+		}
+		if v.BaseURL != "" {
+			if err := validateURL(v.BaseURL); err != nil {
+				errs = append(errs, fmt.Errorf("%s.baseURL: %w", prefix, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+type virtualHostKey struct{}
+
+// virtualHost returns the virtual host the request was received on, or nil
+// when it matched none.
+func virtualHost(ctx context.Context) *VirtualHostConfig {
+	v, _ := ctx.Value(virtualHostKey{}).(*VirtualHostConfig)
+	return v
+}
+
+// vhostRouter strips the path prefix of the matching virtual host, or the
+// server-wide prefix for unknown hosts, and records the host in the request
+// context.
+type vhostRouter struct {
+	next   http.Handler
+	prefix string
+	hosts  map[string]*VirtualHostConfig
+}
+
+func newVHostRouter(next http.Handler, prefix string, cfgs []VirtualHostConfig) *vhostRouter {
+	v := &vhostRouter{next: next, prefix: prefix, hosts: make(map[string]*VirtualHostConfig)}
+	for i := range cfgs {
+		v.hosts[strings.ToLower(cfgs[i].Host)] = &cfgs[i]
+	}
+	return v
+}
+
+func (v *vhostRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	prefix := v.prefix
+	if vh := v.hosts[strings.ToLower(host)]; vh != nil {
+		prefix = vh.PathPrefix
+		r = r.WithContext(context.WithValue(r.Context(), virtualHostKey{}, vh))
+	}
+	if prefix == "" {
+		v.next.ServeHTTP(w, r)
+		return
+	}
+	http.StripPrefix(prefix, v.next).ServeHTTP(w, r)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Call budgets for downstream calls. The budget bounds the derived context
+// deadline and is what the watchdog measures against.
+const (
+	budgetSink  = defaultSinkTimeout
+	budgetOFREP = 2 * time.Second
+	budgetJWKS  = 5 * time.Second
+)
+
+// watchdog counts downstream calls that ran past their budget, by call site.
+var watchdog = &callWatchdog{overruns: make(map[string]int64)}
+
+type callWatchdog struct {
+	mu       sync.Mutex
+	overruns map[string]int64
+}
+
+// start derives a context bounded by budget from ctx. The returned done
+// func cancels it and reports an overrun if the call took longer than the
+// budget or the parent deadline expired first.
+func (w *callWatchdog) start(ctx context.Context, site string, budget time.Duration) (context.Context, func()) {
+	ctx, cancel := context.WithTimeout(ctx, budget)
+	began := time.Now()
+	return ctx, func() {
+		took := time.Since(began)
+		if took >= budget || ctx.Err() == context.DeadlineExceeded {
+			w.mu.Lock()
+			w.overruns[site]++
+			w.mu.Unlock()
+			log.Printf("Watchdog: %s took %v (budget %v)", site, took.Round(time.Millisecond), budget)
+		}
+		cancel()
+	}
+}
+
+// Overruns returns a copy of the overrun counters.
+func (w *callWatchdog) Overruns() map[string]int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	out := make(map[string]int64, len(w.overruns))
+	for k, v := range w.overruns {
+		out[k] = v
+	}
+	return out
+}
@@ -3,41 +3,85 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
+	"text/template"
+	"text/template/parse"
 	"time"
+	"unicode/utf8"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/yaml"
 	"k8s.io/klog/v2"
 )
 
+type ObjectMeta struct {
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+type Subscription struct {
+	Stage  string   `json:"stage"`
+	Events []string `json:"events"`
+}
+
+type SlackMessageSpec struct {
+	SlackChannel string `json:"slackChannel"`
+	Message      string `json:"message"`
+	// Layout names a MessageTemplate the message extends. The message's own
+	// {{define}} blocks override the layout's {{block}}s.
+	Layout      string `json:"layout,omitempty"`
+	Team        string `json:"team,omitempty"`
+	ChannelType string `json:"channelType,omitempty"`
+	// Timezone (IANA name) and Locale control how times and durations are
+	// rendered for this channel. They default to UTC and en-US.
+	Timezone      string         `json:"timezone,omitempty"`
+	Locale        string         `json:"locale,omitempty"`
+	Subscriptions []Subscription `json:"subscriptions,omitempty"`
+	Shadow        *ShadowSpec    `json:"shadow,omitempty"`
+}
+
+const (
+	ShadowPost = "post"
+	ShadowLog  = "log"
+)
+
+// ShadowSpec sends a copy of every notification to a second channel, or
+// only logs it, so that template and policy changes can be previewed
+// before they reach the primary channel. Layout and Message, when set,
+// replace the primary's for the shadow copy only.
+type ShadowSpec struct {
+	Channel string `json:"channel,omitempty"`
+	Mode    string `json:"mode,omitempty"`
+	Layout  string `json:"layout,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
 type MockKargoMessage struct {
-	APIVersion string `json:"apiVersion"`
-	Kind       string `json:"kind"`
-	Metadata   struct {
-		Name      string            `json:"name"`
-		Namespace string            `json:"namespace"`
-		Labels    map[string]string `json:"labels,omitempty"`
-	} `json:"metadata"`
-	Spec struct {
-		SlackChannel string `json:"slackChannel"`
-		Message      string `json:"message"`
-		Team         string `json:"team,omitempty"`
-		ChannelType  string `json:"channelType,omitempty"`
-		Subscriptions []struct {
-			Stage string `json:"stage"`
-			Events []string `json:"events"`
-		} `json:"subscriptions,omitempty"`
-	} `json:"spec"`
-	Status struct {
+	APIVersion string           `json:"apiVersion"`
+	Kind       string           `json:"kind"`
+	Metadata   ObjectMeta       `json:"metadata"`
+	Spec       SlackMessageSpec `json:"spec"`
+	Status     struct {
 		CreatedAt time.Time `json:"createdAt,omitempty"`
 		State     string    `json:"state,omitempty"`
 	} `json:"status,omitempty"`
@@ -47,15 +91,15 @@ type WebhookRequest struct {
 	APIVersion string `json:"apiVersion"`
 	Kind       string `json:"kind"`
 	Request    struct {
-		UID             string `json:"uid"`
-		DryRun          bool   `json:"dryRun"`
-		UserInfo        any    `json:"userInfo"`
-		Object          any    `json:"object"`
-		OldObject       any    `json:"oldObject,omitempty"`
-		Resource        struct {
-			Group     string `json:"group"`
-			Version   string `json:"version"`
-			Resource  string `json:"resource"`
+		UID       string `json:"uid"`
+		DryRun    bool   `json:"dryRun"`
+		UserInfo  any    `json:"userInfo"`
+		Object    any    `json:"object"`
+		OldObject any    `json:"oldObject,omitempty"`
+		Resource  struct {
+			Group    string `json:"group"`
+			Version  string `json:"version"`
+			Resource string `json:"resource"`
 		} `json:"resource"`
 		SubResource string `json:"subResource"`
 	} `json:"request"`
@@ -65,11 +109,12 @@ type WebhookResponse struct {
 	APIVersion string `json:"apiVersion"`
 	Kind       string `json:"kind"`
 	Response   struct {
-		UID           string `json:"uid"`
-		Allowed       bool   `json:"allowed"`
-		Patch         []byte `json:"patch,omitempty"`
-		PatchType     string `json:"patchType,omitempty"`
-		Result        any    `json:"result,omitempty"`
+		UID       string   `json:"uid"`
+		Allowed   bool     `json:"allowed"`
+		Patch     []byte   `json:"patch,omitempty"`
+		PatchType string   `json:"patchType,omitempty"`
+		Result    any      `json:"result,omitempty"`
+		Warnings  []string `json:"warnings,omitempty"`
 	} `json:"response"`
 }
 
@@ -78,6 +123,114 @@ type MockSlackClient struct {
 	channels       map[string]bool
 	conversations  map[string]string
 	lastChannelReq string
+	posts          []SlackPost
+	// restricted makes conversations.create fail as in Grid orgs where
+	// only admins may create channels.
+	restricted bool
+	// failNext makes the next n CreateConversation calls fail.
+	failNext int
+}
+
+type SlackPost struct {
+	Channel  string
+	Text     string
+	Team     string
+	Metadata *SlackMetadata
+}
+
+// SlackMetadata is the message metadata block accepted by chat.postMessage.
+// It travels with the message and comes back on interaction payloads and
+// conversations.history, so handlers can correlate without parsing text.
+type SlackMetadata struct {
+	EventType    string         `json:"event_type"`
+	EventPayload map[string]any `json:"event_payload"`
+}
+
+const notificationEventType = "kargo_notification"
+
+type correlationKey struct{}
+
+// WithCorrelationID attaches the ID of the event that triggered a
+// notification to ctx.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationKey{}, id)
+}
+
+func correlationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return id
+}
+
+type stageKey struct{}
+
+// WithStage attaches the Kargo Stage a notification is about to ctx.
+func WithStage(ctx context.Context, stage string) context.Context {
+	return context.WithValue(ctx, stageKey{}, stage)
+}
+
+func stageFrom(ctx context.Context) string {
+	stage, _ := ctx.Value(stageKey{}).(string)
+	return stage
+}
+
+// notificationMetadata builds the metadata for a notification about msg.
+// pendingObjectsHeader carries a hint from CI listing the objects of the
+// bundle being applied, as comma-separated Kind/namespace/name. GitOps
+// tools apply in no guaranteed order, so a reference to one of them that
+// does not exist yet is admitted with a warning instead of rejected. The
+// API server does not pass client headers on; the hint reaches reviews
+// that CI sends to the webhook directly.
+const pendingObjectsHeader = "X-Kargo-Pending-Objects"
+
+type pendingKey struct{}
+
+// WithPendingObjects attaches the Kind/namespace/name of objects being
+// applied alongside the one under review to ctx.
+func WithPendingObjects(ctx context.Context, refs []string) context.Context {
+	pending := make(map[string]bool, len(refs))
+	for _, r := range refs {
+		pending[r] = true
+	}
+	return context.WithValue(ctx, pendingKey{}, pending)
+}
+
+func pendingObject(ctx context.Context, kind, namespace, name string) bool {
+	pending, _ := ctx.Value(pendingKey{}).(map[string]bool)
+	return pending[kind+"/"+namespace+"/"+name]
+}
+
+// parsePendingObjects splits a pendingObjectsHeader value, dropping
+// malformed entries.
+func parsePendingObjects(h string) []string {
+	var refs []string
+	for _, r := range strings.Split(h, ",") {
+		r = strings.TrimSpace(r)
+		if parts := strings.Split(r, "/"); len(parts) == 3 && parts[0] != "" && parts[1] != "" && parts[2] != "" {
+			refs = append(refs, r)
+		}
+	}
+	return refs
+}
+
+func notificationMetadata(ctx context.Context, msg *MockKargoMessage, shadow bool) *SlackMetadata {
+	return &SlackMetadata{
+		EventType: notificationEventType,
+		EventPayload: map[string]any{
+			"correlation_id": correlationID(ctx),
+			"message":        msg.Metadata.Namespace + "/" + msg.Metadata.Name,
+			"shadow":         shadow,
+		},
+	}
+}
+
+// CorrelationFromMetadata returns the correlation ID carried by metadata
+// read back from Slack, if it belongs to one of our notifications.
+func CorrelationFromMetadata(meta *SlackMetadata) (string, bool) {
+	if meta == nil || meta.EventType != notificationEventType {
+		return "", false
+	}
+	id, ok := meta.EventPayload["correlation_id"].(string)
+	return id, ok && id != ""
 }
 
 func NewMockSlackClient() *MockSlackClient {
@@ -87,16 +240,88 @@ func NewMockSlackClient() *MockSlackClient {
 	}
 }
 
-func (m *MockSlackClient) CreateConversation(ctx context.Context, name, isPrivate bool) (string, error) {
+// CreateConversation mirrors conversations.create. On Enterprise Grid an
+// org-wide installation must name the workspace with teamID.
+func (m *MockSlackClient) CreateConversation(ctx context.Context, name string, isPrivate bool, teamID string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.failNext > 0 {
+		m.failNext--
+		return "", fmt.Errorf("slack API unavailable")
+	}
+	if m.restricted {
+		return "", fmt.Errorf("restricted_action")
+	}
+	return m.create(name, isPrivate, teamID), nil
+}
+
+// AdminCreateConversation mirrors admin.conversations.create, which Grid
+// orgs use when channel creation is restricted to admins.
+func (m *MockSlackClient) AdminCreateConversation(ctx context.Context, name string, isPrivate bool, teamID string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	
+	if m.failNext > 0 {
+		m.failNext--
+		return "", fmt.Errorf("slack API unavailable")
+	}
+	return m.create(name, isPrivate, teamID), nil
+}
+
+func (m *MockSlackClient) create(name string, isPrivate bool, teamID string) string {
 	channelID := fmt.Sprintf("C%08x", len(m.channels))
 	m.channels[channelID] = isPrivate
+	m.conversations[teamID+"/"+name] = channelID
 	m.lastChannelReq = name
-	
-	klog.Infof("MockSlack: Created channel %s (ID: %s, private: %v)", name, channelID, isPrivate)
-	return channelID, nil
+
+	klog.Infof("MockSlack: Created channel %s (ID: %s, team: %q, private: %v)", name, channelID, teamID, isPrivate)
+	return channelID
+}
+
+// FindConversation looks a channel up by name in each of teamIDs in turn,
+// as conversations.list does when called per workspace of a Grid org.
+func (m *MockSlackClient) FindConversation(ctx context.Context, name string, teamIDs []string) (string, string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", "", err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, team := range teamIDs {
+		if id, ok := m.conversations[team+"/"+name]; ok {
+			return id, team, nil
+		}
+	}
+	return "", "", nil
+}
+
+// ConversationPrivate mirrors the is_private field of conversations.info.
+func (m *MockSlackClient) ConversationPrivate(ctx context.Context, channelID string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	private, ok := m.channels[channelID]
+	if !ok {
+		return false, fmt.Errorf("channel_not_found")
+	}
+	return private, nil
+}
+
+func (m *MockSlackClient) PostMessage(ctx context.Context, channel, text, teamID string, meta *SlackMetadata) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.posts = append(m.posts, SlackPost{Channel: channel, Text: text, Team: teamID, Metadata: meta})
+	return nil
 }
 
 func (m *MockSlackClient) ChannelExists(channelID string) bool {
@@ -106,128 +331,2351 @@ func (m *MockSlackClient) ChannelExists(channelID string) bool {
 	return exists
 }
 
-type Validator struct {
-	slackClient *MockSlackClient
-	timeout     time.Duration
+type IntentState string
+
+const (
+	IntentPending   IntentState = "Pending"
+	IntentSucceeded IntentState = "Succeeded"
+	IntentFailed    IntentState = "Failed"
+)
+
+// SlackIntent is a Slack side effect recorded at admission time. The outbox
+// worker carries it out later, so admission never waits on the Slack API.
+type SlackIntent struct {
+	Key         string      `json:"key"`
+	Channel     string      `json:"channel"`
+	Team        string      `json:"team,omitempty"`
+	Private     bool        `json:"private"`
+	State       IntentState `json:"state"`
+	ChannelID   string      `json:"channelID,omitempty"`
+	Attempts    int         `json:"attempts"`
+	LastError   string      `json:"lastError,omitempty"`
+	NextAttempt time.Time   `json:"nextAttempt"`
+	UpdatedAt   time.Time   `json:"updatedAt"`
+
+	inFlight bool
 }
 
-func NewValidator(slackClient *MockSlackClient) *Validator {
-	return &Validator{
-		slackClient: slackClient,
-		timeout:     30 * time.Second,
+// Outbox holds SlackIntents keyed by SlackMessage namespace/name. Enqueueing
+// the same intent twice is a no-op, which keeps admission idempotent across
+// re-applies and API server retries.
+type Outbox struct {
+	mu      sync.Mutex
+	intents map[string]*SlackIntent
+	notify  chan struct{}
+	deliver func(ctx context.Context, intent SlackIntent) (string, error)
+
+	maxAttempts int
+	baseBackoff time.Duration
+}
+
+func NewOutbox(deliver func(ctx context.Context, intent SlackIntent) (string, error)) *Outbox {
+	return &Outbox{
+		intents:     make(map[string]*SlackIntent),
+		notify:      make(chan struct{}, 1),
+		deliver:     deliver,
+		maxAttempts: 5,
+		baseBackoff: time.Second,
 	}
 }
 
-func (v *Validator) ValidateMessage(ctx context.Context, msg *MockKargoMessage) (*WebhookResponse, error) {
-	resp := &WebhookResponse{
-		APIVersion: "admission.k8s.io/v1",
-		Kind:       "AdmissionReview",
+func (o *Outbox) Enqueue(key, channel, team string, private bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if cur, ok := o.intents[key]; ok && cur.Channel == channel && cur.Team == team &&
+		cur.Private == private && cur.State != IntentFailed {
+		return
+	}
+	o.intents[key] = &SlackIntent{
+		Key:         key,
+		Channel:     channel,
+		Team:        team,
+		Private:     private,
+		State:       IntentPending,
+		NextAttempt: time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	select {
+	case o.notify <- struct{}{}:
+	default:
 	}
+}
 
-	resp.Response.Allowed = true
-	resp.Response.UID = fmt.Sprintf("test-uid-%d", time.Now().UnixNano())
+func (o *Outbox) Status(key string) (SlackIntent, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	intent, ok := o.intents[key]
+	if !ok {
+		return SlackIntent{}, false
+	}
+	return *intent, true
+}
+
+// ProcessPending attempts every pending intent that is due and returns the
+// number of attempts made.
+func (o *Outbox) ProcessPending(ctx context.Context) int {
+	o.mu.Lock()
+	var due []SlackIntent
+	now := time.Now()
+	for _, intent := range o.intents {
+		if intent.State == IntentPending && !intent.inFlight && !now.Before(intent.NextAttempt) {
+			intent.inFlight = true
+			due = append(due, *intent)
+		}
+	}
+	o.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, intent := range due {
+		wg.Add(1)
+		go func(intent SlackIntent) {
+			defer wg.Done()
+			o.attempt(ctx, intent)
+		}(intent)
+	}
+	wg.Wait()
+	return len(due)
+}
 
-	asyncCtx, cancel := context.WithTimeout(ctx, v.timeout)
-	defer cancel()
+func (o *Outbox) attempt(ctx context.Context, intent SlackIntent) {
+	channelID, err := o.deliver(ctx, intent)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	cur := o.intents[intent.Key]
+	if cur.Channel != intent.Channel || cur.Team != intent.Team || cur.Private != intent.Private {
+		// Replaced by a newer intent while in flight; that one runs next.
+		return
+	}
+	cur.inFlight = false
+	cur.Attempts++
+	cur.UpdatedAt = time.Now()
+	switch {
+	case err == nil:
+		cur.State = IntentSucceeded
+		cur.ChannelID = channelID
+		cur.LastError = ""
+	case cur.Attempts >= o.maxAttempts:
+		cur.State = IntentFailed
+		cur.LastError = err.Error()
+		klog.Errorf("Slack intent %s failed after %d attempts: %v", cur.Key, cur.Attempts, err)
+	default:
+		cur.LastError = err.Error()
+		cur.NextAttempt = time.Now().Add(o.baseBackoff << (cur.Attempts - 1))
+		klog.Warningf("Slack intent %s attempt %d failed, retrying at %v: %v",
+			cur.Key, cur.Attempts, cur.NextAttempt, err)
+	}
+}
 
-	done := make(chan error, 1)
-	go func() {
-		err := v.validateSlackChannelCreation(asyncCtx, msg)
-		done <- err
-	}()
+// Run processes the outbox until ctx is done, waking up on new intents and
+// periodically for retries.
+func (o *Outbox) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-o.notify:
+		case <-ticker.C:
+		}
+		o.ProcessPending(ctx)
+	}
+}
 
-	select {
-	case err := <-done:
+// StatusHandler serves the outbox state of a SlackMessage, identified by the
+// namespace and name query parameters.
+func (o *Outbox) StatusHandler(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("namespace") + "/" + r.URL.Query().Get("name")
+	intent, ok := o.Status(key)
+	if !ok {
+		http.Error(w, "No Slack intent for "+key, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(intent)
+}
+
+type MessageTemplate struct {
+	APIVersion string     `json:"apiVersion"`
+	Kind       string     `json:"kind"`
+	Metadata   ObjectMeta `json:"metadata"`
+	Spec       struct {
+		// Extends names the layout this template inherits from.
+		Extends  string `json:"extends,omitempty"`
+		Template string `json:"template"`
+		// Payload governs the payload snippets the template echoes. It is
+		// inherited by templates extending this one that set none.
+		Payload *PayloadPolicy `json:"payload,omitempty"`
+	} `json:"spec"`
+}
+
+// TemplateStore holds MessageTemplates by namespace. Templates in the shared
+// namespace are visible everywhere; a namespace may override a shared
+// template by defining one with the same name.
+type TemplateStore struct {
+	mu              sync.RWMutex
+	sharedNamespace string
+	templates       map[string]map[string]*MessageTemplate
+}
+
+func NewTemplateStore(sharedNamespace string) *TemplateStore {
+	return &TemplateStore{
+		sharedNamespace: sharedNamespace,
+		templates:       make(map[string]map[string]*MessageTemplate),
+	}
+}
+
+func (s *TemplateStore) Put(t *MessageTemplate) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ns := t.Metadata.Namespace
+	if s.templates[ns] == nil {
+		s.templates[ns] = make(map[string]*MessageTemplate)
+	}
+	s.templates[ns][t.Metadata.Name] = t
+}
+
+// clone returns a copy of the store that can be modified without affecting
+// the original.
+func (s *TemplateStore) clone() *TemplateStore {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c := NewTemplateStore(s.sharedNamespace)
+	for ns, byName := range s.templates {
+		c.templates[ns] = make(map[string]*MessageTemplate, len(byName))
+		for name, t := range byName {
+			c.templates[ns][name] = t
+		}
+	}
+	return c
+}
+
+// visible returns the templates that resolve in namespace, with local
+// templates shadowing shared ones.
+func (s *TemplateStore) visible(namespace string) map[string]*MessageTemplate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make(map[string]*MessageTemplate)
+	for name, t := range s.templates[s.sharedNamespace] {
+		out[name] = t
+	}
+	for name, t := range s.templates[namespace] {
+		out[name] = t
+	}
+	return out
+}
+
+// Resolve builds the template set for a message body in namespace and
+// returns it along with the name of the template to execute. The layout
+// chain is parsed root first so that each child's {{define}}s override its
+// parent's {{block}}s, and the message body is parsed last. Extends cycles,
+// references to unknown partials and partial inclusion cycles are errors.
+func (s *TemplateStore) Resolve(namespace, layout, body string) (*template.Template, string, error) {
+	return resolveTemplates(s.visible(namespace), layout, body)
+}
+
+// Validate checks that t parses and resolves as a layout in its namespace,
+// as if it were already stored.
+func (s *TemplateStore) Validate(t *MessageTemplate) error {
+	if t.Metadata.Name == "" || t.Metadata.Namespace == "" {
+		return fmt.Errorf("name and namespace are required")
+	}
+	if p := t.Spec.Payload; p != nil {
+		if err := p.validate(); err != nil {
+			return err
+		}
+	}
+	visible := s.visible(t.Metadata.Namespace)
+	visible[t.Metadata.Name] = t
+	_, _, err := resolveTemplates(visible, t.Metadata.Name, "")
+	return err
+}
+
+// withPending returns s, or a copy of it with an empty stand-in for each
+// of refs that is a MessageTemplate pending in ctx but not stored yet. It
+// also returns a warning for each stand-in.
+func (s *TemplateStore) withPending(ctx context.Context, namespace string, refs []string) (*TemplateStore, []string) {
+	visible := s.visible(namespace)
+	var out *TemplateStore
+	var warnings []string
+	for _, name := range refs {
+		if name == "" || visible[name] != nil {
+			continue
+		}
+		ns := namespace
+		if !pendingObject(ctx, "MessageTemplate", ns, name) {
+			if ns = s.sharedNamespace; !pendingObject(ctx, "MessageTemplate", ns, name) {
+				continue
+			}
+		}
+		if out == nil {
+			out = s.clone()
+		}
+		stub := &MessageTemplate{Kind: "MessageTemplate", Metadata: ObjectMeta{Namespace: ns, Name: name}}
+		out.Put(stub)
+		visible[name] = stub
+		warnings = append(warnings, fmt.Sprintf(
+			"MessageTemplate %s/%s does not exist yet; admitted because it is pending in the same apply", ns, name))
+	}
+	if out == nil {
+		return s, nil
+	}
+	return out, warnings
+}
+
+// templateRefs lists the templates body refers to by name, through
+// {{template}} or {{block}}, with extends first if set.
+func templateRefs(extends string, bodies ...string) []string {
+	refs := []string{extends}
+	for _, body := range bodies {
+		t, err := template.New("refs").Funcs(defaultChannelLocale.funcs()).Funcs(defaultPayloadPolicy.funcs(nil)).Parse(body)
 		if err != nil {
-			klog.Errorf("Slack channel validation failed: %v", err)
-			resp.Response.Allowed = false
-			resp.Response.Result = map[string]string{
-				"status": "Failure",
-				"reason": fmt.Sprintf("Slack channel validation failed: %v", err),
+			continue
+		}
+		for _, tt := range t.Templates() {
+			if tt.Tree != nil {
+				refs = templateCalls(tt.Tree.Root, refs)
+			}
+		}
+	}
+	return refs
+}
+
+func resolveTemplates(visible map[string]*MessageTemplate, layout, body string) (*template.Template, string, error) {
+	var chain []*MessageTemplate
+	seen := make(map[string]bool)
+	for name := layout; name != ""; {
+		if seen[name] {
+			return nil, "", fmt.Errorf("layout %q extends itself", name)
+		}
+		seen[name] = true
+		t, ok := visible[name]
+		if !ok {
+			return nil, "", fmt.Errorf("layout %q not found", name)
+		}
+		chain = append(chain, t)
+		name = t.Spec.Extends
+	}
+
+	set := template.New("message").Funcs(defaultChannelLocale.funcs()).Funcs(defaultPayloadPolicy.funcs(nil))
+	names := make([]string, 0, len(visible))
+	for name := range visible {
+		if !seen[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := set.New(name).Parse(visible[name].Spec.Template); err != nil {
+			return nil, "", fmt.Errorf("partial %q: %w", name, err)
+		}
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		t := chain[i]
+		if _, err := set.New(t.Metadata.Name).Parse(t.Spec.Template); err != nil {
+			return nil, "", fmt.Errorf("layout %q: %w", t.Metadata.Name, err)
+		}
+	}
+	if _, err := set.New("message").Parse(body); err != nil {
+		return nil, "", fmt.Errorf("message: %w", err)
+	}
+
+	if err := checkTemplateRefs(set); err != nil {
+		return nil, "", err
+	}
+
+	entry := "message"
+	if len(chain) > 0 {
+		entry = chain[len(chain)-1].Metadata.Name
+	}
+	return set, entry, nil
+}
+
+// Render resolves and executes a message body against data.
+func (s *TemplateStore) Render(namespace, layout, body string, data any) (string, error) {
+	return s.render(namespace, layout, body, defaultChannelLocale, data)
+}
+
+// RenderMessage renders msg's body using its channel's timezone and locale.
+func (s *TemplateStore) RenderMessage(msg *MockKargoMessage, data any) (string, error) {
+	loc, err := channelLocaleFor(&msg.Spec)
+	if err != nil {
+		return "", err
+	}
+	return s.render(msg.Metadata.Namespace, msg.Spec.Layout, msg.Spec.Message, loc, data)
+}
+
+func (s *TemplateStore) render(namespace, layout, body string, loc ChannelLocale, data any) (string, error) {
+	return s.renderWith(namespace, layout, body, loc, nil, data)
+}
+
+// renderWith renders like render, with full-payload links minted by links
+// if it is set.
+func (s *TemplateStore) renderWith(namespace, layout, body string, loc ChannelLocale, links *PayloadLinkSigner, data any) (string, error) {
+	set, entry, err := s.Resolve(namespace, layout, body)
+	if err != nil {
+		return "", err
+	}
+	set.Funcs(loc.funcs())
+	set.Funcs(s.payloadPolicy(namespace, layout).funcs(links))
+	var out bytes.Buffer
+	if err := set.ExecuteTemplate(&out, entry, data); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// PayloadPolicy caps and redacts the raw payload snippets (failure
+// details and the like) that templates echo with
+// {{ payload .Value "/dashboard/path" }}, so notifications neither leak
+// credentials nor exceed Block Kit's 3000-character section limit. When a
+// snippet is cut or redacted and a dashboard path is given, a signed
+// "view full payload" link is appended.
+type PayloadPolicy struct {
+	// MaxBytes caps each snippet, defaultPayloadBytes when unset.
+	MaxBytes int `json:"maxBytes,omitempty"`
+	// RedactKeys are JSON object keys, matched case-insensitively at any
+	// depth, whose values are replaced.
+	RedactKeys []string `json:"redactKeys,omitempty"`
+	// RedactPatterns are regular expressions whose matches are replaced.
+	RedactPatterns []string `json:"redactPatterns,omitempty"`
+}
+
+const (
+	defaultPayloadBytes = 500
+	// maxPayloadBytes leaves room in a section block for the text around
+	// the snippet and the link.
+	maxPayloadBytes = 2500
+	redactedValue   = "[REDACTED]"
+	truncatedMarker = "… [truncated]"
+)
+
+var defaultPayloadPolicy = PayloadPolicy{
+	MaxBytes:   defaultPayloadBytes,
+	RedactKeys: []string{"authorization", "password", "secret", "token"},
+}
+
+func (p *PayloadPolicy) validate() error {
+	if p.MaxBytes < 0 || p.MaxBytes > maxPayloadBytes {
+		return fmt.Errorf("payload.maxBytes must be between 0 and %d", maxPayloadBytes)
+	}
+	for _, pat := range p.RedactPatterns {
+		if _, err := regexp.Compile(pat); err != nil {
+			return fmt.Errorf("payload.redactPatterns: %w", err)
+		}
+	}
+	return nil
+}
+
+// payloadPolicy returns the policy of the nearest template in layout's
+// extends chain that sets one.
+func (s *TemplateStore) payloadPolicy(namespace, layout string) PayloadPolicy {
+	visible := s.visible(namespace)
+	seen := make(map[string]bool)
+	for name := layout; name != "" && !seen[name]; {
+		seen[name] = true
+		t, ok := visible[name]
+		if !ok {
+			break
+		}
+		if t.Spec.Payload != nil {
+			return *t.Spec.Payload
+		}
+		name = t.Spec.Extends
+	}
+	return defaultPayloadPolicy
+}
+
+func (p PayloadPolicy) funcs(links *PayloadLinkSigner) template.FuncMap {
+	return template.FuncMap{
+		"payload": func(v any, link ...string) string {
+			text, cut := p.snippet(v)
+			if cut && links != nil && len(link) > 0 && link[0] != "" {
+				text += fmt.Sprintf(" <%s|view full payload>", links.sign(link[0]))
 			}
-			return resp, err
-		case <-asyncCtx.Done():
-			klog.Errorf("Slack validation timeout after %v", v.timeout)
-			resp.Response.Allowed = false
-			resp.Response.Result = map[string]string{
-				"status": "Failure",
-				"reason": "Slack channel validation timeout",
+			return text
+		},
+	}
+}
+
+// snippet renders v, JSON-encoded unless it is a string, redacted and
+// capped. It reports whether anything was removed.
+func (p PayloadPolicy) snippet(v any) (string, bool) {
+	var doc any
+	switch x := v.(type) {
+	case string:
+		if json.Unmarshal([]byte(x), &doc) != nil {
+			doc = nil
+		}
+	case []byte:
+		if json.Unmarshal(x, &doc) != nil {
+			doc = nil
+		}
+		v = string(x)
+	default:
+		doc = v
+	}
+	redacted := false
+	var text string
+	if doc != nil {
+		// Round-trip through JSON so structs are redacted like maps.
+		b, _ := json.Marshal(doc)
+		json.Unmarshal(b, &doc)
+		doc, redacted = p.redactKeys(doc)
+		b, _ = json.Marshal(doc)
+		text = string(b)
+	} else {
+		text = fmt.Sprint(v)
+	}
+	for _, pat := range p.RedactPatterns {
+		re, err := regexp.Compile(pat)
+		if err != nil {
+			continue
+		}
+		if re.MatchString(text) {
+			text = re.ReplaceAllLiteralString(text, redactedValue)
+			redacted = true
+		}
+	}
+
+	max := p.MaxBytes
+	if max == 0 {
+		max = defaultPayloadBytes
+	}
+	if len(text) <= max {
+		return text, redacted
+	}
+	cut := max
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut] + truncatedMarker, true
+}
+
+func (p PayloadPolicy) redactKeys(v any) (any, bool) {
+	redacted := false
+	switch x := v.(type) {
+	case map[string]any:
+		for k, val := range x {
+			if slices.ContainsFunc(p.RedactKeys, func(key string) bool { return strings.EqualFold(key, k) }) {
+				x[k] = redactedValue
+				redacted = true
+				continue
 			}
-			return resp, asyncCtx.Err()
+			var r bool
+			x[k], r = p.redactKeys(val)
+			redacted = redacted || r
+		}
+	case []any:
+		for i, val := range x {
+			var r bool
+			x[i], r = p.redactKeys(val)
+			redacted = redacted || r
+		}
 	}
+	return v, redacted
+}
 
-	klog.Infof("Successfully validated Kargo message %s/%s for Slack channel %s", 
-		msg.Metadata.Namespace, msg.Metadata.Name, msg.Spec.SlackChannel)
-	return resp, nil
+// PayloadLinkSigner mints links into the webhook receiver's dashboard in
+// the format its LinkSigner verifies; Key must be the receiver's link
+// signing key.
+type PayloadLinkSigner struct {
+	Key     string
+	BaseURL string
+	// TTL is how long links stay valid, a day by default.
+	TTL time.Duration
 }
 
-func (v *Validator) validateSlackChannelCreation(ctx context.Context, msg *MockKargoMessage) error {
-	if msg.Spec.SlackChannel == "" {
-		return fmt.Errorf("slackChannel is required")
+func (s *PayloadLinkSigner) sign(path string) string {
+	ttl := s.TTL
+	if ttl == 0 {
+		ttl = 24 * time.Hour
+	}
+	q := url.Values{}
+	q.Set("exp", strconv.FormatInt(time.Now().Add(ttl).Unix(), 10))
+	m := hmac.New(sha256.New, []byte(s.Key))
+	m.Write([]byte(path + "?" + q.Encode()))
+	q.Set("sig", base64.RawURLEncoding.EncodeToString(m.Sum(nil)))
+	return strings.TrimSuffix(s.BaseURL, "/") + path + "?" + q.Encode()
+}
+
+type localeFormat struct {
+	dateTime string
+	units    [3]string // hours, minutes, seconds
+	sep      string
+}
+
+var localeFormats = map[string]localeFormat{
+	"en-US": {"Jan 2, 2006 3:04 PM MST", [3]string{"h", "m", "s"}, " "},
+	"en-GB": {"2 Jan 2006 15:04 MST", [3]string{"h", "m", "s"}, " "},
+	"de-DE": {"02.01.2006 15:04 MST", [3]string{" Std.", " Min.", " Sek."}, " "},
+	"fr-FR": {"02/01/2006 15:04 MST", [3]string{" h", " min", " s"}, " "},
+	"ja-JP": {"2006/01/02 15:04 MST", [3]string{"時間", "分", "秒"}, ""},
+}
+
+// ChannelLocale carries the per-channel settings applied when rendering
+// times (e.g. a push's pushed_at) and durations (e.g. promotion time).
+type ChannelLocale struct {
+	Location *time.Location
+	Locale   string
+}
+
+var defaultChannelLocale = ChannelLocale{Location: time.UTC, Locale: "en-US"}
+
+func channelLocaleFor(spec *SlackMessageSpec) (ChannelLocale, error) {
+	loc := defaultChannelLocale
+	if spec.Timezone != "" {
+		l, err := time.LoadLocation(spec.Timezone)
+		if err != nil {
+			return loc, fmt.Errorf("unknown timezone %q", spec.Timezone)
+		}
+		loc.Location = l
+	}
+	if spec.Locale != "" {
+		if _, ok := localeFormats[spec.Locale]; !ok {
+			return loc, fmt.Errorf("unsupported locale %q", spec.Locale)
+		}
+		loc.Locale = spec.Locale
+	}
+	return loc, nil
+}
+
+func (c ChannelLocale) funcs() template.FuncMap {
+	return template.FuncMap{
+		"formatTime":     c.formatTime,
+		"formatDuration": c.formatDuration,
+	}
+}
+
+// formatTime accepts a time.Time, Unix seconds (as Docker Hub sends
+// pushed_at) or an RFC 3339 string.
+func (c ChannelLocale) formatTime(v any) (string, error) {
+	var t time.Time
+	switch val := v.(type) {
+	case time.Time:
+		t = val
+	case int:
+		t = time.Unix(int64(val), 0)
+	case int64:
+		t = time.Unix(val, 0)
+	case float64:
+		t = time.Unix(int64(val), 0)
+	case string:
+		parsed, err := time.Parse(time.RFC3339, val)
+		if err != nil {
+			return "", fmt.Errorf("formatTime: %w", err)
+		}
+		t = parsed
+	default:
+		return "", fmt.Errorf("formatTime: unsupported type %T", v)
+	}
+	return t.In(c.Location).Format(localeFormats[c.Locale].dateTime), nil
+}
+
+// formatDuration accepts a time.Duration, seconds, or a Go duration string.
+func (c ChannelLocale) formatDuration(v any) (string, error) {
+	var d time.Duration
+	switch val := v.(type) {
+	case time.Duration:
+		d = val
+	case int:
+		d = time.Duration(val) * time.Second
+	case int64:
+		d = time.Duration(val) * time.Second
+	case float64:
+		d = time.Duration(val * float64(time.Second))
+	case string:
+		parsed, err := time.ParseDuration(val)
+		if err != nil {
+			return "", fmt.Errorf("formatDuration: %w", err)
+		}
+		d = parsed
+	default:
+		return "", fmt.Errorf("formatDuration: unsupported type %T", v)
+	}
+
+	f := localeFormats[c.Locale]
+	d = d.Round(time.Second)
+	parts := []int{int(d / time.Hour), int(d % time.Hour / time.Minute), int(d % time.Minute / time.Second)}
+	var out []string
+	for i, n := range parts {
+		if n > 0 || (i == 2 && len(out) == 0) {
+			out = append(out, fmt.Sprintf("%d%s", n, f.units[i]))
+		}
+	}
+	return strings.Join(out, f.sep), nil
+}
+
+// checkTemplateRefs walks every template in set and fails on {{template}}
+// calls to undefined names or on inclusion cycles.
+func checkTemplateRefs(set *template.Template) error {
+	refs := make(map[string][]string)
+	for _, t := range set.Templates() {
+		if t.Tree == nil {
+			continue
+		}
+		refs[t.Name()] = templateCalls(t.Tree.Root, nil)
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int)
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("template cycle: %s", strings.Join(append(path, name), " -> "))
+		case done:
+			return nil
+		}
+		state[name] = visiting
+		for _, ref := range refs[name] {
+			if _, ok := refs[ref]; !ok {
+				return fmt.Errorf("template %q references unknown partial %q", name, ref)
+			}
+			if err := visit(ref, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = done
+		return nil
+	}
+
+	names := make([]string, 0, len(refs))
+	for name := range refs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func templateCalls(node parse.Node, out []string) []string {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return out
+		}
+		for _, c := range n.Nodes {
+			out = templateCalls(c, out)
+		}
+	case *parse.TemplateNode:
+		out = append(out, n.Name)
+	case *parse.IfNode:
+		out = templateCalls(n.List, templateCalls(n.ElseList, out))
+	case *parse.RangeNode:
+		out = templateCalls(n.List, templateCalls(n.ElseList, out))
+	case *parse.WithNode:
+		out = templateCalls(n.List, templateCalls(n.ElseList, out))
+	}
+	return out
+}
+
+// sharedTemplateNamespace holds the MessageTemplates every namespace inherits.
+// AdmissionLimits caps how much a single namespace can ask of the notifier.
+// A zero field disables that limit.
+type AdmissionLimits struct {
+	MaxMessageLength        int `json:"maxMessageLength,omitempty"`
+	MaxSubscriptions        int `json:"maxSubscriptions,omitempty"`
+	MaxMessagesPerNamespace int `json:"maxMessagesPerNamespace,omitempty"`
+}
+
+var defaultAdmissionLimits = AdmissionLimits{
+	MaxMessageLength:        4000,
+	MaxSubscriptions:        20,
+	MaxMessagesPerNamespace: 100,
+}
+
+// SlackMessageLister returns the names of the SlackMessages in a namespace.
+// In a cluster this is an informer-backed lister; messageIndex stands in for
+// it here by remembering every object the webhook has admitted.
+type SlackMessageLister interface {
+	List(namespace string) []string
+}
+
+type messageIndex struct {
+	mu    sync.RWMutex
+	names map[string]map[string]bool
+}
+
+func newMessageIndex() *messageIndex {
+	return &messageIndex{names: make(map[string]map[string]bool)}
+}
+
+func (m *messageIndex) List(namespace string) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make([]string, 0, len(m.names[namespace]))
+	for name := range m.names[namespace] {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (m *messageIndex) add(namespace, name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.names[namespace] == nil {
+		m.names[namespace] = make(map[string]bool)
+	}
+	m.names[namespace][name] = true
+}
+
+// quotaError mirrors the wording of ResourceQuota rejections so that users
+// recognise it as a limit rather than a malformed object.
+func quotaError(resource string, requested, used, limit int) error {
+	return fmt.Errorf("exceeded quota: %s, requested: %d, used: %d, limited: %d",
+		resource, requested, used, limit)
+}
+
+// check enforces l against msg. Updates to an existing object do not
+// count against the per-namespace total.
+func (l AdmissionLimits) check(msg *MockKargoMessage, lister SlackMessageLister) error {
+	if l.MaxMessageLength > 0 && len(msg.Spec.Message) > l.MaxMessageLength {
+		return quotaError("spec.message length", len(msg.Spec.Message), 0, l.MaxMessageLength)
+	}
+	if l.MaxSubscriptions > 0 && len(msg.Spec.Subscriptions) > l.MaxSubscriptions {
+		return quotaError("spec.subscriptions", len(msg.Spec.Subscriptions), 0, l.MaxSubscriptions)
+	}
+	if l.MaxMessagesPerNamespace > 0 && lister != nil {
+		existing := lister.List(msg.Metadata.Namespace)
+		for _, name := range existing {
+			if name == msg.Metadata.Name {
+				return nil
+			}
+		}
+		if len(existing) >= l.MaxMessagesPerNamespace {
+			return quotaError("count/slackmessages", 1, len(existing), l.MaxMessagesPerNamespace)
+		}
+	}
+	return nil
+}
+
+const sharedTemplateNamespace = "kargo-system"
+
+// muteAnnotation on a Kargo Stage suppresses its notifications.
+const muteAnnotation = "notifications.kargo-demo/mute"
+
+// StageLister returns the annotations of a Kargo Stage. In a cluster this is
+// an informer-backed lister; stageIndex stands in for it here.
+type StageLister interface {
+	Annotations(namespace, name string) (map[string]string, bool)
+}
+
+type stageIndex struct {
+	mu     sync.RWMutex
+	stages map[string]map[string]string
+}
+
+func newStageIndex() *stageIndex {
+	return &stageIndex{stages: make(map[string]map[string]string)}
+}
+
+func (s *stageIndex) Annotations(namespace, name string) (map[string]string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	a, ok := s.stages[namespace+"/"+name]
+	return a, ok
+}
+
+func (s *stageIndex) set(namespace, name string, annotations map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stages[namespace+"/"+name] = annotations
+}
+
+// SuppressedNotification records a notification skipped because its Stage
+// was muted.
+type SuppressedNotification struct {
+	Time          time.Time `json:"time"`
+	Message       string    `json:"message"`
+	Stage         string    `json:"stage"`
+	CorrelationID string    `json:"correlationID,omitempty"`
+}
+
+// stageMuted reports whether namespace/stage carries the mute annotation.
+func (v *Validator) stageMuted(namespace, stage string) bool {
+	if v.stages == nil || stage == "" {
+		return false
+	}
+	a, _ := v.stages.Annotations(namespace, stage)
+	return a[muteAnnotation] == "true"
+}
+
+// muteWarnings lists the subscriptions of msg to muted Stages.
+func (v *Validator) muteWarnings(msg *MockKargoMessage) []string {
+	var out []string
+	for _, sub := range msg.Spec.Subscriptions {
+		if v.stageMuted(msg.Metadata.Namespace, sub.Stage) {
+			out = append(out, fmt.Sprintf("stage %q is muted (%s: \"true\"); its notifications will be suppressed",
+				sub.Stage, muteAnnotation))
+		}
+	}
+	return out
+}
+
+const (
+	maxChannelNameLength  = 80
+	maxChannelSuggestions = 3
+)
+
+// ChannelPolicy constrains the channel names SlackMessages may request on
+// top of Slack's own rules (lowercase letters, digits, - and _, at most 80
+// characters).
+type ChannelPolicy struct {
+	// Prefixes, if set, are the prefixes a channel name must start with.
+	Prefixes []string `json:"prefixes,omitempty"`
+}
+
+// check returns why name does not comply, or "".
+func (p ChannelPolicy) check(name string) string {
+	if len(name) > maxChannelNameLength {
+		return fmt.Sprintf("is longer than %d characters", maxChannelNameLength)
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return "may only contain lowercase letters, digits, - and _"
+		}
+	}
+	if len(p.Prefixes) == 0 {
+		return ""
+	}
+	for _, prefix := range p.Prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return ""
+		}
+	}
+	return fmt.Sprintf("must start with one of %s", strings.Join(p.Prefixes, ", "))
+}
+
+// candidates lists compliant variations of name, best first.
+func (p ChannelPolicy) candidates(name, namespace string) []string {
+	base := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return '-'
+	}, name)
+	base = strings.Trim(base, "-")
+
+	bases := []string{base}
+	if p.check(base) != "" && len(p.Prefixes) > 0 {
+		bases = nil
+		for _, prefix := range p.Prefixes {
+			bases = append(bases, prefix+base)
+		}
+	}
+	var out []string
+	for _, b := range bases {
+		out = append(out, b, b+"-"+namespace)
+		for i := 2; i <= 4; i++ {
+			out = append(out, fmt.Sprintf("%s-%d", b, i))
+		}
+	}
+	return out
+}
+
+// channelError denies a channel name and carries alternatives that were
+// available when admission ran.
+type channelError struct {
+	channel     string
+	problem     string
+	suggestions []string
+}
+
+func (e *channelError) Error() string {
+	msg := fmt.Sprintf("slackChannel %q %s", e.channel, e.problem)
+	if len(e.suggestions) > 0 {
+		msg += fmt.Sprintf("; available names: %s", strings.Join(e.suggestions, ", "))
+	}
+	return msg
+}
+
+// channelTaken reports whether name exists in Slack in a form that cannot
+// be reused, i.e. with the other visibility. Offline validators (bundle
+// checks) have no client and only apply the naming policy.
+func (v *Validator) channelTaken(ctx context.Context, name, team string, private bool) (bool, error) {
+	if v.slackClient == nil || ctx.Value(skipChecksKey{}) != nil {
+		return false, nil
+	}
+	teams := []string{team}
+	if v.grid != nil {
+		teams = v.grid.searchOrder(team)
+	}
+	lctx, done := v.callBudget(ctx, "conversations.list")
+	id, _, err := v.slackClient.FindConversation(lctx, name, teams)
+	done()
+	if err != nil || id == "" {
+		return false, err
+	}
+	ictx, done := v.callBudget(ctx, "conversations.info")
+	defer done()
+	isPrivate, err := v.slackClient.ConversationPrivate(ictx, id)
+	if err != nil {
+		return false, err
+	}
+	return isPrivate != private, nil
+}
+
+// checkChannel runs checkChannelName once v.checks has a slot for it. When
+// none is to be had, only the naming policy is applied and the returned
+// warning says so.
+func (v *Validator) checkChannel(ctx context.Context, msg *MockKargoMessage) (string, error) {
+	var warning string
+	release, err := v.checks.acquire(ctx, msg.Metadata.Namespace)
+	if err != nil {
+		klog.Warningf("Skipping Slack checks for %s/%s: %v", msg.Metadata.Namespace, msg.Metadata.Name, err)
+		warning = fmt.Sprintf("slackChannel %q was not checked against Slack: %v", msg.Spec.SlackChannel, err)
+		ctx = context.WithValue(ctx, skipChecksKey{}, true)
+	} else {
+		defer release()
+	}
+	return warning, v.checkChannelName(ctx, msg)
+}
+
+// checkChannelName denies channel names that break the policy or are taken
+// in Slack, suggesting compliant names that are free. Slack lookup failures
+// do not block admission; the outbox reports them later if they persist.
+func (v *Validator) checkChannelName(ctx context.Context, msg *MockKargoMessage) error {
+	name := msg.Spec.SlackChannel
+	team, _ := v.teamFor(&msg.Spec)
+	private := msg.Spec.ChannelType == "private"
+
+	problem := v.channels.check(name)
+	if problem == "" {
+		taken, err := v.channelTaken(ctx, name, team, private)
+		if err != nil {
+			klog.Warningf("Could not check Slack channel %s: %v", name, err)
+			return nil
+		}
+		if !taken {
+			return nil
+		}
+		problem = "is taken by a channel with different visibility"
+	}
+
+	cerr := &channelError{channel: name, problem: problem}
+	seen := map[string]bool{name: true}
+	for _, c := range v.channels.candidates(name, msg.Metadata.Namespace) {
+		if len(cerr.suggestions) == maxChannelSuggestions {
+			break
+		}
+		if seen[c] || v.channels.check(c) != "" {
+			continue
+		}
+		seen[c] = true
+		if taken, err := v.channelTaken(ctx, c, team, private); err != nil || taken {
+			continue
+		}
+		cerr.suggestions = append(cerr.suggestions, c)
+	}
+	return cerr
+}
+
+// LinkPolicy restricts where links in rendered notifications may point.
+// Template data comes from upstream payloads, so a compromised sender could
+// otherwise put a phishing link in front of everyone in the channel.
+type LinkPolicy struct {
+	// AllowedDomains are the hosts links may point to; "*.example.com"
+	// also matches subdomains. Empty allows every link.
+	AllowedDomains []string `json:"allowedDomains,omitempty"`
+	// Rewrite replaces a disallowed link with a defanged, unclickable form
+	// of its URL instead of removing it.
+	Rewrite bool `json:"rewrite,omitempty"`
+}
+
+// linkPattern finds Slack links (<url|label>, but not <@user>, <#channel>
+// or <!here>), Markdown links as used by Teams, and bare URLs.
+var linkPattern = regexp.MustCompile(`<([^<>|@#!][^<>|]*)(?:\|([^<>]*))?>|\[([^\]]*)\]\(([^()\s]+)\)|[a-zA-Z][a-zA-Z0-9+.-]*://[^\s<>|()\[\]]+`)
+
+func (p LinkPolicy) allowed(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, d := range p.AllowedDomains {
+		d = strings.ToLower(d)
+		if host == d || strings.HasPrefix(d, "*.") && strings.HasSuffix(host, d[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// sanitize rewrites or strips the links in text that the policy does not
+// allow and returns the URLs it removed.
+func (p LinkPolicy) sanitize(text string) (string, []string) {
+	if len(p.AllowedDomains) == 0 {
+		return text, nil
+	}
+	var removed []string
+	out := linkPattern.ReplaceAllStringFunc(text, func(m string) string {
+		sub := linkPattern.FindStringSubmatch(m)
+		target, label := m, ""
+		switch {
+		case sub[1] != "":
+			target, label = sub[1], sub[2]
+		case sub[4] != "":
+			target, label = sub[4], sub[3]
+		}
+		if p.allowed(target) {
+			return m
+		}
+		removed = append(removed, target)
+		if p.Rewrite {
+			defanged := strings.Replace(target, "http", "hxxp", 1)
+			defanged = strings.ReplaceAll(defanged, ".", "[.]")
+			if label != "" {
+				return label + " (" + defanged + ")"
+			}
+			return defanged
+		}
+		if label != "" {
+			return label
+		}
+		return "[link removed]"
+	})
+	return out, removed
+}
+
+// renderNotification renders msg with layout and body and applies the link
+// policy to the result.
+func (v *Validator) renderNotification(msg *MockKargoMessage, layout, body string, data any) (string, error) {
+	loc, err := channelLocaleFor(&msg.Spec)
+	if err != nil {
+		return "", err
+	}
+	text, err := v.templates.renderWith(msg.Metadata.Namespace, layout, body, loc, v.payloadLinks, data)
+	if err != nil {
+		return "", err
+	}
+	text, removed := v.links.sanitize(text)
+	if len(removed) > 0 {
+		klog.Warningf("Removed %d disallowed links from notification for %s/%s: %s",
+			len(removed), msg.Metadata.Namespace, msg.Metadata.Name, strings.Join(removed, ", "))
+	}
+	return text, nil
+}
+
+// SlackGrid describes an Enterprise Grid org the app is installed in
+// org-wide. Every API call then has to name a workspace, so SlackMessages
+// must resolve to one of Teams through spec.team or DefaultTeam.
+type SlackGrid struct {
+	// Teams maps workspace names to team IDs.
+	Teams       map[string]string
+	DefaultTeam string
+	// RestrictedChannelCreation creates channels through
+	// admin.conversations.create, for orgs where only admins may.
+	RestrictedChannelCreation bool
+}
+
+// resolveTeam returns the team ID for spec.team, which may be a workspace
+// name or an ID.
+func (g *SlackGrid) resolveTeam(team string) (string, error) {
+	if team == "" {
+		team = g.DefaultTeam
+	}
+	if team == "" {
+		return "", fmt.Errorf("team is required for an org-wide Enterprise Grid installation")
+	}
+	if id, ok := g.Teams[team]; ok {
+		return id, nil
+	}
+	for _, id := range g.Teams {
+		if id == team {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("team %q is not a workspace of the Enterprise Grid org", team)
+}
+
+// searchOrder lists team IDs for a cross-workspace lookup, target first.
+func (g *SlackGrid) searchOrder(target string) []string {
+	out := []string{target}
+	var rest []string
+	for _, id := range g.Teams {
+		if id != target {
+			rest = append(rest, id)
+		}
+	}
+	sort.Strings(rest)
+	return append(out, rest...)
+}
+
+// CheckPool bounds the external (Slack) checks of concurrent admission
+// reviews. A fixed number run at once; the rest wait in per-namespace
+// queues served round-robin, so a mass re-apply in one namespace, such as
+// an Argo CD full sync, cannot starve reviews elsewhere. Once ShedAbove
+// checks are outstanding, new reviews skip them and are admitted with a
+// warning instead of holding up the API server.
+type CheckPool struct {
+	workers   int
+	shedAbove int
+
+	mu          sync.Mutex
+	running     int
+	outstanding int
+	queues      map[string][]chan struct{}
+	order       []string // namespaces with waiting checks, next first
+	shed        int
+}
+
+const (
+	defaultCheckWorkers  = 16
+	defaultShedThreshold = 256
+	// maxAdmissionReview fits a review carrying both the object and the
+	// old object at the API server's 3 MiB request limit.
+	maxAdmissionReview = 7 << 20
+)
+
+var errChecksShed = errors.New("validator overloaded")
+
+// NewCheckPool returns a pool running workers checks at once. shedAbove 0
+// never sheds.
+func NewCheckPool(workers, shedAbove int) *CheckPool {
+	return &CheckPool{workers: workers, shedAbove: shedAbove, queues: make(map[string][]chan struct{})}
+}
+
+// acquire waits for a slot on behalf of namespace. It fails with
+// errChecksShed when the pool is saturated, or with ctx's error if the
+// review is abandoned while waiting. A nil pool admits every caller.
+func (p *CheckPool) acquire(ctx context.Context, namespace string) (func(), error) {
+	if p == nil {
+		return func() {}, nil
+	}
+	p.mu.Lock()
+	if p.shedAbove > 0 && p.outstanding >= p.shedAbove {
+		p.shed++
+		p.mu.Unlock()
+		return nil, errChecksShed
+	}
+	p.outstanding++
+	if p.running < p.workers {
+		p.running++
+		p.mu.Unlock()
+		return p.release, nil
+	}
+	ready := make(chan struct{})
+	if len(p.queues[namespace]) == 0 {
+		p.order = append(p.order, namespace)
+	}
+	p.queues[namespace] = append(p.queues[namespace], ready)
+	p.mu.Unlock()
+
+	select {
+	case <-ready:
+		return p.release, nil
+	case <-ctx.Done():
+	}
+	p.mu.Lock()
+	if p.dequeue(namespace, ready) {
+		p.outstanding--
+		p.mu.Unlock()
+		return nil, ctx.Err()
+	}
+	p.mu.Unlock()
+	// The slot was handed over as ctx ended; pass it on.
+	p.release()
+	return nil, ctx.Err()
+}
+
+// release hands the caller's slot to the head of the next namespace's
+// queue, or frees it.
+func (p *CheckPool) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.outstanding--
+	if len(p.order) == 0 {
+		p.running--
+		return
+	}
+	ns := p.order[0]
+	p.order = p.order[1:]
+	q := p.queues[ns]
+	if len(q) == 1 {
+		delete(p.queues, ns)
+	} else {
+		p.queues[ns] = q[1:]
+		p.order = append(p.order, ns)
+	}
+	close(q[0])
+}
+
+// dequeue removes a waiter that gave up. It reports false if the waiter
+// was already handed a slot. The caller holds p.mu.
+func (p *CheckPool) dequeue(namespace string, ready chan struct{}) bool {
+	q := p.queues[namespace]
+	for i, c := range q {
+		if c != ready {
+			continue
+		}
+		q = append(q[:i], q[i+1:]...)
+		if len(q) > 0 {
+			p.queues[namespace] = q
+			return true
+		}
+		delete(p.queues, namespace)
+		for j, ns := range p.order {
+			if ns == namespace {
+				p.order = append(p.order[:j], p.order[j+1:]...)
+				break
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Shed returns how many reviews skipped their checks under load.
+func (p *CheckPool) Shed() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.shed
+}
+
+// skipChecksKey marks a review whose Slack checks were shed.
+type skipChecksKey struct{}
+
+type Validator struct {
+	slackClient *MockSlackClient
+	timeout     time.Duration
+	outbox      *Outbox
+	templates   *TemplateStore
+	grid        *SlackGrid
+	channels    ChannelPolicy
+	links       LinkPolicy
+	limits      AdmissionLimits
+	messages    *messageIndex
+	lister      SlackMessageLister
+	stages      StageLister
+	checks      *CheckPool
+
+	// objectSelector mirrors the one in the deployed webhook configuration
+	// (see GenerateManifests); objects it excludes are admitted unchecked.
+	objectSelector *LabelSelector
+
+	// payloadLinks, if set, mints the full-payload links appended to
+	// truncated or redacted snippets.
+	payloadLinks *PayloadLinkSigner
+
+	suppressedMu sync.Mutex
+	suppressed   []SuppressedNotification
+
+	// admitMu serialises the quota check with recording the admitted
+	// object, so concurrent creates cannot overshoot the namespace limit.
+	admitMu sync.Mutex
+
+	overrunMu sync.Mutex
+	overruns  map[string]int
+}
+
+// teamFor returns the workspace Slack calls for msg are routed to. Outside
+// Enterprise Grid this is spec.team as given, which may be empty.
+func (v *Validator) teamFor(spec *SlackMessageSpec) (string, error) {
+	if v.grid == nil {
+		return spec.Team, nil
+	}
+	return v.grid.resolveTeam(spec.Team)
+}
+
+// callBudget bounds a Slack call by v.timeout on top of whatever deadline
+// ctx already carries. The returned done func cancels the context and
+// counts the call as an overrun if it used up its budget.
+func (v *Validator) callBudget(ctx context.Context, site string) (context.Context, func()) {
+	ctx, cancel := context.WithTimeout(ctx, v.timeout)
+	began := time.Now()
+	return ctx, func() {
+		if took := time.Since(began); took >= v.timeout || ctx.Err() == context.DeadlineExceeded {
+			v.overrunMu.Lock()
+			v.overruns[site]++
+			v.overrunMu.Unlock()
+			klog.Warningf("Slack call %s took %v (budget %v)", site, took, v.timeout)
+		}
+		cancel()
+	}
+}
+
+func NewValidator(slackClient *MockSlackClient) *Validator {
+	v := &Validator{
+		slackClient: slackClient,
+		timeout:     30 * time.Second,
+		templates:   NewTemplateStore(sharedTemplateNamespace),
+		limits:      defaultAdmissionLimits,
+		messages:    newMessageIndex(),
+		overruns:    make(map[string]int),
+		checks:      NewCheckPool(defaultCheckWorkers, defaultShedThreshold),
+	}
+	v.lister = v.messages
+	v.stages = newStageIndex()
+	v.outbox = NewOutbox(v.createChannel)
+	return v
+}
+
+func (v *Validator) ValidateMessage(ctx context.Context, msg *MockKargoMessage) (*WebhookResponse, error) {
+	return v.review(ctx, msg, false)
+}
+
+func (v *Validator) review(ctx context.Context, msg *MockKargoMessage, dryRun bool) (*WebhookResponse, error) {
+	resp := &WebhookResponse{
+		APIVersion: "admission.k8s.io/v1",
+		Kind:       "AdmissionReview",
+	}
+
+	resp.Response.Allowed = true
+	resp.Response.UID = fmt.Sprintf("test-uid-%d", time.Now().UnixNano())
+
+	refWarnings, err := v.validateSlackMessage(ctx, msg)
+	if err != nil {
+		klog.Errorf("Slack channel validation failed: %v", err)
+		resp.Response.Allowed = false
+		resp.Response.Result = map[string]string{
+			"status": "Failure",
+			"reason": fmt.Sprintf("Slack channel validation failed: %v", err),
+		}
+		return resp, err
+	}
+
+	warning, err := v.checkChannel(ctx, msg)
+	if err != nil {
+		klog.Errorf("SlackMessage %s/%s rejected: %v", msg.Metadata.Namespace, msg.Metadata.Name, err)
+		resp.Response.Allowed = false
+		resp.Response.Result = map[string]string{
+			"status":  "Failure",
+			"reason":  "Invalid",
+			"message": fmt.Sprintf("slackmessages %q is invalid: %v", msg.Metadata.Name, err),
+		}
+		return resp, err
+	}
+
+	v.admitMu.Lock()
+	if err := v.limits.check(msg, v.lister); err != nil {
+		v.admitMu.Unlock()
+		klog.Errorf("SlackMessage %s/%s rejected: %v", msg.Metadata.Namespace, msg.Metadata.Name, err)
+		resp.Response.Allowed = false
+		resp.Response.Result = map[string]string{
+			"status":  "Failure",
+			"reason":  "Forbidden",
+			"message": fmt.Sprintf("slackmessages %q is forbidden: %v", msg.Metadata.Name, err),
+		}
+		return resp, err
+	}
+	if !dryRun {
+		v.messages.add(msg.Metadata.Namespace, msg.Metadata.Name)
+	}
+	v.admitMu.Unlock()
+
+	if !dryRun {
+		team, _ := v.teamFor(&msg.Spec)
+		v.outbox.Enqueue(msg.Metadata.Namespace+"/"+msg.Metadata.Name,
+			msg.Spec.SlackChannel, team, msg.Spec.ChannelType == "private")
+		if sh := msg.Spec.Shadow; sh != nil && sh.Mode != ShadowLog {
+			v.outbox.Enqueue(msg.Metadata.Namespace+"/"+msg.Metadata.Name+"#shadow",
+				sh.Channel, team, msg.Spec.ChannelType == "private")
+		}
+	}
+
+	resp.Response.Warnings = append(refWarnings, v.muteWarnings(msg)...)
+	if warning != "" {
+		resp.Response.Warnings = append(resp.Response.Warnings, warning)
+	}
+	klog.Infof("Successfully validated Kargo message %s/%s for Slack channel %s",
+		msg.Metadata.Namespace, msg.Metadata.Name, msg.Spec.SlackChannel)
+	return resp, nil
+}
+
+// validateSlackMessage checks msg on its own. Templates it refers to that
+// are pending in ctx are stood in for, and warned about.
+func (v *Validator) validateSlackMessage(ctx context.Context, msg *MockKargoMessage) ([]string, error) {
+	if msg.Spec.SlackChannel == "" {
+		return nil, fmt.Errorf("slackChannel is required")
+	}
+
+	if msg.Metadata.Namespace == "" {
+		return nil, fmt.Errorf("namespace is required")
+	}
+
+	for _, sub := range msg.Spec.Subscriptions {
+		if sub.Stage == "" {
+			return nil, fmt.Errorf("subscription stage cannot be empty")
+		}
+		if len(sub.Events) == 0 {
+			return nil, fmt.Errorf("subscription must have at least one event")
+		}
+	}
+
+	if _, err := channelLocaleFor(&msg.Spec); err != nil {
+		return nil, err
+	}
+
+	if _, err := v.teamFor(&msg.Spec); err != nil {
+		return nil, err
+	}
+
+	refs := templateRefs(msg.Spec.Layout, msg.Spec.Message)
+	if sh := msg.Spec.Shadow; sh != nil {
+		layout, body := shadowTemplate(&msg.Spec)
+		refs = append(refs, templateRefs(layout, body)...)
+	}
+	templates, warnings := v.templates.withPending(ctx, msg.Metadata.Namespace, refs)
+
+	if _, _, err := templates.Resolve(msg.Metadata.Namespace, msg.Spec.Layout, msg.Spec.Message); err != nil {
+		return nil, fmt.Errorf("invalid message template: %w", err)
+	}
+
+	if sh := msg.Spec.Shadow; sh != nil {
+		switch sh.Mode {
+		case "", ShadowPost:
+			if sh.Channel == "" {
+				return nil, fmt.Errorf("shadow.channel is required unless shadow.mode is %q", ShadowLog)
+			}
+			if sh.Channel == msg.Spec.SlackChannel {
+				return nil, fmt.Errorf("shadow.channel must differ from slackChannel")
+			}
+		case ShadowLog:
+		default:
+			return nil, fmt.Errorf("shadow.mode must be %q or %q", ShadowPost, ShadowLog)
+		}
+		layout, body := shadowTemplate(&msg.Spec)
+		if _, _, err := templates.Resolve(msg.Metadata.Namespace, layout, body); err != nil {
+			return nil, fmt.Errorf("invalid shadow template: %w", err)
+		}
+	}
+	return warnings, nil
+}
+
+// shadowTemplate returns the layout and body used for the shadow copy.
+func shadowTemplate(spec *SlackMessageSpec) (string, string) {
+	layout, body := spec.Layout, spec.Message
+	if spec.Shadow.Layout != "" {
+		layout = spec.Shadow.Layout
+	}
+	if spec.Shadow.Message != "" {
+		body = spec.Shadow.Message
+	}
+	return layout, body
+}
+
+// Notify renders msg against data and posts it to the primary channel, then
+// handles the shadow copy. Shadow failures are logged and never affect the
+// primary delivery. Both posts carry the correlation ID from ctx in their
+// Slack metadata.
+func (v *Validator) Notify(ctx context.Context, msg *MockKargoMessage, data any) error {
+	if stage := stageFrom(ctx); v.stageMuted(msg.Metadata.Namespace, stage) {
+		key := msg.Metadata.Namespace + "/" + msg.Metadata.Name
+		klog.Infof("Suppressed notification for %s: stage %s is muted", key, stage)
+		v.suppressedMu.Lock()
+		v.suppressed = append(v.suppressed, SuppressedNotification{
+			Time:          time.Now().UTC(),
+			Message:       key,
+			Stage:         stage,
+			CorrelationID: correlationID(ctx),
+		})
+		v.suppressedMu.Unlock()
+		return nil
+	}
+	text, err := v.renderNotification(msg, msg.Spec.Layout, msg.Spec.Message, data)
+	if err != nil {
+		return fmt.Errorf("rendering message: %w", err)
+	}
+	team, err := v.teamFor(&msg.Spec)
+	if err != nil {
+		return err
+	}
+	pctx, done := v.callBudget(ctx, "chat.postMessage")
+	err = v.slackClient.PostMessage(pctx, msg.Spec.SlackChannel, text, team, notificationMetadata(ctx, msg, false))
+	done()
+	if err != nil {
+		return fmt.Errorf("posting to %s: %w", msg.Spec.SlackChannel, err)
+	}
+
+	sh := msg.Spec.Shadow
+	if sh == nil {
+		return nil
+	}
+	key := msg.Metadata.Namespace + "/" + msg.Metadata.Name
+	layout, body := shadowTemplate(&msg.Spec)
+	shadowText, err := v.renderNotification(msg, layout, body, data)
+	if err != nil {
+		klog.Warningf("Shadow render for %s failed: %v", key, err)
+		return nil
+	}
+	if sh.Mode == ShadowLog {
+		klog.Infof("Shadow notification for %s (correlation %s): %s", key, correlationID(ctx), shadowText)
+		return nil
+	}
+	pctx, done = v.callBudget(ctx, "chat.postMessage")
+	defer done()
+	if err := v.slackClient.PostMessage(pctx, sh.Channel, shadowText, team, notificationMetadata(ctx, msg, true)); err != nil {
+		klog.Warningf("Shadow post for %s to %s failed: %v", key, sh.Channel, err)
+	}
+	return nil
+}
+
+// ValidateTemplate admits a MessageTemplate and, unless dryRun is set, makes
+// it available to later SlackMessages.
+func (v *Validator) ValidateTemplate(ctx context.Context, t *MessageTemplate, dryRun bool) (*WebhookResponse, error) {
+	resp := &WebhookResponse{
+		APIVersion: "admission.k8s.io/v1",
+		Kind:       "AdmissionReview",
+	}
+	resp.Response.Allowed = true
+	resp.Response.UID = fmt.Sprintf("test-uid-%d", time.Now().UnixNano())
+
+	templates, warnings := v.templates.withPending(ctx, t.Metadata.Namespace, templateRefs(t.Spec.Extends, t.Spec.Template))
+	if err := templates.Validate(t); err != nil {
+		klog.Errorf("MessageTemplate validation failed: %v", err)
+		resp.Response.Allowed = false
+		resp.Response.Result = map[string]string{
+			"status": "Failure",
+			"reason": fmt.Sprintf("MessageTemplate validation failed: %v", err),
+		}
+		return resp, err
+	}
+
+	if !dryRun {
+		v.templates.Put(t)
+	}
+	resp.Response.Warnings = warnings
+	klog.Infof("Successfully validated MessageTemplate %s/%s", t.Metadata.Namespace, t.Metadata.Name)
+	return resp, nil
+}
+
+// createChannel is the outbox delivery function for channel creation intents.
+func (v *Validator) createChannel(ctx context.Context, intent SlackIntent) (string, error) {
+	if v.grid != nil {
+		// Grid channels can be shared between workspaces, so one that
+		// already exists anywhere in the org is reused.
+		lctx, done := v.callBudget(ctx, "conversations.list")
+		id, team, err := v.slackClient.FindConversation(lctx, intent.Channel, v.grid.searchOrder(intent.Team))
+		done()
+		if err != nil {
+			return "", fmt.Errorf("looking up Slack channel: %w", err)
+		}
+		if id != "" {
+			klog.Infof("Slack channel %s already exists in team %s, reusing it for %s", intent.Channel, team, intent.Key)
+			return id, nil
+		}
+	}
+
+	create, site := v.slackClient.CreateConversation, "conversations.create"
+	if v.grid != nil && v.grid.RestrictedChannelCreation {
+		create, site = v.slackClient.AdminCreateConversation, "admin.conversations.create"
+	}
+	ctx, done := v.callBudget(ctx, site)
+	defer done()
+
+	channelID, err := create(ctx, intent.Channel, intent.Private, intent.Team)
+	if err != nil {
+		return "", fmt.Errorf("failed to create Slack channel: %w", err)
+	}
+
+	if !v.slackClient.ChannelExists(channelID) {
+		return "", fmt.Errorf("Slack channel %s not found after creation", channelID)
+	}
+
+	klog.Infof("Slack channel %s created for message %s", intent.Channel, intent.Key)
+	return channelID, nil
+}
+
+func (v *Validator) WebhookHandler(w http.ResponseWriter, r *http.Request) {
+	// Only the object is needed, so it is kept raw and decoded once, by
+	// kind, rather than going through a generic map.
+	var req struct {
+		Request struct {
+			UID    string          `json:"uid"`
+			DryRun bool            `json:"dryRun"`
+			Object json.RawMessage `json:"object"`
+		} `json:"request"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdmissionReview)).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Failed to parse JSON", http.StatusBadRequest)
+		return
+	}
+
+	objBytes := req.Request.Object
+	if len(objBytes) == 0 || objBytes[0] != '{' {
+		http.Error(w, "Invalid object format", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	if h := r.Header.Get(pendingObjectsHeader); h != "" {
+		ctx = WithPendingObjects(ctx, parsePendingObjects(h))
+	}
+
+	var resp *WebhookResponse
+	var err error
+	var head struct {
+		Kind     string     `json:"kind"`
+		Metadata ObjectMeta `json:"metadata"`
+	}
+	json.Unmarshal(objBytes, &head)
+	if !v.objectSelector.Matches(head.Metadata.Labels) {
+		resp = &WebhookResponse{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview"}
+		resp.Response.UID = req.Request.UID
+		resp.Response.Allowed = true
+	} else if head.Kind == "MessageTemplate" {
+		var tmpl MessageTemplate
+		json.Unmarshal(objBytes, &tmpl)
+		resp, err = v.ValidateTemplate(ctx, &tmpl, req.Request.DryRun)
+	} else {
+		var msg MockKargoMessage
+		json.Unmarshal(objBytes, &msg)
+		resp, err = v.review(ctx, &msg, req.Request.DryRun)
+	}
+	if err != nil {
+		klog.Errorf("Webhook validation failed: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// BundleResult is the verdict for one SlackMessage or MessageTemplate found
+// in a rendered manifest bundle.
+type BundleResult struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Allowed   bool   `json:"allowed"`
+	Message   string `json:"message,omitempty"`
+}
+
+// unionLister reports the objects known to either lister, so that messages
+// in a bundle count against the namespace limit alongside live ones.
+type unionLister []SlackMessageLister
+
+func (u unionLister) List(namespace string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, l := range u {
+		for _, name := range l.List(namespace) {
+			if !seen[name] {
+				seen[name] = true
+				out = append(out, name)
+			}
+		}
+	}
+	return out
+}
+
+// ValidateBundle runs admission over the output of `kustomize build` or
+// `helm template` without admitting anything. Templates in the bundle are
+// visible to its messages, as they will be once the bundle is synced, and
+// objects without a namespace get defaultNamespace. Other kinds are skipped,
+// as are objects the webhook's object selector excludes.
+func (v *Validator) ValidateBundle(ctx context.Context, r io.Reader, defaultNamespace string) ([]BundleResult, error) {
+	var templates []*MessageTemplate
+	var messages []*MockKargoMessage
+	dec := yaml.NewYAMLOrJSONDecoder(r, 4096)
+	for {
+		var obj map[string]interface{}
+		if err := dec.Decode(&obj); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("decoding bundle: %w", err)
+		}
+		if obj == nil {
+			continue
+		}
+		raw, _ := json.Marshal(obj)
+		var head struct {
+			Metadata ObjectMeta `json:"metadata"`
+		}
+		json.Unmarshal(raw, &head)
+		if !v.objectSelector.Matches(head.Metadata.Labels) {
+			continue
+		}
+		switch obj["kind"] {
+		case "MessageTemplate":
+			t := &MessageTemplate{}
+			if err := json.Unmarshal(raw, t); err != nil {
+				return nil, fmt.Errorf("decoding MessageTemplate: %w", err)
+			}
+			if t.Metadata.Namespace == "" {
+				t.Metadata.Namespace = defaultNamespace
+			}
+			templates = append(templates, t)
+		case "SlackMessage":
+			m := &MockKargoMessage{}
+			if err := json.Unmarshal(raw, m); err != nil {
+				return nil, fmt.Errorf("decoding SlackMessage: %w", err)
+			}
+			if m.Metadata.Namespace == "" {
+				m.Metadata.Namespace = defaultNamespace
+			}
+			messages = append(messages, m)
+		}
+	}
+
+	scratch := &Validator{
+		templates: v.templates.clone(),
+		grid:      v.grid,
+		channels:  v.channels,
+		links:     v.links,
+		limits:    v.limits,
+		messages:  newMessageIndex(),
+	}
+	scratch.lister = unionLister{v.lister, scratch.messages}
+	for _, t := range templates {
+		scratch.templates.Put(t)
+	}
+
+	var results []BundleResult
+	for _, t := range templates {
+		res := BundleResult{Kind: t.Kind, Namespace: t.Metadata.Namespace, Name: t.Metadata.Name, Allowed: true}
+		if err := scratch.templates.Validate(t); err != nil {
+			res.Allowed, res.Message = false, err.Error()
+		}
+		results = append(results, res)
+	}
+	for _, m := range messages {
+		res := BundleResult{Kind: m.Kind, Namespace: m.Metadata.Namespace, Name: m.Metadata.Name, Allowed: true}
+		if _, err := scratch.review(ctx, m, true); err != nil {
+			res.Allowed, res.Message = false, err.Error()
+		} else {
+			scratch.messages.add(m.Metadata.Namespace, m.Metadata.Name)
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// BundleHandler serves POST /validate/bundle for CI pipelines. The body is
+// a multi-document YAML bundle; ?namespace= sets the default namespace. It
+// answers 422 if any object would be rejected.
+func (v *Validator) BundleHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	results, err := v.ValidateBundle(r.Context(), r.Body, r.URL.Query().Get("namespace"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !bundleAllowed(results) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	json.NewEncoder(w).Encode(results)
+}
+
+func bundleAllowed(results []BundleResult) bool {
+	for _, res := range results {
+		if !res.Allowed {
+			return false
+		}
+	}
+	return true
+}
+
+// runValidateBundle implements `validate-bundle [-namespace ns] [-server url] file`.
+// With -server the bundle is checked by a running webhook against its live
+// templates; otherwise only the bundle's own templates are known.
+func runValidateBundle(args []string) int {
+	fs := flag.NewFlagSet("validate-bundle", flag.ExitOnError)
+	namespace := fs.String("namespace", "default", "namespace for objects that do not set one")
+	server := fs.String("server", "", "base URL of a running webhook to validate against")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: validate-bundle [-namespace ns] [-server url] <file|->")
+		return 2
+	}
+
+	in := os.Stdin
+	if p := fs.Arg(0); p != "-" {
+		f, err := os.Open(p)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		defer f.Close()
+		in = f
+	}
+
+	var results []BundleResult
+	if *server != "" {
+		resp, err := http.Post(strings.TrimSuffix(*server, "/")+"/validate/bundle?namespace="+url.QueryEscape(*namespace),
+			"application/yaml", in)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusUnprocessableEntity {
+			msg, _ := io.ReadAll(resp.Body)
+			fmt.Fprintf(os.Stderr, "webhook returned %s: %s\n", resp.Status, msg)
+			return 2
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	} else {
+		var err error
+		results, err = NewValidator(NewMockSlackClient()).ValidateBundle(context.Background(), in, *namespace)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+
+	for _, res := range results {
+		verdict := "ok"
+		if !res.Allowed {
+			verdict = "DENIED: " + res.Message
+		}
+		fmt.Printf("%s %s/%s: %s\n", res.Kind, res.Namespace, res.Name, verdict)
+	}
+	if !bundleAllowed(results) {
+		return 1
+	}
+	return 0
+}
+
+// admissionRoute is one kind the webhook admits. `manifests generate`
+// derives the webhook configurations from admissionRoutes, so the API
+// server only sends what WebhookHandler actually handles.
+type admissionRoute struct {
+	Kind       string
+	Resource   string
+	Path       string
+	Operations []string
+	// Mutating routes go into a MutatingWebhookConfiguration.
+	Mutating bool
+}
+
+const kargoAPIGroup = "kargo.akuity.io"
+
+var admissionRoutes = []admissionRoute{
+	{Kind: "SlackMessage", Resource: "slackmessages", Path: "/validate", Operations: []string{"CREATE", "UPDATE"}},
+	{Kind: "MessageTemplate", Resource: "messagetemplates", Path: "/validate", Operations: []string{"CREATE", "UPDATE"}},
+}
+
+// LabelSelector is the Kubernetes label selector, as used for a webhook's
+// namespaceSelector and objectSelector. A nil selector matches everything.
+type LabelSelector struct {
+	MatchLabels      map[string]string          `json:"matchLabels,omitempty"`
+	MatchExpressions []LabelSelectorRequirement `json:"matchExpressions,omitempty"`
+}
+
+type LabelSelectorRequirement struct {
+	Key      string   `json:"key"`
+	Operator string   `json:"operator"`
+	Values   []string `json:"values,omitempty"`
+}
+
+// ParseLabelSelector parses kubectl's selector syntax: comma-separated
+// key=value, key!=value, key in (a,b), key notin (a,b), key and !key.
+func ParseLabelSelector(src string) (*LabelSelector, error) {
+	if strings.TrimSpace(src) == "" {
+		return nil, nil
+	}
+	var terms []string
+	depth, start := 0, 0
+	for i, r := range src {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				terms = append(terms, src[start:i])
+				start = i + 1
+			}
+		}
+	}
+	terms = append(terms, src[start:])
+
+	s := &LabelSelector{}
+	for _, term := range terms {
+		term = strings.TrimSpace(term)
+		fields := strings.Fields(term)
+		switch {
+		case len(fields) >= 2 && (fields[1] == "in" || fields[1] == "notin"):
+			list := strings.TrimSpace(strings.Join(fields[2:], " "))
+			if !strings.HasPrefix(list, "(") || !strings.HasSuffix(list, ")") {
+				return nil, fmt.Errorf("selector %q: %s needs a parenthesised list", term, fields[1])
+			}
+			var values []string
+			for _, v := range strings.Split(list[1:len(list)-1], ",") {
+				values = append(values, strings.TrimSpace(v))
+			}
+			op := "In"
+			if fields[1] == "notin" {
+				op = "NotIn"
+			}
+			s.MatchExpressions = append(s.MatchExpressions, LabelSelectorRequirement{Key: fields[0], Operator: op, Values: values})
+		case strings.Contains(term, "!="):
+			k, v, _ := strings.Cut(term, "!=")
+			s.MatchExpressions = append(s.MatchExpressions, LabelSelectorRequirement{
+				Key: strings.TrimSpace(k), Operator: "NotIn", Values: []string{strings.TrimSpace(v)}})
+		case strings.Contains(term, "="):
+			k, v, _ := strings.Cut(strings.Replace(term, "==", "=", 1), "=")
+			if s.MatchLabels == nil {
+				s.MatchLabels = make(map[string]string)
+			}
+			s.MatchLabels[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		case strings.HasPrefix(term, "!") && len(fields) == 1:
+			s.MatchExpressions = append(s.MatchExpressions, LabelSelectorRequirement{Key: term[1:], Operator: "DoesNotExist"})
+		case len(fields) == 1:
+			s.MatchExpressions = append(s.MatchExpressions, LabelSelectorRequirement{Key: term, Operator: "Exists"})
+		default:
+			return nil, fmt.Errorf("invalid selector term %q", term)
+		}
+	}
+	return s, nil
+}
+
+// Matches reports whether labels satisfy s.
+func (s *LabelSelector) Matches(labels map[string]string) bool {
+	if s == nil {
+		return true
+	}
+	for k, v := range s.MatchLabels {
+		if labels[k] != v {
+			return false
+		}
+	}
+	for _, req := range s.MatchExpressions {
+		v, ok := labels[req.Key]
+		listed := false
+		for _, want := range req.Values {
+			listed = listed || ok && v == want
+		}
+		switch req.Operator {
+		case "In":
+			if !listed {
+				return false
+			}
+		case "NotIn":
+			if listed {
+				return false
+			}
+		case "Exists":
+			if !ok {
+				return false
+			}
+		case "DoesNotExist":
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ManifestOptions are the deployment details `manifests generate` cannot
+// derive from the code.
+type ManifestOptions struct {
+	Name             string
+	ServiceName      string
+	ServiceNamespace string
+	ServicePort      int32
+	CABundle         []byte
+	// FailurePolicy is Fail or Ignore.
+	FailurePolicy     string
+	TimeoutSeconds    int32
+	NamespaceSelector *LabelSelector
+	ObjectSelector    *LabelSelector
+}
+
+type webhookConfiguration struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Metadata   map[string]string `json:"metadata"`
+	Webhooks   []admissionHook   `json:"webhooks"`
+}
+
+type admissionRule struct {
+	APIGroups   []string `json:"apiGroups"`
+	APIVersions []string `json:"apiVersions"`
+	Operations  []string `json:"operations"`
+	Resources   []string `json:"resources"`
+	Scope       string   `json:"scope"`
+}
+
+type admissionHook struct {
+	Name         string `json:"name"`
+	ClientConfig struct {
+		Service struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+			Path      string `json:"path"`
+			Port      int32  `json:"port"`
+		} `json:"service"`
+		CABundle []byte `json:"caBundle,omitempty"`
+	} `json:"clientConfig"`
+	Rules                   []admissionRule `json:"rules"`
+	NamespaceSelector       *LabelSelector  `json:"namespaceSelector,omitempty"`
+	ObjectSelector          *LabelSelector  `json:"objectSelector,omitempty"`
+	FailurePolicy           string          `json:"failurePolicy"`
+	SideEffects             string          `json:"sideEffects"`
+	TimeoutSeconds          int32           `json:"timeoutSeconds"`
+	AdmissionReviewVersions []string        `json:"admissionReviewVersions"`
+}
+
+// GenerateManifests returns the webhook configurations for admissionRoutes,
+// validating first and then mutating, leaving out a kind with no routes.
+// Channel creation is deferred to the outbox and skipped for dry runs, so
+// the webhooks declare NoneOnDryRun side effects.
+func GenerateManifests(opts ManifestOptions) ([]webhookConfiguration, error) {
+	if opts.FailurePolicy != "Fail" && opts.FailurePolicy != "Ignore" {
+		return nil, fmt.Errorf("failure policy must be Fail or Ignore, not %q", opts.FailurePolicy)
+	}
+	if opts.TimeoutSeconds < 1 || opts.TimeoutSeconds > 30 {
+		return nil, fmt.Errorf("timeout must be between 1 and 30 seconds")
+	}
+	var out []webhookConfiguration
+	for _, mutating := range []bool{false, true} {
+		cfg := webhookConfiguration{
+			APIVersion: "admissionregistration.k8s.io/v1",
+			Kind:       "ValidatingWebhookConfiguration",
+			Metadata:   map[string]string{"name": opts.Name},
+		}
+		if mutating {
+			cfg.Kind = "MutatingWebhookConfiguration"
+		}
+		for _, r := range admissionRoutes {
+			if r.Mutating != mutating {
+				continue
+			}
+			h := admissionHook{
+				Name:                    r.Resource + "." + opts.Name + "." + kargoAPIGroup,
+				NamespaceSelector:       opts.NamespaceSelector,
+				ObjectSelector:          opts.ObjectSelector,
+				FailurePolicy:           opts.FailurePolicy,
+				SideEffects:             "NoneOnDryRun",
+				TimeoutSeconds:          opts.TimeoutSeconds,
+				AdmissionReviewVersions: []string{"v1"},
+			}
+			svc := &h.ClientConfig.Service
+			svc.Name, svc.Namespace, svc.Path, svc.Port = opts.ServiceName, opts.ServiceNamespace, r.Path, opts.ServicePort
+			h.ClientConfig.CABundle = opts.CABundle
+			h.Rules = []admissionRule{{
+				APIGroups:   []string{kargoAPIGroup},
+				APIVersions: []string{"v1alpha1"},
+				Operations:  r.Operations,
+				Resources:   []string{r.Resource},
+				Scope:       "Namespaced",
+			}}
+			cfg.Webhooks = append(cfg.Webhooks, h)
+		}
+		if len(cfg.Webhooks) > 0 {
+			out = append(out, cfg)
+		}
+	}
+	return out, nil
+}
+
+// runManifestsGenerate implements `manifests generate`, writing the webhook
+// configurations to stdout as a multi-document YAML stream.
+func runManifestsGenerate(args []string) int {
+	fs := flag.NewFlagSet("manifests generate", flag.ExitOnError)
+	opts := ManifestOptions{}
+	fs.StringVar(&opts.Name, "name", "kargo-notifications", "webhook configuration name")
+	fs.StringVar(&opts.ServiceName, "service-name", "kargo-notifications-webhook", "Service in front of the webhook")
+	fs.StringVar(&opts.ServiceNamespace, "service-namespace", sharedTemplateNamespace, "namespace of the Service")
+	port := fs.Int("service-port", 443, "Service port")
+	caFile := fs.String("ca-bundle", "", "PEM file with the CA that signed the serving certificate")
+	fs.StringVar(&opts.FailurePolicy, "failure-policy", "Fail", "Fail or Ignore")
+	timeout := fs.Int("timeout", 10, "admission timeout in seconds (1-30)")
+	nsSelector := fs.String("namespace-selector", "", "label selector for namespaces to admit, e.g. 'kargo.akuity.io/project=true'")
+	objSelector := fs.String("object-selector", "", "label selector for objects to admit")
+	fs.Parse(args)
+
+	opts.ServicePort, opts.TimeoutSeconds = int32(*port), int32(*timeout)
+	var err error
+	if *caFile != "" {
+		if opts.CABundle, err = os.ReadFile(*caFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+	if opts.NamespaceSelector, err = ParseLabelSelector(*nsSelector); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if opts.ObjectSelector, err = ParseLabelSelector(*objSelector); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	manifests, err := GenerateManifests(opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	for i, m := range manifests {
+		if i > 0 {
+			fmt.Println("---")
+		}
+		b, _ := json.MarshalIndent(m, "", "  ")
+		fmt.Println(string(b))
+	}
+	return 0
+}
+
+// PolicyTestSuite is a user-authored set of admission test cases, run by
+// `policy test`. Limits, Channels and Templates describe the policy under
+// test and Existing seeds the SlackMessages already present, by namespace.
+type PolicyTestSuite struct {
+	Limits    *AdmissionLimits    `json:"limits,omitempty"`
+	Channels  *ChannelPolicy      `json:"channels,omitempty"`
+	Links     *LinkPolicy         `json:"links,omitempty"`
+	Templates []*MessageTemplate  `json:"templates,omitempty"`
+	Existing  map[string][]string `json:"existing,omitempty"`
+	Cases     []PolicyTestCase    `json:"cases"`
+}
+
+type PolicyTestCase struct {
+	Name   string                 `json:"name"`
+	Object map[string]interface{} `json:"object"`
+	Expect struct {
+		Allowed bool `json:"allowed"`
+		// MessageContains, if set, must appear in the rejection message.
+		MessageContains string `json:"messageContains,omitempty"`
+	} `json:"expect"`
+}
+
+type PolicyTestResult struct {
+	Name    string `json:"name"`
+	Passed  bool   `json:"passed"`
+	Allowed bool   `json:"allowed"`
+	Message string `json:"message,omitempty"`
+}
+
+// newPolicyValidator builds a validator with the suite's policy. Every case
+// gets its own, so cases cannot affect each other.
+func (s *PolicyTestSuite) newPolicyValidator() (*Validator, error) {
+	v := NewValidator(NewMockSlackClient())
+	if s.Limits != nil {
+		v.limits = *s.Limits
+	}
+	if s.Channels != nil {
+		v.channels = *s.Channels
 	}
-
-	if msg.Metadata.Namespace == "" {
-		return fmt.Errorf("namespace is required")
+	if s.Links != nil {
+		v.links = *s.Links
 	}
-
-	channelID, err := v.slackClient.CreateConversation(ctx, msg.Spec.SlackChannel, 
-		msg.Spec.ChannelType == "private")
-	if err != nil {
-		return fmt.Errorf("failed to create Slack channel: %w", err)
+	for _, t := range s.Templates {
+		if err := v.templates.Validate(t); err != nil {
+			return nil, fmt.Errorf("template %s/%s: %w", t.Metadata.Namespace, t.Metadata.Name, err)
+		}
+		v.templates.Put(t)
 	}
-
-	if !v.slackClient.ChannelExists(channelID) {
-		return fmt.Errorf("Slack channel %s not found after creation", channelID)
+	for ns, names := range s.Existing {
+		for _, name := range names {
+			v.messages.add(ns, name)
+		}
 	}
+	return v, nil
+}
 
-	time.Sleep(100 * time.Millisecond)
-	
-	for _, sub := range msg.Spec.Subscriptions {
-		if sub.Stage == "" {
-			return fmt.Errorf("subscription stage cannot be empty")
+// RunPolicyTests evaluates every case as a dry-run admission.
+func RunPolicyTests(ctx context.Context, suite *PolicyTestSuite) ([]PolicyTestResult, error) {
+	var results []PolicyTestResult
+	for i, c := range suite.Cases {
+		if c.Name == "" {
+			c.Name = fmt.Sprintf("case %d", i+1)
 		}
-		if len(sub.Events) == 0 {
-			return fmt.Errorf("subscription must have at least one event")
+		v, err := suite.newPolicyValidator()
+		if err != nil {
+			return nil, err
 		}
-	}
 
-	klog.Infof("Slack channel %s validated successfully for message %s", 
-		msg.Spec.SlackChannel, msg.Metadata.Name)
-	return nil
-}
+		raw, _ := json.Marshal(c.Object)
+		if c.Object["kind"] == "MessageTemplate" {
+			var t MessageTemplate
+			if err = json.Unmarshal(raw, &t); err == nil {
+				err = v.templates.Validate(&t)
+			}
+		} else {
+			var msg MockKargoMessage
+			if err = json.Unmarshal(raw, &msg); err == nil {
+				_, err = v.review(ctx, &msg, true)
+			}
+		}
 
-func (v *Validator) WebhookHandler(w http.ResponseWriter, r *http.Request) {
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
-		return
+		res := PolicyTestResult{Name: c.Name, Allowed: err == nil}
+		if err != nil {
+			res.Message = err.Error()
+		}
+		res.Passed = res.Allowed == c.Expect.Allowed &&
+			(c.Expect.MessageContains == "" || strings.Contains(res.Message, c.Expect.MessageContains))
+		results = append(results, res)
 	}
+	return results, nil
+}
 
-	var req WebhookRequest
-	if err := json.Unmarshal(body, &req); err != nil {
-		http.Error(w, "Failed to parse JSON", http.StatusBadRequest)
-		return
+// runPolicyTest implements `policy test <suite.yaml>...`.
+func runPolicyTest(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: policy test <suite.yaml>...")
+		return 2
 	}
+	failed := 0
+	for _, path := range args {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		var suite PolicyTestSuite
+		err = yaml.NewYAMLOrJSONDecoder(f, 4096).Decode(&suite)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			return 2
+		}
 
-	var msg MockKargoMessage
-	if obj, ok := req.Request.Object.(map[string]interface{}); ok {
-		msgBytes, _ := json.Marshal(obj)
-		json.Unmarshal(msgBytes, &msg)
-	} else {
-		http.Error(w, "Invalid object format", http.StatusBadRequest)
-		return
+		results, err := RunPolicyTests(context.Background(), &suite)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			return 2
+		}
+		for _, res := range results {
+			verdict := "PASS"
+			if !res.Passed {
+				verdict = "FAIL"
+				failed++
+			}
+			fmt.Printf("%s %s: %s (allowed=%v)", verdict, path, res.Name, res.Allowed)
+			if res.Message != "" {
+				fmt.Printf(" %s", res.Message)
+			}
+			fmt.Println()
+		}
 	}
-
-	resp, err := v.ValidateMessage(r.Context(), &msg)
-	if err != nil {
-		klog.Errorf("Webhook validation failed: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(resp)
-		return
+	if failed > 0 {
+		fmt.Printf("%d case(s) failed\n", failed)
+		return 1
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(resp)
+	return 0
 }
 
 func TestWebhookValidator_Success(t *testing.T) {
@@ -237,32 +2685,16 @@ func TestWebhookValidator_Success(t *testing.T) {
 	msg := &MockKargoMessage{
 		APIVersion: "kargo.akuity.io/v1alpha1",
 		Kind:       "SlackMessage",
-		Metadata: struct {
-			Name      string            `json:"name"`
-			Namespace string            `json:"namespace"`
-			Labels    map[string]string `json:"labels,omitempty"`
-		}{
+		Metadata: ObjectMeta{
 			Name:      "test-slack-msg",
 			Namespace: "kargo",
 			Labels:    map[string]string{"app": "kargo"},
 		},
-		Spec: struct {
-			SlackChannel string `json:"slackChannel"`
-			Message      string `json:"message"`
-			Team         string `json:"team,omitempty"`
-			ChannelType  string `json:"channelType,omitempty"`
-			Subscriptions []struct {
-				Stage string `json:"stage"`
-				Events []string `json:"events"`
-			} `json:"subscriptions,omitempty"`
-		}{
+		Spec: SlackMessageSpec{
 			SlackChannel: "kargo-notifications",
 			Message:      "Pipeline {{.Stage.Name}} completed successfully",
 			ChannelType:  "public",
-			Subscriptions: []struct {
-				Stage string `json:"stage"`
-				Events []string `json:"events"`
-			}{
+			Subscriptions: []Subscription{
 				{Stage: "production", Events: []string{"PromoteSucceeded"}},
 				{Stage: "staging", Events: []string{"PromoteFailed"}},
 			},
@@ -282,24 +2714,11 @@ func TestWebhookValidator_MissingChannel(t *testing.T) {
 	msg := &MockKargoMessage{
 		APIVersion: "kargo.akuity.io/v1alpha1",
 		Kind:       "SlackMessage",
-		Metadata: struct {
-			Name      string            `json:"name"`
-			Namespace string            `json:"namespace"`
-			Labels    map[string]string `json:"labels,omitempty"`
-		}{
+		Metadata: ObjectMeta{
 			Name:      "invalid-msg",
 			Namespace: "kargo",
 		},
-		Spec: struct {
-			SlackChannel string `json:"slackChannel"`
-			Message      string `json:"message"`
-			Team         string `json:"team,omitempty"`
-			ChannelType  string `json:"channelType,omitempty"`
-			Subscriptions []struct {
-				Stage string `json:"stage"`
-				Events []string `json:"events"`
-			} `json:"subscriptions,omitempty"`
-		}{
+		Spec: SlackMessageSpec{
 			Message: "Test message",
 		},
 	}
@@ -320,24 +2739,11 @@ func TestWebhookValidator_HTTPHandler(t *testing.T) {
 	validMsg := MockKargoMessage{
 		APIVersion: "kargo.akuity.io/v1alpha1",
 		Kind:       "SlackMessage",
-		Metadata: struct {
-			Name      string            `json:"name"`
-			Namespace string            `json:"namespace"`
-			Labels    map[string]string `json:"labels,omitempty"`
-		}{
+		Metadata: ObjectMeta{
 			Name:      "http-test",
 			Namespace: "default",
 		},
-		Spec: struct {
-			SlackChannel string `json:"slackChannel"`
-			Message      string `json:"message"`
-			Team         string `json:"team,omitempty"`
-			ChannelType  string `json:"channelType,omitempty"`
-			Subscriptions []struct {
-				Stage string `json:"stage"`
-				Events []string `json:"events"`
-			} `json:"subscriptions,omitempty"`
-		}{
+		Spec: SlackMessageSpec{
 			SlackChannel: "devops-notifications",
 			Message:      "Deployment {{.Pipeline.Name}} succeeded",
 		},
@@ -347,21 +2753,21 @@ func TestWebhookValidator_HTTPHandler(t *testing.T) {
 		APIVersion: "admission.k8s.io/v1",
 		Kind:       "AdmissionReview",
 		Request: struct {
-			UID             string `json:"uid"`
-			DryRun          bool   `json:"dryRun"`
-			UserInfo        any    `json:"userInfo"`
-			Object          any    `json:"object"`
-			OldObject       any    `json:"oldObject,omitempty"`
-			Resource        struct {
-				Group     string `json:"group"`
-				Version   string `json:"version"`
-				Resource  string `json:"resource"`
+			UID       string `json:"uid"`
+			DryRun    bool   `json:"dryRun"`
+			UserInfo  any    `json:"userInfo"`
+			Object    any    `json:"object"`
+			OldObject any    `json:"oldObject,omitempty"`
+			Resource  struct {
+				Group    string `json:"group"`
+				Version  string `json:"version"`
+				Resource string `json:"resource"`
 			} `json:"resource"`
 			SubResource string `json:"subResource"`
 		}{
-			UID:     "test-http-uid",
-			DryRun:  false,
-			Object:  validMsg,
+			UID:    "test-http-uid",
+			DryRun: false,
+			Object: validMsg,
 			Resource: struct {
 				Group    string `json:"group"`
 				Version  string `json:"version"`
@@ -382,6 +2788,8 @@ func TestWebhookValidator_HTTPHandler(t *testing.T) {
 	var webhookResp WebhookResponse
 	json.NewDecoder(resp.Body).Decode(&webhookResp)
 	assert.True(t, webhookResp.Response.Allowed)
+
+	validator.outbox.ProcessPending(context.Background())
 	assert.NotEmpty(t, slackClient.lastChannelReq)
 	assert.Equal(t, "devops-notifications", slackClient.lastChannelReq)
 }
@@ -401,24 +2809,11 @@ func TestConcurrentValidations(t *testing.T) {
 			msg := &MockKargoMessage{
 				APIVersion: "kargo.akuity.io/v1alpha1",
 				Kind:       "SlackMessage",
-				Metadata: struct {
-					Name      string            `json:"name"`
-					Namespace string            `json:"namespace"`
-					Labels    map[string]string `json:"labels,omitempty"`
-				}{
+				Metadata: ObjectMeta{
 					Name:      fmt.Sprintf("concurrent-%d", id),
 					Namespace: "concurrent-test",
 				},
-				Spec: struct {
-					SlackChannel string `json:"slackChannel"`
-					Message      string `json:"message"`
-					Team         string `json:"team,omitempty"`
-					ChannelType  string `json:"channelType,omitempty"`
-					Subscriptions []struct {
-						Stage string `json:"stage"`
-						Events []string `json:"events"`
-					} `json:"subscriptions,omitempty"`
-				}{
+				Spec: SlackMessageSpec{
 					SlackChannel: fmt.Sprintf("team-channel-%d", id),
 					Message:      fmt.Sprintf("Concurrent test %d", id),
 				},
@@ -431,6 +2826,7 @@ func TestConcurrentValidations(t *testing.T) {
 
 	wg.Wait()
 	close(results)
+	validator.outbox.ProcessPending(context.Background())
 
 	successCount := 0
 	for resp := range results {
@@ -443,48 +2839,612 @@ func TestConcurrentValidations(t *testing.T) {
 	assert.GreaterOrEqual(t, len(slackClient.channels), numGoroutines/2, "Should create multiple Slack channels")
 }
 
-func TestTimeoutValidation(t *testing.T) {
-	slackClient := NewMockSlackClient()
-	validator := &Validator{
-		slackClient: slackClient,
-		timeout:     10 * time.Millisecond,
-	}
-
-	originalCreate := slackClient.CreateConversation
-	slowCtx := context.Background()
-	
+func testMessage(namespace, name, channel string) *MockKargoMessage {
 	msg := &MockKargoMessage{
 		APIVersion: "kargo.akuity.io/v1alpha1",
 		Kind:       "SlackMessage",
-		Metadata: struct {
-			Name      string            `json:"name"`
-			Namespace string            `json:"namespace"`
-			Labels    map[string]string `json:"labels,omitempty"`
-		}{
-			Name:      "timeout-test",
-			Namespace: "kargo",
-		},
-		Spec: struct {
-			SlackChannel string `json:"slackChannel"`
-			Message      string `json:"message"`
-			Team         string `json:"team,omitempty"`
-			ChannelType  string `json:"channelType,omitempty"`
-			Subscriptions []struct {
-				Stage string `json:"stage"`
-				Events []string `json:"events"`
-			} `json:"subscriptions,omitempty"`
-		}{
-			SlackChannel: "timeout-channel",
-			Message:      "This should timeout",
-		},
 	}
+	msg.Metadata.Namespace = namespace
+	msg.Metadata.Name = name
+	msg.Spec.SlackChannel = channel
+	msg.Spec.Message = "Freight promoted"
+	return msg
+}
 
-	resp, err := validator.ValidateMessage(slowCtx, msg)
-	assert.Error(t, err)
+func TestAdmissionDefersSlackSideEffects(t *testing.T) {
+	slackClient := NewMockSlackClient()
+	validator := NewValidator(slackClient)
+
+	resp, err := validator.ValidateMessage(context.Background(), testMessage("kargo", "deferred", "deferred-channel"))
+	require.NoError(t, err)
+	assert.True(t, resp.Response.Allowed)
+	assert.Empty(t, slackClient.lastChannelReq, "admission must not call Slack")
+
+	intent, ok := validator.outbox.Status("kargo/deferred")
+	require.True(t, ok)
+	assert.Equal(t, IntentPending, intent.State)
+
+	// Re-applying the same object does not create a second intent.
+	validator.ValidateMessage(context.Background(), testMessage("kargo", "deferred", "deferred-channel"))
+	assert.Equal(t, 1, validator.outbox.ProcessPending(context.Background()))
+
+	intent, _ = validator.outbox.Status("kargo/deferred")
+	assert.Equal(t, IntentSucceeded, intent.State)
+	assert.NotEmpty(t, intent.ChannelID)
+	assert.Equal(t, "deferred-channel", slackClient.lastChannelReq)
+}
+
+func TestOutboxRetriesFailedDelivery(t *testing.T) {
+	slackClient := NewMockSlackClient()
+	slackClient.failNext = 2
+	validator := NewValidator(slackClient)
+	validator.outbox.baseBackoff = 0
+
+	_, err := validator.ValidateMessage(context.Background(), testMessage("kargo", "retry", "retry-channel"))
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		validator.outbox.ProcessPending(context.Background())
+	}
+
+	intent, _ := validator.outbox.Status("kargo/retry")
+	assert.Equal(t, IntentSucceeded, intent.State)
+	assert.Equal(t, 3, intent.Attempts)
+	assert.Empty(t, intent.LastError)
+}
+
+func TestDryRunSkipsOutbox(t *testing.T) {
+	validator := NewValidator(NewMockSlackClient())
+
+	_, err := validator.review(context.Background(), testMessage("kargo", "dry", "dry-channel"), true)
+	require.NoError(t, err)
+
+	_, ok := validator.outbox.Status("kargo/dry")
+	assert.False(t, ok)
+}
+
+func testTemplate(namespace, name, extends, body string) *MessageTemplate {
+	t := &MessageTemplate{APIVersion: "kargo.akuity.io/v1alpha1", Kind: "MessageTemplate"}
+	t.Metadata.Namespace = namespace
+	t.Metadata.Name = name
+	t.Spec.Extends = extends
+	t.Spec.Template = body
+	return t
+}
+
+func TestTemplateInheritance(t *testing.T) {
+	validator := NewValidator(NewMockSlackClient())
+	ctx := context.Background()
+
+	for _, tmpl := range []*MessageTemplate{
+		testTemplate(sharedTemplateNamespace, "branding", "", `{{define "footer"}}-- Kargo{{end}}`),
+		testTemplate(sharedTemplateNamespace, "base", "", `[{{block "title" .}}Update{{end}}] {{block "body" .}}{{end}} {{template "footer" .}}`),
+		testTemplate("team-a", "team", "base", `{{define "title"}}Team A{{end}}`),
+		// team-a overrides the shared footer.
+		testTemplate("team-a", "branding", "", `{{define "footer"}}-- Team A{{end}}`),
+	} {
+		_, err := validator.ValidateTemplate(ctx, tmpl, false)
+		require.NoError(t, err)
+	}
+
+	out, err := validator.templates.Render("team-a", "team", `{{define "body"}}{{.Stage}} promoted{{end}}`,
+		map[string]string{"Stage": "prod"})
+	require.NoError(t, err)
+	assert.Equal(t, "[Team A] prod promoted -- Team A", out)
+
+	out, err = validator.templates.Render("team-b", "base", `{{define "body"}}{{.Stage}} promoted{{end}}`,
+		map[string]string{"Stage": "uat"})
+	require.NoError(t, err)
+	assert.Equal(t, "[Update] uat promoted -- Kargo", out)
+}
+
+func TestTemplateCyclesRejected(t *testing.T) {
+	validator := NewValidator(NewMockSlackClient())
+	ctx := context.Background()
+
+	_, err := validator.ValidateTemplate(ctx, testTemplate("kargo", "a", "b", `a`), false)
+	require.Error(t, err, "layout b does not exist yet")
+
+	_, err = validator.ValidateTemplate(ctx, testTemplate("kargo", "b", "", `{{define "x"}}{{template "y" .}}{{end}}`), false)
+	require.Error(t, err, "partial y does not exist")
+
+	_, err = validator.ValidateTemplate(ctx, testTemplate("kargo", "loop", "", `{{define "x"}}{{template "y" .}}{{end}}{{define "y"}}{{template "x" .}}{{end}}`), false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "template cycle")
+
+	_, err = validator.ValidateTemplate(ctx, testTemplate("kargo", "c", "", `c`), false)
+	require.NoError(t, err)
+	_, err = validator.ValidateTemplate(ctx, testTemplate("kargo", "c", "c", `c`), false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "extends itself")
+
+	msg := testMessage("kargo", "uses-missing", "channel")
+	msg.Spec.Message = `{{template "missing" .}}`
+	resp, err := validator.ValidateMessage(ctx, msg)
+	require.Error(t, err)
 	assert.False(t, resp.Response.Allowed)
-	assert.Contains(t, resp.Response.Result.(map[string]string)["reason"], "timeout")
+}
+
+func TestChannelLocaleRendering(t *testing.T) {
+	validator := NewValidator(NewMockSlackClient())
+
+	msg := testMessage("kargo", "tz", "tz-channel")
+	msg.Spec.Timezone = "Europe/Berlin"
+	msg.Spec.Locale = "de-DE"
+	msg.Spec.Message = `{{formatTime .PushedAt}} ({{formatDuration .Duration}})`
+	_, err := validator.ValidateMessage(context.Background(), msg)
+	require.NoError(t, err)
+
+	out, err := validator.templates.RenderMessage(msg, map[string]any{
+		"PushedAt": 1700000000,
+		"Duration": "1h5m3s",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "14.11.2023 23:13 CET (1 Std. 5 Min. 3 Sek.)", out)
+
+	msg.Spec.Timezone = "Mars/Olympus"
+	_, err = validator.ValidateMessage(context.Background(), msg)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown timezone")
+}
+
+func TestAdmissionLimits(t *testing.T) {
+	validator := NewValidator(NewMockSlackClient())
+	validator.limits = AdmissionLimits{MaxMessageLength: 20, MaxSubscriptions: 1, MaxMessagesPerNamespace: 2}
+	ctx := context.Background()
+
+	msg := testMessage("team-a", "long", "channel")
+	msg.Spec.Message = strings.Repeat("x", 21)
+	resp, err := validator.ValidateMessage(ctx, msg)
+	require.Error(t, err)
+	assert.False(t, resp.Response.Allowed)
+	assert.Contains(t, resp.Response.Result.(map[string]string)["message"], "exceeded quota: spec.message length")
+
+	msg = testMessage("team-a", "subs", "channel")
+	msg.Spec.Subscriptions = []Subscription{
+		{Stage: "uat", Events: []string{"promoted"}},
+		{Stage: "prod", Events: []string{"promoted"}},
+	}
+	_, err = validator.ValidateMessage(ctx, msg)
+	require.Error(t, err)
+
+	for _, name := range []string{"one", "two"} {
+		_, err = validator.ValidateMessage(ctx, testMessage("team-a", name, name+"-channel"))
+		require.NoError(t, err)
+	}
+	_, err = validator.ValidateMessage(ctx, testMessage("team-a", "three", "three-channel"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "used: 2, limited: 2")
+
+	// Updating an existing object and other namespaces are unaffected.
+	_, err = validator.ValidateMessage(ctx, testMessage("team-a", "one", "one-channel"))
+	require.NoError(t, err)
+	_, err = validator.ValidateMessage(ctx, testMessage("team-b", "three", "three-channel"))
+	require.NoError(t, err)
+}
+
+func TestValidateBundle(t *testing.T) {
+	validator := NewValidator(NewMockSlackClient())
+	ctx := context.Background()
+	_, err := validator.ValidateTemplate(ctx, testTemplate(sharedTemplateNamespace, "base", "", `[{{block "body" .}}{{end}}]`), false)
+	require.NoError(t, err)
+
+	bundle := `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "ignored"}}
+{"apiVersion": "kargo.akuity.io/v1alpha1", "kind": "MessageTemplate",
+ "metadata": {"name": "team"}, "spec": {"extends": "base", "template": "{{define \"body\"}}team{{end}}"}}
+{"apiVersion": "kargo.akuity.io/v1alpha1", "kind": "SlackMessage",
+ "metadata": {"name": "good"}, "spec": {"slackChannel": "good", "layout": "team", "message": "ok"}}
+{"apiVersion": "kargo.akuity.io/v1alpha1", "kind": "SlackMessage",
+ "metadata": {"name": "bad", "namespace": "other"}, "spec": {"slackChannel": "bad", "layout": "team", "message": "ok"}}
+`
+	results, err := validator.ValidateBundle(ctx, strings.NewReader(bundle), "team-a")
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	assert.True(t, results[0].Allowed)
+	assert.True(t, results[1].Allowed, results[1].Message)
+	assert.Equal(t, "team-a", results[1].Namespace)
+	assert.False(t, results[2].Allowed, "layout team only exists in team-a")
+
+	// Nothing in the bundle is admitted.
+	_, err = validator.templates.Render("team-a", "team", "", nil)
+	assert.Error(t, err)
+	_, ok := validator.outbox.Status("team-a/good")
+	assert.False(t, ok)
+
+	rec := httptest.NewRecorder()
+	validator.BundleHandler(rec, httptest.NewRequest(http.MethodPost, "/validate/bundle?namespace=team-a", strings.NewReader(bundle)))
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+}
+
+func TestShadowChannel(t *testing.T) {
+	slackClient := NewMockSlackClient()
+	validator := NewValidator(slackClient)
+	ctx := context.Background()
+
+	msg := testMessage("kargo", "shadowed", "releases")
+	msg.Spec.Message = `{{.Stage}} promoted`
+	msg.Spec.Shadow = &ShadowSpec{Channel: "releases-preview", Message: `:rocket: {{.Stage}} promoted`}
+	_, err := validator.ValidateMessage(ctx, msg)
+	require.NoError(t, err)
+	_, ok := validator.outbox.Status("kargo/shadowed#shadow")
+	assert.True(t, ok)
+
+	require.NoError(t, validator.Notify(ctx, msg, map[string]string{"Stage": "prod"}))
+	require.Len(t, slackClient.posts, 2)
+	assert.Equal(t, "releases", slackClient.posts[0].Channel)
+	assert.Equal(t, "prod promoted", slackClient.posts[0].Text)
+	assert.Equal(t, "releases-preview", slackClient.posts[1].Channel)
+	assert.Equal(t, ":rocket: prod promoted", slackClient.posts[1].Text)
+
+	msg.Spec.Shadow = &ShadowSpec{Mode: ShadowLog, Message: `{{.Missing.Field}}`}
+	_, err = validator.ValidateMessage(ctx, msg)
+	require.NoError(t, err)
+	require.NoError(t, validator.Notify(ctx, msg, map[string]string{"Stage": "prod"}), "shadow errors do not fail delivery")
+	assert.Len(t, slackClient.posts, 3)
+
+	msg.Spec.Shadow = &ShadowSpec{Channel: "releases"}
+	_, err = validator.ValidateMessage(ctx, msg)
+	require.Error(t, err)
+}
+
+func TestNotificationCorrelationMetadata(t *testing.T) {
+	slackClient := NewMockSlackClient()
+	validator := NewValidator(slackClient)
+	msg := testMessage("kargo", "correlated", "releases")
+
+	ctx := WithCorrelationID(context.Background(), "evt-123")
+	require.NoError(t, validator.Notify(ctx, msg, nil))
+	require.Len(t, slackClient.posts, 1)
+
+	// Round-trip through JSON as Slack would return it.
+	raw, err := json.Marshal(slackClient.posts[0].Metadata)
+	require.NoError(t, err)
+	var meta SlackMetadata
+	require.NoError(t, json.Unmarshal(raw, &meta))
+	id, ok := CorrelationFromMetadata(&meta)
+	assert.True(t, ok)
+	assert.Equal(t, "evt-123", id)
+	assert.Equal(t, "kargo/correlated", meta.EventPayload["message"])
+
+	_, ok = CorrelationFromMetadata(&SlackMetadata{EventType: "other"})
+	assert.False(t, ok)
+}
+
+func TestPolicyTestRunner(t *testing.T) {
+	suite := `{
+  "limits": {"maxMessagesPerNamespace": 1},
+  "templates": [{"kind": "MessageTemplate", "metadata": {"name": "base", "namespace": "kargo-system"},
+                 "spec": {"template": "[{{block \"body\" .}}{{end}}]"}}],
+  "existing": {"team-a": ["already-there"]},
+  "cases": [
+    {"name": "uses shared layout",
+     "object": {"kind": "SlackMessage", "metadata": {"name": "m", "namespace": "team-b"},
+                "spec": {"slackChannel": "c", "layout": "base", "message": "x"}},
+     "expect": {"allowed": true}},
+    {"name": "namespace full",
+     "object": {"kind": "SlackMessage", "metadata": {"name": "m", "namespace": "team-a"},
+                "spec": {"slackChannel": "c", "message": "x"}},
+     "expect": {"allowed": false, "messageContains": "count/slackmessages"}},
+    {"name": "wrong expectation",
+     "object": {"kind": "SlackMessage", "metadata": {"name": "m", "namespace": "team-b"}, "spec": {}},
+     "expect": {"allowed": true}}
+  ]
+}`
+	var s PolicyTestSuite
+	require.NoError(t, yaml.NewYAMLOrJSONDecoder(strings.NewReader(suite), 4096).Decode(&s))
+
+	results, err := RunPolicyTests(context.Background(), &s)
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	assert.True(t, results[0].Passed, results[0].Message)
+	assert.True(t, results[1].Passed, results[1].Message)
+	assert.False(t, results[2].Passed)
+	assert.Contains(t, results[2].Message, "slackChannel is required")
+}
+
+func TestSlackCallsHonourDeadlines(t *testing.T) {
+	slackClient := NewMockSlackClient()
+	validator := NewValidator(slackClient)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := validator.Notify(ctx, testMessage("kargo", "late", "late-channel"), nil)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, slackClient.posts)
+
+	validator.timeout = 0
+	_, err = validator.createChannel(context.Background(), SlackIntent{Key: "kargo/late", Channel: "late-channel"})
+	require.Error(t, err)
+	assert.Equal(t, 1, validator.overruns["conversations.create"])
+}
+
+func TestEnterpriseGridRouting(t *testing.T) {
+	slackClient := NewMockSlackClient()
+	slackClient.restricted = true
+	validator := NewValidator(slackClient)
+	validator.grid = &SlackGrid{
+		Teams:                     map[string]string{"platform": "T001", "payments": "T002"},
+		RestrictedChannelCreation: true,
+	}
+	ctx := context.Background()
+
+	_, err := validator.ValidateMessage(ctx, testMessage("kargo", "no-team", "releases"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "team is required")
+
+	msg := testMessage("kargo", "payments", "payments-releases")
+	msg.Spec.Team = "payments"
+	_, err = validator.ValidateMessage(ctx, msg)
+	require.NoError(t, err)
+	validator.outbox.ProcessPending(ctx)
+	intent, _ := validator.outbox.Status("kargo/payments")
+	require.Equal(t, IntentSucceeded, intent.State, intent.LastError)
+	assert.Equal(t, "T002", intent.Team)
+
+	// The same channel requested from another workspace is found across
+	// the org instead of being created again.
+	other := testMessage("kargo", "platform", "payments-releases")
+	other.Spec.Team = "T001"
+	_, err = validator.ValidateMessage(ctx, other)
+	require.NoError(t, err)
+	validator.outbox.ProcessPending(ctx)
+	shared, _ := validator.outbox.Status("kargo/platform")
+	assert.Equal(t, intent.ChannelID, shared.ChannelID)
+	assert.Len(t, slackClient.channels, 1)
+
+	require.NoError(t, validator.Notify(ctx, msg, nil))
+	assert.Equal(t, "T002", slackClient.posts[0].Team)
+}
+
+func TestChannelNameSuggestions(t *testing.T) {
+	slackClient := NewMockSlackClient()
+	validator := NewValidator(slackClient)
+	validator.channels = ChannelPolicy{Prefixes: []string{"kargo-"}}
+	ctx := context.Background()
+
+	_, err := validator.ValidateMessage(ctx, testMessage("team-a", "bad", "Team A Releases"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "lowercase")
+	assert.Contains(t, err.Error(), "kargo-team-a-releases")
+
+	// A private channel cannot be reused for a public SlackMessage, so
+	// the name is taken and the next free variants are offered.
+	slackClient.create("kargo-releases", true, "")
+	slackClient.create("kargo-releases-team-a", true, "")
+	_, err = validator.ValidateMessage(ctx, testMessage("team-a", "taken", "kargo-releases"))
+	require.Error(t, err)
+	cerr, ok := err.(*channelError)
+	require.True(t, ok)
+	assert.Equal(t, []string{"kargo-releases-2", "kargo-releases-3", "kargo-releases-4"}, cerr.suggestions)
+
+	_, err = validator.ValidateMessage(ctx, testMessage("team-a", "ok", "kargo-releases-2"))
+	assert.NoError(t, err)
+}
+
+func TestMutedStage(t *testing.T) {
+	slackClient := NewMockSlackClient()
+	validator := NewValidator(slackClient)
+	validator.stages.(*stageIndex).set("kargo", "prod", map[string]string{muteAnnotation: "true"})
+	ctx := context.Background()
+
+	msg := testMessage("kargo", "muted", "releases")
+	msg.Spec.Subscriptions = []Subscription{
+		{Stage: "staging", Events: []string{"PromotionSucceeded"}},
+		{Stage: "prod", Events: []string{"PromotionSucceeded"}},
+	}
+	resp, err := validator.ValidateMessage(ctx, msg)
+	require.NoError(t, err)
+	assert.True(t, resp.Response.Allowed)
+	require.Len(t, resp.Response.Warnings, 1)
+	assert.Contains(t, resp.Response.Warnings[0], `"prod"`)
+
+	require.NoError(t, validator.Notify(WithCorrelationID(WithStage(ctx, "prod"), "evt-1"), msg, nil))
+	assert.Empty(t, slackClient.posts)
+	require.Len(t, validator.suppressed, 1)
+	assert.Equal(t, "evt-1", validator.suppressed[0].CorrelationID)
+
+	require.NoError(t, validator.Notify(WithStage(ctx, "staging"), msg, nil))
+	assert.Len(t, slackClient.posts, 1)
+}
+
+func TestNotificationLinkAllowlist(t *testing.T) {
+	slackClient := NewMockSlackClient()
+	validator := NewValidator(slackClient)
+	validator.links = LinkPolicy{AllowedDomains: []string{"kargo.example.com", "*.github.com"}}
+	ctx := context.Background()
+
+	msg := testMessage("kargo", "links", "releases")
+	msg.Spec.Message = "Promoted {{.}} - <https://kargo.example.com/p/1|details>, " +
+		"[diff](https://api.github.com/compare) <https://evil.example.net/login|sign in> " +
+		"https://evil.example.net/x <javascript:alert(1)|run> <@U123>"
+	require.NoError(t, validator.Notify(ctx, msg, "v1.2.3"))
+	require.Len(t, slackClient.posts, 1)
+	assert.Equal(t, "Promoted v1.2.3 - <https://kargo.example.com/p/1|details>, "+
+		"[diff](https://api.github.com/compare) sign in [link removed] run <@U123>", slackClient.posts[0].Text)
+
+	validator.links.Rewrite = true
+	msg.Spec.Message = "{{.}}"
+	require.NoError(t, validator.Notify(ctx, msg, "see https://evil.example.net/x"))
+	assert.Equal(t, "see hxxps://evil[.]example[.]net/x", slackClient.posts[1].Text)
+}
+
+func TestManifestsGenerate(t *testing.T) {
+	sel, err := ParseLabelSelector("team=payments, tier in (prod, staging),!legacy")
+	require.NoError(t, err)
+	assert.True(t, sel.Matches(map[string]string{"team": "payments", "tier": "prod"}))
+	assert.False(t, sel.Matches(map[string]string{"team": "payments", "tier": "dev"}))
+	assert.False(t, sel.Matches(map[string]string{"team": "payments", "tier": "prod", "legacy": "true"}))
+
+	manifests, err := GenerateManifests(ManifestOptions{
+		Name: "kargo-notifications", ServiceName: "webhook", ServiceNamespace: "kargo-system", ServicePort: 443,
+		FailurePolicy: "Fail", TimeoutSeconds: 10, ObjectSelector: sel,
+	})
+	require.NoError(t, err)
+	require.Len(t, manifests, 1, "no mutating routes, so no MutatingWebhookConfiguration")
+	assert.Equal(t, "ValidatingWebhookConfiguration", manifests[0].Kind)
+	require.Len(t, manifests[0].Webhooks, len(admissionRoutes))
+	for i, h := range manifests[0].Webhooks {
+		assert.Equal(t, []string{admissionRoutes[i].Resource}, h.Rules[0].Resources)
+		assert.Equal(t, sel, h.ObjectSelector)
+	}
+
+	_, err = GenerateManifests(ManifestOptions{FailurePolicy: "Sometimes", TimeoutSeconds: 10})
+	assert.Error(t, err)
+
+	validator := NewValidator(NewMockSlackClient())
+	validator.objectSelector = sel
+	results, err := validator.ValidateBundle(context.Background(), strings.NewReader(
+		`{"apiVersion": "kargo.akuity.io/v1alpha1", "kind": "SlackMessage", "metadata": {"name": "unmanaged"}, "spec": {"message": "no channel"}}`),
+		"team-a")
+	require.NoError(t, err)
+	assert.Empty(t, results)
+}
+
+func TestCheckPoolFairnessAndShedding(t *testing.T) {
+	ctx := context.Background()
+	pool := NewCheckPool(1, 5)
+	hold, err := pool.acquire(ctx, "a")
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	for i, ns := range []string{"a", "a", "a", "b"} {
+		wg.Add(1)
+		go func(ns string) {
+			defer wg.Done()
+			release, err := pool.acquire(ctx, ns)
+			require.NoError(t, err)
+			mu.Lock()
+			order = append(order, ns)
+			mu.Unlock()
+			release()
+		}(ns)
+		// Queue the waiters in a known order.
+		require.Eventually(t, func() bool {
+			pool.mu.Lock()
+			defer pool.mu.Unlock()
+			return pool.outstanding == i+2
+		}, time.Second, time.Millisecond)
+	}
+
+	_, err = pool.acquire(ctx, "c")
+	assert.ErrorIs(t, err, errChecksShed)
+	assert.Equal(t, 1, pool.Shed())
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	hold()
+	wg.Wait()
+	assert.Equal(t, []string{"a", "b", "a", "a"}, order)
+	_, err = NewCheckPool(0, 0).acquire(cctx, "a")
+	assert.ErrorIs(t, err, context.Canceled)
+
+	v := NewValidator(NewMockSlackClient())
+	v.checks = NewCheckPool(1, 1)
+	hold, err = v.checks.acquire(ctx, "busy")
+	require.NoError(t, err)
+	defer hold()
+	resp, err := v.ValidateMessage(ctx, testMessage("sync", "shed", "deploys"))
+	require.NoError(t, err)
+	assert.True(t, resp.Response.Allowed)
+	require.Len(t, resp.Response.Warnings, 1)
+	assert.Contains(t, resp.Response.Warnings[0], "not checked against Slack")
+}
+
+func TestPayloadSnippetRedaction(t *testing.T) {
+	slackClient := NewMockSlackClient()
+	validator := NewValidator(slackClient)
+	validator.payloadLinks = &PayloadLinkSigner{Key: "k", BaseURL: "https://receiver.example.com/"}
+	ctx := context.Background()
+
+	failure := testTemplate("kargo", "failure", "", `Failed: {{block "body" .}}{{end}}`)
+	failure.Spec.Payload = &PayloadPolicy{MaxBytes: 60, RedactKeys: []string{"Token"}, RedactPatterns: []string{`ghp_[A-Za-z0-9]+`}}
+	require.NoError(t, validator.templates.Validate(failure))
+	validator.templates.Put(failure)
+
+	msg := testMessage("kargo", "payload", "releases")
+	msg.Spec.Layout = "failure"
+	msg.Spec.Message = `{{define "body"}}{{payload .Payload "/admin/deliveries/7"}}{{end}}`
+	payload := `{"error":"clone failed with ghp_abc123","auth":{"token":"s3cr3t"},"log":"` + strings.Repeat("x", 100) + `"}`
+	require.NoError(t, validator.Notify(ctx, msg, map[string]any{"Payload": payload}))
+	text := slackClient.posts[0].Text
+	assert.NotContains(t, text, "s3cr3t")
+	assert.NotContains(t, text, "ghp_abc123")
+	assert.Contains(t, text, `"token":"[REDACTED]"`)
+	assert.Contains(t, text, truncatedMarker+" <https://receiver.example.com/admin/deliveries/7?exp=")
+	assert.Contains(t, text, "|view full payload>")
+
+	// Short, clean snippets are echoed as they are, without a link.
+	require.NoError(t, validator.Notify(ctx, msg, map[string]any{"Payload": `{"error":"timeout"}`}))
+	assert.Equal(t, `Failed: {"error":"timeout"}`, slackClient.posts[1].Text)
+
+	// Without a layout the default policy applies.
+	msg.Spec.Layout = ""
+	msg.Spec.Message = `{{payload .}}`
+	require.NoError(t, validator.Notify(ctx, msg, map[string]string{"password": "hunter2"}))
+	assert.Equal(t, `{"password":"[REDACTED]"}`, slackClient.posts[2].Text)
+
+	bad := testTemplate("kargo", "bad", "", "x")
+	bad.Spec.Payload = &PayloadPolicy{MaxBytes: maxPayloadBytes + 1}
+	assert.Error(t, validator.templates.Validate(bad))
+	bad.Spec.Payload = &PayloadPolicy{RedactPatterns: []string{"("}}
+	assert.Error(t, validator.templates.Validate(bad))
+}
+
+func TestPendingTemplateRefs(t *testing.T) {
+	validator := NewValidator(NewMockSlackClient())
+	server := httptest.NewServer(http.HandlerFunc(validator.WebhookHandler))
+	defer server.Close()
+
+	review := func(obj any, pending string) WebhookResponse {
+		body, _ := json.Marshal(map[string]any{"request": map[string]any{"uid": "u", "dryRun": true, "object": obj}})
+		req, _ := http.NewRequest(http.MethodPost, server.URL, bytes.NewReader(body))
+		if pending != "" {
+			req.Header.Set(pendingObjectsHeader, pending)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var out WebhookResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&out))
+		return out
+	}
+
+	msg := testMessage("kargo", "ordered", "releases")
+	msg.Spec.Layout = "base"
+	msg.Spec.Message = `{{define "body"}}{{template "footer" .}}{{end}}`
+	assert.False(t, review(msg, "").Response.Allowed)
+
+	resp := review(msg, "MessageTemplate/kargo/base, MessageTemplate/kargo-system/footer, junk")
+	assert.True(t, resp.Response.Allowed)
+	assert.Equal(t, []string{
+		"MessageTemplate kargo/base does not exist yet; admitted because it is pending in the same apply",
+		"MessageTemplate kargo-system/footer does not exist yet; admitted because it is pending in the same apply",
+	}, resp.Response.Warnings)
+
+	// Only the refs named in the hint are excused.
+	assert.False(t, review(msg, "MessageTemplate/kargo/base").Response.Allowed)
+
+	child := testTemplate("kargo", "child", "base", `{{define "body"}}x{{end}}`)
+	assert.False(t, review(child, "").Response.Allowed)
+	resp = review(child, "MessageTemplate/kargo/base")
+	assert.True(t, resp.Response.Allowed)
+	assert.Len(t, resp.Response.Warnings, 1)
+	_, _, err := validator.templates.Resolve("kargo", "base", "")
+	assert.Error(t, err, "stand-ins must not be stored")
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "validate-bundle" {
+		os.Exit(runValidateBundle(os.Args[2:]))
+	}
+	if len(os.Args) > 2 && os.Args[1] == "policy" && os.Args[2] == "test" {
+		os.Exit(runPolicyTest(os.Args[3:]))
+	}
+	if len(os.Args) > 2 && os.Args[1] == "manifests" && os.Args[2] == "generate" {
+		os.Exit(runManifestsGenerate(os.Args[3:]))
+	}
 	fmt.Println("Run tests with: go test -v ./...")
 }